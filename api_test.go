@@ -2,53 +2,251 @@ package main
 
 import (
 	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"image"
+	"image/jpeg"
+	imagepng "image/png"
+	"io"
 	"log/slog"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
 
 	"github.com/AndreHeber/go-sqlite-blog/config"
 	dbService "github.com/AndreHeber/go-sqlite-blog/db"
+	"github.com/AndreHeber/go-sqlite-blog/markdown"
 	"github.com/AndreHeber/go-sqlite-blog/middleware"
 )
 
-func TestAPI(t *testing.T) {
+// newTestServer starts a server on a fresh database in a temporary directory.
+func newTestServer(t *testing.T, cfg config.Config) *httptest.Server {
+	t.Helper()
 
-	// reading env variables
-	cfg := config.Config{
-		LogLevel: &slog.LevelVar{},
-		Database: config.DatabaseConfig{
-			Driver: "sqlite3",
-			Source: "./test.db",
-		},
-		ErrorsInResponse: false,
-		IPRateLimit:      10,
-		BurstRateLimit:   10,
+	server, _ := newTestServerWithDB(t, cfg)
+	return server
+}
+
+// newTestServerWithDB is newTestServer for tests that also prepare data without a route.
+func newTestServerWithDB(t *testing.T, cfg config.Config) (*httptest.Server, *sql.DB) {
+	t.Helper()
+
+	return newTestServerWithLog(t, cfg, os.Stdout)
+}
+
+// newTestServerWithLog is newTestServerWithDB for tests that check what is logged to w.
+func newTestServerWithLog(t *testing.T, cfg config.Config, w io.Writer) (*httptest.Server, *sql.DB) {
+	t.Helper()
+
+	mux, db := newTestRouter(t, cfg, w)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	// redirects are part of the responses under test
+	server.Client().CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
 	}
+
+	return server, db
+}
+
+// logBuffer collects the log output of a test server, requests log concurrently
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// newTestRouter sets up the routes on a fresh database in a temporary directory, logging to w.
+func newTestRouter(t *testing.T, cfg config.Config, w io.Writer) (*router, *sql.DB) {
+	t.Helper()
+
+	cfg.LogLevel = &slog.LevelVar{}
 	cfg.LogLevel.Set(slog.LevelDebug)
+	cfg.Database.Driver = "sqlite3"
+	cfg.Database.Source = filepath.Join(t.TempDir(), "test.db")
+	if cfg.Password == (config.PasswordConfig{}) {
+		// cheap parameters keep the tests fast
+		cfg.Password = config.PasswordConfig{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	}
+	if cfg.Mail.Driver == "" {
+		cfg.Mail = config.MailConfig{Driver: "file", Dir: t.TempDir()}
+	}
+	if cfg.Media.Dir == "" {
+		cfg.Media = config.MediaConfig{Dir: t.TempDir(), MaxSize: 1 << 20, Timeout: time.Minute}
+	}
 
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+	logger := slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
 		Level: cfg.LogLevel,
 	}))
 	slog.SetDefault(logger)
 
-	_ = os.Remove(cfg.Database.Source)
-
-	db, err := dbService.Init(logger, cfg.Database.Driver, cfg.Database.Source, "./tables.sql")
+	db, err := dbService.Init(logger, cfg.Database.Driver, cfg.Database.Source)
 	if err != nil {
-		slog.Error("main: Error initializing database", "error", err)
 		t.Fatalf("Error initializing database: %v", err)
 	}
+	t.Cleanup(func() { _ = dbService.CloseDB(db) })
 
-	adapter := middleware.Init(logger, db, cfg.ErrorsInResponse, cfg.Database.LogQueries, cfg.IPRateLimit, cfg.BurstRateLimit)
-	mux := setupRouter(adapter)
+	adapter, err := middleware.Init(logger, db, &cfg)
+	if err != nil {
+		t.Fatalf("Error initializing middleware: %v", err)
+	}
+	// emails are sent in the background, the database must stay open for them
+	t.Cleanup(adapter.Wait)
+	return setupRouter(adapter), db
+}
 
-	// Create test server
-	server := httptest.NewServer(mux)
-	defer server.Close()
+// postForm sends form values and cookies to path and returns the response with its body closed.
+func postForm(t *testing.T, server *httptest.Server, path string, values url.Values, cookies ...*http.Cookie) *http.Response {
+	t.Helper()
+
+	request, err := http.NewRequest("POST", server.URL+path, strings.NewReader(values.Encode()))
+	if err != nil {
+		t.Errorf("Error creating request: %v", err)
+		return &http.Response{}
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Errorf("Error making request: %v", err)
+		return &http.Response{}
+	}
+	response.Body.Close()
+
+	return response
+}
+
+// get requests path with cookies and returns the response with its body closed.
+func get(t *testing.T, server *httptest.Server, path string, cookies ...*http.Cookie) *http.Response {
+	t.Helper()
+
+	request, err := http.NewRequest("GET", server.URL+path, nil)
+	if err != nil {
+		t.Errorf("Error creating request: %v", err)
+		return &http.Response{}
+	}
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Errorf("Error making request: %v", err)
+		return &http.Response{}
+	}
+	response.Body.Close()
+
+	return response
+}
+
+// getBody requests path with cookies and returns the status code and the body.
+func getBody(t *testing.T, server *httptest.Server, path string, cookies ...*http.Cookie) (int, string) {
+	t.Helper()
+
+	request, err := http.NewRequest("GET", server.URL+path, nil)
+	if err != nil {
+		t.Fatalf("Error creating request: %v", err)
+	}
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("GET %s: reading response: %v", path, err)
+	}
+	return response.StatusCode, string(body)
+}
+
+// getJSON requests path with cookies, decodes the JSON body into v and returns the status code.
+func getJSON(t *testing.T, server *httptest.Server, path string, v any, cookies ...*http.Cookie) int {
+	t.Helper()
 
-	defer os.Remove(cfg.Database.Source)
+	request, err := http.NewRequest("GET", server.URL+path, nil)
+	if err != nil {
+		t.Fatalf("Error creating request: %v", err)
+	}
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	defer response.Body.Close()
+
+	err = json.NewDecoder(response.Body).Decode(v)
+	if err != nil {
+		t.Fatalf("GET %s: decoding response: %v", path, err)
+	}
+	return response.StatusCode
+}
+
+// registerAndLogin creates a user and returns its session cookie.
+func registerAndLogin(t *testing.T, server *httptest.Server, username string) *http.Cookie {
+	t.Helper()
+
+	credentials := url.Values{"username": {username}, "password": {username + "-password"}, "email": {username + "@test.com"}}
+	if status := postForm(t, server, "/register", credentials).StatusCode; status != http.StatusOK {
+		t.Fatalf("register %s: expected status code %d, got %d", username, http.StatusOK, status)
+	}
+
+	response := postForm(t, server, "/login", credentials)
+	if response.StatusCode != http.StatusSeeOther {
+		t.Fatalf("login %s: expected status code %d, got %d", username, http.StatusSeeOther, response.StatusCode)
+	}
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == "session" {
+			return cookie
+		}
+	}
+	t.Fatalf("login %s: no session cookie set", username)
+	return nil
+}
+
+func TestAPI(t *testing.T) {
+	server := newTestServer(t, config.Config{
+		ErrorsInResponse: false,
+		IPRateLimit:      10,
+		BurstRateLimit:   10,
+	})
 
 	t.Run("Test /register endpoint", func(t *testing.T) {
 		// make a POST request to /register with Form data
@@ -71,3 +269,2450 @@ func TestAPI(t *testing.T) {
 		}
 	})
 }
+
+// TestConcurrentRequests hammers /register and /login in parallel. Run it with
+// -race to detect request state shared between handlers.
+func TestConcurrentRequests(t *testing.T) {
+	const users = 8
+
+	server := newTestServer(t, config.Config{
+		ErrorsInResponse: false,
+		IPRateLimit:      rate.Inf,
+		BurstRateLimit:   1,
+	})
+
+	credentials := func(i int) url.Values {
+		return url.Values{
+			"username": {fmt.Sprintf("user%d", i)},
+			"password": {fmt.Sprintf("password%d", i)},
+			"email":    {fmt.Sprintf("user%d@test.com", i)},
+		}
+	}
+
+	t.Run("register", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < users; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if status := postForm(t, server, "/register", credentials(i)).StatusCode; status != http.StatusOK {
+					t.Errorf("register user%d: expected status code %d, got %d", i, http.StatusOK, status)
+				}
+			}(i)
+		}
+		wg.Wait()
+	})
+
+	t.Run("login", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < users; i++ {
+			// every valid login runs next to an invalid one, a handler reading
+			// the form of another request would flip the status codes
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+				if status := postForm(t, server, "/login", credentials(i)).StatusCode; status != http.StatusSeeOther {
+					t.Errorf("login user%d: expected status code %d, got %d", i, http.StatusSeeOther, status)
+				}
+			}(i)
+			go func(i int) {
+				defer wg.Done()
+				values := credentials(i)
+				values.Set("password", "wrong")
+				if status := postForm(t, server, "/login", values).StatusCode; status != http.StatusUnauthorized {
+					t.Errorf("login user%d with wrong password: expected status code %d, got %d", i, http.StatusUnauthorized, status)
+				}
+			}(i)
+		}
+		wg.Wait()
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < users; i++ {
+			for _, path := range []string{"/login", "/register", "/health"} {
+				wg.Add(1)
+				go func(path string) {
+					defer wg.Done()
+					response, err := server.Client().Get(server.URL + path)
+					if err != nil {
+						t.Errorf("GET %s: %v", path, err)
+						return
+					}
+					response.Body.Close()
+					if response.StatusCode != http.StatusOK {
+						t.Errorf("GET %s: expected status code %d, got %d", path, http.StatusOK, response.StatusCode)
+					}
+				}(path)
+			}
+		}
+		wg.Wait()
+	})
+}
+
+func TestSessions(t *testing.T) {
+	server := newTestServer(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		Session: config.SessionConfig{
+			Secret:          "test-secret",
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+	})
+
+	credentials := url.Values{"username": {"testuser"}, "password": {"testpassword"}, "email": {"test@test.com"}}
+	if status := postForm(t, server, "/register", credentials).StatusCode; status != http.StatusOK {
+		t.Fatalf("register: expected status code %d, got %d", http.StatusOK, status)
+	}
+
+	login := func(t *testing.T) *http.Cookie {
+		t.Helper()
+		response := postForm(t, server, "/login", credentials)
+		if response.StatusCode != http.StatusSeeOther {
+			t.Fatalf("login: expected status code %d, got %d", http.StatusSeeOther, response.StatusCode)
+		}
+		for _, cookie := range response.Cookies() {
+			if cookie.Name == "session" {
+				if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+					t.Errorf("login: session cookie must be HttpOnly and SameSite=Lax, got %v", cookie)
+				}
+				return cookie
+			}
+		}
+		t.Fatalf("login: no session cookie set")
+		return nil
+	}
+
+	t.Run("anonymous request is rejected", func(t *testing.T) {
+		if status := postForm(t, server, "/logout/all", nil).StatusCode; status != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, status)
+		}
+	})
+
+	t.Run("tampered cookie is rejected", func(t *testing.T) {
+		cookie := login(t)
+		cookie.Value = "x" + cookie.Value
+		if status := postForm(t, server, "/logout/all", nil, cookie).StatusCode; status != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, status)
+		}
+	})
+
+	t.Run("logout ends only the current session", func(t *testing.T) {
+		first, second := login(t), login(t)
+		if status := postForm(t, server, "/logout", nil, first).StatusCode; status != http.StatusSeeOther {
+			t.Fatalf("logout: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		if status := postForm(t, server, "/logout/all", nil, first).StatusCode; status != http.StatusUnauthorized {
+			t.Errorf("logged out session: expected status code %d, got %d", http.StatusUnauthorized, status)
+		}
+		if status := postForm(t, server, "/logout/all", nil, second).StatusCode; status != http.StatusSeeOther {
+			t.Errorf("other session: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+	})
+
+	t.Run("logout everywhere ends all sessions", func(t *testing.T) {
+		first, second := login(t), login(t)
+		if status := postForm(t, server, "/logout/all", nil, first).StatusCode; status != http.StatusSeeOther {
+			t.Fatalf("logout everywhere: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		if status := postForm(t, server, "/logout/all", nil, second).StatusCode; status != http.StatusUnauthorized {
+			t.Errorf("other session: expected status code %d, got %d", http.StatusUnauthorized, status)
+		}
+	})
+}
+
+// TestSessionSecretPlaceholder checks that the public placeholder of earlier config files isn't accepted
+func TestSessionSecretPlaceholder(t *testing.T) {
+	cfg := config.Config{Mail: config.MailConfig{Driver: "stdout"}}
+	cfg.Session.Secret = "change-me-in-production"
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	if _, err := middleware.Init(logger, nil, &cfg); err == nil || !strings.Contains(err.Error(), "session.secret") {
+		t.Errorf("expected the placeholder session secret to be refused, got %v", err)
+	}
+}
+
+// TestFirstAdmin registers users at the same time, only one of them may become admin
+func TestFirstAdmin(t *testing.T) {
+	server, db := newTestServerWithDB(t, config.Config{IPRateLimit: rate.Inf, BurstRateLimit: 1})
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("user%d", i)
+			values := url.Values{"username": {name}, "password": {name + "-password"}, "email": {name + "@test.com"}}
+			if status := postForm(t, server, "/register", values).StatusCode; status != http.StatusOK {
+				t.Errorf("register %s: expected status code %d, got %d", name, http.StatusOK, status)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var admins int
+	err := db.QueryRow("SELECT COUNT(*) FROM users JOIN roles ON roles.id = users.role_id WHERE roles.name = 'admin'").Scan(&admins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admins != 1 {
+		t.Errorf("expected 1 admin, got %d", admins)
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	server, db := newTestServerWithDB(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		Session: config.SessionConfig{
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+	})
+
+	// the first user becomes admin
+	admin := registerAndLogin(t, server, "admin")
+	reader := registerAndLogin(t, server, "reader")
+
+	if status := get(t, server, "/admin/users").StatusCode; status != http.StatusSeeOther {
+		t.Errorf("anonymous: expected status code %d, got %d", http.StatusSeeOther, status)
+	}
+	if status := get(t, server, "/admin/users", reader).StatusCode; status != http.StatusForbidden {
+		t.Errorf("reader: expected status code %d, got %d", http.StatusForbidden, status)
+	}
+	if status := get(t, server, "/admin/users", admin).StatusCode; status != http.StatusOK {
+		t.Errorf("admin: expected status code %d, got %d", http.StatusOK, status)
+	}
+
+	// promote the reader, the role is read from the database on every request
+	if status := postForm(t, server, "/admin/users/2/role", url.Values{"role": {"admin"}}, admin).StatusCode; status != http.StatusSeeOther {
+		t.Fatalf("promote: expected status code %d, got %d", http.StatusSeeOther, status)
+	}
+	if status := get(t, server, "/admin/users", reader).StatusCode; status != http.StatusOK {
+		t.Errorf("promoted reader: expected status code %d, got %d", http.StatusOK, status)
+	}
+
+	if status := postForm(t, server, "/admin/users/1/role", url.Values{"role": {"reader"}}, admin).StatusCode; status != http.StatusBadRequest {
+		t.Errorf("demote self: expected status code %d, got %d", http.StatusBadRequest, status)
+	}
+
+	// a change of the permissions, e.g. by a migration, applies without a restart
+	if status := get(t, server, "/admin/users", admin).StatusCode; status != http.StatusOK {
+		t.Fatalf("admin: expected status code %d, got %d", http.StatusOK, status)
+	}
+	if _, err := db.Exec("DELETE FROM permissions WHERE role_id = 4 AND permission = 'user.manage'"); err != nil {
+		t.Fatal(err)
+	}
+	if status := get(t, server, "/admin/users", admin).StatusCode; status != http.StatusForbidden {
+		t.Errorf("revoked permission: expected status code %d, got %d", http.StatusForbidden, status)
+	}
+}
+
+func TestArticles(t *testing.T) {
+	server := newTestServer(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		Session: config.SessionConfig{
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+	})
+
+	admin := registerAndLogin(t, server, "admin")
+	reader := registerAndLogin(t, server, "reader")
+
+	create := func(t *testing.T, values url.Values) string {
+		t.Helper()
+		response := postForm(t, server, "/articles", values, admin)
+		if response.StatusCode != http.StatusSeeOther {
+			t.Fatalf("create: expected status code %d, got %d", http.StatusSeeOther, response.StatusCode)
+		}
+		return response.Header.Get("Location")
+	}
+
+	published := create(t, url.Values{"title": {"Hello World"}, "content": {"first"}, "published": {"1"}})
+	if published != "/articles/hello-world" {
+		t.Errorf("expected slug from title, got %s", published)
+	}
+	duplicate := create(t, url.Values{"title": {"Hello World"}, "content": {"second"}, "published": {"1"}})
+	if duplicate != "/articles/hello-world-2" {
+		t.Errorf("expected unique slug, got %s", duplicate)
+	}
+	draft := create(t, url.Values{"title": {"Draft"}, "content": {"not yet"}})
+	if reserved := create(t, url.Values{"title": {"New"}, "content": {"third"}}); reserved != "/articles/new-2" {
+		t.Errorf("expected the slug of /articles/new to be taken, got %s", reserved)
+	}
+
+	t.Run("reader can't create", func(t *testing.T) {
+		values := url.Values{"title": {"Nope"}, "content": {"nope"}}
+		if status := postForm(t, server, "/articles", values, reader).StatusCode; status != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, status)
+		}
+	})
+
+	t.Run("visibility", func(t *testing.T) {
+		for _, path := range []string{"/", "/articles", published} {
+			if status := get(t, server, path).StatusCode; status != http.StatusOK {
+				t.Errorf("GET %s: expected status code %d, got %d", path, http.StatusOK, status)
+			}
+		}
+		if status := get(t, server, draft).StatusCode; status != http.StatusNotFound {
+			t.Errorf("draft as anonymous: expected status code %d, got %d", http.StatusNotFound, status)
+		}
+		if status := get(t, server, draft, admin).StatusCode; status != http.StatusOK {
+			t.Errorf("draft as admin: expected status code %d, got %d", http.StatusOK, status)
+		}
+	})
+
+	t.Run("edit", func(t *testing.T) {
+		values := url.Values{"title": {"Hello Again"}, "slug": {"hello-again"}, "content": {"changed"}, "published": {"1"}}
+		if status := postForm(t, server, published+"/edit", values, reader).StatusCode; status != http.StatusForbidden {
+			t.Errorf("reader: expected status code %d, got %d", http.StatusForbidden, status)
+		}
+		response := postForm(t, server, published+"/edit", values, admin)
+		if response.StatusCode != http.StatusSeeOther || response.Header.Get("Location") != "/articles/hello-again" {
+			t.Errorf("admin: expected redirect to new slug, got %d %s", response.StatusCode, response.Header.Get("Location"))
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if status := postForm(t, server, duplicate+"/delete", nil, reader).StatusCode; status != http.StatusForbidden {
+			t.Errorf("reader: expected status code %d, got %d", http.StatusForbidden, status)
+		}
+		if status := postForm(t, server, duplicate+"/delete", nil, admin).StatusCode; status != http.StatusSeeOther {
+			t.Errorf("admin: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		if status := get(t, server, duplicate).StatusCode; status != http.StatusNotFound {
+			t.Errorf("deleted: expected status code %d, got %d", http.StatusNotFound, status)
+		}
+	})
+}
+
+// lastMailLink returns the last link to path found in the emails written to dir.
+func lastMailLink(t *testing.T, dir string, path string) string {
+	t.Helper()
+
+	// emails are sent in the background, wait until the last one is written completely
+	pattern := regexp.MustCompile(regexp.QuoteMeta(path) + `\?token=\S+\r\n`)
+	var content []byte
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+		if err != nil {
+			t.Fatalf("Error listing emails: %v", err)
+		}
+		if len(files) == 0 {
+			continue
+		}
+		sort.Strings(files)
+		content, err = os.ReadFile(files[len(files)-1])
+		if err != nil {
+			t.Fatalf("Error reading email: %v", err)
+		}
+		if link := pattern.Find(content); link != nil {
+			return strings.TrimSpace(string(link))
+		}
+	}
+	t.Fatalf("no link to %s in the last email of %s:\n%s", path, dir, content)
+	return ""
+}
+
+func TestEmailVerification(t *testing.T) {
+	mailDir := t.TempDir()
+	server := newTestServer(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		Session: config.SessionConfig{
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+		Mail: config.MailConfig{Driver: "file", Dir: mailDir},
+		Accounts: config.AccountsConfig{
+			RequireVerifiedEmail: true,
+			VerificationTTL:      time.Hour,
+		},
+	})
+
+	credentials := url.Values{"username": {"testuser"}, "password": {"testpassword"}, "email": {"test@test.com"}}
+	if status := postForm(t, server, "/register", credentials).StatusCode; status != http.StatusOK {
+		t.Fatalf("register: expected status code %d, got %d", http.StatusOK, status)
+	}
+	first := lastMailLink(t, mailDir, "/verify")
+
+	if status := postForm(t, server, "/login", credentials).StatusCode; status != http.StatusForbidden {
+		t.Errorf("unverified login: expected status code %d, got %d", http.StatusForbidden, status)
+	}
+
+	// resending invalidates the first link, unknown addresses get the same answer
+	if status := postForm(t, server, "/verify/resend", url.Values{"email": {"unknown@test.com"}}).StatusCode; status != http.StatusOK {
+		t.Errorf("resend unknown: expected status code %d, got %d", http.StatusOK, status)
+	}
+	if status := postForm(t, server, "/verify/resend", url.Values{"email": {"test@test.com"}}).StatusCode; status != http.StatusOK {
+		t.Errorf("resend: expected status code %d, got %d", http.StatusOK, status)
+	}
+	// the new email is sent in the background
+	second := first
+	for start := time.Now(); second == first && time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		second = lastMailLink(t, mailDir, "/verify")
+	}
+	if first == second {
+		t.Fatalf("resend: expected a new link")
+	}
+	if status := get(t, server, first).StatusCode; status != http.StatusBadRequest {
+		t.Errorf("old link: expected status code %d, got %d", http.StatusBadRequest, status)
+	}
+
+	if status := get(t, server, second+"x").StatusCode; status != http.StatusBadRequest {
+		t.Errorf("tampered link: expected status code %d, got %d", http.StatusBadRequest, status)
+	}
+	if status := get(t, server, second).StatusCode; status != http.StatusOK {
+		t.Errorf("verify: expected status code %d, got %d", http.StatusOK, status)
+	}
+	if status := get(t, server, second).StatusCode; status != http.StatusBadRequest {
+		t.Errorf("reused link: expected status code %d, got %d", http.StatusBadRequest, status)
+	}
+
+	if status := postForm(t, server, "/login", credentials).StatusCode; status != http.StatusSeeOther {
+		t.Errorf("verified login: expected status code %d, got %d", http.StatusSeeOther, status)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	mailDir := t.TempDir()
+	logs := &logBuffer{}
+	server, _ := newTestServerWithLog(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		Session: config.SessionConfig{
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+		Mail: config.MailConfig{Driver: "file", Dir: mailDir},
+		Accounts: config.AccountsConfig{
+			PasswordResetTTL: time.Hour,
+		},
+	}, io.MultiWriter(os.Stdout, logs))
+
+	session := registerAndLogin(t, server, "testuser")
+
+	// unknown addresses get the same answer and no email
+	if status := postForm(t, server, "/password/forgot", url.Values{"email": {"unknown@test.com"}}).StatusCode; status != http.StatusOK {
+		t.Errorf("forgot unknown: expected status code %d, got %d", http.StatusOK, status)
+	}
+	if status := postForm(t, server, "/password/forgot", url.Values{"email": {"testuser@test.com"}}).StatusCode; status != http.StatusOK {
+		t.Errorf("forgot: expected status code %d, got %d", http.StatusOK, status)
+	}
+	link, _ := url.Parse(lastMailLink(t, mailDir, "/password/reset"))
+	token := link.Query().Get("token")
+
+	if status := get(t, server, link.String()).StatusCode; status != http.StatusOK {
+		t.Errorf("reset form: expected status code %d, got %d", http.StatusOK, status)
+	}
+
+	reset := url.Values{"token": {token}, "password": {"new-password"}}
+	if status := postForm(t, server, "/password/reset", reset).StatusCode; status != http.StatusOK {
+		t.Fatalf("reset: expected status code %d, got %d", http.StatusOK, status)
+	}
+	if status := postForm(t, server, "/password/reset", reset).StatusCode; status != http.StatusBadRequest {
+		t.Errorf("reused token: expected status code %d, got %d", http.StatusBadRequest, status)
+	}
+	for _, secret := range []string{token, "new-password"} {
+		if strings.Contains(logs.String(), secret) {
+			t.Errorf("expected %s not to be logged", secret)
+		}
+	}
+
+	if status := postForm(t, server, "/logout/all", nil, session).StatusCode; status != http.StatusUnauthorized {
+		t.Errorf("old session: expected status code %d, got %d", http.StatusUnauthorized, status)
+	}
+	old := url.Values{"username": {"testuser"}, "password": {"testuser-password"}}
+	if status := postForm(t, server, "/login", old).StatusCode; status != http.StatusUnauthorized {
+		t.Errorf("old password: expected status code %d, got %d", http.StatusUnauthorized, status)
+	}
+	changed := url.Values{"username": {"testuser"}, "password": {"new-password"}}
+	if status := postForm(t, server, "/login", changed).StatusCode; status != http.StatusSeeOther {
+		t.Errorf("new password: expected status code %d, got %d", http.StatusSeeOther, status)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	server := newTestServer(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		Session: config.SessionConfig{
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+	})
+
+	admin := registerAndLogin(t, server, "admin")
+	for _, values := range []url.Values{
+		{"title": {"SQLite Tips"}, "content": {"Full-text search with <b>FTS5</b> is fast."}, "published": {"1"}},
+		{"title": {"Go Routines"}, "content": {"Concurrency in Go, mentions sqlite once."}, "published": {"1"}},
+		{"title": {"Secret Draft"}, "content": {"sqlite draft"}},
+	} {
+		if status := postForm(t, server, "/articles", values, admin).StatusCode; status != http.StatusSeeOther {
+			t.Fatalf("create: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+	}
+
+	search := func(t *testing.T, query string) (slugs []string, snippets []string) {
+		t.Helper()
+		var page struct {
+			Results []struct {
+				Slug    string `json:"slug"`
+				Snippet string `json:"snippet"`
+			} `json:"results"`
+		}
+		if status := getJSON(t, server, "/search.json?q="+url.QueryEscape(query), &page); status != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, status)
+		}
+		for _, result := range page.Results {
+			slugs = append(slugs, result.Slug)
+			snippets = append(snippets, result.Snippet)
+		}
+		return slugs, snippets
+	}
+
+	t.Run("ranking and drafts", func(t *testing.T) {
+		slugs, _ := search(t, "sqlite")
+		if !slices.Equal(slugs, []string{"sqlite-tips", "go-routines"}) {
+			t.Errorf("expected title match first and no drafts, got %v", slugs)
+		}
+	})
+
+	t.Run("prefix and phrase", func(t *testing.T) {
+		if slugs, _ := search(t, "concurr*"); !slices.Equal(slugs, []string{"go-routines"}) {
+			t.Errorf("prefix: got %v", slugs)
+		}
+		if slugs, _ := search(t, `"search with"`); !slices.Equal(slugs, []string{"sqlite-tips"}) {
+			t.Errorf("phrase: got %v", slugs)
+		}
+		if slugs, _ := search(t, `"with search"`); len(slugs) != 0 {
+			t.Errorf("phrase in wrong order: got %v", slugs)
+		}
+	})
+
+	t.Run("highlighted snippet is escaped", func(t *testing.T) {
+		_, snippets := search(t, "fts5")
+		if len(snippets) != 1 || !strings.Contains(snippets[0], "&lt;b&gt;<mark>FTS5</mark>&lt;/b&gt;") {
+			t.Errorf("got %v", snippets)
+		}
+	})
+
+	t.Run("operators are no syntax errors", func(t *testing.T) {
+		for _, query := range []string{`"unbalanced`, "NEAR(a b)", "a OR", "-", "title:sqlite", "*"} {
+			search(t, query)
+		}
+	})
+
+	t.Run("index follows updates", func(t *testing.T) {
+		values := url.Values{"title": {"SQLite Tips"}, "slug": {"sqlite-tips"}, "content": {"now about indexes"}, "published": {"1"}}
+		if status := postForm(t, server, "/articles/sqlite-tips/edit", values, admin).StatusCode; status != http.StatusSeeOther {
+			t.Fatalf("edit: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		if slugs, _ := search(t, "fts5"); len(slugs) != 0 {
+			t.Errorf("old content still found: %v", slugs)
+		}
+		if slugs, _ := search(t, "indexes"); !slices.Equal(slugs, []string{"sqlite-tips"}) {
+			t.Errorf("new content not found: %v", slugs)
+		}
+		if status := postForm(t, server, "/articles/sqlite-tips/delete", nil, admin).StatusCode; status != http.StatusSeeOther {
+			t.Fatalf("delete: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		if slugs, _ := search(t, "indexes"); len(slugs) != 0 {
+			t.Errorf("deleted article still found: %v", slugs)
+		}
+	})
+
+	t.Run("html page", func(t *testing.T) {
+		if status := get(t, server, "/search?q=sqlite").StatusCode; status != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, status)
+		}
+	})
+}
+
+func TestFeeds(t *testing.T) {
+	server, db := newTestServerWithDB(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		BaseURL:        "https://blog.example",
+		Session: config.SessionConfig{
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+	})
+
+	admin := registerAndLogin(t, server, "admin")
+	for _, values := range []url.Values{
+		{"title": {"First Post"}, "summary": {"the first"}, "content": {"Hello **world** <script>alert(1)</script>"}, "published": {"1"}},
+		{"title": {"Second Post"}, "content": {"no summary here"}, "published": {"1"}},
+		{"title": {"Draft"}, "content": {"not yet"}},
+	} {
+		if status := postForm(t, server, "/articles", values, admin).StatusCode; status != http.StatusSeeOther {
+			t.Fatalf("create: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+	}
+
+	_, err := db.Exec(`INSERT INTO categories (name, slug) VALUES ('News', 'news');
+		INSERT INTO article_categories (article_id, category_id) SELECT id, 1 FROM articles WHERE slug = 'first-post';`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(t *testing.T, path string, header http.Header) (*http.Response, string) {
+		t.Helper()
+		request, err := http.NewRequest("GET", server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header = header
+		response, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response, string(body)
+	}
+
+	t.Run("formats", func(t *testing.T) {
+		for path, contentType := range map[string]string{
+			"/feed.xml":  "application/rss+xml; charset=utf-8",
+			"/atom.xml":  "application/atom+xml; charset=utf-8",
+			"/feed.json": "application/feed+json; charset=utf-8",
+		} {
+			response, body := read(t, path, nil)
+			if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != contentType {
+				t.Errorf("GET %s: got status code %d and content type %q", path, response.StatusCode, response.Header.Get("Content-Type"))
+			}
+			if !strings.Contains(body, "https://blog.example/articles/first-post") || !strings.Contains(body, "https://blog.example/articles/second-post") {
+				t.Errorf("GET %s: articles missing", path)
+			}
+			if strings.Contains(body, "/articles/draft") {
+				t.Errorf("GET %s: contains a draft", path)
+			}
+			if strings.Contains(body, "Hello") {
+				t.Errorf("GET %s: contains the content although only summaries are configured", path)
+			}
+		}
+	})
+
+	t.Run("category", func(t *testing.T) {
+		response, body := read(t, "/category/news/atom.xml", nil)
+		if response.StatusCode != http.StatusOK || !strings.Contains(body, "first-post") || strings.Contains(body, "second-post") {
+			t.Errorf("expected only the article of the category, got status code %d: %s", response.StatusCode, body)
+		}
+		if status := get(t, server, "/tag/unknown/feed.xml").StatusCode; status != http.StatusNotFound {
+			t.Errorf("unknown tag: expected status code %d, got %d", http.StatusNotFound, status)
+		}
+	})
+
+	t.Run("conditional get", func(t *testing.T) {
+		response, _ := read(t, "/feed.xml", nil)
+		etag := response.Header.Get("ETag")
+		if etag == "" || response.Header.Get("Last-Modified") != "" {
+			t.Fatalf("expected only an ETag, got %q and Last-Modified %q", etag, response.Header.Get("Last-Modified"))
+		}
+		if response, _ := read(t, "/feed.xml", http.Header{"If-None-Match": {etag}}); response.StatusCode != http.StatusNotModified {
+			t.Errorf("If-None-Match: expected status code %d, got %d", http.StatusNotModified, response.StatusCode)
+		}
+
+		values := url.Values{"title": {"Second Post"}, "slug": {"second-post"}, "content": {"changed"}, "published": {"1"}}
+		if status := postForm(t, server, "/articles/second-post/edit", values, admin).StatusCode; status != http.StatusSeeOther {
+			t.Fatalf("edit: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		response, _ = read(t, "/feed.xml", http.Header{"If-None-Match": {etag}})
+		if response.StatusCode != http.StatusOK {
+			t.Errorf("changed feed: expected status code %d, got %d", http.StatusOK, response.StatusCode)
+		}
+
+		// unpublishing keeps the time of the newest article in the feed, only the body changes
+		etag = response.Header.Get("ETag")
+		delete(values, "published")
+		if status := postForm(t, server, "/articles/second-post/edit", values, admin).StatusCode; status != http.StatusSeeOther {
+			t.Fatalf("unpublish: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		header := http.Header{"If-None-Match": {etag}, "If-Modified-Since": {time.Now().UTC().Format(http.TimeFormat)}}
+		if response, body := read(t, "/feed.xml", header); response.StatusCode != http.StatusOK || strings.Contains(body, "second-post") {
+			t.Errorf("unpublished: expected status code %d without the article, got %d: %s", http.StatusOK, response.StatusCode, body)
+		}
+	})
+
+	t.Run("full content", func(t *testing.T) {
+		values := url.Values{"feed_full_content": {"false", "true"}}
+		if status := postForm(t, server, "/admin/settings", values, admin).StatusCode; status != http.StatusSeeOther {
+			t.Fatalf("settings: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		_, body := read(t, "/feed.json", nil)
+		if !strings.Contains(body, `"content_html": "\u003cp\u003eHello \u003cstrong\u003eworld\u003c/strong\u003e \u003c/p\u003e\n"`) {
+			t.Errorf("expected rendered and sanitized content, got %s", body)
+		}
+	})
+}
+
+func TestComments(t *testing.T) {
+	server, db := newTestServerWithDB(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		Session: config.SessionConfig{
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+	})
+
+	admin := registerAndLogin(t, server, "admin")
+	reader := registerAndLogin(t, server, "reader")
+	article := postForm(t, server, "/articles", url.Values{"title": {"Talk"}, "content": {"about"}, "published": {"1"}}, admin).Header.Get("Location")
+
+	comment := func(t *testing.T, values url.Values, cookies ...*http.Cookie) (int, string) {
+		t.Helper()
+		response := postForm(t, server, article+"/comments", values, cookies...)
+		return response.StatusCode, response.Header.Get("Location")
+	}
+	lastCommentID := func(t *testing.T) string {
+		t.Helper()
+		var id string
+		err := db.QueryRow("SELECT id FROM comments ORDER BY id DESC LIMIT 1").Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	articlePage := func(t *testing.T) string {
+		t.Helper()
+		status, body := getBody(t, server, article)
+		if status != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, status)
+		}
+		return body
+	}
+
+	if status, _ := comment(t, url.Values{"content": {"no name"}}); status != http.StatusBadRequest {
+		t.Errorf("anonymous without name: expected status code %d, got %d", http.StatusBadRequest, status)
+	}
+
+	status, location := comment(t, url.Values{"author_name": {"Guest"}, "content": {"<b>first</b>"}})
+	if status != http.StatusSeeOther || location != article+"?comment=pending#comments" {
+		t.Fatalf("anonymous comment: got status code %d and location %s", status, location)
+	}
+	anonymous := lastCommentID(t)
+	if strings.Contains(articlePage(t), "first") {
+		t.Error("pending comment is public")
+	}
+
+	t.Run("moderation queue", func(t *testing.T) {
+		if status := get(t, server, "/admin/comments", reader).StatusCode; status != http.StatusForbidden {
+			t.Errorf("reader: expected status code %d, got %d", http.StatusForbidden, status)
+		}
+		_, body := getBody(t, server, "/admin/comments", admin)
+		if !strings.Contains(body, "&lt;b&gt;first&lt;/b&gt;") {
+			t.Error("pending comment missing in the queue")
+		}
+
+		if status, _ := comment(t, url.Values{"content": {"reply to pending"}, "parent_id": {anonymous}}, reader); status != http.StatusBadRequest {
+			t.Errorf("reply to pending comment: expected status code %d, got %d", http.StatusBadRequest, status)
+		}
+
+		response := postForm(t, server, "/admin/comments/"+anonymous+"/approve", url.Values{"status": {"pending"}}, admin)
+		if response.StatusCode != http.StatusSeeOther || response.Header.Get("Location") != "/admin/comments?status=pending" {
+			t.Errorf("approve: got status code %d and location %s", response.StatusCode, response.Header.Get("Location"))
+		}
+		if !strings.Contains(articlePage(t), "&lt;b&gt;first&lt;/b&gt;") {
+			t.Error("approved comment is not public")
+		}
+	})
+
+	t.Run("replies", func(t *testing.T) {
+		if status, _ := comment(t, url.Values{"content": {"a reply"}, "parent_id": {anonymous}}, reader); status != http.StatusSeeOther {
+			t.Fatalf("reply: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		reply := lastCommentID(t)
+		postForm(t, server, "/admin/comments/"+reply+"/approve", nil, admin)
+
+		status, location := comment(t, url.Values{"content": {"moderator reply"}, "parent_id": {reply}}, admin)
+		if status != http.StatusSeeOther || !strings.HasPrefix(location, article+"#comment-") {
+			t.Fatalf("moderator reply: got status code %d and location %s", status, location)
+		}
+
+		body := articlePage(t)
+		first, second, third := strings.Index(body, "first"), strings.Index(body, "a reply"), strings.Index(body, "moderator reply")
+		if first < 0 || second < first || third < second || !strings.Contains(body, `class="replies"`) {
+			t.Error("expected the replies below their parent")
+		}
+
+		postForm(t, server, "/admin/comments/"+reply+"/reject", nil, admin)
+		body = articlePage(t)
+		if strings.Contains(body, "a reply") || strings.Contains(body, "moderator reply") {
+			t.Error("rejected comment or the reply to it is public")
+		}
+		if _, body := getBody(t, server, "/admin/comments?status=rejected", admin); !strings.Contains(body, "a reply") {
+			t.Error("rejected comment missing in the rejected list")
+		}
+	})
+
+	t.Run("edit and delete", func(t *testing.T) {
+		response := postForm(t, server, "/admin/comments/"+anonymous+"/edit", url.Values{"author_name": {"Guest"}, "content": {"edited"}}, admin)
+		if response.StatusCode != http.StatusSeeOther {
+			t.Fatalf("edit: expected status code %d, got %d", http.StatusSeeOther, response.StatusCode)
+		}
+		if !strings.Contains(articlePage(t), "edited") {
+			t.Error("edit not shown")
+		}
+
+		postForm(t, server, "/admin/comments/"+anonymous+"/delete", nil, admin)
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM comments").Scan(&count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("expected the replies to be deleted with the comment, %d comments left", count)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		values := url.Values{"title": {"Talk"}, "slug": {"talk"}, "content": {"about"}, "published": {"1"}, "comments_closed": {"1"}}
+		if status := postForm(t, server, article+"/edit", values, admin).StatusCode; status != http.StatusSeeOther {
+			t.Fatalf("edit: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		if status, _ := comment(t, url.Values{"author_name": {"Guest"}, "content": {"too late"}}); status != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, status)
+		}
+		if !strings.Contains(articlePage(t), "Comments are closed") {
+			t.Error("closed comments not shown")
+		}
+	})
+}
+
+func TestRevisions(t *testing.T) {
+	server, db := newTestServerWithDB(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		Session: config.SessionConfig{
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+	})
+
+	admin := registerAndLogin(t, server, "admin")
+	reader := registerAndLogin(t, server, "reader")
+	article := postForm(t, server, "/articles", url.Values{"title": {"Draft One"}, "content": {"first line\nsecond line\n"}, "published": {"1"}}, admin).Header.Get("Location")
+
+	edit := func(t *testing.T, title, content string) {
+		t.Helper()
+		values := url.Values{"title": {title}, "slug": {"draft-one"}, "content": {content}, "published": {"1"}}
+		if status := postForm(t, server, article+"/edit", values, admin).StatusCode; status != http.StatusSeeOther {
+			t.Fatalf("edit: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+	}
+	revisions := func(t *testing.T) []string {
+		t.Helper()
+		rows, err := db.Query("SELECT id FROM article_revisions ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	edit(t, "Draft One", "first line\nsecond line changed\n")
+	edit(t, "Draft One", "first line\nsecond line changed\n")
+	if ids := revisions(t); len(ids) != 1 {
+		t.Fatalf("expected one revision, saves without changes don't count, got %d", len(ids))
+	}
+	first := revisions(t)[0]
+
+	t.Run("history", func(t *testing.T) {
+		if status := get(t, server, article+"/revisions", reader).StatusCode; status != http.StatusForbidden {
+			t.Errorf("reader: expected status code %d, got %d", http.StatusForbidden, status)
+		}
+		status, body := getBody(t, server, article+"/revisions", admin)
+		if status != http.StatusOK || !strings.Contains(body, "/revisions/"+first+"/restore") {
+			t.Errorf("expected the revision in the history, got status code %d", status)
+		}
+	})
+
+	t.Run("diff", func(t *testing.T) {
+		status, body := getBody(t, server, article+"/diff?from="+first+"&to=current", admin)
+		if status != http.StatusOK || !strings.Contains(body, "<del>second line\n</del><ins>second line changed\n</ins>") {
+			t.Errorf("line diff: got status code %d: %s", status, body)
+		}
+		status, body = getBody(t, server, article+"/diff?from="+first+"&to=current&mode=words", admin)
+		if status != http.StatusOK || !strings.Contains(body, "second line<ins> changed</ins>") {
+			t.Errorf("word diff: got status code %d: %s", status, body)
+		}
+		if status := get(t, server, article+"/diff?from=999", admin).StatusCode; status != http.StatusNotFound {
+			t.Errorf("unknown revision: expected status code %d, got %d", http.StatusNotFound, status)
+		}
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		response := postForm(t, server, article+"/revisions/"+first+"/restore", nil, admin)
+		if response.StatusCode != http.StatusSeeOther {
+			t.Fatalf("expected status code %d, got %d", http.StatusSeeOther, response.StatusCode)
+		}
+		var content string
+		err := db.QueryRow("SELECT content FROM articles WHERE slug = 'draft-one'").Scan(&content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content != "first line\nsecond line\n" {
+			t.Errorf("expected the restored content, got %q", content)
+		}
+		if ids := revisions(t); len(ids) != 2 {
+			t.Errorf("expected the restore to create a revision, got %d revisions", len(ids))
+		}
+	})
+}
+
+func TestTaxonomy(t *testing.T) {
+	server, db := newTestServerWithDB(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		Session: config.SessionConfig{
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+	})
+
+	admin := registerAndLogin(t, server, "admin")
+	reader := registerAndLogin(t, server, "reader")
+
+	id := func(t *testing.T, table, slug string) string {
+		t.Helper()
+		var id string
+		err := db.QueryRow("SELECT id FROM "+table+" WHERE slug = ?", slug).Scan(&id)
+		if err != nil {
+			t.Fatalf("%s %q: %v", table, slug, err)
+		}
+		return id
+	}
+
+	t.Run("categories", func(t *testing.T) {
+		if status := postForm(t, server, "/admin/categories", url.Values{"name": {"News"}}, reader).StatusCode; status != http.StatusForbidden {
+			t.Errorf("reader: expected status code %d, got %d", http.StatusForbidden, status)
+		}
+		for _, name := range []string{"Go News", "Go: News"} {
+			if status := postForm(t, server, "/admin/categories", url.Values{"name": {name}}, admin).StatusCode; status != http.StatusSeeOther {
+				t.Fatalf("create %q: expected status code %d, got %d", name, http.StatusSeeOther, status)
+			}
+		}
+		// both names make the slug go-news
+		id(t, "categories", "go-news")
+		second := id(t, "categories", "go-news-2")
+
+		if status := postForm(t, server, "/admin/categories", url.Values{"name": {"go news"}}, admin).StatusCode; status != http.StatusBadRequest {
+			t.Errorf("duplicate name: expected status code %d, got %d", http.StatusBadRequest, status)
+		}
+		if status := postForm(t, server, "/admin/categories/"+second, url.Values{"name": {"Releases"}}, admin).StatusCode; status != http.StatusSeeOther {
+			t.Errorf("update: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		id(t, "categories", "releases")
+	})
+
+	news := id(t, "categories", "go-news")
+	article := postForm(t, server, "/articles", url.Values{
+		"title": {"Tagged"}, "content": {"text"}, "published": {"1"},
+		"categories": {news}, "tags": {"Go, SQLite, go"},
+	}, admin).Header.Get("Location")
+	postForm(t, server, "/articles", url.Values{"title": {"Other"}, "content": {"text"}, "published": {"1"}, "tags": {"golang"}}, admin)
+
+	t.Run("editor", func(t *testing.T) {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM article_tags").Scan(&count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 3 {
+			t.Errorf("expected 3 tag assignments, duplicates ignoring case are dropped, got %d", count)
+		}
+		status, body := getBody(t, server, article, reader)
+		if status != http.StatusOK || !strings.Contains(body, `href="/category/go-news"`) || !strings.Contains(body, `href="/tag/sqlite"`) {
+			t.Errorf("expected the category and tags on the article, got status code %d", status)
+		}
+		_, body = getBody(t, server, article+"/edit", admin)
+		if !strings.Contains(body, `value="Go, SQLite"`) {
+			t.Errorf("expected the tags in the form: %s", body)
+		}
+	})
+
+	t.Run("archives", func(t *testing.T) {
+		status, body := getBody(t, server, "/category/go-news", reader)
+		if status != http.StatusOK || !strings.Contains(body, "Tagged") || strings.Contains(body, "Other") {
+			t.Errorf("category: got status code %d: %s", status, body)
+		}
+		status, body = getBody(t, server, "/tag/go", reader)
+		if status != http.StatusOK || !strings.Contains(body, "Tagged") || !strings.Contains(body, `href="/tag/go/feed.xml"`) {
+			t.Errorf("tag: got status code %d: %s", status, body)
+		}
+		if status := get(t, server, "/tag/unknown", reader).StatusCode; status != http.StatusNotFound {
+			t.Errorf("unknown tag: expected status code %d, got %d", http.StatusNotFound, status)
+		}
+		status, body = getBody(t, server, "/tags", reader)
+		if status != http.StatusOK || !strings.Contains(body, `SQLite <span class="count">(1)</span>`) {
+			t.Errorf("tag cloud: got status code %d: %s", status, body)
+		}
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		golang, goTag := id(t, "tags", "golang"), id(t, "tags", "go")
+		if status := postForm(t, server, "/admin/tags/merge", url.Values{"from": {golang}, "into": {golang}}, admin).StatusCode; status != http.StatusBadRequest {
+			t.Errorf("merge into itself: expected status code %d, got %d", http.StatusBadRequest, status)
+		}
+		if status := postForm(t, server, "/admin/tags/merge", url.Values{"from": {golang}, "into": {goTag}}, admin).StatusCode; status != http.StatusSeeOther {
+			t.Fatalf("expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		if status := get(t, server, "/tag/golang", reader).StatusCode; status != http.StatusNotFound {
+			t.Errorf("merged tag: expected status code %d, got %d", http.StatusNotFound, status)
+		}
+		_, body := getBody(t, server, "/tag/go", reader)
+		if !strings.Contains(body, "Tagged") || !strings.Contains(body, "Other") {
+			t.Errorf("expected both articles under the remaining tag: %s", body)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if status := postForm(t, server, "/admin/categories/"+news+"/delete", nil, admin).StatusCode; status != http.StatusSeeOther {
+			t.Fatalf("expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		if status := get(t, server, "/category/go-news", reader).StatusCode; status != http.StatusNotFound {
+			t.Errorf("deleted category: expected status code %d, got %d", http.StatusNotFound, status)
+		}
+		if status := get(t, server, article, reader).StatusCode; status != http.StatusOK {
+			t.Errorf("article of the deleted category: expected status code %d, got %d", http.StatusOK, status)
+		}
+	})
+}
+
+// upload sends content as the file of a multipart form to /admin/media and returns the response with its body closed.
+func upload(t *testing.T, server *httptest.Server, fileName string, content []byte, cookies ...*http.Cookie) *http.Response {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	form.Close()
+
+	request, err := http.NewRequest("POST", server.URL+"/admin/media", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	return response
+}
+
+func TestMedia(t *testing.T) {
+	mediaDir := t.TempDir()
+	server, db := newTestServerWithDB(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		Session: config.SessionConfig{
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+		Media: config.MediaConfig{Dir: mediaDir, MaxSize: 4 << 10, Timeout: time.Minute},
+	})
+
+	admin := registerAndLogin(t, server, "admin")
+	reader := registerAndLogin(t, server, "reader")
+
+	var png bytes.Buffer
+	if err := imagepng.Encode(&png, image.NewGray(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := upload(t, server, "photo.png", png.Bytes(), reader).StatusCode; status != http.StatusForbidden {
+		t.Errorf("reader: expected status code %d, got %d", http.StatusForbidden, status)
+	}
+	for _, name := range []string{"My Photo.PNG", `C:\Users\me\copy.txt`} {
+		if status := upload(t, server, name, png.Bytes(), admin).StatusCode; status != http.StatusSeeOther {
+			t.Fatalf("upload %q: expected status code %d, got %d", name, http.StatusSeeOther, status)
+		}
+	}
+	if status := upload(t, server, "page.png", []byte("<html><script>alert(1)</script></html>"), admin).StatusCode; status != http.StatusUnsupportedMediaType {
+		t.Errorf("html: expected status code %d, got %d", http.StatusUnsupportedMediaType, status)
+	}
+	large := append(bytes.Clone(png.Bytes()), make([]byte, 8<<10)...)
+	if status := upload(t, server, "large.png", large, admin).StatusCode; status != http.StatusRequestEntityTooLarge {
+		t.Errorf("large file: expected status code %d, got %d", http.StatusRequestEntityTooLarge, status)
+	}
+	large = append(large, make([]byte, 128<<10)...)
+	if status := upload(t, server, "larger.png", large, admin).StatusCode; status != http.StatusRequestEntityTooLarge {
+		t.Errorf("body over the limit of the route: expected status code %d, got %d", http.StatusRequestEntityTooLarge, status)
+	}
+
+	var names []string
+	var paths []string
+	rows, err := db.Query("SELECT file_name, file_path FROM media ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var name, path string
+		if err := rows.Scan(&name, &path); err != nil {
+			t.Fatal(err)
+		}
+		names, paths = append(names, name), append(paths, path)
+	}
+	rows.Close()
+	if !slices.Equal(names, []string{"my-photo.png", "copy.png"}) {
+		t.Fatalf("expected the sanitized names with the extension of the content, got %v", names)
+	}
+	if paths[0] != paths[1] {
+		t.Errorf("expected identical uploads to share the file, got %v", paths)
+	}
+	stored, err := os.ReadFile(filepath.Join(mediaDir, paths[0]))
+	if err != nil || !bytes.Equal(stored, png.Bytes()) {
+		t.Errorf("expected the file under its hash, got %v", err)
+	}
+
+	t.Run("serve", func(t *testing.T) {
+		response := get(t, server, "/media/1/my-photo.png")
+		if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "image/png" || !strings.Contains(response.Header.Get("Cache-Control"), "immutable") {
+			t.Fatalf("got status code %d and headers %v", response.StatusCode, response.Header)
+		}
+		request, err := http.NewRequest("GET", server.URL+"/media/1/my-photo.png", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("If-None-Match", response.Header.Get("ETag"))
+		cached, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cached.Body.Close()
+		if cached.StatusCode != http.StatusNotModified {
+			t.Errorf("If-None-Match: expected status code %d, got %d", http.StatusNotModified, cached.StatusCode)
+		}
+		if status := get(t, server, "/media/1/other.png").StatusCode; status != http.StatusNotFound {
+			t.Errorf("wrong name: expected status code %d, got %d", http.StatusNotFound, status)
+		}
+		status, body := getBody(t, server, "/admin/media", admin)
+		if status != http.StatusOK || !strings.Contains(body, `src="/media/2/copy.png"`) {
+			t.Errorf("media browser: got status code %d", status)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		postForm(t, server, "/articles", url.Values{"title": {"Photo"}, "content": {"![photo](/media/1/my-photo.png)"}}, admin)
+		if status := postForm(t, server, "/admin/media/1/delete", nil, admin).StatusCode; status != http.StatusConflict {
+			t.Errorf("referenced file: expected status code %d, got %d", http.StatusConflict, status)
+		}
+		if status := postForm(t, server, "/admin/media/2/delete", nil, admin).StatusCode; status != http.StatusSeeOther {
+			t.Fatalf("expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		if _, err := os.Stat(filepath.Join(mediaDir, paths[0])); err != nil {
+			t.Errorf("expected the file to stay for the other upload: %v", err)
+		}
+
+		postForm(t, server, "/articles/photo/delete", nil, admin)
+		if status := postForm(t, server, "/admin/media/1/delete", nil, admin).StatusCode; status != http.StatusSeeOther {
+			t.Fatalf("expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		if _, err := os.Stat(filepath.Join(mediaDir, paths[0])); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected the unused file to be removed: %v", err)
+		}
+	})
+}
+
+func TestImageDerivatives(t *testing.T) {
+	server, db := newTestServerWithDB(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		Session: config.SessionConfig{
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+		Media: config.MediaConfig{Dir: t.TempDir(), MaxSize: 1 << 20, Timeout: time.Minute, ImageWidths: []int{200, 100, 5000}},
+	})
+
+	admin := registerAndLogin(t, server, "admin")
+
+	var photo, logo bytes.Buffer
+	if err := jpeg.Encode(&photo, image.NewGray(image.Rect(0, 0, 300, 150)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := imagepng.Encode(&logo, image.NewNRGBA(image.Rect(0, 0, 300, 300))); err != nil {
+		t.Fatal(err)
+	}
+	if status := upload(t, server, "photo.jpg", photo.Bytes(), admin).StatusCode; status != http.StatusSeeOther {
+		t.Fatalf("upload photo: expected status code %d, got %d", http.StatusSeeOther, status)
+	}
+	if status := upload(t, server, "logo.png", logo.Bytes(), admin).StatusCode; status != http.StatusSeeOther {
+		t.Fatalf("upload logo: expected status code %d, got %d", http.StatusSeeOther, status)
+	}
+
+	type file struct {
+		name          string
+		contentType   string
+		width, height int
+	}
+	derivatives := func(t *testing.T, parent string) []file {
+		t.Helper()
+		rows, err := db.Query(`SELECT file_name, content_type, width, height FROM media
+			WHERE parent_id = (SELECT id FROM media WHERE file_name = ?) ORDER BY width`, parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var files []file
+		for rows.Next() {
+			var f file
+			if err := rows.Scan(&f.name, &f.contentType, &f.width, &f.height); err != nil {
+				t.Fatal(err)
+			}
+			files = append(files, f)
+		}
+		return files
+	}
+
+	want := []file{{"photo-100w.jpg", "image/jpeg", 100, 50}, {"photo-200w.jpg", "image/jpeg", 200, 100}}
+	if got := derivatives(t, "photo.jpg"); !slices.Equal(got, want) {
+		t.Errorf("photo: expected %v, got %v", want, got)
+	}
+	want = []file{{"logo-100w.png", "image/png", 100, 100}, {"logo-200w.png", "image/png", 200, 200}}
+	if got := derivatives(t, "logo.png"); !slices.Equal(got, want) {
+		t.Errorf("transparent image: expected %v, got %v", want, got)
+	}
+
+	// the photo is uploaded first, then its derivatives are saved from narrow to wide
+	status, body := getBody(t, server, "/admin/media", admin)
+	if status != http.StatusOK || !strings.Contains(body, `srcset="/media/2/photo-100w.jpg 100w, /media/3/photo-200w.jpg 200w, /media/1/photo.jpg 300w"`) || strings.Contains(body, `href="/media/2/photo-100w.jpg"`) {
+		t.Errorf("expected the originals with their srcset in the media browser: %s", body)
+	}
+	if status := get(t, server, "/media/2/photo-100w.jpg").StatusCode; status != http.StatusOK {
+		t.Errorf("derivative: expected status code %d, got %d", http.StatusOK, status)
+	}
+
+	if status := postForm(t, server, "/admin/media/1/delete", nil, admin).StatusCode; status != http.StatusSeeOther {
+		t.Fatalf("delete: expected status code %d, got %d", http.StatusSeeOther, status)
+	}
+	if got := derivatives(t, "photo.jpg"); len(got) != 0 {
+		t.Errorf("expected the derivatives to be deleted with the original, got %v", got)
+	}
+}
+
+func TestPages(t *testing.T) {
+	server, db := newTestServerWithDB(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		Session: config.SessionConfig{
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+	})
+
+	admin := registerAndLogin(t, server, "admin")
+	reader := registerAndLogin(t, server, "reader")
+
+	id := func(t *testing.T, slug string) string {
+		t.Helper()
+		var id string
+		err := db.QueryRow("SELECT id FROM pages WHERE slug = ?", slug).Scan(&id)
+		if err != nil {
+			t.Fatalf("page %q: %v", slug, err)
+		}
+		return id
+	}
+
+	if status := postForm(t, server, "/admin/pages", url.Values{"title": {"About"}, "content": {"text"}}, reader).StatusCode; status != http.StatusForbidden {
+		t.Errorf("reader: expected status code %d, got %d", http.StatusForbidden, status)
+	}
+	if status := postForm(t, server, "/admin/pages", url.Values{"title": {"About"}, "content": {"text"}, "menu_order": {"-1"}}, admin).StatusCode; status != http.StatusBadRequest {
+		t.Errorf("negative menu order: expected status code %d, got %d", http.StatusBadRequest, status)
+	}
+	for _, values := range []url.Values{
+		{"title": {"Imprint"}, "content": {"imprint text"}, "published": {"1"}, "menu_order": {"2"}},
+		{"title": {"About me"}, "slug": {"about"}, "content": {"about text"}, "published": {"1"}, "menu_order": {"1"}},
+		{"title": {"Login"}, "content": {"a page about logging in"}, "published": {"1"}},
+		{"title": {"Upcoming"}, "content": {"draft text"}, "menu_order": {"3"}},
+	} {
+		if status := postForm(t, server, "/admin/pages", values, admin).StatusCode; status != http.StatusSeeOther {
+			t.Fatalf("create %q: expected status code %d, got %d", values.Get("title"), http.StatusSeeOther, status)
+		}
+	}
+
+	t.Run("reserved slugs", func(t *testing.T) {
+		id(t, "login-2")
+		if status, body := getBody(t, server, "/login-2"); status != http.StatusOK || !strings.Contains(body, "a page about logging in") {
+			t.Errorf("expected the page at /login-2, got status code %d", status)
+		}
+		if status, body := getBody(t, server, "/login"); status != http.StatusOK || strings.Contains(body, "a page about logging in") {
+			t.Errorf("expected the login form at /login, got status code %d", status)
+		}
+		if status := get(t, server, "/health").StatusCode; status != http.StatusOK {
+			t.Errorf("health: expected status code %d, got %d", http.StatusOK, status)
+		}
+		if status := get(t, server, "/missing").StatusCode; status != http.StatusNotFound {
+			t.Errorf("missing page: expected status code %d, got %d", http.StatusNotFound, status)
+		}
+	})
+
+	t.Run("drafts", func(t *testing.T) {
+		if status := get(t, server, "/upcoming").StatusCode; status != http.StatusNotFound {
+			t.Errorf("anonymous: expected status code %d, got %d", http.StatusNotFound, status)
+		}
+		if status := get(t, server, "/upcoming", reader).StatusCode; status != http.StatusNotFound {
+			t.Errorf("reader: expected status code %d, got %d", http.StatusNotFound, status)
+		}
+		if status := get(t, server, "/upcoming", admin).StatusCode; status != http.StatusOK {
+			t.Errorf("admin: expected status code %d, got %d", http.StatusOK, status)
+		}
+	})
+
+	t.Run("menu", func(t *testing.T) {
+		_, body := getBody(t, server, "/")
+		about, imprint := strings.Index(body, `href="/about"`), strings.Index(body, `href="/imprint"`)
+		if about < 0 || imprint < 0 || about > imprint {
+			t.Errorf("expected About before Imprint in the menu")
+		}
+		if strings.Contains(body, `href="/upcoming"`) || strings.Contains(body, `href="/login-2"`) {
+			t.Errorf("expected drafts and pages without a menu position to be left out of the menu")
+		}
+	})
+
+	t.Run("edit", func(t *testing.T) {
+		imprint := id(t, "imprint")
+		if status := get(t, server, "/admin/pages/"+imprint+"/edit", admin).StatusCode; status != http.StatusOK {
+			t.Errorf("edit form: expected status code %d, got %d", http.StatusOK, status)
+		}
+		values := url.Values{"title": {"Legal"}, "slug": {"legal"}, "content": {"changed"}, "published": {"1"}}
+		if status := postForm(t, server, "/admin/pages/"+imprint+"/edit", values, admin).StatusCode; status != http.StatusSeeOther {
+			t.Fatalf("update: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		if status, body := getBody(t, server, "/legal"); status != http.StatusOK || !strings.Contains(body, "changed") {
+			t.Errorf("expected the changed page at its new slug, got status code %d", status)
+		}
+		if _, body := getBody(t, server, "/"); strings.Contains(body, `href="/legal"`) {
+			t.Errorf("expected the page without a menu position to leave the menu")
+		}
+
+		if status := postForm(t, server, "/admin/pages/"+imprint+"/delete", nil, admin).StatusCode; status != http.StatusSeeOther {
+			t.Fatalf("delete: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		if status := get(t, server, "/legal").StatusCode; status != http.StatusNotFound {
+			t.Errorf("deleted page: expected status code %d, got %d", http.StatusNotFound, status)
+		}
+		if status := get(t, server, "/admin/pages/"+imprint+"/edit", admin).StatusCode; status != http.StatusNotFound {
+			t.Errorf("edit deleted page: expected status code %d, got %d", http.StatusNotFound, status)
+		}
+	})
+}
+
+func TestTemplates(t *testing.T) {
+	server, _ := newTestServerWithDB(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		Session: config.SessionConfig{
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+	})
+
+	admin := registerAndLogin(t, server, "admin")
+	reader := registerAndLogin(t, server, "reader")
+
+	save := func(t *testing.T, name, content string) int {
+		t.Helper()
+		return postForm(t, server, "/admin/templates", url.Values{"name": {name}, "content": {content}}, admin).StatusCode
+	}
+
+	if status := get(t, server, "/admin/templates", reader).StatusCode; status != http.StatusForbidden {
+		t.Errorf("reader: expected status code %d, got %d", http.StatusForbidden, status)
+	}
+	if status, body := getBody(t, server, "/admin/templates", admin); status != http.StatusOK || !strings.Contains(body, "_layout.html") {
+		t.Errorf("expected the list of templates, got status code %d", status)
+	}
+
+	t.Run("validation", func(t *testing.T) {
+		tests := []struct {
+			name, content string
+			status        int
+		}{
+			{"articles.html", `{{template "layout" .}}{{define "content"}}{{if}}{{end}}`, http.StatusBadRequest},
+			{"articles.html", `{{template "layout" .}}{{define "content"}}{{unknown}}{{end}}`, http.StatusBadRequest},
+			{"articles.html", `{{template "layout" .}}{{define "content"}}{{template "missing" .}}{{end}}`, http.StatusBadRequest},
+			{"_nav.html", `{{define "navigation"}}{{end}}`, http.StatusBadRequest},
+			{"new-page.html", `<p>hello</p>`, http.StatusBadRequest},
+			{"../articles.html", `<p>hello</p>`, http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			if status := save(t, tt.name, tt.content); status != tt.status {
+				t.Errorf("%s %q: expected status code %d, got %d", tt.name, tt.content, tt.status, status)
+			}
+		}
+		if status, body := getBody(t, server, "/"); status != http.StatusOK || !strings.Contains(body, "No articles yet.") {
+			t.Errorf("expected the default page after invalid changes, got status code %d", status)
+		}
+	})
+
+	t.Run("customize", func(t *testing.T) {
+		// the first request compiles the page, saving a partial must replace it
+		getBody(t, server, "/")
+		if status := save(t, "_footer.html", `{{define "footer"}}<footer>Custom footer</footer>{{end}}`); status != http.StatusSeeOther {
+			t.Fatalf("new partial: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		_, layout := getBody(t, server, "/admin/templates/_layout.html", admin)
+		start, end := strings.Index(layout, "<textarea"), strings.Index(layout, "</textarea>")
+		if start < 0 || end < start {
+			t.Fatalf("expected the layout in the editor")
+		}
+		content := html.UnescapeString(layout[strings.Index(layout[start:], ">")+start+1 : end])
+		content = strings.Replace(content, "</body>", `{{template "footer" .}}</body>`, 1)
+		if status := save(t, "_layout.html", content); status != http.StatusSeeOther {
+			t.Fatalf("layout: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		if _, body := getBody(t, server, "/"); !strings.Contains(body, "Custom footer") {
+			t.Errorf("expected the changed layout to be used")
+		}
+
+		if status := postForm(t, server, "/admin/templates/_footer.html/delete", nil, admin).StatusCode; status != http.StatusConflict {
+			t.Errorf("delete used partial: expected status code %d, got %d", http.StatusConflict, status)
+		}
+		if status := postForm(t, server, "/admin/templates/_layout.html/delete", nil, admin).StatusCode; status != http.StatusSeeOther {
+			t.Errorf("reset layout: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		if status := postForm(t, server, "/admin/templates/_footer.html/delete", nil, admin).StatusCode; status != http.StatusSeeOther {
+			t.Errorf("delete partial: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		if _, body := getBody(t, server, "/"); strings.Contains(body, "Custom footer") {
+			t.Errorf("expected the default layout again")
+		}
+		if status := postForm(t, server, "/admin/templates/articles.html/delete", nil, admin).StatusCode; status != http.StatusBadRequest {
+			t.Errorf("reset default: expected status code %d, got %d", http.StatusBadRequest, status)
+		}
+	})
+}
+
+func TestStatic(t *testing.T) {
+	cfg := config.Config{IPRateLimit: rate.Inf, BurstRateLimit: 1}
+
+	t.Run("embedded", func(t *testing.T) {
+		server, _ := newTestServerWithDB(t, cfg)
+
+		response := get(t, server, "/static/style.css")
+		if response.StatusCode != http.StatusOK || !strings.HasPrefix(response.Header.Get("Content-Type"), "text/css") {
+			t.Fatalf("expected the stylesheet, got status code %d and %q", response.StatusCode, response.Header.Get("Content-Type"))
+		}
+		etag := response.Header.Get("ETag")
+		if etag == "" {
+			t.Fatalf("expected an ETag")
+		}
+
+		request, err := http.NewRequest("GET", server.URL+"/static/style.css", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("If-None-Match", etag)
+		response, err = server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusNotModified {
+			t.Errorf("unchanged: expected status code %d, got %d", http.StatusNotModified, response.StatusCode)
+		}
+
+		for _, path := range []string{"/static/missing.css", "/static/", "/static/%2e%2e/go.mod"} {
+			if status := get(t, server, path).StatusCode; status != http.StatusNotFound {
+				t.Errorf("%s: expected status code %d, got %d", path, http.StatusNotFound, status)
+			}
+		}
+	})
+
+	t.Run("directory", func(t *testing.T) {
+		// a copy of the static directory, changes show up without a restart
+		dir := t.TempDir()
+		for _, name := range []string{"templates", "assets"} {
+			files, err := filepath.Glob(filepath.Join("static", name, "*"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = os.MkdirAll(filepath.Join(dir, name), 0o755)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, file := range files {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = os.WriteFile(filepath.Join(dir, name, filepath.Base(file)), data, 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		cfg := cfg
+		cfg.StaticDir = dir
+		server, _ := newTestServerWithDB(t, cfg)
+
+		if _, body := getBody(t, server, "/"); !strings.Contains(body, "No articles yet.") {
+			t.Fatalf("expected the articles from the copied templates")
+		}
+		articles := filepath.Join(dir, "templates", "articles.html")
+		data, err := os.ReadFile(articles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(articles, bytes.Replace(data, []byte("No articles yet."), []byte("Nothing here."), 1), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, body := getBody(t, server, "/"); !strings.Contains(body, "Nothing here.") {
+			t.Errorf("expected the changed template without a restart")
+		}
+
+		err = os.WriteFile(filepath.Join(dir, "assets", "site.js"), []byte("console.log(1)"), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status, body := getBody(t, server, "/static/site.js"); status != http.StatusOK || body != "console.log(1)" {
+			t.Errorf("expected the new asset, got status code %d: %s", status, body)
+		}
+	})
+}
+
+func TestSettings(t *testing.T) {
+	server, db := newTestServerWithDB(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		Session: config.SessionConfig{
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+	})
+
+	admin := registerAndLogin(t, server, "admin")
+	reader := registerAndLogin(t, server, "reader")
+	var article string
+	for _, title := range []string{"One", "Two", "Three"} {
+		article = postForm(t, server, "/articles", url.Values{"title": {title}, "content": {"text"}, "published": {"1"}}, admin).Header.Get("Location")
+	}
+	save := func(t *testing.T, values url.Values) int {
+		t.Helper()
+		return postForm(t, server, "/admin/settings", values, admin).StatusCode
+	}
+
+	if status := get(t, server, "/admin/settings", reader).StatusCode; status != http.StatusForbidden {
+		t.Errorf("reader: expected status code %d, got %d", http.StatusForbidden, status)
+	}
+	if status, body := getBody(t, server, "/", reader); status != http.StatusOK || !strings.Contains(body, "<title>Articles - Go-SQLite-Blog</title>") {
+		t.Errorf("expected the default title, got status code %d", status)
+	}
+
+	t.Run("invalid values", func(t *testing.T) {
+		for _, values := range []url.Values{
+			{"site_title": {" "}},
+			{"articles_per_page": {"0"}},
+			{"comment_policy": {"sometimes"}},
+			{"timezone": {"Mars/Olympus_Mons"}},
+			{"feed_full_content": {"yes please"}},
+		} {
+			if status := save(t, values); status != http.StatusBadRequest {
+				t.Errorf("%v: expected status code %d, got %d", values, http.StatusBadRequest, status)
+			}
+		}
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM settings").Scan(&count); err != nil || count != 0 {
+			t.Errorf("expected no stored settings, got %d (%v)", count, err)
+		}
+	})
+
+	t.Run("site title and articles per page", func(t *testing.T) {
+		if status := save(t, url.Values{"site_title": {"My <Blog>"}, "site_description": {"Notes"}, "articles_per_page": {"2"}}); status != http.StatusSeeOther {
+			t.Fatalf("expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		_, body := getBody(t, server, "/", reader)
+		if !strings.Contains(body, "<title>Articles - My &lt;Blog&gt;</title>") || !strings.Contains(body, `<meta name="description" content="Notes">`) {
+			t.Errorf("expected the new title and description, got %s", body)
+		}
+		if strings.Contains(body, "/articles/one") || !strings.Contains(body, "?page=2") {
+			t.Errorf("expected two articles and a next page, got %s", body)
+		}
+		if _, body := getBody(t, server, "/feed.json"); !strings.Contains(body, `"title": "My \u003cBlog\u003e"`) {
+			t.Errorf("expected the new title in the feed, got %s", body)
+		}
+		if _, body := getBody(t, server, "/admin/settings", admin); !strings.Contains(body, `value="My &lt;Blog&gt;"`) {
+			t.Errorf("expected the stored title in the form, got %s", body)
+		}
+	})
+
+	t.Run("comment policy", func(t *testing.T) {
+		comment := func(t *testing.T, cookies ...*http.Cookie) (int, string) {
+			t.Helper()
+			response := postForm(t, server, article+"/comments", url.Values{"author_name": {"Guest"}, "content": {"hello"}}, cookies...)
+			return response.StatusCode, response.Header.Get("Location")
+		}
+
+		save(t, url.Values{"comment_policy": {"open"}})
+		if status, location := comment(t); status != http.StatusSeeOther || strings.Contains(location, "pending") {
+			t.Errorf("open: expected an approved comment, got status code %d and location %s", status, location)
+		}
+
+		save(t, url.Values{"comment_policy": {"registered"}})
+		if status, _ := comment(t); status != http.StatusForbidden {
+			t.Errorf("registered, anonymous: expected status code %d, got %d", http.StatusForbidden, status)
+		}
+		if _, body := getBody(t, server, article); !strings.Contains(body, "to comment.") {
+			t.Error("registered: expected a login link for anonymous users")
+		}
+		if status, location := comment(t, reader); status != http.StatusSeeOther || !strings.Contains(location, "pending") {
+			t.Errorf("registered, reader: expected a pending comment, got status code %d and location %s", status, location)
+		}
+
+		save(t, url.Values{"comment_policy": {"closed"}})
+		if status, _ := comment(t, reader); status != http.StatusForbidden {
+			t.Errorf("closed: expected status code %d, got %d", http.StatusForbidden, status)
+		}
+	})
+
+	t.Run("timezone", func(t *testing.T) {
+		_, err := db.Exec("UPDATE articles SET published_at = '2024-06-30 23:30:00+00:00', updated_at = '2024-06-30 23:30:00+00:00'")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, body := getBody(t, server, article); !strings.Contains(body, "Published 2024-06-30") {
+			t.Errorf("UTC: expected the date in UTC, got %s", body)
+		}
+		save(t, url.Values{"timezone": {"Europe/Berlin"}})
+		if _, body := getBody(t, server, article); !strings.Contains(body, "Published 2024-07-01") || !strings.Contains(body, "2024-07-01 01:30") {
+			t.Errorf("Europe/Berlin: expected the local date, got %s", body)
+		}
+	})
+
+	t.Run("invalid stored value", func(t *testing.T) {
+		_, err := db.Exec("UPDATE settings SET value = 'Nowhere/Land' WHERE key = 'timezone'")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the settings are cached until they are saved again
+		save(t, url.Values{"site_title": {"Renamed"}})
+		if status, body := getBody(t, server, article); status != http.StatusOK || !strings.Contains(body, "Published 2024-06-30") {
+			t.Errorf("expected the default time zone, got status code %d", status)
+		}
+	})
+}
+
+func TestAudit(t *testing.T) {
+	server, db := newTestServerWithDB(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		Session: config.SessionConfig{
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+	})
+
+	admin := registerAndLogin(t, server, "admin")
+	reader := registerAndLogin(t, server, "reader")
+
+	// entries returns the user, details and ip of the entries of the action, oldest first
+	entries := func(t *testing.T, action string) []string {
+		t.Helper()
+		rows, err := db.Query(`SELECT COALESCE(users.username, '-'), audit_logs.details, audit_logs.ip FROM audit_logs
+			LEFT JOIN users ON users.id = audit_logs.user_id WHERE action = ? ORDER BY audit_logs.id`, action)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var list []string
+		for rows.Next() {
+			var username, details, ip string
+			if err := rows.Scan(&username, &details, &ip); err != nil {
+				t.Fatal(err)
+			}
+			list = append(list, username+" "+details+" "+ip)
+		}
+		return list
+	}
+	expect := func(t *testing.T, action string, want ...string) {
+		t.Helper()
+		got := entries(t, action)
+		if len(got) != len(want) {
+			t.Fatalf("%s: expected %d entries, got %q", action, len(want), got)
+		}
+		for i := range want {
+			if !strings.HasPrefix(got[i], want[i]) || !strings.HasSuffix(got[i], " 127.0.0.1") {
+				t.Errorf("%s: expected %q, got %q", action, want[i], got[i])
+			}
+		}
+	}
+
+	postForm(t, server, "/login", url.Values{"username": {"admin"}, "password": {"wrong"}})
+	article := postForm(t, server, "/articles", url.Values{"title": {"Audited"}, "content": {"text"}}, admin).Header.Get("Location")
+	postForm(t, server, article+"/edit", url.Values{"title": {"Audited"}, "content": {"text"}, "published": {"1"}}, admin)
+	postForm(t, server, article+"/comments", url.Values{"author_name": {"Guest"}, "content": {"hello"}})
+	var commentID string
+	if err := db.QueryRow("SELECT id FROM comments").Scan(&commentID); err != nil {
+		t.Fatal(err)
+	}
+	postForm(t, server, "/admin/comments/"+commentID+"/approve", nil, admin)
+	postForm(t, server, "/admin/users/2/role", url.Values{"role": {"author"}}, admin)
+	postForm(t, server, "/admin/settings", url.Values{"site_title": {"Audited Blog"}, "articles_per_page": {"10"}}, admin)
+	postForm(t, server, article+"/delete", nil, admin)
+
+	t.Run("recorded actions", func(t *testing.T) {
+		expect(t, "user.register", `admin {"role_id":4,"username":"admin"}`, `reader {"role_id":1,"username":"reader"}`)
+		expect(t, "login.success", "admin {}", "reader {}")
+		expect(t, "login.failure", `- {"username":"admin"}`)
+		expect(t, "article.publish", `admin {"article_id":1,"slug":"audited","title":"Audited"}`)
+		expect(t, "comment.approve", `admin {"article_id":1,"author_name":"Guest","comment_id":1}`)
+		expect(t, "user.role", `admin {"from_role_id":1,"to_role_id":2,"user_id":2,"username":"reader"}`)
+		expect(t, "settings.update", `admin {"site_title":{"from":"Go-SQLite-Blog","to":"Audited Blog"}}`)
+		expect(t, "article.delete", `admin {"article_id":1,"slug":"audited","title":"Audited"}`)
+	})
+
+	t.Run("admin view", func(t *testing.T) {
+		if status := get(t, server, "/admin/audit", reader).StatusCode; status != http.StatusForbidden {
+			t.Errorf("reader: expected status code %d, got %d", http.StatusForbidden, status)
+		}
+		status, body := getBody(t, server, "/admin/audit", admin)
+		if status != http.StatusOK || !strings.Contains(body, "login.failure") || !strings.Contains(body, "Go-http-client") {
+			t.Errorf("expected all entries, got status code %d: %s", status, body)
+		}
+		_, body = getBody(t, server, "/admin/audit?action=login.failure", admin)
+		if !strings.Contains(body, "<td>login.failure</td>") || strings.Contains(body, "<td>login.success</td>") {
+			t.Errorf("action filter: got %s", body)
+		}
+		_, body = getBody(t, server, "/admin/audit?user=reader", admin)
+		if !strings.Contains(body, "<td>user.register</td>") || strings.Contains(body, "<td>article.delete</td>") {
+			t.Errorf("user filter: got %s", body)
+		}
+		if _, body := getBody(t, server, "/admin/audit?to=2000-01-01", admin); !strings.Contains(body, "No entries.") {
+			t.Errorf("date filter: got %s", body)
+		}
+		for _, query := range []string{"action=unknown", "from=yesterday"} {
+			if status := get(t, server, "/admin/audit?"+query, admin).StatusCode; status != http.StatusBadRequest {
+				t.Errorf("%s: expected status code %d, got %d", query, http.StatusBadRequest, status)
+			}
+		}
+	})
+
+	t.Run("retention", func(t *testing.T) {
+		_, err := db.Exec("INSERT INTO audit_logs (action, created_at) VALUES ('login.failure', ?), ('login.failure', ?)",
+			time.Now().UTC().AddDate(0, 0, -91), time.Now().UTC().AddDate(0, 0, -89))
+		if err != nil {
+			t.Fatal(err)
+		}
+		postForm(t, server, "/login", url.Values{"username": {"nobody"}, "password": {"wrong"}})
+		if got := entries(t, "login.failure"); len(got) != 3 {
+			t.Errorf("expected the entry older than 90 days to be deleted, got %q", got)
+		}
+	})
+}
+
+func TestLikes(t *testing.T) {
+	server, db := newTestServerWithDB(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		Session: config.SessionConfig{
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+	})
+
+	admin := registerAndLogin(t, server, "admin")
+	reader := registerAndLogin(t, server, "reader")
+	first := postForm(t, server, "/articles", url.Values{"title": {"First"}, "content": {"text"}, "published": {"1"}}, admin).Header.Get("Location")
+	second := postForm(t, server, "/articles", url.Values{"title": {"Second"}, "content": {"text"}, "published": {"1"}}, admin).Header.Get("Location")
+	draft := postForm(t, server, "/articles", url.Values{"title": {"Draft"}, "content": {"text"}}, admin).Header.Get("Location")
+
+	// likeJSON posts the reaction as JSON and decodes the answer
+	likeJSON := func(t *testing.T, path, reaction string, cookie *http.Cookie) (int, map[string]any) {
+		t.Helper()
+		request, err := http.NewRequest("POST", server.URL+path, strings.NewReader(`{"reaction": "`+reaction+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Content-Type", "application/json")
+		request.AddCookie(cookie)
+		response, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		var body map[string]any
+		if response.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return response.StatusCode, body
+	}
+
+	t.Run("forms", func(t *testing.T) {
+		if status := postForm(t, server, first+"/like", nil).StatusCode; status != http.StatusUnauthorized {
+			t.Errorf("anonymous: expected status code %d, got %d", http.StatusUnauthorized, status)
+		}
+		response := postForm(t, server, first+"/like", url.Values{"reaction": {"like"}}, reader)
+		if response.StatusCode != http.StatusSeeOther || response.Header.Get("Location") != first+"#likes" {
+			t.Fatalf("like: got status code %d and location %s", response.StatusCode, response.Header.Get("Location"))
+		}
+		if _, body := getBody(t, server, first, reader); !strings.Contains(body, `title="Like" class="chosen">&#128077; 1<`) {
+			t.Errorf("expected the chosen like, got %s", body)
+		}
+		if _, body := getBody(t, server, first); !strings.Contains(body, "&#128077; 1 &#128078; 0") {
+			t.Errorf("anonymous: expected the counts, got %s", body)
+		}
+
+		// the same reaction again takes it back
+		postForm(t, server, first+"/like", url.Values{"reaction": {"like"}}, reader)
+		if _, body := getBody(t, server, first, reader); !strings.Contains(body, `title="Like">&#128077; 0<`) {
+			t.Errorf("expected no like, got %s", body)
+		}
+		if status := postForm(t, server, first+"/like", url.Values{"reaction": {"love"}}, reader).StatusCode; status != http.StatusBadRequest {
+			t.Errorf("unknown reaction: expected status code %d, got %d", http.StatusBadRequest, status)
+		}
+		if status := postForm(t, server, draft+"/like", nil, admin).StatusCode; status != http.StatusForbidden {
+			t.Errorf("draft: expected status code %d, got %d", http.StatusForbidden, status)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		status, body := likeJSON(t, first+"/like", "dislike", reader)
+		if status != http.StatusOK || body["reaction"] != "dislike" || body["likes"] != 0.0 || body["dislikes"] != 1.0 {
+			t.Errorf("dislike: got status code %d and %v", status, body)
+		}
+		// one reaction per user, a like replaces the dislike
+		status, body = likeJSON(t, first+"/like", "like", reader)
+		if status != http.StatusOK || body["reaction"] != "like" || body["likes"] != 1.0 || body["dislikes"] != 0.0 {
+			t.Errorf("like: got status code %d and %v", status, body)
+		}
+		_, err := db.Exec("INSERT INTO likes (type, user_id, article_id) SELECT 1, 2, id FROM articles WHERE slug = 'first'")
+		if err == nil {
+			t.Error("expected the unique index to reject a second reaction")
+		}
+	})
+
+	t.Run("comments", func(t *testing.T) {
+		postForm(t, server, first+"/comments", url.Values{"content": {"approved"}}, admin)
+		postForm(t, server, first+"/comments", url.Values{"author_name": {"Guest"}, "content": {"pending"}})
+		status, body := likeJSON(t, first+"/comments/1/like", "like", reader)
+		if status != http.StatusOK || body["reaction"] != "like" || body["likes"] != 1.0 {
+			t.Errorf("like comment: got status code %d and %v", status, body)
+		}
+		if _, body := getBody(t, server, first, reader); !strings.Contains(body, `action="/articles/first/comments/1/like"`) || !strings.Contains(body, `title="Like" class="chosen">&#128077; 1<`) {
+			t.Errorf("expected the like of the comment, got %s", body)
+		}
+		for _, path := range []string{first + "/comments/2/like", second + "/comments/1/like", first + "/comments/99/like"} {
+			if status, _ := likeJSON(t, path, "like", reader); status != http.StatusNotFound {
+				t.Errorf("%s: expected status code %d, got %d", path, http.StatusNotFound, status)
+			}
+		}
+		response := postForm(t, server, first+"/comments/1/like", nil, admin)
+		if response.StatusCode != http.StatusSeeOther || response.Header.Get("Location") != first+"#comment-1" {
+			t.Errorf("form: got status code %d and location %s", response.StatusCode, response.Header.Get("Location"))
+		}
+	})
+
+	t.Run("most liked", func(t *testing.T) {
+		likeJSON(t, second+"/like", "like", reader)
+		likeJSON(t, second+"/like", "like", admin)
+		_, body := getBody(t, server, "/popular")
+		firstAt, secondAt := strings.Index(body, `href="/articles/first"`), strings.Index(body, `href="/articles/second"`)
+		if firstAt < 0 || secondAt < 0 || secondAt > firstAt {
+			t.Errorf("expected second before first, got %s", body)
+		}
+		if !strings.Contains(body, "&#128077; 2 &#128078; 0") {
+			t.Errorf("expected the counts, got %s", body)
+		}
+	})
+}
+
+// apiResponse is the answer of a request to the JSON API
+type apiResponse struct {
+	Status int
+	Header http.Header
+	Body   map[string]any
+}
+
+// apiRequest sends body as JSON with the headers and decodes the answer, if there is one
+func apiRequest(t *testing.T, server *httptest.Server, method, path string, body any, header http.Header, cookies ...*http.Cookie) apiResponse {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequest(method, server.URL+path, reader)
+	if err != nil {
+		t.Fatalf("Error creating request: %v", err)
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	defer response.Body.Close()
+
+	result := apiResponse{Status: response.StatusCode, Header: response.Header}
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &result.Body); err != nil {
+			t.Fatalf("%s %s: decoding %q: %v", method, path, data, err)
+		}
+	}
+	return result
+}
+
+func TestAPIv1(t *testing.T) {
+	server := newTestServer(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		Session: config.SessionConfig{
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+	})
+
+	admin := registerAndLogin(t, server, "admin")
+	reader := registerAndLogin(t, server, "reader")
+	postForm(t, server, "/admin/categories", url.Values{"name": {"Go"}}, admin)
+	for _, title := range []string{"One", "Two", "Three"} {
+		postForm(t, server, "/articles", url.Values{"title": {title}, "content": {"text"}, "published": {"1"}}, admin)
+	}
+	postForm(t, server, "/articles", url.Values{"title": {"Draft"}, "content": {"text"}}, admin)
+	postForm(t, server, "/articles/one/comments", url.Values{"content": {"Nice"}}, admin)
+
+	t.Run("errors", func(t *testing.T) {
+		response := apiRequest(t, server, "GET", "/api/v1/articles/missing", nil, nil)
+		errorObject, _ := response.Body["error"].(map[string]any)
+		if response.Status != http.StatusNotFound || response.Header.Get("Content-Type") != "application/json" ||
+			errorObject["status"] != 404.0 || errorObject["code"] != "not_found" || errorObject["message"] != "Not Found" {
+			t.Errorf("missing: got status code %d, %s and %v", response.Status, response.Header.Get("Content-Type"), response.Body)
+		}
+		if response := apiRequest(t, server, "GET", "/api/v1/nothing", nil, nil); response.Status != http.StatusNotFound || response.Body["error"] == nil {
+			t.Errorf("unknown route: got status code %d and %v", response.Status, response.Body)
+		}
+		response = apiRequest(t, server, "GET", "/api/v1/articles", nil, http.Header{"Accept": {"text/html"}})
+		if response.Status != http.StatusNotAcceptable || response.Body["error"] == nil {
+			t.Errorf("html: got status code %d and %v", response.Status, response.Body)
+		}
+		for _, accept := range []string{"*/*", "application/*", "text/html;q=0.9, application/json"} {
+			if response := apiRequest(t, server, "GET", "/api/v1/articles", nil, http.Header{"Accept": {accept}}); response.Status != http.StatusOK {
+				t.Errorf("%s: expected status code %d, got %d", accept, http.StatusOK, response.Status)
+			}
+		}
+		if response := apiRequest(t, server, "GET", "/api/v1/users/me", nil, nil); response.Status != http.StatusUnauthorized {
+			t.Errorf("anonymous: expected status code %d, got %d", http.StatusUnauthorized, response.Status)
+		}
+		if response := apiRequest(t, server, "GET", "/api/v1/users", nil, nil, reader); response.Status != http.StatusForbidden {
+			t.Errorf("users: expected status code %d, got %d", http.StatusForbidden, response.Status)
+		}
+		if response := apiRequest(t, server, "GET", "/api/v1/articles?cursor=nonsense", nil, nil); response.Status != http.StatusBadRequest {
+			t.Errorf("cursor: expected status code %d, got %d", http.StatusBadRequest, response.Status)
+		}
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		var titles []any
+		path := "/api/v1/articles?limit=2&fields=title"
+		for page := 0; path != ""; page++ {
+			response := apiRequest(t, server, "GET", path, nil, nil)
+			if response.Status != http.StatusOK || page > 2 {
+				t.Fatalf("%s: got status code %d and %v", path, response.Status, response.Body)
+			}
+			for _, item := range response.Body["data"].([]any) {
+				if len(item.(map[string]any)) != 1 {
+					t.Errorf("expected only the title, got %v", item)
+				}
+				titles = append(titles, item.(map[string]any)["title"])
+			}
+			path = ""
+			if cursor, ok := response.Body["next_cursor"].(string); ok {
+				path = "/api/v1/articles?limit=2&fields=title&cursor=" + cursor
+			}
+		}
+		if fmt.Sprint(titles) != "[Three Two One]" {
+			t.Errorf("anonymous: expected the published articles newest first, got %v", titles)
+		}
+
+		response := apiRequest(t, server, "GET", "/api/v1/articles?fields=slug", nil, nil, admin)
+		if len(response.Body["data"].([]any)) != 4 {
+			t.Errorf("admin: expected the draft too, got %v", response.Body)
+		}
+		response = apiRequest(t, server, "GET", "/api/v1/articles/one/comments", nil, nil)
+		if data, _ := response.Body["data"].([]any); len(data) != 1 || data[0].(map[string]any)["content"] != "Nice" {
+			t.Errorf("comments: got %v", response.Body)
+		}
+		response = apiRequest(t, server, "GET", "/api/v1/categories", nil, nil)
+		if data, _ := response.Body["data"].([]any); len(data) != 1 || data[0].(map[string]any)["slug"] != "go" {
+			t.Errorf("categories: got %v", response.Body)
+		}
+		var usernames []any
+		path = "/api/v1/users?limit=1&fields=username"
+		for page := 0; path != ""; page++ {
+			response := apiRequest(t, server, "GET", path, nil, nil, admin)
+			if response.Status != http.StatusOK || page > 2 {
+				t.Fatalf("%s: got status code %d and %v", path, response.Status, response.Body)
+			}
+			for _, item := range response.Body["data"].([]any) {
+				usernames = append(usernames, item.(map[string]any)["username"])
+			}
+			path = ""
+			if cursor, ok := response.Body["next_cursor"].(string); ok {
+				path = "/api/v1/users?limit=1&fields=username&cursor=" + cursor
+			}
+		}
+		if fmt.Sprint(usernames) != "[reader admin]" {
+			t.Errorf("users: expected the newest first, got %v", usernames)
+		}
+		response = apiRequest(t, server, "GET", "/api/v1/users/me?fields=username,email", nil, nil, reader)
+		if response.Body["username"] != "reader" || response.Body["email"] != "reader@test.com" || len(response.Body) != 2 {
+			t.Errorf("me: got %v", response.Body)
+		}
+	})
+
+	t.Run("articles", func(t *testing.T) {
+		input := map[string]any{"title": "From the API", "content": "text", "published": true, "categories": []int{1, 99}, "tags": []string{"json", "JSON"}}
+		if response := apiRequest(t, server, "POST", "/api/v1/articles", input, nil, reader); response.Status != http.StatusForbidden {
+			t.Errorf("reader: expected status code %d, got %d", http.StatusForbidden, response.Status)
+		}
+		response := postForm(t, server, "/api/v1/articles", url.Values{"title": {"Form"}, "content": {"text"}}, admin)
+		if response.StatusCode != http.StatusUnsupportedMediaType {
+			t.Errorf("form: expected status code %d, got %d", http.StatusUnsupportedMediaType, response.StatusCode)
+		}
+
+		created := apiRequest(t, server, "POST", "/api/v1/articles", input, nil, admin)
+		if created.Status != http.StatusCreated || created.Header.Get("Location") != "/api/v1/articles/from-the-api" || created.Header.Get("ETag") == "" {
+			t.Fatalf("create: got status code %d, headers %v and %v", created.Status, created.Header, created.Body)
+		}
+		if len(created.Body["categories"].([]any)) != 1 || len(created.Body["tags"].([]any)) != 1 || created.Body["published_at"] == nil {
+			t.Errorf("create: got %v", created.Body)
+		}
+		etag := created.Header.Get("ETag")
+		if got := apiRequest(t, server, "GET", "/api/v1/articles/from-the-api", nil, nil); got.Header.Get("ETag") != etag {
+			t.Errorf("get: expected the ETag %s, got %s", etag, got.Header.Get("ETag"))
+		}
+		if response := apiRequest(t, server, "POST", "/api/v1/articles", map[string]any{"title": "Bad", "unknown": 1}, nil, admin); response.Status != http.StatusBadRequest {
+			t.Errorf("unknown field: expected status code %d, got %d", http.StatusBadRequest, response.Status)
+		}
+
+		update := map[string]any{"title": "Changed", "slug": "from-the-api", "content": "new text", "published": true}
+		if response := apiRequest(t, server, "PUT", "/api/v1/articles/from-the-api", update, nil, admin); response.Status != http.StatusPreconditionRequired {
+			t.Errorf("without If-Match: expected status code %d, got %d", http.StatusPreconditionRequired, response.Status)
+		}
+		updated := apiRequest(t, server, "PUT", "/api/v1/articles/from-the-api", update, http.Header{"If-Match": {etag}}, admin)
+		if updated.Status != http.StatusOK || updated.Body["title"] != "Changed" || len(updated.Body["tags"].([]any)) != 0 || updated.Header.Get("ETag") == etag {
+			t.Fatalf("update: got status code %d and %v", updated.Status, updated.Body)
+		}
+		// the old ETag is outdated now
+		if response := apiRequest(t, server, "PUT", "/api/v1/articles/from-the-api", update, http.Header{"If-Match": {etag}}, admin); response.Status != http.StatusPreconditionFailed {
+			t.Errorf("outdated If-Match: expected status code %d, got %d", http.StatusPreconditionFailed, response.Status)
+		}
+		if response := apiRequest(t, server, "PUT", "/api/v1/articles/from-the-api", update, http.Header{"If-Match": {updated.Header.Get("ETag")}}, admin); response.Status != http.StatusOK {
+			t.Errorf("current If-Match: expected status code %d, got %d", http.StatusOK, response.Status)
+		}
+
+		// of concurrent updates with the same ETag only one may win
+		current := apiRequest(t, server, "GET", "/api/v1/articles/from-the-api", nil, nil).Header.Get("ETag")
+		statuses := make(chan int, 8)
+		var wg sync.WaitGroup
+		for i := range cap(statuses) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				body := fmt.Sprintf(`{"title": "Concurrent %d", "slug": "from-the-api", "content": "text %d", "published": true}`, i, i)
+				request, err := http.NewRequest("PUT", server.URL+"/api/v1/articles/from-the-api", strings.NewReader(body))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				request.Header.Set("Content-Type", "application/json")
+				request.Header.Set("If-Match", current)
+				request.AddCookie(admin)
+				response, err := server.Client().Do(request)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				response.Body.Close()
+				statuses <- response.StatusCode
+			}()
+		}
+		wg.Wait()
+		close(statuses)
+		won := 0
+		for status := range statuses {
+			switch status {
+			case http.StatusOK:
+				won++
+			case http.StatusPreconditionFailed:
+			default:
+				t.Errorf("concurrent update: expected status code %d or %d, got %d", http.StatusOK, http.StatusPreconditionFailed, status)
+			}
+		}
+		if won != 1 {
+			t.Errorf("concurrent update: expected 1 update to succeed, got %d", won)
+		}
+
+		if response := apiRequest(t, server, "DELETE", "/api/v1/articles/from-the-api", nil, nil, reader); response.Status != http.StatusForbidden {
+			t.Errorf("reader delete: expected status code %d, got %d", http.StatusForbidden, response.Status)
+		}
+		if response := apiRequest(t, server, "DELETE", "/api/v1/articles/from-the-api", nil, nil, admin); response.Status != http.StatusNoContent {
+			t.Errorf("delete: expected status code %d, got %d", http.StatusNoContent, response.Status)
+		}
+		if response := apiRequest(t, server, "GET", "/api/v1/articles/from-the-api", nil, nil); response.Status != http.StatusNotFound {
+			t.Errorf("deleted: expected status code %d, got %d", http.StatusNotFound, response.Status)
+		}
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		created := apiRequest(t, server, "POST", "/api/v1/pages", map[string]any{"title": "About", "content": "me", "published": false}, nil, admin)
+		if created.Status != http.StatusCreated || created.Body["slug"] != "about" {
+			t.Fatalf("create: got status code %d and %v", created.Status, created.Body)
+		}
+		if response := apiRequest(t, server, "GET", "/api/v1/pages/about", nil, nil); response.Status != http.StatusNotFound {
+			t.Errorf("draft: expected status code %d, got %d", http.StatusNotFound, response.Status)
+		}
+		update := map[string]any{"title": "About", "content": "me", "published": true, "menu_order": 1}
+		if response := apiRequest(t, server, "PUT", "/api/v1/pages/about", update, http.Header{"If-Match": {"*"}}, admin); response.Status != http.StatusOK {
+			t.Errorf("update: expected status code %d, got %d", http.StatusOK, response.Status)
+		}
+		response := apiRequest(t, server, "GET", "/api/v1/pages", nil, nil)
+		if data, _ := response.Body["data"].([]any); len(data) != 1 || data[0].(map[string]any)["menu_order"] != 1.0 {
+			t.Errorf("list: got %v", response.Body)
+		}
+		if response := apiRequest(t, server, "DELETE", "/api/v1/pages/about", nil, nil, admin); response.Status != http.StatusNoContent {
+			t.Errorf("delete: expected status code %d, got %d", http.StatusNoContent, response.Status)
+		}
+	})
+}
+
+func TestAPITokens(t *testing.T) {
+	server, db := newTestServerWithDB(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		Session: config.SessionConfig{
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+	})
+
+	admin := registerAndLogin(t, server, "admin")
+	reader := registerAndLogin(t, server, "reader")
+	tokenPattern := regexp.MustCompile(`<code>(blog_[A-Za-z0-9_-]+)</code>`)
+
+	// createToken creates a token with the form and returns it from the answer
+	createToken := func(t *testing.T, values url.Values, cookie *http.Cookie) string {
+		t.Helper()
+		request, err := http.NewRequest("POST", server.URL+"/account/tokens", strings.NewReader(values.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.AddCookie(cookie)
+		response, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		match := tokenPattern.FindSubmatch(body)
+		if response.StatusCode != http.StatusOK || match == nil {
+			t.Fatalf("create token: got status code %d and %s", response.StatusCode, body)
+		}
+		if response.Header.Get("Cache-Control") != "no-store" {
+			t.Errorf("create token: expected Cache-Control no-store, got %q", response.Header.Get("Cache-Control"))
+		}
+		return string(match[1])
+	}
+	bearer := func(token string) http.Header {
+		return http.Header{"Authorization": {"Bearer " + token}}
+	}
+
+	publish := createToken(t, url.Values{"name": {"CI"}, "permissions": {"article.create", "article.publish"}, "expires_days": {"30"}}, admin)
+
+	t.Run("scopes", func(t *testing.T) {
+		response := apiRequest(t, server, "GET", "/api/v1/users/me", nil, bearer(publish))
+		if response.Status != http.StatusOK || response.Body["username"] != "admin" {
+			t.Fatalf("me: got status code %d and %v", response.Status, response.Body)
+		}
+		created := apiRequest(t, server, "POST", "/api/v1/articles", map[string]any{"title": "From CI", "content": "text", "published": true}, bearer(publish))
+		if created.Status != http.StatusCreated || created.Body["published"] != true {
+			t.Errorf("create article: got status code %d and %v", created.Status, created.Body)
+		}
+		// the admin may edit pages, the token may not
+		if response := apiRequest(t, server, "POST", "/api/v1/pages", map[string]any{"title": "About", "content": "me"}, bearer(publish)); response.Status != http.StatusForbidden {
+			t.Errorf("create page: expected status code %d, got %d", http.StatusForbidden, response.Status)
+		}
+		// a token could create another one with more permissions
+		request, err := http.NewRequest("GET", server.URL+"/account/tokens", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header = bearer(publish)
+		tokensPage, err := server.Client().Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokensPage.Body.Close()
+		if tokensPage.StatusCode != http.StatusForbidden {
+			t.Errorf("tokens page: expected status code %d, got %d", http.StatusForbidden, tokensPage.StatusCode)
+		}
+
+		// a reader can't grant a token more than their role has
+		if status := postForm(t, server, "/account/tokens", url.Values{"name": {"Sneaky"}, "permissions": {"user.manage"}}, reader).StatusCode; status != http.StatusBadRequest {
+			t.Errorf("reader: expected status code %d, got %d", http.StatusBadRequest, status)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, header := range []string{"Bearer blog_unknown", "Basic YWRtaW46YWRtaW4=", "Bearer " + publish + "x"} {
+			response := apiRequest(t, server, "GET", "/api/v1/articles", nil, http.Header{"Authorization": {header}})
+			if response.Status != http.StatusUnauthorized || response.Header.Get("WWW-Authenticate") == "" || response.Body["error"] == nil {
+				t.Errorf("%s: got status code %d, %v and %v", header, response.Status, response.Header, response.Body)
+			}
+		}
+
+		expiring := createToken(t, url.Values{"name": {"Expiring"}, "expires_days": {"1"}}, reader)
+		if response := apiRequest(t, server, "GET", "/api/v1/users/me", nil, bearer(expiring)); response.Status != http.StatusOK {
+			t.Errorf("before expiry: expected status code %d, got %d", http.StatusOK, response.Status)
+		}
+		_, err := db.Exec("UPDATE api_tokens SET expires_at = ? WHERE name = 'Expiring'", time.Now().UTC().Add(-time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response := apiRequest(t, server, "GET", "/api/v1/users/me", nil, bearer(expiring)); response.Status != http.StatusUnauthorized {
+			t.Errorf("expired: expected status code %d, got %d", http.StatusUnauthorized, response.Status)
+		}
+	})
+
+	t.Run("tracking and revoking", func(t *testing.T) {
+		var hash string
+		var lastUsed sql.NullTime
+		err := db.QueryRow("SELECT hash, last_used_at FROM api_tokens WHERE name = 'CI'").Scan(&hash, &lastUsed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(hash, publish) || !lastUsed.Valid {
+			t.Errorf("expected the hash and the last use to be stored, got %q and %v", hash, lastUsed)
+		}
+		_, body := getBody(t, server, "/account/tokens", admin)
+		if !strings.Contains(body, "CI") || strings.Contains(body, publish) || !strings.Contains(body, "article.create, article.publish") {
+			t.Errorf("expected the token without its secret, got %s", body)
+		}
+
+		// tokens of other users are not found
+		if status := postForm(t, server, "/account/tokens/1/delete", nil, reader).StatusCode; status != http.StatusNotFound {
+			t.Errorf("other user: expected status code %d, got %d", http.StatusNotFound, status)
+		}
+		if status := postForm(t, server, "/account/tokens/1/delete", nil, admin).StatusCode; status != http.StatusSeeOther {
+			t.Errorf("revoke: expected status code %d, got %d", http.StatusSeeOther, status)
+		}
+		if response := apiRequest(t, server, "GET", "/api/v1/users/me", nil, bearer(publish)); response.Status != http.StatusUnauthorized {
+			t.Errorf("revoked: expected status code %d, got %d", http.StatusUnauthorized, response.Status)
+		}
+		var actions []string
+		rows, err := db.Query("SELECT action FROM audit_logs WHERE action LIKE 'token.%' ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var action string
+			rows.Scan(&action)
+			actions = append(actions, action)
+		}
+		if fmt.Sprint(actions) != "[token.create token.create token.revoke]" {
+			t.Errorf("expected the audit entries, got %v", actions)
+		}
+	})
+}
+
+func TestMarkdown(t *testing.T) {
+	server, db := newTestServerWithDB(t, config.Config{
+		IPRateLimit:    rate.Inf,
+		BurstRateLimit: 1,
+		Session: config.SessionConfig{
+			CookieName:      "session",
+			IdleTimeout:     time.Hour,
+			AbsoluteTimeout: 24 * time.Hour,
+		},
+	})
+
+	admin := registerAndLogin(t, server, "admin")
+	content := "## Intro\n\nSome **bold** text.<script>alert(1)</script>\n\n## Details\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\n- [x] done\n\nA note[^1].\n\n[^1]: The note.\n"
+	values := url.Values{"title": {"Markdown"}, "content": {content}, "published": {"1"}}
+	if status := postForm(t, server, "/articles", values, admin).StatusCode; status != http.StatusSeeOther {
+		t.Fatalf("create: expected status code %d, got %d", http.StatusSeeOther, status)
+	}
+
+	check := func(t *testing.T) {
+		t.Helper()
+		status, body := getBody(t, server, "/articles/markdown")
+		if status != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, status)
+		}
+		for _, want := range []string{
+			`<h2 id="section-intro">Intro <a href="#section-intro" class="anchor"`,
+			`<strong>bold</strong>`,
+			`<table>`,
+			`<input checked="" disabled="" type="checkbox">`,
+			`<sup id="fnref:1">`,
+			`<nav class="toc" aria-label="Contents"><strong>Contents</strong><ul><li><a href="#section-intro">Intro</a></li><li><a href="#section-details">Details</a></li></ul></nav>`,
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("expected %s in the article", want)
+			}
+		}
+		if strings.Contains(body, "alert(1)") {
+			t.Error("expected the script to be removed")
+		}
+	}
+
+	t.Run("rendered when saved", func(t *testing.T) {
+		var html string
+		var version int
+		err := db.QueryRow("SELECT content_html, html_version FROM articles WHERE slug = 'markdown'").Scan(&html, &version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(html, "<strong>bold</strong>") || version != markdown.Version {
+			t.Errorf("expected the stored HTML of version %d, got version %d: %s", markdown.Version, version, html)
+		}
+		check(t)
+	})
+
+	t.Run("rendered again for an older renderer", func(t *testing.T) {
+		_, err := db.Exec("UPDATE articles SET content_html = '', toc_html = '', html_version = 0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t)
+
+		var version int
+		err = db.QueryRow("SELECT html_version FROM articles WHERE slug = 'markdown'").Scan(&version)
+		if err != nil || version != markdown.Version {
+			t.Errorf("expected the HTML to be stored again, got version %d, %v", version, err)
+		}
+	})
+}
+
+// TestOpenAPI checks that the OpenAPI document describes every route of the API and nothing else
+func TestOpenAPI(t *testing.T) {
+	mux, _ := newTestRouter(t, config.Config{IPRateLimit: rate.Inf}, os.Stdout)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	response := apiRequest(t, server, "GET", "/api/openapi.json", nil, nil)
+	if response.Status != http.StatusOK || response.Body["openapi"] != "3.1.0" {
+		t.Fatalf("Expected an OpenAPI 3.1 document, got %d %v", response.Status, response.Body["openapi"])
+	}
+	paths, _ := response.Body["paths"].(map[string]any)
+
+	registered := make(map[string]bool)
+	for _, pattern := range mux.patterns {
+		method, path, ok := strings.Cut(pattern, " ")
+		if !ok || !strings.HasPrefix(path, "/api/") || path == "/api/openapi.json" {
+			continue
+		}
+		registered[method+" "+path] = true
+		operations, _ := paths[path].(map[string]any)
+		if _, ok := operations[strings.ToLower(method)]; !ok {
+			t.Errorf("The route %s has no entry in the OpenAPI document", pattern)
+		}
+	}
+	if len(registered) == 0 {
+		t.Fatal("Expected API routes")
+	}
+
+	for path, operations := range paths {
+		for method, operation := range operations.(map[string]any) {
+			if !registered[strings.ToUpper(method)+" "+path] {
+				t.Errorf("The OpenAPI document describes %s %s without a route", strings.ToUpper(method), path)
+			}
+			for status, value := range operation.(map[string]any)["responses"].(map[string]any) {
+				content, _ := value.(map[string]any)["content"].(map[string]any)
+				for _, media := range content {
+					ref, _ := media.(map[string]any)["schema"].(map[string]any)["$ref"].(string)
+					name := strings.TrimPrefix(ref, "#/components/schemas/")
+					if ref != "" && componentSchema(response.Body, name) == nil {
+						t.Errorf("%s %s %s refers to the missing schema %s", method, path, status, ref)
+					}
+				}
+			}
+		}
+	}
+
+	article := componentSchema(response.Body, "Article")
+	if article == nil {
+		t.Fatal("Expected the schema Article")
+	}
+	if required, _ := article["required"].([]any); !slices.Contains(required, any("title")) || !slices.Contains(required, any("published_at")) {
+		t.Errorf("Expected title and published_at to be required, got %v", required)
+	}
+	input := paths["/api/v1/articles"].(map[string]any)["post"].(map[string]any)["requestBody"]
+	if input == nil {
+		t.Error("Expected a request body for creating articles")
+	}
+}
+
+// componentSchema returns the component schema of the OpenAPI document with the name
+func componentSchema(doc map[string]any, name string) map[string]any {
+	components, _ := doc["components"].(map[string]any)
+	schemas, _ := components["schemas"].(map[string]any)
+	schema, _ := schemas[name].(map[string]any)
+	return schema
+}
@@ -0,0 +1,48 @@
+// Package cache keeps values that are expensive to load until they are invalidated
+package cache
+
+import "sync"
+
+// Map keeps loaded values by key until Invalidate, the zero value is ready to use.
+// Values are loaded without holding the lock, so a value whose load started before
+// an Invalidate may be outdated. It is returned to its caller, but not kept.
+type Map[K comparable, V any] struct {
+	mu         sync.RWMutex
+	values     map[K]V
+	generation uint64 // counts the calls of Invalidate
+}
+
+// Get returns the value of key, it is loaded if it isn't kept yet
+func (m *Map[K, V]) Get(key K, load func() (V, error)) (V, error) {
+	m.mu.RLock()
+	value, ok := m.values[key]
+	generation := m.generation
+	m.mu.RUnlock()
+	if ok {
+		return value, nil
+	}
+
+	value, err := load()
+	if err != nil {
+		return value, err
+	}
+
+	m.mu.Lock()
+	if m.generation == generation {
+		if m.values == nil {
+			m.values = make(map[K]V)
+		}
+		m.values[key] = value
+	}
+	m.mu.Unlock()
+
+	return value, nil
+}
+
+// Invalidate drops all values
+func (m *Map[K, V]) Invalidate() {
+	m.mu.Lock()
+	m.values = nil
+	m.generation++
+	m.mu.Unlock()
+}
@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMap(t *testing.T) {
+	var m Map[string, int]
+	loads := 0
+	load := func() (int, error) {
+		loads++
+		return loads, nil
+	}
+
+	if v, err := m.Get("a", load); v != 1 || err != nil {
+		t.Errorf("first Get: expected 1, got %d, %v", v, err)
+	}
+	if v, _ := m.Get("a", load); v != 1 {
+		t.Errorf("second Get: expected the kept 1, got %d", v)
+	}
+
+	m.Invalidate()
+	if v, _ := m.Get("a", load); v != 2 {
+		t.Errorf("Get after Invalidate: expected 2, got %d", v)
+	}
+
+	// a value loaded while Invalidate is called is returned, but not kept
+	m.Invalidate()
+	stale := func() (int, error) {
+		m.Invalidate()
+		return load()
+	}
+	if v, _ := m.Get("a", stale); v != 3 {
+		t.Errorf("stale Get: expected 3, got %d", v)
+	}
+	if v, _ := m.Get("a", load); v != 4 {
+		t.Errorf("Get after stale Get: expected 4, got %d", v)
+	}
+
+	// errors are not kept
+	failed := errors.New("failed")
+	if _, err := m.Get("b", func() (int, error) { return 0, failed }); err != failed {
+		t.Errorf("expected the error of load, got %v", err)
+	}
+	if v, _ := m.Get("b", load); v != 5 {
+		t.Errorf("Get after error: expected 5, got %d", v)
+	}
+}
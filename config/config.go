@@ -1,6 +1,7 @@
 package config
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log/slog"
@@ -8,6 +9,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/time/rate"
 	"gopkg.in/yaml.v3"
@@ -20,6 +22,62 @@ type DatabaseConfig struct {
 	LogQueries bool   `yaml:"log_queries"`
 }
 
+type SessionConfig struct {
+	Secret          Secret        `yaml:"secret"`
+	CookieName      string        `yaml:"cookie_name"`
+	SecureCookie    bool          `yaml:"secure_cookie"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	AbsoluteTimeout time.Duration `yaml:"absolute_timeout"`
+}
+
+type MailConfig struct {
+	Driver   string `yaml:"driver"` // smtp, file or stdout
+	From     string `yaml:"from"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password Secret `yaml:"password"`
+	Dir      string `yaml:"dir"` // directory of the file driver
+}
+
+type AccountsConfig struct {
+	RequireVerifiedEmail bool          `yaml:"require_verified_email"`
+	VerificationTTL      time.Duration `yaml:"verification_ttl"`
+	PasswordResetTTL     time.Duration `yaml:"password_reset_ttl"`
+}
+
+// PasswordConfig holds the argon2id parameters for new password hashes.
+// Existing hashes with other parameters are rehashed on the next login.
+type PasswordConfig struct {
+	Memory      uint32 `yaml:"memory"` // in KiB
+	Iterations  uint32 `yaml:"iterations"`
+	Parallelism uint8  `yaml:"parallelism"`
+	SaltLength  uint32 `yaml:"salt_length"`
+	KeyLength   uint32 `yaml:"key_length"`
+}
+
+// MediaConfig holds where uploads are stored and how large they may be
+type MediaConfig struct {
+	Dir         string        `yaml:"dir"`
+	MaxSize     int64         `yaml:"max_size"`     // in bytes
+	Timeout     time.Duration `yaml:"timeout"`      // for uploading and downloading a file
+	ImageWidths []int         `yaml:"image_widths"` // resized versions of uploaded images, narrower than the original
+}
+
+// Secret is a string that is never printed, so it does not end up in the logs
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
 type Config struct {
 	LogLevel         *slog.LevelVar `yaml:"log_level"`
 	Port             int            `yaml:"port"`
@@ -27,6 +85,13 @@ type Config struct {
 	ErrorsInResponse bool           `yaml:"errors_in_response"`
 	IPRateLimit      rate.Limit     `yaml:"ip_rate_limit"`
 	BurstRateLimit   int            `yaml:"burst_rate_limit"`
+	Session          SessionConfig  `yaml:"session"`
+	BaseURL          string         `yaml:"base_url"` // used for links in emails and feeds
+	Mail             MailConfig     `yaml:"mail"`
+	Accounts         AccountsConfig `yaml:"accounts"`
+	Password         PasswordConfig `yaml:"password"`
+	Media            MediaConfig    `yaml:"media"`
+	StaticDir        string         `yaml:"static_dir"` // templates and assets from disk instead of the built-in ones
 }
 
 // 1. Load defaults
@@ -48,6 +113,36 @@ func LoadConfig() (*Config, error) {
 		ErrorsInResponse: false,
 		IPRateLimit:      10,
 		BurstRateLimit:   20,
+		Session: SessionConfig{
+			CookieName:      "session",
+			SecureCookie:    false,
+			IdleTimeout:     7 * 24 * time.Hour,
+			AbsoluteTimeout: 30 * 24 * time.Hour,
+		},
+		BaseURL: "http://localhost:8080",
+		Mail: MailConfig{
+			Driver: "stdout",
+			From:   "blog@localhost",
+			Port:   587,
+		},
+		Accounts: AccountsConfig{
+			RequireVerifiedEmail: false,
+			VerificationTTL:      48 * time.Hour,
+			PasswordResetTTL:     time.Hour,
+		},
+		Password: PasswordConfig{
+			Memory:      64 * 1024,
+			Iterations:  1,
+			Parallelism: 4,
+			SaltLength:  16,
+			KeyLength:   32,
+		},
+		Media: MediaConfig{
+			Dir:         "./media",
+			MaxSize:     10 << 20,
+			Timeout:     5 * time.Minute,
+			ImageWidths: []int{320, 640, 1024, 1600},
+		},
 	}
 
 	path := checkConfigPath("config.yaml")
@@ -183,6 +278,102 @@ func loadConfigEnv(config *Config) (*Config, error) {
 		}
 	}
 
+	if envVal := os.Getenv("SESSION_SECRET"); envVal != "" {
+		config.Session.Secret = Secret(envVal)
+	}
+
+	if envVal := os.Getenv("SESSION_SECURE_COOKIE"); envVal != "" {
+		config.Session.SecureCookie, err = strconv.ParseBool(envVal)
+		if err != nil {
+			return nil, fmt.Errorf("loadConfigEnv: Error parsing session secure cookie: %w", err)
+		}
+	}
+
+	if envVal := os.Getenv("SESSION_IDLE_TIMEOUT"); envVal != "" {
+		config.Session.IdleTimeout, err = time.ParseDuration(envVal)
+		if err != nil {
+			return nil, fmt.Errorf("loadConfigEnv: Error parsing session idle timeout: %w", err)
+		}
+	}
+
+	if envVal := os.Getenv("SESSION_ABSOLUTE_TIMEOUT"); envVal != "" {
+		config.Session.AbsoluteTimeout, err = time.ParseDuration(envVal)
+		if err != nil {
+			return nil, fmt.Errorf("loadConfigEnv: Error parsing session absolute timeout: %w", err)
+		}
+	}
+
+	if envVal := os.Getenv("BASE_URL"); envVal != "" {
+		config.BaseURL = envVal
+	}
+
+	if envVal := os.Getenv("MAIL_DRIVER"); envVal != "" {
+		if envVal != "smtp" && envVal != "file" && envVal != "stdout" {
+			return nil, fmt.Errorf("loadConfigEnv: Invalid mail driver: %s", envVal)
+		}
+		config.Mail.Driver = envVal
+	}
+
+	if envVal := os.Getenv("MAIL_FROM"); envVal != "" {
+		config.Mail.From = envVal
+	}
+
+	if envVal := os.Getenv("MAIL_HOST"); envVal != "" {
+		config.Mail.Host = envVal
+	}
+
+	if envVal := os.Getenv("MAIL_PORT"); envVal != "" {
+		config.Mail.Port, err = strconv.Atoi(envVal)
+		if err != nil {
+			return nil, fmt.Errorf("loadConfigEnv: Error parsing mail port: %w", err)
+		}
+	}
+
+	if envVal := os.Getenv("MAIL_USERNAME"); envVal != "" {
+		config.Mail.Username = envVal
+	}
+
+	if envVal := os.Getenv("MAIL_PASSWORD"); envVal != "" {
+		config.Mail.Password = Secret(envVal)
+	}
+
+	if envVal := os.Getenv("MAIL_DIR"); envVal != "" {
+		config.Mail.Dir = envVal
+	}
+
+	if envVal := os.Getenv("REQUIRE_VERIFIED_EMAIL"); envVal != "" {
+		config.Accounts.RequireVerifiedEmail, err = strconv.ParseBool(envVal)
+		if err != nil {
+			return nil, fmt.Errorf("loadConfigEnv: Error parsing require verified email: %w", err)
+		}
+	}
+
+	if envVal := os.Getenv("STATIC_DIR"); envVal != "" {
+		config.StaticDir = envVal
+	}
+
+	if envVal := os.Getenv("MEDIA_DIR"); envVal != "" {
+		config.Media.Dir = envVal
+	}
+
+	if envVal := os.Getenv("MEDIA_MAX_SIZE"); envVal != "" {
+		config.Media.MaxSize, err = strconv.ParseInt(envVal, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("loadConfigEnv: Error parsing media max size: %w", err)
+		}
+	}
+
+	if envVal := os.Getenv("MEDIA_IMAGE_WIDTHS"); envVal != "" {
+		config.Media.ImageWidths = nil
+		for _, field := range strings.Split(envVal, ",") {
+			width, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || width < 1 {
+				return nil, fmt.Errorf("loadConfigEnv: Error parsing media image widths: %q", field)
+			}
+			config.Media.ImageWidths = append(config.Media.ImageWidths, width)
+		}
+	}
+
 	return config, nil
 }
 
@@ -196,6 +387,8 @@ func loadConfigFlags(config *Config) *Config {
 	flag.BoolVar(&config.Database.Reset, "database-reset", config.Database.Reset, "Reset database")
 	flag.BoolVar(&config.Database.LogQueries, "database-log-queries", config.Database.LogQueries, "Log database queries")
 	flag.BoolVar(&config.ErrorsInResponse, "errors-in-response", config.ErrorsInResponse, "Include errors in response")
+	flag.StringVar(&config.StaticDir, "static-dir", config.StaticDir, "Serve templates and assets from this directory, like ./static")
+	flag.BoolVar(&config.Accounts.RequireVerifiedEmail, "require-verified-email", config.Accounts.RequireVerifiedEmail, "Block login until the email is verified")
 
 	flag.Parse()
 
@@ -0,0 +1,292 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations contains the numbered migrations of the blog schema,
+// named <version>_<name>.up.sql and <version>_<name>.down.sql
+var Migrations, _ = fs.Sub(migrationFiles, "migrations")
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    checksum TEXT NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+)`
+
+// ErrUnversionedSchema is returned by Up for a database that already has tables but no applied migrations,
+// like one created by tables.sql before there were migrations. Its tables lack columns of the initial
+// migration, which would skip them because of IF NOT EXISTS.
+var ErrUnversionedSchema = errors.New("database has tables but no applied migrations, start with a new database")
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // sha256 of Up
+}
+
+// MigrationStatus is a migration as known by the files and the database.
+// State is one of "pending", "applied", "modified" (the file changed after it was applied)
+// or "missing" (applied, but the file is gone).
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	State     string
+	AppliedAt time.Time
+}
+
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// Migrator applies and reverts migrations, each in its own transaction
+type Migrator struct {
+	logger     *slog.Logger
+	db         *sql.DB
+	migrations []Migration
+}
+
+func NewMigrator(logger *slog.Logger, db *sql.DB, files fs.FS) (*Migrator, error) {
+	migrations, err := loadMigrations(files)
+	if err != nil {
+		return nil, fmt.Errorf("NewMigrator: %w", err)
+	}
+	return &Migrator{logger: logger, db: db, migrations: migrations}, nil
+}
+
+func loadMigrations(files fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, fmt.Errorf("loadMigrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("loadMigrations: %w", err)
+		}
+		content, err := fs.ReadFile(files, path.Clean(entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("loadMigrations: %w", err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("loadMigrations: version %d is used by %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("loadMigrations: migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]appliedMigration, error) {
+	_, err := m.db.ExecContext(ctx, createMigrationsTable)
+	if err != nil {
+		return nil, fmt.Errorf("applied: %w", err)
+	}
+
+	rows, err := m.db.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("applied: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		err = rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt)
+		if err != nil {
+			return nil, fmt.Errorf("applied: %w", err)
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// Status lists all migrations known by the files or the database
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Status: %w", err)
+	}
+
+	var status []MigrationStatus
+	for _, migration := range m.migrations {
+		s := MigrationStatus{Version: migration.Version, Name: migration.Name, State: "pending"}
+		if a, ok := applied[migration.Version]; ok {
+			s.AppliedAt = a.appliedAt
+			s.State = "applied"
+			if a.checksum != migration.Checksum {
+				s.State = "modified"
+			}
+			delete(applied, migration.Version)
+		}
+		status = append(status, s)
+	}
+	for version, a := range applied {
+		status = append(status, MigrationStatus{Version: version, Name: a.name, State: "missing", AppliedAt: a.appliedAt})
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Version < status[j].Version })
+
+	return status, nil
+}
+
+// Verify fails if an applied migration was changed or removed after it was applied
+func (m *Migrator) Verify(ctx context.Context) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("Verify: %w", err)
+	}
+	for _, s := range status {
+		if s.State == "modified" || s.State == "missing" {
+			return fmt.Errorf("Verify: migration %d_%s is %s", s.Version, s.Name, s.State)
+		}
+	}
+	return nil
+}
+
+// Up applies all pending migrations in order and returns how many were applied
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	err := m.Verify(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("Up: %w", err)
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("Up: %w", err)
+	}
+	if len(applied) == 0 {
+		var tables int
+		err = m.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name != 'schema_migrations' AND name NOT LIKE 'sqlite_%'").Scan(&tables)
+		if err != nil {
+			return 0, fmt.Errorf("Up: %w", err)
+		}
+		if tables > 0 {
+			return 0, fmt.Errorf("Up: %w", ErrUnversionedSchema)
+		}
+	}
+
+	count := 0
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		m.logger.Info("db: applying migration", "version", migration.Version, "name", migration.Name)
+		err = m.inTx(ctx, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, migration.Up)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+				migration.Version, migration.Name, migration.Checksum, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("Up: migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Down reverts the most recently applied migration
+func (m *Migrator) Down(ctx context.Context) (Migration, error) {
+	err := m.Verify(ctx)
+	if err != nil {
+		return Migration{}, fmt.Errorf("Down: %w", err)
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return Migration{}, fmt.Errorf("Down: %w", err)
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == "" {
+			return Migration{}, fmt.Errorf("Down: migration %d_%s has no down file", migration.Version, migration.Name)
+		}
+
+		m.logger.Info("db: reverting migration", "version", migration.Version, "name", migration.Name)
+		err = m.inTx(ctx, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, migration.Down)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+			return err
+		})
+		if err != nil {
+			return Migration{}, fmt.Errorf("Down: migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		return migration, nil
+	}
+
+	return Migration{}, errors.New("Down: no migration applied")
+}
+
+func (m *Migrator) inTx(ctx context.Context, f func(*sql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = f(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	db, err := ConnectDB("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Error connecting database: %v", err)
+	}
+	defer CloseDB(db)
+
+	files := fstest.MapFS{
+		"0001_posts.up.sql":    {Data: []byte("CREATE TABLE posts (id INTEGER PRIMARY KEY);")},
+		"0001_posts.down.sql":  {Data: []byte("DROP TABLE posts;")},
+		"0002_title.up.sql":    {Data: []byte("ALTER TABLE posts ADD COLUMN title TEXT;")},
+		"0002_title.down.sql":  {Data: []byte("ALTER TABLE posts DROP COLUMN title;")},
+		"0003_broken.up.sql":   {Data: []byte("CREATE TABLE broken (id INTEGER PRIMARY KEY); INSERT INTO missing VALUES (1);")},
+		"0003_broken.down.sql": {Data: []byte("DROP TABLE broken;")},
+		"README.md":            {Data: []byte("not a migration")},
+	}
+
+	migrator, err := NewMigrator(logger, db, files)
+	if err != nil {
+		t.Fatalf("Error loading migrations: %v", err)
+	}
+
+	// the broken migration must be rolled back completely
+	count, err := migrator.Up(ctx)
+	if err == nil || count != 2 {
+		t.Fatalf("Up: expected 2 migrations and an error, got %d, %v", count, err)
+	}
+	var tables int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'broken'").Scan(&tables); err != nil || tables != 0 {
+		t.Errorf("Up: broken migration was not rolled back, %d tables, %v", tables, err)
+	}
+
+	delete(files, "0003_broken.up.sql")
+	delete(files, "0003_broken.down.sql")
+	migrator, err = NewMigrator(logger, db, files)
+	if err != nil {
+		t.Fatalf("Error loading migrations: %v", err)
+	}
+
+	status, err := migrator.Status(ctx)
+	if err != nil || len(status) != 2 || status[0].State != "applied" || status[1].State != "applied" {
+		t.Fatalf("Status: expected 2 applied migrations, got %+v, %v", status, err)
+	}
+
+	reverted, err := migrator.Down(ctx)
+	if err != nil || reverted.Version != 2 {
+		t.Fatalf("Down: expected to revert version 2, got %d, %v", reverted.Version, err)
+	}
+	if _, err := db.Exec("INSERT INTO posts (title) VALUES ('x')"); err == nil {
+		t.Errorf("Down: column title still exists")
+	}
+
+	count, err = migrator.Up(ctx)
+	if err != nil || count != 1 {
+		t.Fatalf("Up: expected 1 migration, got %d, %v", count, err)
+	}
+
+	// changing an applied migration must be detected
+	files["0001_posts.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE posts (id INTEGER PRIMARY KEY, body TEXT);")}
+	migrator, err = NewMigrator(logger, db, files)
+	if err != nil {
+		t.Fatalf("Error loading migrations: %v", err)
+	}
+	if err := migrator.Verify(ctx); err == nil {
+		t.Errorf("Verify: expected checksum mismatch")
+	}
+	if _, err := migrator.Up(ctx); err == nil {
+		t.Errorf("Up: expected checksum mismatch")
+	}
+}
+
+func TestUnversionedSchema(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	db, err := ConnectDB("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Error connecting database: %v", err)
+	}
+	defer CloseDB(db)
+
+	// articles as created by tables.sql before migrations
+	_, err = db.Exec("CREATE TABLE articles (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT NOT NULL, content TEXT NOT NULL, created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrator, err := NewMigrator(logger, db, Migrations)
+	if err != nil {
+		t.Fatalf("Error loading migrations: %v", err)
+	}
+	if count, err := migrator.Up(ctx); !errors.Is(err, ErrUnversionedSchema) || count != 0 {
+		t.Errorf("Up: expected ErrUnversionedSchema and no migration, got %d, %v", count, err)
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	db, err := ConnectDB("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Error connecting database: %v", err)
+	}
+	defer CloseDB(db)
+
+	migrator, err := NewMigrator(logger, db, Migrations)
+	if err != nil {
+		t.Fatalf("Error loading migrations: %v", err)
+	}
+
+	// every migration must be reversible
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	for {
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			t.Fatalf("Status: %v", err)
+		}
+		if status[0].State == "pending" {
+			break
+		}
+		if _, err := migrator.Down(ctx); err != nil {
+			t.Fatalf("Down: %v", err)
+		}
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up after Down: %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+-- drop all tables, children before their parents
+DROP TABLE IF EXISTS audit_logs;
+DROP TABLE IF EXISTS likes;
+DROP TABLE IF EXISTS article_revisions;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS article_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS article_categories;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS articles;
+DROP TABLE IF EXISTS media;
+DROP TABLE IF EXISTS pages;
+DROP TABLE IF EXISTS templates;
+DROP TABLE IF EXISTS settings;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
@@ -1,4 +1,4 @@
--- sqlite tables
+-- initial schema, uses IF NOT EXISTS so databases created before migrations can adopt it
 
 -- settings
 CREATE TABLE IF NOT EXISTS settings (
@@ -11,10 +11,19 @@ CREATE TABLE IF NOT EXISTS settings (
 CREATE TABLE IF NOT EXISTS articles (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     title TEXT NOT NULL,
+    slug TEXT NOT NULL UNIQUE,
+    summary TEXT NOT NULL DEFAULT '',
     content TEXT NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    author_id INTEGER NOT NULL,
+    published BOOLEAN NOT NULL DEFAULT FALSE,
+    published_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(author_id) REFERENCES users(id)
 );
 
+CREATE INDEX IF NOT EXISTS articles_published_at ON articles(published, published_at);
+
 -- templates (use go html/template)
 CREATE TABLE IF NOT EXISTS templates (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -31,7 +40,7 @@ CREATE TABLE IF NOT EXISTS comments (
     content TEXT NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     approved BOOLEAN DEFAULT 0,
-    FOREIGN KEY(article_id) REFERENCES articles(id),
+    FOREIGN KEY(article_id) REFERENCES articles(id) ON DELETE CASCADE,
     FOREIGN KEY(user_id) REFERENCES users(id)
 );
 
@@ -47,7 +56,7 @@ CREATE TABLE IF NOT EXISTS article_categories (
     article_id INTEGER NOT NULL,
     category_id INTEGER NOT NULL,
     PRIMARY KEY (article_id, category_id),
-    FOREIGN KEY(article_id) REFERENCES articles(id),
+    FOREIGN KEY(article_id) REFERENCES articles(id) ON DELETE CASCADE,
     FOREIGN KEY(category_id) REFERENCES categories(id)
 );
 
@@ -63,7 +72,7 @@ CREATE TABLE IF NOT EXISTS article_tags (
     article_id INTEGER NOT NULL,
     tag_id INTEGER NOT NULL,
     PRIMARY KEY (article_id, tag_id),
-    FOREIGN KEY(article_id) REFERENCES articles(id),
+    FOREIGN KEY(article_id) REFERENCES articles(id) ON DELETE CASCADE,
     FOREIGN KEY(tag_id) REFERENCES tags(id)
 );
 
@@ -93,9 +102,11 @@ CREATE TABLE IF NOT EXISTS roles (
     name TEXT NOT NULL UNIQUE
 );
 
--- insert role
--- INSERT INTO roles (name) VALUES ('admin');
--- INSERT INTO roles (name) VALUES ('user');
+-- insert roles, new users get role_id 1
+INSERT OR IGNORE INTO roles (id, name) VALUES (1, 'reader');
+INSERT OR IGNORE INTO roles (id, name) VALUES (2, 'author');
+INSERT OR IGNORE INTO roles (id, name) VALUES (3, 'editor');
+INSERT OR IGNORE INTO roles (id, name) VALUES (4, 'admin');
 
 -- permissions
 CREATE TABLE IF NOT EXISTS permissions (
@@ -105,6 +116,46 @@ CREATE TABLE IF NOT EXISTS permissions (
     FOREIGN KEY(role_id) REFERENCES roles(id)
 );
 
+CREATE UNIQUE INDEX IF NOT EXISTS permissions_role_permission ON permissions(role_id, permission);
+
+-- insert permissions, the vocabulary is defined in models/roles
+-- reader
+INSERT OR IGNORE INTO permissions (role_id, permission) VALUES
+    (1, 'comment.create');
+-- author
+INSERT OR IGNORE INTO permissions (role_id, permission) VALUES
+    (2, 'comment.create'),
+    (2, 'article.create'),
+    (2, 'media.upload');
+-- editor
+INSERT OR IGNORE INTO permissions (role_id, permission) VALUES
+    (3, 'comment.create'),
+    (3, 'comment.moderate'),
+    (3, 'article.create'),
+    (3, 'article.edit'),
+    (3, 'article.publish'),
+    (3, 'article.delete'),
+    (3, 'media.upload'),
+    (3, 'media.delete'),
+    (3, 'page.edit'),
+    (3, 'taxonomy.manage');
+-- admin
+INSERT OR IGNORE INTO permissions (role_id, permission) VALUES
+    (4, 'comment.create'),
+    (4, 'comment.moderate'),
+    (4, 'article.create'),
+    (4, 'article.edit'),
+    (4, 'article.publish'),
+    (4, 'article.delete'),
+    (4, 'media.upload'),
+    (4, 'media.delete'),
+    (4, 'page.edit'),
+    (4, 'taxonomy.manage'),
+    (4, 'user.manage'),
+    (4, 'settings.edit'),
+    (4, 'template.edit'),
+    (4, 'audit.view');
+
 -- users
 CREATE TABLE IF NOT EXISTS users (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -119,6 +170,18 @@ CREATE TABLE IF NOT EXISTS users (
     FOREIGN KEY(role_id) REFERENCES roles(id)
 );
 
+-- sessions, id is the sha256 of the token in the session cookie
+CREATE TABLE IF NOT EXISTS sessions (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id ON sessions(user_id);
+
 -- article revisions
 CREATE TABLE IF NOT EXISTS article_revisions (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -127,7 +190,7 @@ CREATE TABLE IF NOT EXISTS article_revisions (
     content TEXT NOT NULL,
     edited_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     edited_by INTEGER NOT NULL,
-    FOREIGN KEY(article_id) REFERENCES articles(id),
+    FOREIGN KEY(article_id) REFERENCES articles(id) ON DELETE CASCADE,
     FOREIGN KEY(edited_by) REFERENCES users(id)
 );
 
@@ -140,8 +203,8 @@ CREATE TABLE IF NOT EXISTS likes (
     comment_id INTEGER,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY(user_id) REFERENCES users(id),
-    FOREIGN KEY(article_id) REFERENCES articles(id),
-    FOREIGN KEY(comment_id) REFERENCES comments(id)
+    FOREIGN KEY(article_id) REFERENCES articles(id) ON DELETE CASCADE,
+    FOREIGN KEY(comment_id) REFERENCES comments(id) ON DELETE CASCADE
 );
 
 -- audit logs
@@ -0,0 +1,11 @@
+-- single use tokens sent to users by email, id is the sha256 of the token
+CREATE TABLE user_tokens (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    purpose TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX user_tokens_user_id ON user_tokens(user_id, purpose);
@@ -0,0 +1,6 @@
+ALTER TABLE articles DROP COLUMN comments_closed;
+
+DROP INDEX comments_parent;
+DROP INDEX comments_article;
+ALTER TABLE comments DROP COLUMN rejected;
+ALTER TABLE comments DROP COLUMN parent_id;
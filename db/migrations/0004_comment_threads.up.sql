@@ -0,0 +1,9 @@
+-- replies point to the comment they answer. There is no REFERENCES clause, because sqlite
+-- can't drop a column of a foreign key again, DeleteComment removes the replies instead.
+ALTER TABLE comments ADD COLUMN parent_id INTEGER;
+-- rejected comments are kept, but hidden from the public and the moderation queue
+ALTER TABLE comments ADD COLUMN rejected BOOLEAN NOT NULL DEFAULT 0;
+CREATE INDEX comments_article ON comments (article_id, approved);
+CREATE INDEX comments_parent ON comments (parent_id);
+
+ALTER TABLE articles ADD COLUMN comments_closed BOOLEAN NOT NULL DEFAULT 0;
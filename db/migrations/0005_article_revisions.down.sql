@@ -0,0 +1,2 @@
+DROP INDEX article_revisions_article;
+ALTER TABLE articles DROP COLUMN updated_by;
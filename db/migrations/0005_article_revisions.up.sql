@@ -0,0 +1,5 @@
+-- the editor of the current version, saved with it in article_revisions when the article changes
+ALTER TABLE articles ADD COLUMN updated_by INTEGER;
+UPDATE articles SET updated_by = author_id;
+
+CREATE INDEX article_revisions_article ON article_revisions (article_id, edited_at);
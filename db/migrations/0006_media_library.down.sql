@@ -0,0 +1,5 @@
+DROP INDEX media_uploaded_at;
+DROP INDEX media_file_path;
+ALTER TABLE media DROP COLUMN hash;
+ALTER TABLE media DROP COLUMN size;
+ALTER TABLE media DROP COLUMN content_type;
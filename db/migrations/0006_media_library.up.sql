@@ -0,0 +1,8 @@
+-- file_path is relative to the media directory and named after the sha256 hash of the content,
+-- rows of identical uploads share the file
+ALTER TABLE media ADD COLUMN content_type TEXT NOT NULL DEFAULT 'application/octet-stream';
+ALTER TABLE media ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE media ADD COLUMN hash TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX media_file_path ON media (file_path);
+CREATE INDEX media_uploaded_at ON media (uploaded_at);
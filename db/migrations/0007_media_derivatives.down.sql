@@ -0,0 +1,5 @@
+DELETE FROM media WHERE parent_id IS NOT NULL;
+DROP INDEX media_parent;
+ALTER TABLE media DROP COLUMN height;
+ALTER TABLE media DROP COLUMN width;
+ALTER TABLE media DROP COLUMN parent_id;
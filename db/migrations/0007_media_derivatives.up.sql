@@ -0,0 +1,6 @@
+-- resized versions of an image are stored as media with the id of the original in parent_id
+ALTER TABLE media ADD COLUMN parent_id INTEGER;
+ALTER TABLE media ADD COLUMN width INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE media ADD COLUMN height INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX media_parent ON media (parent_id, width);
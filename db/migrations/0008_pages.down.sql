@@ -0,0 +1,2 @@
+ALTER TABLE pages DROP COLUMN menu_order;
+ALTER TABLE pages DROP COLUMN published;
@@ -0,0 +1,4 @@
+-- drafts are only visible to editors. Published pages with a menu_order above 0
+-- are linked in the navigation, in ascending order.
+ALTER TABLE pages ADD COLUMN published BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE pages ADD COLUMN menu_order INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,16 @@
+DROP INDEX audit_logs_action;
+DROP INDEX audit_logs_created_at;
+
+CREATE TABLE audit_logs_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    details TEXT,
+    timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
+-- entries without a user can't be kept
+INSERT INTO audit_logs_old (id, user_id, action, details, timestamp)
+    SELECT id, user_id, action, details, created_at FROM audit_logs WHERE user_id IS NOT NULL;
+DROP TABLE audit_logs;
+ALTER TABLE audit_logs_old RENAME TO audit_logs;
@@ -0,0 +1,22 @@
+-- user_id is the acting user, NULL for anonymous requests like failed logins and kept
+-- when the user is deleted. details is a JSON object, ip and user_agent are those of the request.
+-- sqlite can't drop NOT NULL from a column, so the table is created again.
+CREATE TABLE audit_logs_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    action TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '{}',
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO audit_logs_new (id, user_id, action, details, created_at)
+    SELECT id, user_id, action,
+        CASE WHEN json_valid(details) THEN details ELSE json_object('text', details) END,
+        COALESCE(timestamp, CURRENT_TIMESTAMP)
+    FROM audit_logs;
+DROP TABLE audit_logs;
+ALTER TABLE audit_logs_new RENAME TO audit_logs;
+
+CREATE INDEX audit_logs_created_at ON audit_logs (created_at);
+CREATE INDEX audit_logs_action ON audit_logs (action, created_at);
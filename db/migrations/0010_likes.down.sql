@@ -0,0 +1,4 @@
+DROP INDEX likes_comment;
+DROP INDEX likes_article;
+DROP INDEX likes_user_comment;
+DROP INDEX likes_user_article;
@@ -0,0 +1,9 @@
+-- a user has one reaction per article or comment, type is 1 for like and 2 for dislike.
+-- Duplicates from before the unique indexes keep the newest reaction.
+DELETE FROM likes WHERE id NOT IN (
+    SELECT MAX(id) FROM likes GROUP BY user_id, article_id, comment_id
+);
+CREATE UNIQUE INDEX likes_user_article ON likes (user_id, article_id) WHERE article_id IS NOT NULL;
+CREATE UNIQUE INDEX likes_user_comment ON likes (user_id, comment_id) WHERE comment_id IS NOT NULL;
+CREATE INDEX likes_article ON likes (article_id, type);
+CREATE INDEX likes_comment ON likes (comment_id, type);
@@ -0,0 +1,13 @@
+-- personal access tokens for scripts. hash is the sha256 of the token, the token itself
+-- is only shown once. permissions are space separated, a token can't do more than its user.
+CREATE TABLE api_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    hash TEXT NOT NULL UNIQUE,
+    permissions TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP
+);
+CREATE INDEX api_tokens_user ON api_tokens (user_id);
@@ -0,0 +1,3 @@
+ALTER TABLE articles DROP COLUMN html_version;
+ALTER TABLE articles DROP COLUMN toc_html;
+ALTER TABLE articles DROP COLUMN content_html;
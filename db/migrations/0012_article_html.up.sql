@@ -0,0 +1,5 @@
+-- the HTML rendered from the Markdown of the content and the table of contents.
+-- html_version is the version of the renderer, articles of older versions are rendered again.
+ALTER TABLE articles ADD COLUMN content_html TEXT NOT NULL DEFAULT '';
+ALTER TABLE articles ADD COLUMN toc_html TEXT NOT NULL DEFAULT '';
+ALTER TABLE articles ADD COLUMN html_version INTEGER NOT NULL DEFAULT 0;
@@ -1,12 +1,9 @@
 package db
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"log/slog"
-	"os"
-	"path/filepath"
-	"strings"
 
 	// _ "github.com/mattn/go-sqlite3"
 	_ "github.com/ncruces/go-sqlite3/driver"
@@ -21,37 +18,33 @@ func CloseDB(db *sql.DB) error {
 	return db.Close()
 }
 
-func CreateTables(logger *slog.Logger, db *sql.DB, initFile string) error {
-	cleanPath := filepath.Clean(initFile)
-	if strings.Contains(cleanPath, "..") {
-		logger.Error("CreateTables: Invalid file path", "path", cleanPath)
-		return fmt.Errorf("invalid file path")
-	}
-
-	// read tables.sql
-	content, err := os.ReadFile(initFile)
+// Migrate brings the schema up to date by applying all pending migrations
+func Migrate(logger *slog.Logger, db *sql.DB) error {
+	migrator, err := NewMigrator(logger, db, Migrations)
 	if err != nil {
-		logger.Error("CreateTables: Error reading init file", "error", err)
+		logger.Error("Migrate: Error loading migrations", "error", err)
 		return err
 	}
 
-	// execute the content
-	_, err = db.Exec(string(content))
+	count, err := migrator.Up(context.Background())
 	if err != nil {
-		logger.Error("CreateTables: Error executing init file", "error", err)
+		logger.Error("Migrate: Error applying migrations", "error", err)
 		return err
 	}
+	if count > 0 {
+		logger.Info("Migrate: Applied migrations", "count", count)
+	}
 
 	return nil
 }
 
-func Init(logger *slog.Logger, driver string, source string, initFile string) (*sql.DB, error) {
+func Init(logger *slog.Logger, driver string, source string) (*sql.DB, error) {
 	db, err := ConnectDB(driver, source)
 	if err != nil {
 		return nil, err
 	}
 
-	err = CreateTables(logger, db, initFile)
+	err = Migrate(logger, db)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,170 @@
+// Package diff compares two texts line by line or word by word
+package diff
+
+import (
+	"strings"
+	"unicode"
+)
+
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Insert Op = "insert"
+	Delete Op = "delete"
+)
+
+// Chunk is a piece of text that is in both texts, or only in the old or new one.
+// Concatenating the Equal and Delete chunks gives the old text, Equal and Insert the new one.
+type Chunk struct {
+	Op   Op
+	Text string
+}
+
+// maxEdits limits the work on very different texts. If more edits are needed,
+// the differing middle part is reported as deleted and inserted as a whole.
+const maxEdits = 1000
+
+// Lines compares the texts line by line
+func Lines(a, b string) []Chunk {
+	return Tokens(strings.SplitAfter(a, "\n"), strings.SplitAfter(b, "\n"))
+}
+
+// Words compares the texts word by word, whitespace is kept in its own tokens
+func Words(a, b string) []Chunk {
+	return Tokens(splitWords(a), splitWords(b))
+}
+
+func splitWords(s string) []string {
+	var tokens []string
+	start, space := 0, false
+	for i, r := range s {
+		if i > start && unicode.IsSpace(r) != space {
+			tokens = append(tokens, s[start:i])
+			start = i
+		}
+		space = unicode.IsSpace(r)
+	}
+	if start < len(s) {
+		tokens = append(tokens, s[start:])
+	}
+	return tokens
+}
+
+// Tokens compares two lists of tokens with the algorithm of Myers,
+// adjacent tokens with the same operation are merged into one chunk.
+func Tokens(a, b []string) []Chunk {
+	var chunks []Chunk
+	add := func(op Op, text string) {
+		if text == "" {
+			return
+		}
+		if len(chunks) > 0 && chunks[len(chunks)-1].Op == op {
+			chunks[len(chunks)-1].Text += text
+			return
+		}
+		chunks = append(chunks, Chunk{Op: op, Text: text})
+	}
+
+	// the common prefix and suffix don't need the search
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	add(Equal, strings.Join(a[:prefix], ""))
+	for _, edit := range myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		add(edit.Op, edit.Text)
+	}
+	add(Equal, strings.Join(a[len(a)-suffix:], ""))
+
+	return chunks
+}
+
+// myers returns the shortest edit script from a to b, one chunk per token
+func myers(a, b []string) []Chunk {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+
+	// v[offset+k] is the furthest x reached on diagonal k. trace[d] keeps the diagonals
+	// -d-1 to d+1 of v before step d, the only ones needed on the way back.
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+	found := false
+	for d := 0; d <= max && d <= maxEdits && !found; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	if !found {
+		chunks := make([]Chunk, 0, n+m)
+		for _, token := range a {
+			chunks = append(chunks, Chunk{Op: Delete, Text: token})
+		}
+		for _, token := range b {
+			chunks = append(chunks, Chunk{Op: Insert, Text: token})
+		}
+		return chunks
+	}
+
+	// walk back from the end, collecting the edits in reverse
+	var reversed []Chunk
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v, offset := trace[d], d+1
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, Chunk{Op: Equal, Text: a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, Chunk{Op: Insert, Text: b[y-1]})
+			} else {
+				reversed = append(reversed, Chunk{Op: Delete, Text: a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	chunks := make([]Chunk, len(reversed))
+	for i, chunk := range reversed {
+		chunks[len(reversed)-1-i] = chunk
+	}
+	return chunks
+}
@@ -0,0 +1,83 @@
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// apply rebuilds the old and new text from the chunks
+func apply(chunks []Chunk) (a, b string) {
+	for _, chunk := range chunks {
+		if chunk.Op != Insert {
+			a += chunk.Text
+		}
+		if chunk.Op != Delete {
+			b += chunk.Text
+		}
+	}
+	return a, b
+}
+
+func TestLines(t *testing.T) {
+	got := Lines("one\ntwo\nthree\n", "one\n2\nthree\nfour\n")
+	want := []Chunk{
+		{Equal, "one\n"},
+		{Delete, "two\n"},
+		{Insert, "2\n"},
+		{Equal, "three\n"},
+		{Insert, "four\n"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWords(t *testing.T) {
+	got := Words("the quick brown fox", "the slow brown  fox jumps")
+	want := []Chunk{
+		{Equal, "the "},
+		{Delete, "quick"},
+		{Insert, "slow"},
+		{Equal, " brown"},
+		{Delete, " "},
+		{Insert, "  "},
+		{Equal, "fox"},
+		{Insert, " jumps"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTokensRebuildsBothTexts(t *testing.T) {
+	tests := [][2]string{
+		{"", ""},
+		{"", "new text"},
+		{"old text", ""},
+		{"a b c a b b a", "c b a b a c"},
+		{"Grüße aus Köln", "Grüße nach Köln\n"},
+		{strings.Repeat("x ", 3000), strings.Repeat("y ", 3000)},
+	}
+	for _, test := range tests {
+		for _, chunks := range [][]Chunk{Words(test[0], test[1]), Lines(test[0], test[1])} {
+			a, b := apply(chunks)
+			if a != test[0] || b != test[1] {
+				t.Errorf("diff of %.20q and %.20q rebuilds %.20q and %.20q", test[0], test[1], a, b)
+			}
+		}
+	}
+}
+
+func TestShortestScript(t *testing.T) {
+	// the classic example of the paper: 5 edits
+	edits := 0
+	for _, chunk := range Tokens(strings.Split("ABCABBA", ""), strings.Split("CBABAC", "")) {
+		if chunk.Op != Equal {
+			edits += len(chunk.Text)
+		}
+	}
+	if edits != 5 {
+		t.Errorf("expected 5 edits, got %d", edits)
+	}
+}
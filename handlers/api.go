@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/categories"
+	"github.com/AndreHeber/go-sqlite-blog/models/comments"
+	"github.com/AndreHeber/go-sqlite-blog/models/media"
+	"github.com/AndreHeber/go-sqlite-blog/models/tags"
+	"github.com/AndreHeber/go-sqlite-blog/models/users"
+)
+
+// apiDefaultLimit and apiMaxLimit bound the ?limit= of the API lists
+const (
+	apiDefaultLimit = 20
+	apiMaxLimit     = 100
+)
+
+// listParams reads ?limit= and ?cursor= of a list. The cursor is the id of the last
+// item of the previous page, lists are in descending order of the ids.
+func listParams(c *middleware.Context) (limit int, beforeID uint64, err error) {
+	query := c.Request.URL.Query()
+
+	limit = apiDefaultLimit
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > apiMaxLimit {
+			return 0, 0, middleware.Error(http.StatusBadRequest, fmt.Errorf("listParams: the limit must be between 1 and %d", apiMaxLimit))
+		}
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(value)
+		if err == nil {
+			beforeID, err = strconv.ParseUint(string(decoded), 10, 64)
+		}
+		if err != nil || beforeID == 0 {
+			return 0, 0, middleware.Error(http.StatusBadRequest, errors.New("listParams: invalid cursor"))
+		}
+	}
+	return limit, beforeID, nil
+}
+
+// listOf makes the envelope of a page from up to limit+1 items, the extra item
+// only tells that there is a next page
+func listOf[T any](items []T, limit int, id func(T) uint64) middleware.List {
+	list := middleware.List{Data: items}
+	if len(items) > limit {
+		items = items[:limit]
+		list.Data = items
+		list.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(id(items[limit-1]), 10)))
+	}
+	if len(items) == 0 {
+		// an empty list and not null
+		list.Data = []T{}
+	}
+	return list
+}
+
+// etagOf is the entity tag of a resource, it changes whenever its JSON changes
+func etagOf(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("etagOf: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// withETag answers with the resource and its entity tag
+func withETag(status int, header http.Header, v any) (middleware.Response, error) {
+	etag, err := etagOf(v)
+	if err != nil {
+		return middleware.Response{}, fmt.Errorf("withETag: %w", err)
+	}
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("ETag", etag)
+	return middleware.Response{Status: status, Header: header, Body: v}, nil
+}
+
+// checkIfMatch protects updates from overwriting changes the client hasn't seen.
+// Requests without If-Match get 428, those with an outdated entity tag 412.
+func checkIfMatch(c *middleware.Context, current any) error {
+	value := strings.TrimSpace(c.Request.Header.Get("If-Match"))
+	if value == "" {
+		return middleware.Error(http.StatusPreconditionRequired, errors.New("checkIfMatch: If-Match is required, use the ETag of the resource"))
+	}
+	if value == "*" {
+		return nil
+	}
+	etag, err := etagOf(current)
+	if err != nil {
+		return fmt.Errorf("checkIfMatch: %w", err)
+	}
+	// weak tags never match, updates need the strong comparison
+	for _, tag := range strings.Split(value, ",") {
+		if strings.TrimSpace(tag) == etag {
+			return nil
+		}
+	}
+	return middleware.Error(http.StatusPreconditionFailed, errors.New("checkIfMatch: the resource was changed"))
+}
+
+// nullableTime is null for the zero time
+func nullableTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+type apiCategory struct {
+	ID   uint64 `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+	URL  string `json:"url"`
+}
+
+func categoryData(category categories.Category) apiCategory {
+	return apiCategory{ID: category.ID, Name: category.Name, Slug: category.Slug, URL: "/category/" + category.Slug}
+}
+
+type apiTag struct {
+	ID   uint64 `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+	URL  string `json:"url"`
+}
+
+func tagData(tag tags.Tag) apiTag {
+	return apiTag{ID: tag.ID, Name: tag.Name, Slug: tag.Slug, URL: "/tag/" + tag.Slug}
+}
+
+type apiComment struct {
+	ID         uint64    `json:"id"`
+	ArticleID  uint64    `json:"article_id"`
+	ParentID   *uint64   `json:"parent_id"` // null for comments on the article itself
+	UserID     *uint64   `json:"user_id"`   // null for anonymous comments
+	AuthorName string    `json:"author_name"`
+	Content    string    `json:"content"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func commentData(comment comments.Comment) apiComment {
+	data := apiComment{
+		ID:         comment.ID,
+		ArticleID:  comment.ArticleID,
+		AuthorName: comment.AuthorName,
+		Content:    comment.Content,
+		CreatedAt:  comment.CreatedAt,
+	}
+	if comment.ParentID != 0 {
+		data.ParentID = &comment.ParentID
+	}
+	if comment.UserID != 0 {
+		data.UserID = &comment.UserID
+	}
+	return data
+}
+
+type apiMedia struct {
+	ID          uint64    `json:"id"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Width       int       `json:"width,omitempty"` // only for images
+	Height      int       `json:"height,omitempty"`
+	UploadedBy  string    `json:"uploaded_by"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+	URL         string    `json:"url"`
+}
+
+func mediaData(m media.Media) apiMedia {
+	return apiMedia{
+		ID:          m.ID,
+		FileName:    m.FileName,
+		ContentType: m.ContentType,
+		Size:        m.Size,
+		Width:       m.Width,
+		Height:      m.Height,
+		UploadedBy:  m.UploaderName,
+		UploadedAt:  m.UploadedAt,
+		URL:         m.URL(),
+	}
+}
+
+type apiUser struct {
+	ID        uint64     `json:"id"`
+	Username  string     `json:"username"`
+	Email     string     `json:"email"`
+	Verified  bool       `json:"verified"`
+	RoleID    uint64     `json:"role_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	LastLogin *time.Time `json:"last_login"`
+}
+
+func userData(user users.User) apiUser {
+	return apiUser{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Verified:  user.Verified,
+		RoleID:    user.RoleID,
+		CreatedAt: user.CreatedAt,
+		LastLogin: nullableTime(user.LastLogin),
+	}
+}
+
+// APIListCategories returns a page of the categories
+func APIListCategories(c *middleware.Context) (any, error) {
+	limit, beforeID, err := listParams(c)
+	if err != nil {
+		return nil, fmt.Errorf("APIListCategories: %w", err)
+	}
+	all, err := categories.GetCategoriesBefore(c.Env(), beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("APIListCategories: %w", err)
+	}
+	data := make([]apiCategory, 0, len(all))
+	for _, category := range all {
+		data = append(data, categoryData(category))
+	}
+	return listOf(data, limit, func(category apiCategory) uint64 { return category.ID }), nil
+}
+
+// APIListTags returns a page of the tags
+func APIListTags(c *middleware.Context) (any, error) {
+	limit, beforeID, err := listParams(c)
+	if err != nil {
+		return nil, fmt.Errorf("APIListTags: %w", err)
+	}
+	all, err := tags.GetTagsBefore(c.Env(), beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("APIListTags: %w", err)
+	}
+	data := make([]apiTag, 0, len(all))
+	for _, tag := range all {
+		data = append(data, tagData(tag))
+	}
+	return listOf(data, limit, func(tag apiTag) uint64 { return tag.ID }), nil
+}
+
+// APIListComments returns a page of the approved comments of the article
+func APIListComments(c *middleware.Context) (any, error) {
+	limit, beforeID, err := listParams(c)
+	if err != nil {
+		return nil, fmt.Errorf("APIListComments: %w", err)
+	}
+	article, err := articleFromPath(c)
+	if err != nil {
+		return nil, fmt.Errorf("APIListComments: %w", err)
+	}
+	approved, err := comments.GetApprovedCommentsBefore(c.Env(), article.ID, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("APIListComments: %w", err)
+	}
+	data := make([]apiComment, 0, len(approved))
+	for _, comment := range approved {
+		data = append(data, commentData(comment))
+	}
+	return listOf(data, limit, func(comment apiComment) uint64 { return comment.ID }), nil
+}
+
+// APIListMedia returns a page of the uploads without their resized versions
+func APIListMedia(c *middleware.Context) (any, error) {
+	limit, beforeID, err := listParams(c)
+	if err != nil {
+		return nil, fmt.Errorf("APIListMedia: %w", err)
+	}
+	list, err := media.GetMediaBefore(c.Env(), beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("APIListMedia: %w", err)
+	}
+	data := make([]apiMedia, 0, len(list))
+	for _, m := range list {
+		data = append(data, mediaData(m))
+	}
+	return listOf(data, limit, func(m apiMedia) uint64 { return m.ID }), nil
+}
+
+// APIListUsers returns a page of the users
+func APIListUsers(c *middleware.Context) (any, error) {
+	limit, beforeID, err := listParams(c)
+	if err != nil {
+		return nil, fmt.Errorf("APIListUsers: %w", err)
+	}
+	all, err := users.GetUsersBefore(c.Env(), beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("APIListUsers: %w", err)
+	}
+	data := make([]apiUser, 0, len(all))
+	for _, user := range all {
+		data = append(data, userData(user))
+	}
+	return listOf(data, limit, func(user apiUser) uint64 { return user.ID }), nil
+}
+
+// APICurrentUser returns the logged in user
+func APICurrentUser(c *middleware.Context) (any, error) {
+	return userData(*c.User), nil
+}
+
+// APINotFound answers API paths without a route
+func APINotFound(c *middleware.Context) (any, error) {
+	return nil, middleware.Error(http.StatusNotFound, fmt.Errorf("APINotFound: no route for %s %s", c.Request.Method, c.Request.URL.Path))
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/articles"
+	"github.com/AndreHeber/go-sqlite-blog/models/audit"
+	"github.com/AndreHeber/go-sqlite-blog/models/categories"
+	"github.com/AndreHeber/go-sqlite-blog/models/roles"
+	"github.com/AndreHeber/go-sqlite-blog/models/tags"
+)
+
+type apiArticle struct {
+	ID             uint64        `json:"id"`
+	Slug           string        `json:"slug"`
+	Title          string        `json:"title"`
+	Summary        string        `json:"summary"`
+	Content        string        `json:"content"`
+	AuthorID       uint64        `json:"author_id"`
+	Published      bool          `json:"published"`
+	PublishedAt    *time.Time    `json:"published_at"` // null if the article was never published
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+	CommentsClosed bool          `json:"comments_closed"`
+	Categories     []apiCategory `json:"categories"`
+	Tags           []apiTag      `json:"tags"`
+	URL            string        `json:"url"`
+}
+
+// articleData loads the categories and tags of the article
+func articleData(c *middleware.Context, article articles.Article) (apiArticle, error) {
+	data := apiArticle{
+		ID:             article.ID,
+		Slug:           article.Slug,
+		Title:          article.Title,
+		Summary:        article.Summary,
+		Content:        article.Content,
+		AuthorID:       article.AuthorID,
+		Published:      article.Published,
+		PublishedAt:    nullableTime(article.PublishedAt),
+		CreatedAt:      article.CreatedAt,
+		UpdatedAt:      article.UpdatedAt,
+		CommentsClosed: article.CommentsClosed,
+		Categories:     []apiCategory{},
+		Tags:           []apiTag{},
+		URL:            "/articles/" + article.Slug,
+	}
+
+	articleCategories, err := categories.GetArticleCategories(c.Env(), article.ID)
+	if err != nil {
+		return apiArticle{}, fmt.Errorf("articleData: %w", err)
+	}
+	for _, category := range articleCategories {
+		data.Categories = append(data.Categories, categoryData(category))
+	}
+	articleTags, err := tags.GetArticleTags(c.Env(), article.ID)
+	if err != nil {
+		return apiArticle{}, fmt.Errorf("articleData: %w", err)
+	}
+	for _, tag := range articleTags {
+		data.Tags = append(data.Tags, tagData(tag))
+	}
+	return data, nil
+}
+
+// APIListArticles returns a page of articles. Editors get all drafts, authors their own.
+func APIListArticles(c *middleware.Context) (any, error) {
+	limit, beforeID, err := listParams(c)
+	if err != nil {
+		return nil, fmt.Errorf("APIListArticles: %w", err)
+	}
+	var authorID uint64
+	if c.User != nil && c.Can(roles.ArticleCreate) {
+		authorID = c.User.ID
+	}
+	list, err := articles.GetArticlesBefore(c.Env(), beforeID, limit+1, c.Can(roles.ArticleEdit), authorID)
+	if err != nil {
+		return nil, fmt.Errorf("APIListArticles: %w", err)
+	}
+
+	data := make([]apiArticle, 0, len(list))
+	for i, article := range list {
+		// the extra article only shows that there is a next page
+		if i == limit {
+			data = append(data, apiArticle{ID: article.ID})
+			break
+		}
+		item, err := articleData(c, article)
+		if err != nil {
+			return nil, fmt.Errorf("APIListArticles: %w", err)
+		}
+		data = append(data, item)
+	}
+	return listOf(data, limit, func(article apiArticle) uint64 { return article.ID }), nil
+}
+
+// APIGetArticle returns the article of the {slug} path value with its ETag
+func APIGetArticle(c *middleware.Context) (any, error) {
+	article, err := articleFromPath(c)
+	if err != nil {
+		return nil, fmt.Errorf("APIGetArticle: %w", err)
+	}
+	data, err := articleData(c, article)
+	if err != nil {
+		return nil, fmt.Errorf("APIGetArticle: %w", err)
+	}
+	return withETag(http.StatusOK, nil, data)
+}
+
+// APICreateArticle saves the article of the request body for the current user
+func APICreateArticle(c *middleware.Context) (any, error) {
+	var input articleInput
+	err := c.DecodeData(&input)
+	if err != nil {
+		return nil, fmt.Errorf("APICreateArticle: %w", err)
+	}
+
+	now := time.Now().UTC()
+	article := articles.Article{AuthorID: c.User.ID, CreatedAt: now, UpdatedAt: now, UpdatedBy: c.User.ID}
+	err = applyArticleInput(c, &article, input)
+	if err != nil {
+		return nil, fmt.Errorf("APICreateArticle: %w", err)
+	}
+	categoryIDs, tagNames, err := checkTaxonomy(c, input.Categories, input.Tags)
+	if err != nil {
+		return nil, fmt.Errorf("APICreateArticle: %w", err)
+	}
+	err = createArticle(c, &article, categoryIDs, tagNames)
+	if err != nil {
+		return nil, fmt.Errorf("APICreateArticle: %w", err)
+	}
+
+	// loaded again to answer with the stored times, the ETag must match later requests
+	article, err = articles.GetArticleByID(c.Env(), article.ID)
+	if err != nil {
+		return nil, fmt.Errorf("APICreateArticle: %w", err)
+	}
+	data, err := articleData(c, article)
+	if err != nil {
+		return nil, fmt.Errorf("APICreateArticle: %w", err)
+	}
+	return withETag(http.StatusCreated, http.Header{"Location": {"/api/v1/articles/" + article.Slug}}, data)
+}
+
+// APIUpdateArticle replaces the article of the {slug} path value with the request body.
+// The If-Match header must carry the current ETag of the article.
+func APIUpdateArticle(c *middleware.Context) (any, error) {
+	article, err := articleFromPath(c)
+	if err != nil {
+		return nil, fmt.Errorf("APIUpdateArticle: %w", err)
+	}
+	if !canEditArticle(c, article) {
+		return nil, middleware.Error(http.StatusForbidden, errors.New("APIUpdateArticle: not allowed to edit this article"))
+	}
+	current, err := articleData(c, article)
+	if err != nil {
+		return nil, fmt.Errorf("APIUpdateArticle: %w", err)
+	}
+	err = checkIfMatch(c, current)
+	if err != nil {
+		return nil, fmt.Errorf("APIUpdateArticle: %w", err)
+	}
+
+	var input articleInput
+	err = c.DecodeData(&input)
+	if err != nil {
+		return nil, fmt.Errorf("APIUpdateArticle: %w", err)
+	}
+	previous := article
+	article.UpdatedAt = time.Now().UTC()
+	article.UpdatedBy = c.User.ID
+	err = applyArticleInput(c, &article, input)
+	if err != nil {
+		return nil, fmt.Errorf("APIUpdateArticle: %w", err)
+	}
+	categoryIDs, tagNames, err := checkTaxonomy(c, input.Categories, input.Tags)
+	if err != nil {
+		return nil, fmt.Errorf("APIUpdateArticle: %w", err)
+	}
+	err = updateArticle(c, previous, article, categoryIDs, tagNames)
+	if errors.Is(err, articles.ErrConflict) {
+		// saved by another request since the If-Match check
+		return nil, middleware.Error(http.StatusPreconditionFailed, fmt.Errorf("APIUpdateArticle: %w", err))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("APIUpdateArticle: %w", err)
+	}
+
+	// loaded again to answer with the stored times, the ETag must match later requests
+	article, err = articles.GetArticleByID(c.Env(), article.ID)
+	if err != nil {
+		return nil, fmt.Errorf("APIUpdateArticle: %w", err)
+	}
+	data, err := articleData(c, article)
+	if err != nil {
+		return nil, fmt.Errorf("APIUpdateArticle: %w", err)
+	}
+	return withETag(http.StatusOK, nil, data)
+}
+
+// APIDeleteArticle deletes the article of the {slug} path value
+func APIDeleteArticle(c *middleware.Context) (any, error) {
+	article, err := articleFromPath(c)
+	if err != nil {
+		return nil, fmt.Errorf("APIDeleteArticle: %w", err)
+	}
+	if !canDeleteArticle(c, article) {
+		return nil, middleware.Error(http.StatusForbidden, errors.New("APIDeleteArticle: not allowed to delete this article"))
+	}
+
+	err = articles.DeleteArticle(c.Env(), article.ID)
+	if err != nil {
+		return nil, fmt.Errorf("APIDeleteArticle: %w", err)
+	}
+	c.Audit(audit.ArticleDeleted, articleDetails(article))
+	return middleware.Response{Status: http.StatusNoContent}, nil
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/pages"
+	"github.com/AndreHeber/go-sqlite-blog/models/roles"
+)
+
+type apiPage struct {
+	ID        uint64    `json:"id"`
+	Slug      string    `json:"slug"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Published bool      `json:"published"`
+	MenuOrder int       `json:"menu_order"` // 0 leaves the page out of the navigation
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	URL       string    `json:"url"`
+}
+
+func pageData(page pages.Page) apiPage {
+	return apiPage{
+		ID:        page.ID,
+		Slug:      page.Slug,
+		Title:     page.Title,
+		Content:   page.Content,
+		Published: page.Published,
+		MenuOrder: page.MenuOrder,
+		CreatedAt: page.CreatedAt,
+		UpdatedAt: page.UpdatedAt,
+		URL:       "/" + page.Slug,
+	}
+}
+
+// APIListPages returns a page of the pages, drafts only for editors
+func APIListPages(c *middleware.Context) (any, error) {
+	limit, beforeID, err := listParams(c)
+	if err != nil {
+		return nil, fmt.Errorf("APIListPages: %w", err)
+	}
+	all, err := pages.GetPagesBefore(c.Env(), beforeID, limit+1, c.Can(roles.PageEdit))
+	if err != nil {
+		return nil, fmt.Errorf("APIListPages: %w", err)
+	}
+	data := make([]apiPage, 0, len(all))
+	for _, page := range all {
+		data = append(data, pageData(page))
+	}
+	return listOf(data, limit, func(page apiPage) uint64 { return page.ID }), nil
+}
+
+// APIGetPage returns the page of the {slug} path value with its ETag
+func APIGetPage(c *middleware.Context) (any, error) {
+	page, err := pageFromSlug(c)
+	if err != nil {
+		return nil, fmt.Errorf("APIGetPage: %w", err)
+	}
+	return withETag(http.StatusOK, nil, pageData(page))
+}
+
+// APICreatePage saves the page of the request body
+func APICreatePage(c *middleware.Context) (any, error) {
+	var input pageInput
+	err := c.DecodeData(&input)
+	if err != nil {
+		return nil, fmt.Errorf("APICreatePage: %w", err)
+	}
+
+	now := time.Now().UTC()
+	page := pages.Page{CreatedAt: now, UpdatedAt: now}
+	err = applyPageInput(c, &page, input)
+	if err != nil {
+		return nil, fmt.Errorf("APICreatePage: %w", err)
+	}
+	page.ID, err = pages.CreatePage(c.Env(), page)
+	if err != nil {
+		return nil, fmt.Errorf("APICreatePage: %w", err)
+	}
+	// loaded again to answer with the stored times, the ETag must match later requests
+	page, err = pages.GetPageByID(c.Env(), page.ID)
+	if err != nil {
+		return nil, fmt.Errorf("APICreatePage: %w", err)
+	}
+	return withETag(http.StatusCreated, http.Header{"Location": {"/api/v1/pages/" + page.Slug}}, pageData(page))
+}
+
+// APIUpdatePage replaces the page of the {slug} path value with the request body.
+// The If-Match header must carry the current ETag of the page.
+func APIUpdatePage(c *middleware.Context) (any, error) {
+	page, err := pageFromSlug(c)
+	if err != nil {
+		return nil, fmt.Errorf("APIUpdatePage: %w", err)
+	}
+	err = checkIfMatch(c, pageData(page))
+	if err != nil {
+		return nil, fmt.Errorf("APIUpdatePage: %w", err)
+	}
+
+	var input pageInput
+	err = c.DecodeData(&input)
+	if err != nil {
+		return nil, fmt.Errorf("APIUpdatePage: %w", err)
+	}
+	lastUpdatedAt := page.UpdatedAt
+	page.UpdatedAt = time.Now().UTC()
+	err = applyPageInput(c, &page, input)
+	if err != nil {
+		return nil, fmt.Errorf("APIUpdatePage: %w", err)
+	}
+	err = pages.UpdatePage(c.Env(), page, lastUpdatedAt)
+	if errors.Is(err, pages.ErrConflict) {
+		// saved by another request since the If-Match check
+		return nil, middleware.Error(http.StatusPreconditionFailed, fmt.Errorf("APIUpdatePage: %w", err))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("APIUpdatePage: %w", err)
+	}
+	page, err = pages.GetPageByID(c.Env(), page.ID)
+	if err != nil {
+		return nil, fmt.Errorf("APIUpdatePage: %w", err)
+	}
+	return withETag(http.StatusOK, nil, pageData(page))
+}
+
+// APIDeletePage deletes the page of the {slug} path value
+func APIDeletePage(c *middleware.Context) (any, error) {
+	page, err := pageFromSlug(c)
+	if err != nil {
+		return nil, fmt.Errorf("APIDeletePage: %w", err)
+	}
+	err = pages.DeletePage(c.Env(), page.ID)
+	if err != nil {
+		return nil, fmt.Errorf("APIDeletePage: %w", err)
+	}
+	return middleware.Response{Status: http.StatusNoContent}, nil
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/roles"
+	"github.com/AndreHeber/go-sqlite-blog/openapi"
+)
+
+// APIRoute is a route of the JSON API with its description for the OpenAPI document
+type APIRoute struct {
+	openapi.Route
+	Handler middleware.DataFunc
+}
+
+// DataFunc is the handler with the checks the description promises
+func (r APIRoute) DataFunc() middleware.DataFunc {
+	h := r.Handler
+	if r.Request != nil {
+		h = middleware.RequireData(h)
+	}
+	if r.Permission != "" {
+		return middleware.DataRequirePermission(roles.Permission(r.Permission), h)
+	}
+	if r.Login {
+		return middleware.DataRequireUser(h)
+	}
+	return h
+}
+
+// APIRoutes are the routes of the JSON API. The router registers them and the
+// OpenAPI document is made from them, so the document can't miss a route.
+var APIRoutes = []APIRoute{
+	{openapi.Route{Method: "GET", Path: "/api/v1/articles", Summary: "List the articles, drafts only for their authors and editors", Response: apiArticle{}, List: true}, APIListArticles},
+	{openapi.Route{Method: "POST", Path: "/api/v1/articles", Summary: "Create an article", Permission: string(roles.ArticleCreate), Request: articleInput{}, Response: apiArticle{}, Status: http.StatusCreated, ETag: true}, APICreateArticle},
+	{openapi.Route{Method: "GET", Path: "/api/v1/articles/{slug}", Summary: "Get an article", Response: apiArticle{}, ETag: true}, APIGetArticle},
+	{openapi.Route{Method: "PUT", Path: "/api/v1/articles/{slug}", Summary: "Replace an article", Login: true, Request: articleInput{}, Response: apiArticle{}, ETag: true, IfMatch: true}, APIUpdateArticle},
+	{openapi.Route{Method: "DELETE", Path: "/api/v1/articles/{slug}", Summary: "Delete an article", Login: true, Status: http.StatusNoContent}, APIDeleteArticle},
+	{openapi.Route{Method: "GET", Path: "/api/v1/articles/{slug}/comments", Summary: "List the approved comments of an article", Response: apiComment{}, List: true}, APIListComments},
+	{openapi.Route{Method: "GET", Path: "/api/v1/pages", Summary: "List the pages, drafts only for editors", Response: apiPage{}, List: true}, APIListPages},
+	{openapi.Route{Method: "POST", Path: "/api/v1/pages", Summary: "Create a page", Permission: string(roles.PageEdit), Request: pageInput{}, Response: apiPage{}, Status: http.StatusCreated, ETag: true}, APICreatePage},
+	{openapi.Route{Method: "GET", Path: "/api/v1/pages/{slug}", Summary: "Get a page", Response: apiPage{}, ETag: true}, APIGetPage},
+	{openapi.Route{Method: "PUT", Path: "/api/v1/pages/{slug}", Summary: "Replace a page", Permission: string(roles.PageEdit), Request: pageInput{}, Response: apiPage{}, ETag: true, IfMatch: true}, APIUpdatePage},
+	{openapi.Route{Method: "DELETE", Path: "/api/v1/pages/{slug}", Summary: "Delete a page", Permission: string(roles.PageEdit), Status: http.StatusNoContent}, APIDeletePage},
+	{openapi.Route{Method: "GET", Path: "/api/v1/categories", Summary: "List the categories", Response: apiCategory{}, List: true}, APIListCategories},
+	{openapi.Route{Method: "GET", Path: "/api/v1/tags", Summary: "List the tags", Response: apiTag{}, List: true}, APIListTags},
+	{openapi.Route{Method: "GET", Path: "/api/v1/media", Summary: "List the uploads", Permission: string(roles.MediaUpload), Response: apiMedia{}, List: true}, APIListMedia},
+	{openapi.Route{Method: "GET", Path: "/api/v1/users", Summary: "List the users", Permission: string(roles.UserManage), Response: apiUser{}, List: true}, APIListUsers},
+	{openapi.Route{Method: "GET", Path: "/api/v1/users/me", Summary: "Get the logged in user", Login: true, Response: apiUser{}}, APICurrentUser},
+}
+
+// OpenAPI answers with the OpenAPI document of the spec
+func OpenAPI(spec *openapi.Spec) middleware.DataFunc {
+	doc := spec.Document()
+	return func(c *middleware.Context) (any, error) {
+		return doc, nil
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/apitokens"
+	"github.com/AndreHeber/go-sqlite-blog/models/audit"
+	"github.com/AndreHeber/go-sqlite-blog/models/roles"
+	"github.com/AndreHeber/go-sqlite-blog/signing"
+)
+
+const (
+	// apiTokenPrefix makes tokens easy to recognize, e.g. by secret scanners
+	apiTokenPrefix        = "blog_"
+	apiTokenNameMaxLength = 100
+	apiTokenMaxDays       = 3650
+)
+
+// requireSession keeps API tokens from managing tokens, a token could
+// otherwise create another one with more permissions
+func requireSession(c *middleware.Context) error {
+	if c.Token != nil {
+		return middleware.Error(http.StatusForbidden, errors.New("requireSession: API tokens can't manage tokens, log in instead"))
+	}
+	return nil
+}
+
+// renderTokens renders the tokens of the current user. newToken is shown once after it was created.
+func renderTokens(c *middleware.Context, newToken string) error {
+	env := c.Env()
+	list, err := apitokens.GetUserTokens(env, c.User.ID)
+	if err != nil {
+		return fmt.Errorf("renderTokens: %w", err)
+	}
+	permissions, err := roles.GetRolePermissions(env, c.User.RoleID)
+	if err != nil {
+		return fmt.Errorf("renderTokens: %w", err)
+	}
+
+	err = render(c, "account_tokens.html", map[string]any{
+		"Tokens":      list,
+		"Permissions": permissions,
+		"NewToken":    newToken,
+		"Now":         time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("renderTokens: %w", err)
+	}
+	return nil
+}
+
+// ShowTokens lists the API tokens of the current user with the form for a new one
+func ShowTokens(c *middleware.Context) error {
+	err := requireSession(c)
+	if err != nil {
+		return fmt.Errorf("ShowTokens: %w", err)
+	}
+	err = renderTokens(c, "")
+	if err != nil {
+		return fmt.Errorf("ShowTokens: %w", err)
+	}
+	return nil
+}
+
+// CreateToken creates an API token with the permissions of the form, they must be
+// permissions of the user. The token is shown in the answer and never again.
+func CreateToken(c *middleware.Context) error {
+	err := requireSession(c)
+	if err != nil {
+		return fmt.Errorf("CreateToken: %w", err)
+	}
+	r := c.Request
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || utf8.RuneCountInString(name) > apiTokenNameMaxLength {
+		return middleware.Error(http.StatusBadRequest, fmt.Errorf("CreateToken: the name must have 1 to %d characters", apiTokenNameMaxLength))
+	}
+
+	var permissions []roles.Permission
+	for _, value := range r.Form["permissions"] {
+		permission := roles.Permission(value)
+		if !c.Can(permission) {
+			return middleware.Error(http.StatusBadRequest, fmt.Errorf("CreateToken: you don't have the permission %s", permission))
+		}
+		permissions = append(permissions, permission)
+	}
+
+	now := time.Now().UTC()
+	token := apitokens.Token{UserID: c.User.ID, Name: name, Permissions: permissions, CreatedAt: now}
+	if value := strings.TrimSpace(r.FormValue("expires_days")); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 || days > apiTokenMaxDays {
+			return middleware.Error(http.StatusBadRequest, fmt.Errorf("CreateToken: the token must expire within 0 to %d days", apiTokenMaxDays))
+		}
+		if days > 0 {
+			token.ExpiresAt = now.AddDate(0, 0, days)
+		}
+	}
+
+	secret := apiTokenPrefix + signing.RandomToken(32)
+	token.Hash = signing.HashToken(secret)
+	token.ID, err = apitokens.CreateToken(c.Env(), token)
+	if err != nil {
+		return fmt.Errorf("CreateToken: %w", err)
+	}
+	c.Audit(audit.TokenCreated, map[string]any{"token_id": token.ID, "name": token.Name, "permissions": token.Permissions})
+
+	// the page holds the only copy of the token
+	c.ResponseWriter.Header().Set("Cache-Control", "no-store")
+	err = renderTokens(c, secret)
+	if err != nil {
+		return fmt.Errorf("CreateToken: %w", err)
+	}
+	return nil
+}
+
+// RevokeToken deletes an API token of the current user
+func RevokeToken(c *middleware.Context) error {
+	err := requireSession(c)
+	if err != nil {
+		return fmt.Errorf("RevokeToken: %w", err)
+	}
+	id, err := idFromPath(c)
+	if err != nil {
+		return fmt.Errorf("RevokeToken: %w", err)
+	}
+
+	err = apitokens.DeleteToken(c.Env(), id, c.User.ID)
+	if errors.Is(err, apitokens.ErrNotFound) {
+		return middleware.Error(http.StatusNotFound, fmt.Errorf("RevokeToken: %w", err))
+	}
+	if err != nil {
+		return fmt.Errorf("RevokeToken: %w", err)
+	}
+	c.Audit(audit.TokenRevoked, map[string]any{"token_id": id})
+
+	http.Redirect(c.ResponseWriter, c.Request, "/account/tokens", http.StatusSeeOther)
+	return nil
+}
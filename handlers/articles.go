@@ -1,19 +1,408 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"html/template"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/markdown"
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/articles"
+	"github.com/AndreHeber/go-sqlite-blog/models/audit"
+	"github.com/AndreHeber/go-sqlite-blog/models/categories"
+	"github.com/AndreHeber/go-sqlite-blog/models/comments"
+	"github.com/AndreHeber/go-sqlite-blog/models/likes"
+	"github.com/AndreHeber/go-sqlite-blog/models/roles"
+	"github.com/AndreHeber/go-sqlite-blog/models/tags"
+	"github.com/AndreHeber/go-sqlite-blog/slug"
 )
 
-func ArticlesHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.ParseFiles("static/templates/articles.html")
+// canEditArticle reports whether the current user may change the article.
+// Authors may change their own articles, editors all of them.
+func canEditArticle(c *middleware.Context, article articles.Article) bool {
+	if c.User == nil {
+		return false
+	}
+	return c.Can(roles.ArticleEdit) || (article.AuthorID == c.User.ID && c.Can(roles.ArticleCreate))
+}
+
+// canDeleteArticle reports whether the current user may delete the article
+func canDeleteArticle(c *middleware.Context, article articles.Article) bool {
+	if c.User == nil {
+		return false
+	}
+	return c.Can(roles.ArticleDelete) || (article.AuthorID == c.User.ID && c.Can(roles.ArticleCreate))
+}
+
+// articleDetails identifies the article in the audit log
+func articleDetails(article articles.Article) map[string]any {
+	return map[string]any{"article_id": article.ID, "title": article.Title, "slug": article.Slug}
+}
+
+// articleFromPath loads the article of the {slug} path value.
+// Drafts are only visible to those who may edit them.
+func articleFromPath(c *middleware.Context) (articles.Article, error) {
+	article, err := articles.GetArticleBySlug(c.Env(), c.Request.PathValue("slug"))
+	if errors.Is(err, articles.ErrNotFound) {
+		return articles.Article{}, middleware.Error(http.StatusNotFound, err)
+	}
+	if err != nil {
+		return articles.Article{}, err
+	}
+	if !article.Published && !canEditArticle(c, article) {
+		return articles.Article{}, middleware.Error(http.StatusNotFound, articles.ErrNotFound)
+	}
+	return article, nil
+}
+
+// ListArticles renders a page of articles. Editors see all drafts, authors their own.
+func ListArticles(c *middleware.Context) error {
+	env := c.Env()
+	page := pageNumber(c.Request)
+	perPage := c.Settings().ArticlesPerPage
+	limit, offset := perPage+1, (page-1)*perPage
+
+	var list []articles.Article
+	var err error
+	switch {
+	case c.Can(roles.ArticleEdit):
+		list, err = articles.GetArticles(env, limit, offset)
+	case c.Can(roles.ArticleCreate):
+		list, err = articles.GetArticlesVisibleToAuthor(env, c.User.ID, limit, offset)
+	default:
+		list, err = articles.GetPublishedArticles(env, limit, offset)
+	}
+	if err != nil {
+		return fmt.Errorf("ListArticles: %w", err)
+	}
+
+	// one more article than shown was fetched to know if there is a next page
+	nextPage := 0
+	if len(list) > perPage {
+		list = list[:perPage]
+		nextPage = page + 1
+	}
+
+	err = render(c, "articles.html", map[string]any{
+		"Heading":  "Articles",
+		"FeedPath": "",
+		"Articles": list,
+		"PrevPage": page - 1,
+		"NextPage": nextPage,
+	})
+	if err != nil {
+		return fmt.Errorf("ListArticles: %w", err)
+	}
+	return nil
+}
+
+// ShowArticle renders a single article
+func ShowArticle(c *middleware.Context) error {
+	article, err := articleFromPath(c)
+	if err != nil {
+		return fmt.Errorf("ShowArticle: %w", err)
+	}
+
+	approved, err := comments.GetApprovedComments(c.Env(), article.ID)
+	if err != nil {
+		return fmt.Errorf("ShowArticle: %w", err)
+	}
+	articleCategories, err := categories.GetArticleCategories(c.Env(), article.ID)
+	if err != nil {
+		return fmt.Errorf("ShowArticle: %w", err)
+	}
+	articleTags, err := tags.GetArticleTags(c.Env(), article.ID)
+	if err != nil {
+		return fmt.Errorf("ShowArticle: %w", err)
+	}
+	articleLikes, err := likes.GetArticleCounts(c.Env(), article.ID)
+	if err != nil {
+		return fmt.Errorf("ShowArticle: %w", err)
+	}
+	commentLikes, err := likes.GetCommentCounts(c.Env(), article.ID)
+	if err != nil {
+		return fmt.Errorf("ShowArticle: %w", err)
+	}
+	var reactions likes.Reactions
+	if c.User != nil {
+		reactions, err = likes.GetUserReactions(c.Env(), c.User.ID, article.ID)
+		if err != nil {
+			return fmt.Errorf("ShowArticle: %w", err)
+		}
+	}
+
+	err = refreshArticleHTML(c, &article)
+	if err != nil {
+		return fmt.Errorf("ShowArticle: %w", err)
+	}
+
+	openErr := commentsOpen(c, article)
+	err = render(c, "article.html", map[string]any{
+		"Article":        article,
+		"ContentHTML":    template.HTML(article.ContentHTML), // sanitized by the renderer
+		"TOC":            template.HTML(article.TOCHTML),
+		"CanEdit":        canEditArticle(c, article),
+		"CanDelete":      canDeleteArticle(c, article),
+		"Categories":     articleCategories,
+		"Tags":           articleTags,
+		"Likes":          articleLikes,
+		"Reaction":       reactions.Article,
+		"Comments":       commentThreads(approved, commentLikes, reactions.Comments),
+		"CommentCount":   len(approved),
+		"CommentsOpen":   openErr == nil,
+		"LoginToComment": errors.Is(openErr, errLoginToComment),
+		"CommentPending": c.Request.URL.Query().Get("comment") == "pending",
+	})
+	if err != nil {
+		return fmt.Errorf("ShowArticle: %w", err)
+	}
+	return nil
+}
+
+// NewArticle renders the form for a new article
+func NewArticle(c *middleware.Context) error {
+	err := renderArticleForm(c, articles.Article{})
+	if err != nil {
+		return fmt.Errorf("NewArticle: %w", err)
+	}
+	return nil
+}
+
+// CreateArticle saves the submitted article of the current user
+func CreateArticle(c *middleware.Context) error {
+	now := time.Now().UTC()
+
+	article := articles.Article{AuthorID: c.User.ID, CreatedAt: now, UpdatedAt: now, UpdatedBy: c.User.ID}
+	err := articleFromForm(c, &article)
+	if err != nil {
+		return fmt.Errorf("CreateArticle: %w", err)
+	}
+	categoryIDs, tagNames, err := taxonomyFromForm(c)
+	if err != nil {
+		return fmt.Errorf("CreateArticle: %w", err)
+	}
+
+	err = createArticle(c, &article, categoryIDs, tagNames)
+	if err != nil {
+		return fmt.Errorf("CreateArticle: %w", err)
+	}
+
+	http.Redirect(c.ResponseWriter, c.Request, "/articles/"+article.Slug, http.StatusSeeOther)
+	return nil
+}
+
+// EditArticle renders the form to change an article
+func EditArticle(c *middleware.Context) error {
+	article, err := articleFromPath(c)
+	if err != nil {
+		return fmt.Errorf("EditArticle: %w", err)
+	}
+	if !canEditArticle(c, article) {
+		return middleware.Error(http.StatusForbidden, errors.New("EditArticle: not allowed to edit this article"))
+	}
+
+	err = renderArticleForm(c, article)
+	if err != nil {
+		return fmt.Errorf("EditArticle: %w", err)
+	}
+	return nil
+}
+
+// UpdateArticle saves the submitted changes of an article
+func UpdateArticle(c *middleware.Context) error {
+	article, err := articleFromPath(c)
+	if err != nil {
+		return fmt.Errorf("UpdateArticle: %w", err)
+	}
+	if !canEditArticle(c, article) {
+		return middleware.Error(http.StatusForbidden, errors.New("UpdateArticle: not allowed to edit this article"))
+	}
+
+	previous := article
+	article.UpdatedAt = time.Now().UTC()
+	article.UpdatedBy = c.User.ID
+	err = articleFromForm(c, &article)
+	if err != nil {
+		return fmt.Errorf("UpdateArticle: %w", err)
+	}
+	categoryIDs, tagNames, err := taxonomyFromForm(c)
+	if err != nil {
+		return fmt.Errorf("UpdateArticle: %w", err)
+	}
+
+	err = updateArticle(c, previous, article, categoryIDs, tagNames)
+	if errors.Is(err, articles.ErrConflict) {
+		return middleware.Error(http.StatusConflict, fmt.Errorf("UpdateArticle: %w", err))
+	}
+	if err != nil {
+		return fmt.Errorf("UpdateArticle: %w", err)
+	}
+
+	http.Redirect(c.ResponseWriter, c.Request, "/articles/"+article.Slug, http.StatusSeeOther)
+	return nil
+}
+
+// createArticle saves a new article with its categories and tags and sets its id
+func createArticle(c *middleware.Context, article *articles.Article, categoryIDs []uint64, tagNames []string) error {
+	taxonomy, err := articleTaxonomy(c, categoryIDs, tagNames)
+	if err != nil {
+		return fmt.Errorf("createArticle: %w", err)
+	}
+	article.ID, err = articles.CreateArticle(c.Env(), *article, taxonomy)
+	if err != nil {
+		return fmt.Errorf("createArticle: %w", err)
+	}
+	if article.Published {
+		c.Audit(audit.ArticlePublished, articleDetails(*article))
+	}
+	return nil
+}
+
+// updateArticle saves the changes of an article with its categories and tags.
+// previous is the article as it was loaded, it must not have been saved since.
+func updateArticle(c *middleware.Context, previous, article articles.Article, categoryIDs []uint64, tagNames []string) error {
+	taxonomy, err := articleTaxonomy(c, categoryIDs, tagNames)
+	if err != nil {
+		return fmt.Errorf("updateArticle: %w", err)
+	}
+	err = articles.UpdateArticle(c.Env(), article, previous.UpdatedAt, &taxonomy)
+	if err != nil {
+		return fmt.Errorf("updateArticle: %w", err)
+	}
+	switch {
+	case article.Published && !previous.Published:
+		c.Audit(audit.ArticlePublished, articleDetails(article))
+	case !article.Published && previous.Published:
+		c.Audit(audit.ArticleWithdrawn, articleDetails(article))
+	}
+	return nil
+}
+
+// DeleteArticle deletes an article
+func DeleteArticle(c *middleware.Context) error {
+	article, err := articleFromPath(c)
+	if err != nil {
+		return fmt.Errorf("DeleteArticle: %w", err)
+	}
+	if !canDeleteArticle(c, article) {
+		return middleware.Error(http.StatusForbidden, errors.New("DeleteArticle: not allowed to delete this article"))
+	}
+
+	err = articles.DeleteArticle(c.Env(), article.ID)
+	if err != nil {
+		return fmt.Errorf("DeleteArticle: %w", err)
+	}
+	c.Audit(audit.ArticleDeleted, articleDetails(article))
+
+	http.Redirect(c.ResponseWriter, c.Request, "/articles", http.StatusSeeOther)
+	return nil
+}
+
+// articleInput are the fields of an article a user submits, by the form or the API
+type articleInput struct {
+	Title          string   `json:"title"`
+	Slug           string   `json:"slug,omitempty"` // made from the title if empty
+	Summary        string   `json:"summary,omitempty"`
+	Content        string   `json:"content"`
+	Published      bool     `json:"published,omitempty"`
+	CommentsClosed bool     `json:"comments_closed,omitempty"`
+	Categories     []uint64 `json:"categories,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+}
+
+// articleFromForm validates the submitted form and copies it into article
+func articleFromForm(c *middleware.Context, article *articles.Article) error {
+	r := c.Request
+	err := applyArticleInput(c, article, articleInput{
+		Title:          r.FormValue("title"),
+		Slug:           r.FormValue("slug"),
+		Summary:        r.FormValue("summary"),
+		Content:        r.FormValue("content"),
+		Published:      r.FormValue("published") != "",
+		CommentsClosed: r.FormValue("comments_closed") != "",
+	})
+	if err != nil {
+		return fmt.Errorf("articleFromForm: %w", err)
+	}
+	return nil
+}
+
+// reservedArticleSlugs are the fixed path segments after /articles/. An article
+// with one of these slugs would be hidden by the route.
+var reservedArticleSlugs = map[string]bool{
+	"new": true,
+}
+
+// applyArticleInput validates the input and copies it into article.
+// The published state only changes if the user may publish.
+func applyArticleInput(c *middleware.Context, article *articles.Article, input articleInput) error {
+	title := strings.TrimSpace(input.Title)
+	if title == "" || strings.TrimSpace(input.Content) == "" {
+		return middleware.Error(http.StatusBadRequest, errors.New("applyArticleInput: title and content are required"))
+	}
+
+	base := slug.Make(input.Slug)
+	if base == "" {
+		base = slug.Make(title)
+	}
+	articleSlug, err := slug.Unique(base, func(s string) (bool, error) {
+		if reservedArticleSlugs[s] {
+			return true, nil
+		}
+		return articles.SlugExists(c.Env(), s, article.ID)
+	})
+	if err != nil {
+		return fmt.Errorf("applyArticleInput: %w", err)
+	}
+
+	article.Title = title
+	article.Slug = articleSlug
+	article.Summary = strings.TrimSpace(input.Summary)
+	article.Content = input.Content
+	article.CommentsClosed = input.CommentsClosed
+	err = renderContent(article)
+	if err != nil {
+		return fmt.Errorf("applyArticleInput: %w", err)
+	}
+
+	if c.Can(roles.ArticlePublish) {
+		article.Published = input.Published
+		if article.Published && article.PublishedAt.IsZero() {
+			article.PublishedAt = article.UpdatedAt
+		}
+	}
+
+	return nil
+}
+
+// renderContent renders the Markdown of the article into its HTML fields
+func renderContent(article *articles.Article) error {
+	doc, err := markdown.Render(article.Content)
+	if err != nil {
+		return fmt.Errorf("renderContent: %w", err)
+	}
+	article.ContentHTML = doc.HTML
+	article.TOCHTML = doc.TOC
+	article.HTMLVersion = markdown.Version
+	return nil
+}
+
+// refreshArticleHTML renders articles saved before the current renderer and stores
+// the result, so only the first view after an update of the renderer renders them
+func refreshArticleHTML(c *middleware.Context, article *articles.Article) error {
+	if article.HTMLVersion == markdown.Version {
+		return nil
+	}
+	err := renderContent(article)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return fmt.Errorf("refreshArticleHTML: %w", err)
 	}
-	err = tmpl.Execute(w, nil)
+	err = articles.UpdateArticleHTML(c.Env(), *article)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return fmt.Errorf("refreshArticleHTML: %w", err)
 	}
+	return nil
 }
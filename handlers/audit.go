@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/audit"
+)
+
+// auditPerPage is the number of entries on each page of the audit log
+const auditPerPage = 50
+
+// auditFilter reads the filter of the audit log from the query. Days are
+// in the time zone of the site, to includes the whole day.
+func auditFilter(c *middleware.Context) (audit.Filter, error) {
+	query := c.Request.URL.Query()
+	filter := audit.Filter{
+		Action:   audit.Action(query.Get("action")),
+		Username: strings.TrimSpace(query.Get("user")),
+	}
+	if filter.Action != "" && !slices.Contains(audit.Actions, filter.Action) {
+		return audit.Filter{}, middleware.Error(http.StatusBadRequest, fmt.Errorf("auditFilter: unknown action %q", filter.Action))
+	}
+
+	location := c.Settings().Timezone
+	for _, bound := range []struct {
+		name string
+		dest *time.Time
+		days int
+	}{{"from", &filter.From, 0}, {"to", &filter.To, 1}} {
+		value := query.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		day, err := time.ParseInLocation("2006-01-02", value, location)
+		if err != nil {
+			return audit.Filter{}, middleware.Error(http.StatusBadRequest, fmt.Errorf("auditFilter: invalid %s date %q", bound.name, value))
+		}
+		*bound.dest = day.AddDate(0, 0, bound.days)
+	}
+	return filter, nil
+}
+
+// ShowAudit renders a page of the audit log, newest first
+func ShowAudit(c *middleware.Context) error {
+	filter, err := auditFilter(c)
+	if err != nil {
+		return fmt.Errorf("ShowAudit: %w", err)
+	}
+	page := pageNumber(c.Request)
+	list, err := audit.GetEntries(c.Env(), filter, auditPerPage+1, (page-1)*auditPerPage)
+	if err != nil {
+		return fmt.Errorf("ShowAudit: %w", err)
+	}
+
+	// one more entry than shown was fetched to know if there is a next page
+	nextPage := 0
+	if len(list) > auditPerPage {
+		list = list[:auditPerPage]
+		nextPage = page + 1
+	}
+
+	// the links to other pages keep the filter
+	query := c.Request.URL.Query()
+	query.Del("page")
+
+	err = render(c, "admin_audit.html", map[string]any{
+		"Entries":  list,
+		"Actions":  audit.Actions,
+		"Filter":   query,
+		"Query":    template.URL(query.Encode()),
+		"PrevPage": page - 1,
+		"NextPage": nextPage,
+	})
+	if err != nil {
+		return fmt.Errorf("ShowAudit: %w", err)
+	}
+	return nil
+}
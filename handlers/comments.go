@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/articles"
+	"github.com/AndreHeber/go-sqlite-blog/models/audit"
+	"github.com/AndreHeber/go-sqlite-blog/models/comments"
+	"github.com/AndreHeber/go-sqlite-blog/models/likes"
+	"github.com/AndreHeber/go-sqlite-blog/models/roles"
+	"github.com/AndreHeber/go-sqlite-blog/models/settings"
+)
+
+const (
+	commentMaxLength    = 5000
+	authorNameMaxLength = 100
+	commentsPerPage     = 20
+)
+
+// commentThread is a comment with the replies to it and its reactions
+type commentThread struct {
+	comments.Comment
+	Replies  []*commentThread
+	Likes    likes.Counts
+	Reaction likes.Reaction // of the current user
+}
+
+// commentThreads arranges the comments of an article as threads, in the order of the list.
+// Replies to comments which aren't in the list, because they aren't approved, are left out.
+// counts and reactions are by comment id.
+func commentThreads(list []comments.Comment, counts map[uint64]likes.Counts, reactions map[uint64]likes.Reaction) []*commentThread {
+	byID := make(map[uint64]*commentThread, len(list))
+	for _, comment := range list {
+		byID[comment.ID] = &commentThread{Comment: comment, Likes: counts[comment.ID], Reaction: reactions[comment.ID]}
+	}
+
+	var threads []*commentThread
+	for _, comment := range list {
+		thread := byID[comment.ID]
+		if comment.ParentID == 0 {
+			threads = append(threads, thread)
+			continue
+		}
+		if parent, ok := byID[comment.ParentID]; ok {
+			parent.Replies = append(parent.Replies, thread)
+		}
+	}
+	return threads
+}
+
+// validateComment checks the submitted author name and content of a comment
+func validateComment(authorName, content string) error {
+	if content == "" {
+		return errors.New("the comment is empty")
+	}
+	if utf8.RuneCountInString(content) > commentMaxLength {
+		return fmt.Errorf("the comment is longer than %d characters", commentMaxLength)
+	}
+	if authorName == "" {
+		return errors.New("a name is required")
+	}
+	if utf8.RuneCountInString(authorName) > authorNameMaxLength {
+		return fmt.Errorf("the name is longer than %d characters", authorNameMaxLength)
+	}
+	return nil
+}
+
+// errLoginToComment is returned by commentsOpen for anonymous users if only logged in users may comment
+var errLoginToComment = errors.New("log in to comment")
+
+// commentsOpen returns why the current user can't comment on the article, or nil if they can.
+// Who may comment depends on the comment policy, logged in users also need the permission to.
+func commentsOpen(c *middleware.Context, article articles.Article) error {
+	policy := c.Settings().CommentPolicy
+	if !article.Published || article.CommentsClosed || policy == settings.CommentsClosed {
+		return errors.New("comments are closed")
+	}
+	if c.User == nil && policy == settings.CommentsRegistered {
+		return errLoginToComment
+	}
+	if c.User != nil && !c.Can(roles.CommentCreate) {
+		return errors.New("not allowed to comment")
+	}
+	return nil
+}
+
+// CreateComment saves a comment on the article or a reply to one of its comments.
+// Comments wait for approval unless the author is a moderator or the comment policy is open.
+func CreateComment(c *middleware.Context) error {
+	article, err := articleFromPath(c)
+	if err != nil {
+		return fmt.Errorf("CreateComment: %w", err)
+	}
+	err = commentsOpen(c, article)
+	if err != nil {
+		return middleware.Error(http.StatusForbidden, fmt.Errorf("CreateComment: %w", err))
+	}
+
+	comment := comments.Comment{
+		ArticleID:  article.ID,
+		AuthorName: strings.TrimSpace(c.Request.FormValue("author_name")),
+		Content:    strings.TrimSpace(c.Request.FormValue("content")),
+		CreatedAt:  time.Now().UTC(),
+		Approved:   c.Can(roles.CommentModerate) || c.Settings().CommentPolicy == settings.CommentsOpen,
+	}
+	if c.User != nil {
+		comment.UserID = c.User.ID
+		comment.AuthorName = c.User.Username
+	}
+	err = validateComment(comment.AuthorName, comment.Content)
+	if err != nil {
+		return middleware.Error(http.StatusBadRequest, fmt.Errorf("CreateComment: %w", err))
+	}
+
+	if value := c.Request.FormValue("parent_id"); value != "" {
+		parentID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return middleware.Error(http.StatusBadRequest, fmt.Errorf("CreateComment: %w", err))
+		}
+		parent, err := comments.GetCommentByID(c.Env(), parentID)
+		if errors.Is(err, comments.ErrNotFound) || (err == nil && (parent.ArticleID != article.ID || !parent.Approved)) {
+			return middleware.Error(http.StatusBadRequest, errors.New("CreateComment: can't reply to this comment"))
+		}
+		if err != nil {
+			return fmt.Errorf("CreateComment: %w", err)
+		}
+		comment.ParentID = parent.ID
+	}
+
+	comment.ID, err = comments.CreateComment(c.Env(), comment)
+	if err != nil {
+		return fmt.Errorf("CreateComment: %w", err)
+	}
+
+	target := fmt.Sprintf("/articles/%s#comment-%d", article.Slug, comment.ID)
+	if !comment.Approved {
+		target = "/articles/" + article.Slug + "?comment=pending#comments"
+	}
+	http.Redirect(c.ResponseWriter, c.Request, target, http.StatusSeeOther)
+	return nil
+}
+
+// commentDetails identifies the comment in the audit log
+func commentDetails(comment comments.Comment) map[string]any {
+	return map[string]any{"comment_id": comment.ID, "article_id": comment.ArticleID, "author_name": comment.AuthorName}
+}
+
+// commentFromPath loads the comment of the {id} path value
+func commentFromPath(c *middleware.Context) (comments.Comment, error) {
+	id, err := strconv.ParseUint(c.Request.PathValue("id"), 10, 64)
+	if err != nil {
+		return comments.Comment{}, middleware.Error(http.StatusNotFound, err)
+	}
+	comment, err := comments.GetCommentByID(c.Env(), id)
+	if errors.Is(err, comments.ErrNotFound) {
+		return comments.Comment{}, middleware.Error(http.StatusNotFound, err)
+	}
+	return comment, err
+}
+
+// moderationStatus returns the status query or form parameter, pending by default
+func moderationStatus(r *http.Request) comments.Status {
+	switch status := comments.Status(r.FormValue("status")); status {
+	case comments.Approved, comments.Rejected:
+		return status
+	default:
+		return comments.Pending
+	}
+}
+
+// redirectToQueue returns to the moderation queue the request was sent from
+func redirectToQueue(c *middleware.Context) {
+	http.Redirect(c.ResponseWriter, c.Request, "/admin/comments?status="+url.QueryEscape(string(moderationStatus(c.Request))), http.StatusSeeOther)
+}
+
+// ShowComments renders the moderation queue, the comments waiting for approval.
+// The status query parameter shows the approved or rejected comments instead.
+func ShowComments(c *middleware.Context) error {
+	status := moderationStatus(c.Request)
+	page := pageNumber(c.Request)
+
+	list, err := comments.GetCommentsByStatus(c.Env(), status, commentsPerPage+1, (page-1)*commentsPerPage)
+	if err != nil {
+		return fmt.Errorf("ShowComments: %w", err)
+	}
+
+	// one more comment than shown was fetched to know if there is a next page
+	nextPage := 0
+	if len(list) > commentsPerPage {
+		list = list[:commentsPerPage]
+		nextPage = page + 1
+	}
+
+	err = render(c, "admin_comments.html", map[string]any{
+		"Status":   status,
+		"Statuses": []comments.Status{comments.Pending, comments.Approved, comments.Rejected},
+		"Comments": list,
+		"PrevPage": page - 1,
+		"NextPage": nextPage,
+	})
+	if err != nil {
+		return fmt.Errorf("ShowComments: %w", err)
+	}
+	return nil
+}
+
+// ApproveComment makes a comment public
+func ApproveComment(c *middleware.Context) error {
+	comment, err := commentFromPath(c)
+	if err != nil {
+		return fmt.Errorf("ApproveComment: %w", err)
+	}
+	err = comments.UpdateStatus(c.Env(), comment.ID, comments.Approved)
+	if err != nil {
+		return fmt.Errorf("ApproveComment: %w", err)
+	}
+	c.Audit(audit.CommentApproved, commentDetails(comment))
+	redirectToQueue(c)
+	return nil
+}
+
+// RejectComment hides a comment without deleting it
+func RejectComment(c *middleware.Context) error {
+	comment, err := commentFromPath(c)
+	if err != nil {
+		return fmt.Errorf("RejectComment: %w", err)
+	}
+	err = comments.UpdateStatus(c.Env(), comment.ID, comments.Rejected)
+	if err != nil {
+		return fmt.Errorf("RejectComment: %w", err)
+	}
+	c.Audit(audit.CommentRejected, commentDetails(comment))
+	redirectToQueue(c)
+	return nil
+}
+
+// DeleteComment deletes a comment and the replies to it
+func DeleteComment(c *middleware.Context) error {
+	comment, err := commentFromPath(c)
+	if err != nil {
+		return fmt.Errorf("DeleteComment: %w", err)
+	}
+	err = comments.DeleteComment(c.Env(), comment.ID)
+	if err != nil {
+		return fmt.Errorf("DeleteComment: %w", err)
+	}
+	c.Audit(audit.CommentDeleted, commentDetails(comment))
+	redirectToQueue(c)
+	return nil
+}
+
+// EditComment renders the form to change a comment
+func EditComment(c *middleware.Context) error {
+	comment, err := commentFromPath(c)
+	if err != nil {
+		return fmt.Errorf("EditComment: %w", err)
+	}
+	err = render(c, "comment_form.html", map[string]any{"Comment": comment})
+	if err != nil {
+		return fmt.Errorf("EditComment: %w", err)
+	}
+	return nil
+}
+
+// UpdateComment saves the changes of a moderator to a comment
+func UpdateComment(c *middleware.Context) error {
+	comment, err := commentFromPath(c)
+	if err != nil {
+		return fmt.Errorf("UpdateComment: %w", err)
+	}
+
+	authorName := strings.TrimSpace(c.Request.FormValue("author_name"))
+	content := strings.TrimSpace(c.Request.FormValue("content"))
+	err = validateComment(authorName, content)
+	if err != nil {
+		return middleware.Error(http.StatusBadRequest, fmt.Errorf("UpdateComment: %w", err))
+	}
+
+	err = comments.UpdateContent(c.Env(), comment.ID, authorName, content)
+	if err != nil {
+		return fmt.Errorf("UpdateComment: %w", err)
+	}
+	c.Audit(audit.CommentEdited, commentDetails(comment))
+	http.Redirect(c.ResponseWriter, c.Request, "/admin/comments?status="+url.QueryEscape(string(comment.Status())), http.StatusSeeOther)
+	return nil
+}
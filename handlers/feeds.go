@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/AndreHeber/go-sqlite-blog/feed"
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/articles"
+	"github.com/AndreHeber/go-sqlite-blog/models/categories"
+	"github.com/AndreHeber/go-sqlite-blog/models/tags"
+)
+
+// feedSize is the number of articles in a feed
+const feedSize = 20
+
+// summaryLength is the length of the summary taken from the content of articles without one
+const summaryLength = 300
+
+// articleSummary returns the summary of the article or the beginning of its content
+func articleSummary(article articles.Article) string {
+	if article.Summary != "" {
+		return article.Summary
+	}
+	content := strings.Join(strings.Fields(article.Content), " ")
+	if utf8.RuneCountInString(content) <= summaryLength {
+		return content
+	}
+	return string([]rune(content)[:summaryLength]) + "…"
+}
+
+// newFeed builds the feed of the articles with the site wide settings.
+// Whether the feed contains the full articles or only the summaries is the feed_full_content setting.
+func newFeed(c *middleware.Context, title string, link string, list []articles.Article) (feed.Feed, error) {
+	site := c.Settings()
+	siteTitle := site.SiteTitle
+
+	baseURL := strings.TrimSuffix(c.Config.BaseURL, "/")
+	f := feed.Feed{
+		Title:       siteTitle,
+		Description: site.SiteDescription,
+		Author:      siteTitle,
+		Link:        baseURL + link,
+		FeedURL:     baseURL + c.Request.URL.Path,
+	}
+	if title != "" {
+		f.Title = siteTitle + " - " + title
+	}
+
+	for _, article := range list {
+		item := feed.Item{
+			Title:     article.Title,
+			Link:      baseURL + "/articles/" + article.Slug,
+			Summary:   articleSummary(article),
+			Published: article.PublishedAt,
+			Updated:   article.UpdatedAt,
+		}
+		if site.FeedFullContent {
+			err := refreshArticleHTML(c, &article)
+			if err != nil {
+				return feed.Feed{}, fmt.Errorf("newFeed: %w", err)
+			}
+			item.ContentHTML = article.ContentHTML
+		}
+		if item.Updated.After(f.Updated) {
+			f.Updated = item.Updated
+		}
+		f.Items = append(f.Items, item)
+	}
+
+	return f, nil
+}
+
+// serveFeed writes the feed in the format. The ETag is the hash of the body, so unchanged feeds
+// are answered with 304 Not Modified. There is no Last-Modified, the newest article in the feed
+// stays the same when another one is deleted or unpublished.
+func serveFeed(c *middleware.Context, f feed.Feed, format feed.Format) error {
+	body, err := feed.Encode(f, format)
+	if err != nil {
+		return fmt.Errorf("serveFeed: %w", err)
+	}
+
+	sum := sha256.Sum256(body)
+	header := c.ResponseWriter.Header()
+	header.Set("Content-Type", format.ContentType())
+	header.Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	header.Set("Cache-Control", "no-cache")
+	http.ServeContent(c.ResponseWriter, c.Request, "", time.Time{}, bytes.NewReader(body))
+	return nil
+}
+
+// Feed returns the handler of the feed of all published articles
+func Feed(format feed.Format) middleware.HandlerFunc {
+	return func(c *middleware.Context) error {
+		env := c.Env()
+		list, err := articles.GetPublishedArticles(env, feedSize, 0)
+		if err != nil {
+			return fmt.Errorf("Feed: %w", err)
+		}
+
+		f, err := newFeed(c, "", "/", list)
+		if err != nil {
+			return fmt.Errorf("Feed: %w", err)
+		}
+		err = serveFeed(c, f, format)
+		if err != nil {
+			return fmt.Errorf("Feed: %w", err)
+		}
+		return nil
+	}
+}
+
+// CategoryFeed returns the handler of the feed of the category in the {slug} path value
+func CategoryFeed(format feed.Format) middleware.HandlerFunc {
+	return func(c *middleware.Context) error {
+		env := c.Env()
+		category, err := categories.GetCategoryBySlug(env, c.Request.PathValue("slug"))
+		if errors.Is(err, categories.ErrNotFound) {
+			return middleware.Error(http.StatusNotFound, fmt.Errorf("CategoryFeed: %w", err))
+		}
+		if err != nil {
+			return fmt.Errorf("CategoryFeed: %w", err)
+		}
+
+		list, err := articles.GetPublishedArticlesByCategory(env, category.ID, feedSize, 0)
+		if err != nil {
+			return fmt.Errorf("CategoryFeed: %w", err)
+		}
+
+		f, err := newFeed(c, category.Name, "/category/"+category.Slug, list)
+		if err != nil {
+			return fmt.Errorf("CategoryFeed: %w", err)
+		}
+		err = serveFeed(c, f, format)
+		if err != nil {
+			return fmt.Errorf("CategoryFeed: %w", err)
+		}
+		return nil
+	}
+}
+
+// TagFeed returns the handler of the feed of the tag in the {slug} path value
+func TagFeed(format feed.Format) middleware.HandlerFunc {
+	return func(c *middleware.Context) error {
+		env := c.Env()
+		tag, err := tags.GetTagBySlug(env, c.Request.PathValue("slug"))
+		if errors.Is(err, tags.ErrNotFound) {
+			return middleware.Error(http.StatusNotFound, fmt.Errorf("TagFeed: %w", err))
+		}
+		if err != nil {
+			return fmt.Errorf("TagFeed: %w", err)
+		}
+
+		list, err := articles.GetPublishedArticlesByTag(env, tag.ID, feedSize, 0)
+		if err != nil {
+			return fmt.Errorf("TagFeed: %w", err)
+		}
+
+		f, err := newFeed(c, tag.Name, "/tag/"+tag.Slug, list)
+		if err != nil {
+			return fmt.Errorf("TagFeed: %w", err)
+		}
+		err = serveFeed(c, f, format)
+		if err != nil {
+			return fmt.Errorf("TagFeed: %w", err)
+		}
+		return nil
+	}
+}
@@ -7,12 +7,12 @@ import (
 	"github.com/AndreHeber/go-sqlite-blog/middleware"
 )
 
-func Health(a *middleware.Adapter) error {
-	a.ResponseWriter.WriteHeader(http.StatusOK)
+func Health(c *middleware.Context) error {
+	c.ResponseWriter.WriteHeader(http.StatusOK)
 	return nil
 }
 
-func TimeConsumingHandler(a *middleware.Adapter) error {
+func TimeConsumingHandler(c *middleware.Context) error {
 	time.Sleep(5 * time.Second)
 	return nil
 }
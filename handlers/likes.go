@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/comments"
+	"github.com/AndreHeber/go-sqlite-blog/models/likes"
+)
+
+// mostLikedSize is the number of articles in the most liked listing
+const mostLikedSize = 20
+
+// likeResponse is the JSON answer of the like endpoints
+type likeResponse struct {
+	Reaction string `json:"reaction"` // empty if the user has no reaction
+	likes.Counts
+}
+
+// isJSON reports whether the body of the request is JSON
+func isJSON(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
+// wantsJSON reports whether the client expects a JSON answer instead of a redirect
+func wantsJSON(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept") {
+		for _, accepted := range strings.Split(value, ",") {
+			if mediaType, _, _ := mime.ParseMediaType(accepted); mediaType == "application/json" {
+				return true
+			}
+		}
+	}
+	return isJSON(r)
+}
+
+// reactionFromRequest reads the reaction from the form or the JSON body, like is the default
+func reactionFromRequest(r *http.Request) (likes.Reaction, error) {
+	var value string
+	if isJSON(r) {
+		var body struct {
+			Reaction string `json:"reaction"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, middleware.Error(http.StatusBadRequest, fmt.Errorf("reactionFromRequest: %w", err))
+		}
+		value = body.Reaction
+	} else {
+		value = r.FormValue("reaction")
+	}
+	if value == "" {
+		return likes.Like, nil
+	}
+	reaction, err := likes.ParseReaction(value)
+	if err != nil {
+		return 0, middleware.Error(http.StatusBadRequest, fmt.Errorf("reactionFromRequest: %w", err))
+	}
+	return reaction, nil
+}
+
+// toggleLike toggles the reaction of the current user to the target. JSON clients get
+// the new state, forms are redirected back to the article.
+func toggleLike(c *middleware.Context, target likes.Target, redirect string, count func() (likes.Counts, error)) error {
+	reaction, err := reactionFromRequest(c.Request)
+	if err != nil {
+		return fmt.Errorf("toggleLike: %w", err)
+	}
+	reaction, err = likes.Toggle(c.Env(), c.User.ID, target, reaction)
+	if err != nil {
+		return fmt.Errorf("toggleLike: %w", err)
+	}
+
+	if !wantsJSON(c.Request) {
+		http.Redirect(c.ResponseWriter, c.Request, redirect, http.StatusSeeOther)
+		return nil
+	}
+	counts, err := count()
+	if err != nil {
+		return fmt.Errorf("toggleLike: %w", err)
+	}
+	c.ResponseWriter.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(c.ResponseWriter).Encode(likeResponse{Reaction: reaction.String(), Counts: counts})
+	if err != nil {
+		return fmt.Errorf("toggleLike: %w", err)
+	}
+	return nil
+}
+
+// LikeArticle toggles the like or dislike of the current user on the article.
+// The reaction is "like" or "dislike" in the form or JSON body, like if missing.
+func LikeArticle(c *middleware.Context) error {
+	article, err := articleFromPath(c)
+	if err != nil {
+		return fmt.Errorf("LikeArticle: %w", err)
+	}
+	if !article.Published {
+		return middleware.Error(http.StatusForbidden, errors.New("LikeArticle: drafts can't be liked"))
+	}
+
+	err = toggleLike(c, likes.Target{ArticleID: article.ID}, "/articles/"+article.Slug+"#likes", func() (likes.Counts, error) {
+		return likes.GetArticleCounts(c.Env(), article.ID)
+	})
+	if err != nil {
+		return fmt.Errorf("LikeArticle: %w", err)
+	}
+	return nil
+}
+
+// LikeComment toggles the like or dislike of the current user on an approved comment of the article
+func LikeComment(c *middleware.Context) error {
+	article, err := articleFromPath(c)
+	if err != nil {
+		return fmt.Errorf("LikeComment: %w", err)
+	}
+	id, err := idFromPath(c)
+	if err != nil {
+		return fmt.Errorf("LikeComment: %w", err)
+	}
+	comment, err := comments.GetCommentByID(c.Env(), id)
+	if errors.Is(err, comments.ErrNotFound) || (err == nil && (comment.ArticleID != article.ID || !comment.Approved)) {
+		return middleware.Error(http.StatusNotFound, fmt.Errorf("LikeComment: %w", comments.ErrNotFound))
+	}
+	if err != nil {
+		return fmt.Errorf("LikeComment: %w", err)
+	}
+	if !article.Published {
+		return middleware.Error(http.StatusForbidden, errors.New("LikeComment: comments of drafts can't be liked"))
+	}
+
+	redirect := fmt.Sprintf("/articles/%s#comment-%d", article.Slug, comment.ID)
+	err = toggleLike(c, likes.Target{CommentID: comment.ID}, redirect, func() (likes.Counts, error) {
+		counts, err := likes.GetCommentCounts(c.Env(), article.ID)
+		return counts[comment.ID], err
+	})
+	if err != nil {
+		return fmt.Errorf("LikeComment: %w", err)
+	}
+	return nil
+}
+
+// MostLiked renders the published articles with the most likes
+func MostLiked(c *middleware.Context) error {
+	list, err := likes.GetMostLikedArticles(c.Env(), mostLikedSize)
+	if err != nil {
+		return fmt.Errorf("MostLiked: %w", err)
+	}
+	err = render(c, "popular.html", map[string]any{"Articles": list})
+	if err != nil {
+		return fmt.Errorf("MostLiked: %w", err)
+	}
+	return nil
+}
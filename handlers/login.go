@@ -3,28 +3,27 @@ package handlers
 import (
 	"errors"
 	"fmt"
-	"html/template"
+	"net/http"
+	"strings"
+	"time"
 
+	"github.com/AndreHeber/go-sqlite-blog/config"
 	"github.com/AndreHeber/go-sqlite-blog/middleware"
 	"github.com/AndreHeber/go-sqlite-blog/models"
+	"github.com/AndreHeber/go-sqlite-blog/models/audit"
 	"github.com/AndreHeber/go-sqlite-blog/models/users"
 )
 
-func ShowLogin(a *middleware.Adapter) error {
-	w := a.ResponseWriter
-	tmpl, err := template.ParseFiles("static/templates/login.html")
-	if err != nil {
-		return fmt.Errorf("ShowLogin: %w", err)
-	}
-	err = tmpl.Execute(w, nil)
+func ShowLogin(c *middleware.Context) error {
+	err := render(c, "login.html", map[string]string{"Next": c.Request.URL.Query().Get("next")})
 	if err != nil {
 		return fmt.Errorf("ShowLogin: %w", err)
 	}
 	return nil
 }
 
-func TryLogin(a *middleware.Adapter) error {
-	r := a.Request
+func TryLogin(c *middleware.Context) error {
+	r := c.Request
 
 	err := r.ParseForm()
 	if err != nil {
@@ -33,33 +32,92 @@ func TryLogin(a *middleware.Adapter) error {
 	username := r.FormValue("username")
 	password := r.FormValue("password")
 
-	err = login(models.EnvFromAdapter(a), username, password)
+	user, err := login(c.Env(), c.Config.Password, username, password)
 	if err != nil {
-		if a.ErrorInResponse {
-			return fmt.Errorf("TryLogin: %w", err)
+		c.Audit(audit.LoginFailed, map[string]any{"username": username})
+		if c.ErrorInResponse {
+			return middleware.Error(http.StatusUnauthorized, fmt.Errorf("TryLogin: %w", err))
 		}
-		return fmt.Errorf("TryLogin: username or password is invalid")
+		return middleware.Error(http.StatusUnauthorized, fmt.Errorf("TryLogin: username or password is invalid"))
+	}
+
+	if c.Config.Accounts.RequireVerifiedEmail && !user.Verified {
+		c.Audit(audit.LoginFailed, map[string]any{"username": username, "reason": "email address not verified"})
+		return middleware.Error(http.StatusForbidden, errors.New("TryLogin: email address not verified, see /verify/resend"))
 	}
 
+	err = c.StartSession(user)
+	if err != nil {
+		return fmt.Errorf("TryLogin: %w", err)
+	}
+	c.Audit(audit.LoginSucceeded, nil)
+
+	http.Redirect(c.ResponseWriter, r, redirectTarget(r.FormValue("next")), http.StatusSeeOther)
 	return nil
 }
 
-func login(env *models.Env, username, password string) error {
+func login(env *models.Env, params config.PasswordConfig, username, password string) (users.User, error) {
 	// verify input
 	if username == "" || password == "" {
-		return errors.New("login: username and password are required")
+		return users.User{}, errors.New("login: username and password are required")
 	}
 
 	// get user from database
 	user, err := users.GetUserByUsername(env, username)
 	if err != nil {
-		return fmt.Errorf("login: %w", err)
+		return users.User{}, fmt.Errorf("login: %w", err)
 	}
 
 	// verify password
-	if !verifyPassword(password, user.HashedPassword, user.Salt) {
-		return errors.New("login: invalid password")
+	match, rehash := verifyPassword(password, user.HashedPassword, user.Salt, params)
+	if !match {
+		return users.User{}, errors.New("login: invalid password")
+	}
+
+	// the password is known right now, so outdated hashes can be upgraded
+	if rehash {
+		user.HashedPassword, user.Salt = hashPassword(password, params), ""
+		err = users.UpdatePassword(env, user.ID, user.HashedPassword, user.Salt)
+		if err != nil {
+			return users.User{}, fmt.Errorf("login: %w", err)
+		}
+	}
+
+	user.LastLogin = time.Now()
+	err = users.UpdateLastLogin(env, user.ID, user.LastLogin)
+	if err != nil {
+		return users.User{}, fmt.Errorf("login: %w", err)
 	}
 
+	return user, nil
+}
+
+// Logout ends the current session
+func Logout(c *middleware.Context) error {
+	err := c.EndSession()
+	if err != nil {
+		return fmt.Errorf("Logout: %w", err)
+	}
+
+	http.Redirect(c.ResponseWriter, c.Request, "/login", http.StatusSeeOther)
+	return nil
+}
+
+// LogoutEverywhere ends all sessions of the current user
+func LogoutEverywhere(c *middleware.Context) error {
+	err := c.EndAllSessions()
+	if err != nil {
+		return fmt.Errorf("LogoutEverywhere: %w", err)
+	}
+
+	http.Redirect(c.ResponseWriter, c.Request, "/login", http.StatusSeeOther)
 	return nil
 }
+
+// redirectTarget only allows redirects to local paths, to avoid open redirects
+func redirectTarget(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/imaging"
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/media"
+	"github.com/AndreHeber/go-sqlite-blog/models/roles"
+	"github.com/AndreHeber/go-sqlite-blog/slug"
+	"github.com/AndreHeber/go-sqlite-blog/storage"
+)
+
+const mediaPerPage = 24
+
+// mediaTypes are the content types that may be uploaded, with the extension of their files.
+// Types that browsers run scripts in, like HTML and SVG, are left out.
+var mediaTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+// mediaStorage returns the storage of the uploads
+func mediaStorage(c *middleware.Context) storage.Storage {
+	return storage.New(c.Config.Media.Dir)
+}
+
+// canDeleteMedia reports whether the current user may delete the upload.
+// Uploaders may delete their own uploads, users with media.delete all of them.
+func canDeleteMedia(c *middleware.Context, m media.Media) bool {
+	if c.User == nil {
+		return false
+	}
+	return c.Can(roles.MediaDelete) || (m.UploadedBy == c.User.ID && c.Can(roles.MediaUpload))
+}
+
+// mediaFromPath loads the upload of the {id} path value
+func mediaFromPath(c *middleware.Context) (media.Media, error) {
+	id, err := idFromPath(c)
+	if err != nil {
+		return media.Media{}, err
+	}
+	m, err := media.GetMediaByID(c.Env(), id)
+	if errors.Is(err, media.ErrNotFound) {
+		return media.Media{}, middleware.Error(http.StatusNotFound, err)
+	}
+	return m, err
+}
+
+// mediaFileName makes a url safe file name from the name of the uploaded file
+// and the extension of its content type
+func mediaFileName(name, ext string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	stem := slug.Make(strings.TrimSuffix(name, path.Ext(name)))
+	if stem == "" {
+		stem = "file"
+	}
+	return stem + ext
+}
+
+// humanSize formats a file size like 1.5 MB
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, prefix := float64(size)/unit, 0
+	for value >= unit && prefix < 3 {
+		value /= unit
+		prefix++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "KMGT"[prefix])
+}
+
+// uploadError answers errors reading the upload with 400 Bad Request,
+// or 413 Request Entity Too Large if the body exceeds the limit of the route
+func uploadError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return err
+	}
+	return middleware.Error(http.StatusBadRequest, err)
+}
+
+// mediaItem is an upload in the media browser
+type mediaItem struct {
+	media.Media
+	HumanSize string
+	IsImage   bool
+	Srcset    string
+	Sizes     int // number of resized versions
+	CanDelete bool
+}
+
+// ShowMedia renders the media browser with the upload form
+func ShowMedia(c *middleware.Context) error {
+	page := pageNumber(c.Request)
+	list, err := media.GetMedia(c.Env(), mediaPerPage+1, (page-1)*mediaPerPage)
+	if err != nil {
+		return fmt.Errorf("ShowMedia: %w", err)
+	}
+
+	// one more upload than shown was fetched to know if there is a next page
+	nextPage := 0
+	if len(list) > mediaPerPage {
+		list = list[:mediaPerPage]
+		nextPage = page + 1
+	}
+
+	items := make([]mediaItem, len(list))
+	for i, m := range list {
+		derivatives, err := media.GetDerivatives(c.Env(), m.ID)
+		if err != nil {
+			return fmt.Errorf("ShowMedia: %w", err)
+		}
+		items[i] = mediaItem{
+			Media:     m,
+			HumanSize: humanSize(m.Size),
+			IsImage:   strings.HasPrefix(m.ContentType, "image/"),
+			Srcset:    media.Srcset(append(derivatives, m)...),
+			Sizes:     len(derivatives),
+			CanDelete: canDeleteMedia(c, m),
+		}
+	}
+
+	err = render(c, "admin_media.html", map[string]any{
+		"Media":    items,
+		"MaxSize":  humanSize(c.Config.Media.MaxSize),
+		"PrevPage": page - 1,
+		"NextPage": nextPage,
+	})
+	if err != nil {
+		return fmt.Errorf("ShowMedia: %w", err)
+	}
+	return nil
+}
+
+// UploadMedia stores the file of the multipart form field "file". The content type is
+// sniffed from the content, the extension and content type sent by the browser are ignored.
+// Images lose their metadata, photos are turned upright and resized versions are stored with them.
+func UploadMedia(c *middleware.Context) error {
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return middleware.Error(http.StatusBadRequest, fmt.Errorf("UploadMedia: %w", err))
+	}
+	var part io.Reader
+	var fileName string
+	for part == nil {
+		next, err := reader.NextPart()
+		if err == io.EOF {
+			return middleware.Error(http.StatusBadRequest, errors.New("UploadMedia: no file uploaded"))
+		}
+		if err != nil {
+			return uploadError(fmt.Errorf("UploadMedia: %w", err))
+		}
+		if next.FormName() == "file" && next.FileName() != "" {
+			part, fileName = next, next.FileName()
+		}
+	}
+
+	buffered := bufio.NewReaderSize(part, 512)
+	head, err := buffered.Peek(512)
+	if err != nil && err != io.EOF {
+		return uploadError(fmt.Errorf("UploadMedia: %w", err))
+	}
+	if len(head) == 0 {
+		return middleware.Error(http.StatusBadRequest, errors.New("UploadMedia: the file is empty"))
+	}
+	contentType := http.DetectContentType(head)
+	ext, ok := mediaTypes[contentType]
+	if !ok {
+		return middleware.Error(http.StatusUnsupportedMediaType, fmt.Errorf("UploadMedia: files of type %s are not allowed", contentType))
+	}
+
+	maxSize := c.Config.Media.MaxSize
+	data, err := io.ReadAll(io.LimitReader(buffered, maxSize+1))
+	if err != nil {
+		return uploadError(fmt.Errorf("UploadMedia: %w", err))
+	}
+	if int64(len(data)) > maxSize {
+		return middleware.Error(http.StatusRequestEntityTooLarge, fmt.Errorf("UploadMedia: the file is larger than %s", humanSize(maxSize)))
+	}
+
+	m := media.Media{
+		FileName:    mediaFileName(fileName, ext),
+		ContentType: contentType,
+		UploadedBy:  c.User.ID,
+		UploadedAt:  time.Now().UTC(),
+	}
+	if strings.HasPrefix(contentType, "image/") {
+		data, err = imaging.Sanitize(data, contentType)
+		if err == nil {
+			var config image.Config
+			config, err = imaging.Config(data)
+			m.Width, m.Height = config.Width, config.Height
+		}
+		if errors.Is(err, imaging.ErrInvalid) || errors.Is(err, imaging.ErrTooManyPixels) {
+			return middleware.Error(http.StatusBadRequest, fmt.Errorf("UploadMedia: %w", err))
+		}
+		if err != nil {
+			return fmt.Errorf("UploadMedia: %w", err)
+		}
+	}
+
+	store := mediaStorage(c)
+	file, err := store.Save(bytes.NewReader(data), ext, int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("UploadMedia: %w", err)
+	}
+	m.FilePath, m.Size, m.Hash = file.Path, file.Size, file.Hash
+	m.ID, err = media.CreateMedia(c.Env(), m)
+	if err != nil {
+		removeUnusedFile(c, store, file.Path)
+		return fmt.Errorf("UploadMedia: %w", err)
+	}
+
+	if m.Width > 0 {
+		err = createDerivatives(c, store, m, data)
+		if err != nil {
+			// the original works without them, pages just load slower
+			c.Logger.Error("handlers: UploadMedia", "error", err, "id", m.ID)
+		}
+	}
+
+	http.Redirect(c.ResponseWriter, c.Request, "/admin/media", http.StatusSeeOther)
+	return nil
+}
+
+// createDerivatives stores resized versions of an image in the configured widths that are
+// narrower than the original. Animated GIFs are left alone, resizing would keep only the first frame.
+func createDerivatives(c *middleware.Context, store storage.Storage, original media.Media, data []byte) error {
+	if original.ContentType == "image/gif" {
+		return nil
+	}
+	widths := slices.Clone(c.Config.Media.ImageWidths)
+	slices.Sort(widths)
+	widths = slices.Compact(widths)
+	if len(widths) == 0 || widths[0] >= original.Width {
+		return nil
+	}
+
+	img, err := imaging.Decode(data)
+	if err != nil {
+		return fmt.Errorf("createDerivatives: %w", err)
+	}
+	stem := strings.TrimSuffix(original.FileName, path.Ext(original.FileName))
+	for _, width := range widths {
+		if width >= original.Width {
+			break
+		}
+		resized := imaging.Resize(img, width)
+		var buf bytes.Buffer
+		contentType, err := imaging.Encode(&buf, resized)
+		if err != nil {
+			return fmt.Errorf("createDerivatives: %w", err)
+		}
+		ext := mediaTypes[contentType]
+		file, err := store.Save(&buf, ext, int64(buf.Len()))
+		if err != nil {
+			return fmt.Errorf("createDerivatives: %w", err)
+		}
+
+		derivative := media.Media{
+			ParentID:    original.ID,
+			FileName:    fmt.Sprintf("%s-%dw%s", stem, width, ext),
+			FilePath:    file.Path,
+			ContentType: contentType,
+			Size:        file.Size,
+			Hash:        file.Hash,
+			Width:       resized.Bounds().Dx(),
+			Height:      resized.Bounds().Dy(),
+			UploadedBy:  original.UploadedBy,
+			UploadedAt:  original.UploadedAt,
+		}
+		_, err = media.CreateMedia(c.Env(), derivative)
+		if err != nil {
+			removeUnusedFile(c, store, file.Path)
+			return fmt.Errorf("createDerivatives: %w", err)
+		}
+	}
+	return nil
+}
+
+// removeUnusedFile deletes a stored file unless another upload has the same content
+func removeUnusedFile(c *middleware.Context, store storage.Storage, filePath string) {
+	inUse, err := media.FilePathInUse(c.Env(), filePath)
+	if err == nil && !inUse {
+		err = store.Remove(filePath)
+	}
+	if err != nil {
+		c.Logger.Error("handlers: removeUnusedFile", "error", err, "file_path", filePath)
+	}
+}
+
+// DeleteMedia deletes an upload with its resized versions, unless an article links to one of them
+func DeleteMedia(c *middleware.Context) error {
+	m, err := mediaFromPath(c)
+	if err != nil {
+		return fmt.Errorf("DeleteMedia: %w", err)
+	}
+	if m.ParentID != 0 {
+		return middleware.Error(http.StatusBadRequest, errors.New("DeleteMedia: resized images are deleted with their original"))
+	}
+	if !canDeleteMedia(c, m) {
+		return middleware.Error(http.StatusForbidden, errors.New("DeleteMedia: not allowed to delete this file"))
+	}
+
+	derivatives, err := media.GetDerivatives(c.Env(), m.ID)
+	if err != nil {
+		return fmt.Errorf("DeleteMedia: %w", err)
+	}
+	files := append([]media.Media{m}, derivatives...)
+	for _, file := range files {
+		slugs, err := media.GetReferencingArticles(c.Env(), file.ID)
+		if err != nil {
+			return fmt.Errorf("DeleteMedia: %w", err)
+		}
+		if len(slugs) > 0 {
+			return middleware.Error(http.StatusConflict, fmt.Errorf("DeleteMedia: %s is used by the articles %s", file.FileName, strings.Join(slugs, ", ")))
+		}
+	}
+
+	err = media.DeleteMedia(c.Env(), m.ID)
+	if err != nil {
+		return fmt.Errorf("DeleteMedia: %w", err)
+	}
+	store := mediaStorage(c)
+	for _, file := range files {
+		removeUnusedFile(c, store, file.FilePath)
+	}
+
+	http.Redirect(c.ResponseWriter, c.Request, "/admin/media", http.StatusSeeOther)
+	return nil
+}
+
+// ServeMedia serves the upload of the {id} path value. The {name} path value has to match
+// its file name. The content of an id never changes, so browsers may cache it forever.
+func ServeMedia(c *middleware.Context) error {
+	m, err := mediaFromPath(c)
+	if err != nil {
+		return fmt.Errorf("ServeMedia: %w", err)
+	}
+	if c.Request.PathValue("name") != m.FileName {
+		return middleware.Error(http.StatusNotFound, fmt.Errorf("ServeMedia: %w", media.ErrNotFound))
+	}
+
+	f, err := mediaStorage(c).Open(m.FilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return middleware.Error(http.StatusNotFound, fmt.Errorf("ServeMedia: %w", err))
+	}
+	if err != nil {
+		return fmt.Errorf("ServeMedia: %w", err)
+	}
+	defer f.Close()
+
+	header := c.ResponseWriter.Header()
+	header.Set("Content-Type", m.ContentType)
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	header.Set("ETag", `"`+m.Hash+`"`)
+	http.ServeContent(c.ResponseWriter, c.Request, m.FileName, m.UploadedAt, f)
+	return nil
+}
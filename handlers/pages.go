@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/pages"
+	"github.com/AndreHeber/go-sqlite-blog/models/roles"
+	"github.com/AndreHeber/go-sqlite-blog/slug"
+)
+
+// reservedSlugs are the first path segments of the built-in routes. Pages are served
+// at /<slug>, so they can't use these slugs without being hidden by the routes.
+var reservedSlugs = map[string]bool{
+	"account":        true,
+	"admin":          true,
+	"api":            true,
+	"articles":       true,
+	"category":       true,
+	"health":         true,
+	"login":          true,
+	"logout":         true,
+	"media":          true,
+	"password":       true,
+	"popular":        true,
+	"register":       true,
+	"search":         true,
+	"static":         true,
+	"tag":            true,
+	"tags":           true,
+	"time-consuming": true,
+	"verify":         true,
+}
+
+// pageFromPath loads the page of the {id} path value
+func pageFromPath(c *middleware.Context) (pages.Page, error) {
+	id, err := idFromPath(c)
+	if err != nil {
+		return pages.Page{}, err
+	}
+	page, err := pages.GetPageByID(c.Env(), id)
+	if errors.Is(err, pages.ErrNotFound) {
+		return pages.Page{}, middleware.Error(http.StatusNotFound, err)
+	}
+	return page, err
+}
+
+// pageFromSlug loads the page of the {slug} path value. Drafts are only visible to editors.
+func pageFromSlug(c *middleware.Context) (pages.Page, error) {
+	page, err := pages.GetPageBySlug(c.Env(), c.Request.PathValue("slug"))
+	if errors.Is(err, pages.ErrNotFound) {
+		return pages.Page{}, middleware.Error(http.StatusNotFound, err)
+	}
+	if err != nil {
+		return pages.Page{}, err
+	}
+	if !page.Published && !c.Can(roles.PageEdit) {
+		return pages.Page{}, middleware.Error(http.StatusNotFound, pages.ErrNotFound)
+	}
+	return page, nil
+}
+
+// pageInput are the fields of a page an editor submits, by the form or the API
+type pageInput struct {
+	Title     string `json:"title"`
+	Slug      string `json:"slug,omitempty"` // made from the title if empty
+	Content   string `json:"content"`
+	Published bool   `json:"published,omitempty"`
+	MenuOrder int    `json:"menu_order,omitempty"`
+}
+
+// pageFromForm validates the submitted form and copies it into page
+func pageFromForm(c *middleware.Context, page *pages.Page) error {
+	r := c.Request
+
+	menuOrder := 0
+	if value := strings.TrimSpace(r.FormValue("menu_order")); value != "" {
+		var err error
+		menuOrder, err = strconv.Atoi(value)
+		if err != nil {
+			return middleware.Error(http.StatusBadRequest, fmt.Errorf("pageFromForm: invalid menu order %q", value))
+		}
+	}
+
+	err := applyPageInput(c, page, pageInput{
+		Title:     r.FormValue("title"),
+		Slug:      r.FormValue("slug"),
+		Content:   r.FormValue("content"),
+		Published: r.FormValue("published") != "",
+		MenuOrder: menuOrder,
+	})
+	if err != nil {
+		return fmt.Errorf("pageFromForm: %w", err)
+	}
+	return nil
+}
+
+// applyPageInput validates the input and copies it into page
+func applyPageInput(c *middleware.Context, page *pages.Page, input pageInput) error {
+	title := strings.TrimSpace(input.Title)
+	if title == "" || strings.TrimSpace(input.Content) == "" {
+		return middleware.Error(http.StatusBadRequest, errors.New("applyPageInput: title and content are required"))
+	}
+	if input.MenuOrder < 0 {
+		return middleware.Error(http.StatusBadRequest, fmt.Errorf("applyPageInput: invalid menu order %d", input.MenuOrder))
+	}
+
+	base := slug.Make(input.Slug)
+	if base == "" {
+		base = slug.Make(title)
+	}
+	pageSlug, err := slug.Unique(base, func(s string) (bool, error) {
+		if reservedSlugs[s] {
+			return true, nil
+		}
+		return pages.SlugExists(c.Env(), s, page.ID)
+	})
+	if err != nil {
+		return fmt.Errorf("applyPageInput: %w", err)
+	}
+
+	page.Title = title
+	page.Slug = pageSlug
+	page.Content = input.Content
+	page.Published = input.Published
+	page.MenuOrder = input.MenuOrder
+	return nil
+}
+
+// ShowPage renders the page of the {slug} path value. Drafts are only visible to editors.
+func ShowPage(c *middleware.Context) error {
+	page, err := pageFromSlug(c)
+	if err != nil {
+		return fmt.Errorf("ShowPage: %w", err)
+	}
+
+	err = render(c, "page.html", map[string]any{"Page": page})
+	if err != nil {
+		return fmt.Errorf("ShowPage: %w", err)
+	}
+	return nil
+}
+
+// ShowPages renders the list of pages to manage them
+func ShowPages(c *middleware.Context) error {
+	list, err := pages.GetPages(c.Env())
+	if err != nil {
+		return fmt.Errorf("ShowPages: %w", err)
+	}
+	err = render(c, "admin_pages.html", map[string]any{"Pages": list})
+	if err != nil {
+		return fmt.Errorf("ShowPages: %w", err)
+	}
+	return nil
+}
+
+// NewPage renders the form for a new page
+func NewPage(c *middleware.Context) error {
+	err := render(c, "page_form.html", map[string]any{"Page": pages.Page{}})
+	if err != nil {
+		return fmt.Errorf("NewPage: %w", err)
+	}
+	return nil
+}
+
+// CreatePage saves the submitted page
+func CreatePage(c *middleware.Context) error {
+	now := time.Now().UTC()
+	page := pages.Page{CreatedAt: now, UpdatedAt: now}
+	err := pageFromForm(c, &page)
+	if err != nil {
+		return fmt.Errorf("CreatePage: %w", err)
+	}
+	_, err = pages.CreatePage(c.Env(), page)
+	if err != nil {
+		return fmt.Errorf("CreatePage: %w", err)
+	}
+	http.Redirect(c.ResponseWriter, c.Request, "/admin/pages", http.StatusSeeOther)
+	return nil
+}
+
+// EditPage renders the form to change a page
+func EditPage(c *middleware.Context) error {
+	page, err := pageFromPath(c)
+	if err != nil {
+		return fmt.Errorf("EditPage: %w", err)
+	}
+	err = render(c, "page_form.html", map[string]any{"Page": page})
+	if err != nil {
+		return fmt.Errorf("EditPage: %w", err)
+	}
+	return nil
+}
+
+// UpdatePage saves the submitted changes of a page
+func UpdatePage(c *middleware.Context) error {
+	page, err := pageFromPath(c)
+	if err != nil {
+		return fmt.Errorf("UpdatePage: %w", err)
+	}
+	lastUpdatedAt := page.UpdatedAt
+	page.UpdatedAt = time.Now().UTC()
+	err = pageFromForm(c, &page)
+	if err != nil {
+		return fmt.Errorf("UpdatePage: %w", err)
+	}
+	err = pages.UpdatePage(c.Env(), page, lastUpdatedAt)
+	if errors.Is(err, pages.ErrConflict) {
+		return middleware.Error(http.StatusConflict, fmt.Errorf("UpdatePage: %w", err))
+	}
+	if err != nil {
+		return fmt.Errorf("UpdatePage: %w", err)
+	}
+	http.Redirect(c.ResponseWriter, c.Request, "/admin/pages", http.StatusSeeOther)
+	return nil
+}
+
+// DeletePage deletes a page
+func DeletePage(c *middleware.Context) error {
+	page, err := pageFromPath(c)
+	if err != nil {
+		return fmt.Errorf("DeletePage: %w", err)
+	}
+	err = pages.DeletePage(c.Env(), page.ID)
+	if err != nil {
+		return fmt.Errorf("DeletePage: %w", err)
+	}
+	http.Redirect(c.ResponseWriter, c.Request, "/admin/pages", http.StatusSeeOther)
+	return nil
+}
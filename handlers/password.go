@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/AndreHeber/go-sqlite-blog/mail"
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/sessions"
+	"github.com/AndreHeber/go-sqlite-blog/models/tokens"
+	"github.com/AndreHeber/go-sqlite-blog/models/users"
+)
+
+// ShowForgotPassword renders the form to request a password reset link
+func ShowForgotPassword(c *middleware.Context) error {
+	err := render(c, "forgot_password.html", nil)
+	if err != nil {
+		return fmt.Errorf("ShowForgotPassword: %w", err)
+	}
+	return nil
+}
+
+// ForgotPassword mails a reset link. The answer is the same whether the
+// address is registered or not, so it can't be used to probe for accounts.
+// The email is sent in the background, otherwise the answer would take longer for accounts.
+func ForgotPassword(c *middleware.Context) error {
+	email := strings.TrimSpace(c.Request.FormValue("email"))
+
+	user, err := users.GetUserByEmail(c.Env(), email)
+	if err == nil {
+		c.Go(func(c *middleware.Context) error {
+			err := sendPasswordResetEmail(c, user)
+			if err != nil {
+				return fmt.Errorf("ForgotPassword: %w", err)
+			}
+			return nil
+		})
+	}
+
+	return showMessage(c, "Check your inbox", "If the address belongs to an account, a link to reset the password is on its way.")
+}
+
+func sendPasswordResetEmail(c *middleware.Context, user users.User) error {
+	token, err := issueToken(c, user.ID, tokens.PasswordReset, c.Config.Accounts.PasswordResetTTL)
+	if err != nil {
+		return fmt.Errorf("sendPasswordResetEmail: %w", err)
+	}
+
+	link := strings.TrimSuffix(c.Config.BaseURL, "/") + "/password/reset?token=" + url.QueryEscape(token)
+	err = c.Mailer.Send(c.Ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\r\n\r\nsomeone asked to reset the password of your account. To choose a new password, open this link:\r\n\r\n%s\r\n\r\nThe link is valid for %s. If you didn't ask for it, you can ignore this email.\r\n",
+			user.Username, link, c.Config.Accounts.PasswordResetTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("sendPasswordResetEmail: %w", err)
+	}
+	return nil
+}
+
+// ShowResetPassword renders the form to choose a new password.
+// The token is only checked and used up when the form is submitted.
+func ShowResetPassword(c *middleware.Context) error {
+	err := render(c, "reset_password.html", map[string]string{"Token": c.Request.URL.Query().Get("token")})
+	if err != nil {
+		return fmt.Errorf("ShowResetPassword: %w", err)
+	}
+	return nil
+}
+
+// ResetPassword sets the new password and logs the user out everywhere
+func ResetPassword(c *middleware.Context) error {
+	r := c.Request
+	env := c.Env()
+
+	password := r.FormValue("password")
+	if password == "" {
+		return middleware.Error(http.StatusBadRequest, errors.New("ResetPassword: password is required"))
+	}
+
+	token, err := consumeToken(c, r.FormValue("token"), tokens.PasswordReset)
+	if err != nil {
+		return fmt.Errorf("ResetPassword: %w", err)
+	}
+
+	err = users.UpdatePassword(env, token.UserID, hashPassword(password, c.Config.Password), "")
+	if err != nil {
+		return fmt.Errorf("ResetPassword: %w", err)
+	}
+
+	// whoever knew the old password must not stay logged in
+	err = sessions.DeleteUserSessions(env, token.UserID)
+	if err != nil {
+		return fmt.Errorf("ResetPassword: %w", err)
+	}
+
+	// the link arrived, so the address belongs to the user
+	err = users.UpdateVerified(env, token.UserID, true)
+	if err != nil {
+		return fmt.Errorf("ResetPassword: %w", err)
+	}
+
+	return showMessage(c, "Password changed", "Your password was changed and all sessions were logged out. You can log in with the new password now.")
+}
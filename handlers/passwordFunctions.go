@@ -4,29 +4,96 @@ import (
 	"crypto/rand"
 	"crypto/subtle"
 	"encoding/base64"
+	"fmt"
+	"strings"
 
 	"golang.org/x/crypto/argon2"
+
+	"github.com/AndreHeber/go-sqlite-blog/config"
 )
 
-func hashPassword(password string, saltSize int) (string, string) {
-	salt := make([]byte, saltSize)
+// legacyParams were hard-coded before hashes carried their parameters,
+// the salt of those hashes is stored in the separate salt column
+var legacyParams = config.PasswordConfig{Memory: 64 * 1024, Iterations: 1, Parallelism: 4, KeyLength: 32}
+
+// hashPassword returns the argon2id hash of password in the PHC string format:
+//
+//	$argon2id$v=19$m=65536,t=1,p=4$<salt>$<hash>
+func hashPassword(password string, params config.PasswordConfig) string {
+	salt := make([]byte, params.SaltLength)
 	_, err := rand.Read(salt)
 	if err != nil {
 		panic(err)
 	}
-	hash := argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, 32)
-	return base64.RawStdEncoding.EncodeToString(hash), base64.RawStdEncoding.EncodeToString(salt)
+	hash := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash))
 }
 
-func verifyPassword(password, encodedHash, encodedSalt string) bool {
-	salt, err := base64.RawStdEncoding.DecodeString(encodedSalt)
+// decodeHash parses a hash created by hashPassword
+func decodeHash(encodedHash string) (params config.PasswordConfig, salt, hash []byte, err error) {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, fmt.Errorf("decodeHash: unknown hash format")
+	}
+
+	var version int
+	_, err = fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("decodeHash: unsupported argon2 version")
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("decodeHash: %w", err)
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(parts[4])
 	if err != nil {
-		return false
+		return params, nil, nil, fmt.Errorf("decodeHash: %w", err)
 	}
-	hash, err := base64.RawStdEncoding.DecodeString(encodedHash)
+	hash, err = base64.RawStdEncoding.DecodeString(parts[5])
 	if err != nil {
-		return false
+		return params, nil, nil, fmt.Errorf("decodeHash: %w", err)
 	}
-	newHash := argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, 32)
-	return subtle.ConstantTimeCompare(hash, newHash) == 1
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(hash))
+
+	return params, salt, hash, nil
+}
+
+// verifyPassword checks password against a stored hash. Hashes in the PHC format carry
+// their parameters, older hashes use legacyParams and the separate encodedSalt.
+// rehash is true if the password matched but the hash doesn't use the current params.
+func verifyPassword(password, encodedHash, encodedSalt string, current config.PasswordConfig) (match bool, rehash bool) {
+	var params config.PasswordConfig
+	var salt, hash []byte
+	var err error
+
+	if strings.HasPrefix(encodedHash, "$") {
+		params, salt, hash, err = decodeHash(encodedHash)
+		if err != nil {
+			return false, false
+		}
+	} else {
+		params = legacyParams
+		salt, err = base64.RawStdEncoding.DecodeString(encodedSalt)
+		if err != nil {
+			return false, false
+		}
+		hash, err = base64.RawStdEncoding.DecodeString(encodedHash)
+		if err != nil {
+			return false, false
+		}
+		params.SaltLength = uint32(len(salt))
+		// legacy hashes always get the new format
+		rehash = true
+	}
+
+	newHash := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(hash)))
+	if subtle.ConstantTimeCompare(hash, newHash) != 1 {
+		return false, false
+	}
+
+	return true, rehash || params != current
 }
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+
+	"github.com/AndreHeber/go-sqlite-blog/config"
+)
+
+func TestPasswordHashing(t *testing.T) {
+	params := config.PasswordConfig{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+	encoded := hashPassword("secret", params)
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=8192,t=1,p=1$") {
+		t.Fatalf("unexpected hash format %s", encoded)
+	}
+
+	if match, rehash := verifyPassword("secret", encoded, "", params); !match || rehash {
+		t.Errorf("same params: expected match without rehash, got %v %v", match, rehash)
+	}
+	if match, _ := verifyPassword("wrong", encoded, "", params); match {
+		t.Errorf("wrong password: expected no match")
+	}
+
+	stronger := params
+	stronger.Iterations = 2
+	if match, rehash := verifyPassword("secret", encoded, "", stronger); !match || !rehash {
+		t.Errorf("changed params: expected match with rehash, got %v %v", match, rehash)
+	}
+
+	// hashes from before the PHC format keep the salt in its own column
+	salt := []byte("0123456789abcdef")
+	legacy := argon2.IDKey([]byte("secret"), salt, 1, 64*1024, 4, 32)
+	legacyHash, legacySalt := base64.RawStdEncoding.EncodeToString(legacy), base64.RawStdEncoding.EncodeToString(salt)
+	if match, rehash := verifyPassword("secret", legacyHash, legacySalt, params); !match || !rehash {
+		t.Errorf("legacy hash: expected match with rehash, got %v %v", match, rehash)
+	}
+	if match, _ := verifyPassword("wrong", legacyHash, legacySalt, params); match {
+		t.Errorf("legacy hash, wrong password: expected no match")
+	}
+
+	if match, _ := verifyPassword("secret", "$argon2id$v=19$garbage", "", params); match {
+		t.Errorf("malformed hash: expected no match")
+	}
+}
@@ -3,22 +3,21 @@ package handlers
 import (
 	"errors"
 	"fmt"
-	"html/template"
+	"net/http"
+	"net/mail"
 	"time"
 
+	"github.com/AndreHeber/go-sqlite-blog/config"
 	"github.com/AndreHeber/go-sqlite-blog/middleware"
 	"github.com/AndreHeber/go-sqlite-blog/models"
+	"github.com/AndreHeber/go-sqlite-blog/models/audit"
+	"github.com/AndreHeber/go-sqlite-blog/models/roles"
 	"github.com/AndreHeber/go-sqlite-blog/models/users"
 )
 
 // ShowRegister renders the register page
-func ShowRegister(a *middleware.Adapter) error {
-	w := a.ResponseWriter
-	tmpl, err := template.ParseFiles("static/templates/register.html")
-	if err != nil {
-		return fmt.Errorf("ShowRegister: %w", err)
-	}
-	err = tmpl.Execute(w, nil)
+func ShowRegister(c *middleware.Context) error {
+	err := render(c, "register.html", nil)
 	if err != nil {
 		return fmt.Errorf("ShowRegister: %w", err)
 	}
@@ -26,8 +25,8 @@ func ShowRegister(a *middleware.Adapter) error {
 }
 
 // TryRegister handles the registration form submission
-func TryRegister(a *middleware.Adapter) error {
-	r := a.Request
+func TryRegister(c *middleware.Context) error {
+	r := c.Request
 
 	err := r.ParseForm()
 	if err != nil {
@@ -37,40 +36,58 @@ func TryRegister(a *middleware.Adapter) error {
 	password := r.FormValue("password")
 	email := r.FormValue("email")
 
-	err = register(models.EnvFromAdapter(a), username, password, email)
+	user, err := register(c.Env(), c.Config.Password, username, password, email)
 	if err != nil {
 		return fmt.Errorf("TryRegister: %w", err)
 	}
+	c.AuditAs(&user, audit.UserRegistered, map[string]any{"username": user.Username, "role_id": user.RoleID})
 
-	return nil
+	// the account exists, a failed email can be sent again from /verify/resend
+	err = sendVerificationEmail(c, user)
+	if err != nil {
+		c.Logger.Error("handlers: TryRegister", "error", err)
+	}
+
+	return showMessage(c, "Check your inbox", "Your account was created. We sent you an email with a link to verify your email address.")
 }
 
-// register saves the user to the database, password is hashed before saving using bcrypt
-// also an email is sent to the user with a link to verify their account
-func register(env *models.Env, username, password, email string) error {
+// register saves the user to the database, password is hashed before saving using argon2id
+func register(env *models.Env, params config.PasswordConfig, username, password, email string) (users.User, error) {
 	// verify input
 	if username == "" || password == "" || email == "" {
-		return errors.New("register: username, password and email are required")
+		return users.User{}, middleware.Error(http.StatusBadRequest, errors.New("register: username, password and email are required"))
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return users.User{}, middleware.Error(http.StatusBadRequest, errors.New("register: invalid email address"))
 	}
 
-	encodedHash, encodedSalt := hashPassword(password, 16)
+	// the first user administrates the blog, everyone else starts as reader
+	reader, err := roles.GetRoleByName(env, roles.Reader)
+	if err != nil {
+		return users.User{}, fmt.Errorf("register: %w", err)
+	}
+	admin, err := roles.GetRoleByName(env, roles.Admin)
+	if err != nil {
+		return users.User{}, fmt.Errorf("register: %w", err)
+	}
 
 	// save user to database
 	user := users.User{
 		Username:       username,
-		HashedPassword: encodedHash,
-		Salt:           encodedSalt,
+		HashedPassword: hashPassword(password, params),
+		Salt:           "", // the salt is part of the hash
 		Email:          email,
 		Verified:       false,
-		RoleID:         1,
+		RoleID:         reader.ID,
 		CreatedAt:      time.Now(),
 		LastLogin:      time.Now(),
 	}
 
-	err := users.CreateUser(env, user)
+	user.ID, user.RoleID, err = users.CreateUser(env, user, admin.ID)
 	if err != nil {
-		return fmt.Errorf("register: %w", err)
+		return users.User{}, fmt.Errorf("register: %w", err)
 	}
 
-	return nil
+	return user, nil
 }
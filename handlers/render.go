@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+)
+
+// render executes the page template with the name and the template functions of the request,
+// see package theme for where templates come from
+func render(c *middleware.Context, name string, data any) error {
+	compiled, err := c.Theme.Lookup(c.Env(), name)
+	if err != nil {
+		return fmt.Errorf("render: %w", err)
+	}
+	// the compiled template is shared, executing it would fix its functions to this request
+	tmpl, err := compiled.Clone()
+	if err != nil {
+		return fmt.Errorf("render: %w", err)
+	}
+	err = tmpl.Funcs(c.TemplateFuncs()).Execute(c.ResponseWriter, data)
+	if err != nil {
+		return fmt.Errorf("render: %w", err)
+	}
+	return nil
+}
+
+// pageNumber returns the page query parameter, the first page is 1
+func pageNumber(r *http.Request) int {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/diff"
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/articles"
+	"github.com/AndreHeber/go-sqlite-blog/models/users"
+)
+
+// articleVersion is the current version of an article (ID 0) or one of its revisions
+type articleVersion struct {
+	ID         uint64
+	Title      string
+	Content    string
+	EditedAt   time.Time
+	EditorName string
+}
+
+// editableArticle loads the article of the {slug} path value, if the user may edit it
+func editableArticle(c *middleware.Context) (articles.Article, error) {
+	article, err := articleFromPath(c)
+	if err != nil {
+		return articles.Article{}, err
+	}
+	if !canEditArticle(c, article) {
+		return articles.Article{}, middleware.Error(http.StatusForbidden, errors.New("not allowed to edit this article"))
+	}
+	return article, nil
+}
+
+// currentVersion returns the article as a version
+func currentVersion(c *middleware.Context, article articles.Article) (articleVersion, error) {
+	editor, err := users.GetUserByID(c.Env(), article.UpdatedBy)
+	if err != nil {
+		return articleVersion{}, fmt.Errorf("currentVersion: %w", err)
+	}
+	return articleVersion{Title: article.Title, Content: article.Content, EditedAt: article.UpdatedAt, EditorName: editor.Username}, nil
+}
+
+// versionFromQuery returns the version of the query parameter, a revision id or "current"
+func versionFromQuery(c *middleware.Context, article articles.Article, name string) (articleVersion, error) {
+	value := c.Request.URL.Query().Get(name)
+	if value == "" || value == "current" {
+		return currentVersion(c, article)
+	}
+
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return articleVersion{}, middleware.Error(http.StatusBadRequest, fmt.Errorf("versionFromQuery: %w", err))
+	}
+	revision, err := articles.GetRevision(c.Env(), article.ID, id)
+	if errors.Is(err, articles.ErrRevisionNotFound) {
+		return articleVersion{}, middleware.Error(http.StatusNotFound, fmt.Errorf("versionFromQuery: %w", err))
+	}
+	if err != nil {
+		return articleVersion{}, fmt.Errorf("versionFromQuery: %w", err)
+	}
+	return articleVersion{ID: revision.ID, Title: revision.Title, Content: revision.Content, EditedAt: revision.EditedAt, EditorName: revision.EditorName}, nil
+}
+
+// ShowRevisions renders the history of an article
+func ShowRevisions(c *middleware.Context) error {
+	article, err := editableArticle(c)
+	if err != nil {
+		return fmt.Errorf("ShowRevisions: %w", err)
+	}
+
+	current, err := currentVersion(c, article)
+	if err != nil {
+		return fmt.Errorf("ShowRevisions: %w", err)
+	}
+	revisions, err := articles.GetRevisions(c.Env(), article.ID)
+	if err != nil {
+		return fmt.Errorf("ShowRevisions: %w", err)
+	}
+
+	err = render(c, "revisions.html", map[string]any{
+		"Article":   article,
+		"Current":   current,
+		"Revisions": revisions,
+	})
+	if err != nil {
+		return fmt.Errorf("ShowRevisions: %w", err)
+	}
+	return nil
+}
+
+// ShowDiff renders the changes between the versions of the from and to query parameters,
+// by line or, if the mode query parameter is "words", by word
+func ShowDiff(c *middleware.Context) error {
+	article, err := editableArticle(c)
+	if err != nil {
+		return fmt.Errorf("ShowDiff: %w", err)
+	}
+
+	from, err := versionFromQuery(c, article, "from")
+	if err != nil {
+		return fmt.Errorf("ShowDiff: %w", err)
+	}
+	to, err := versionFromQuery(c, article, "to")
+	if err != nil {
+		return fmt.Errorf("ShowDiff: %w", err)
+	}
+
+	mode := "lines"
+	content := diff.Lines(from.Content, to.Content)
+	if c.Request.URL.Query().Get("mode") == "words" {
+		mode = "words"
+		content = diff.Words(from.Content, to.Content)
+	}
+
+	err = render(c, "diff.html", map[string]any{
+		"Article": article,
+		"From":    from,
+		"To":      to,
+		"Mode":    mode,
+		"Query":   c.Request.URL.Query(),
+		"Title":   diff.Words(from.Title, to.Title),
+		"Content": content,
+	})
+	if err != nil {
+		return fmt.Errorf("ShowDiff: %w", err)
+	}
+	return nil
+}
+
+// RestoreRevision makes a revision the current version of the article.
+// Like every change, this keeps the version before it as a new revision.
+func RestoreRevision(c *middleware.Context) error {
+	article, err := editableArticle(c)
+	if err != nil {
+		return fmt.Errorf("RestoreRevision: %w", err)
+	}
+
+	id, err := strconv.ParseUint(c.Request.PathValue("id"), 10, 64)
+	if err != nil {
+		return middleware.Error(http.StatusNotFound, fmt.Errorf("RestoreRevision: %w", err))
+	}
+	revision, err := articles.GetRevision(c.Env(), article.ID, id)
+	if errors.Is(err, articles.ErrRevisionNotFound) {
+		return middleware.Error(http.StatusNotFound, fmt.Errorf("RestoreRevision: %w", err))
+	}
+	if err != nil {
+		return fmt.Errorf("RestoreRevision: %w", err)
+	}
+
+	lastUpdatedAt := article.UpdatedAt
+	article.Title = revision.Title
+	article.Content = revision.Content
+	article.UpdatedAt = time.Now().UTC()
+	article.UpdatedBy = c.User.ID
+	err = renderContent(&article)
+	if err != nil {
+		return fmt.Errorf("RestoreRevision: %w", err)
+	}
+	err = articles.UpdateArticle(c.Env(), article, lastUpdatedAt, nil)
+	if errors.Is(err, articles.ErrConflict) {
+		return middleware.Error(http.StatusConflict, fmt.Errorf("RestoreRevision: %w", err))
+	}
+	if err != nil {
+		return fmt.Errorf("RestoreRevision: %w", err)
+	}
+
+	http.Redirect(c.ResponseWriter, c.Request, "/articles/"+article.Slug+"/revisions", http.StatusSeeOther)
+	return nil
+}
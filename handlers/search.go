@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/articles"
+)
+
+const searchResultsPerPage = 10
+
+// highlight escapes the text of a search result and marks the matched terms
+func highlight(marked string) template.HTML {
+	escaped := template.HTMLEscapeString(marked)
+	escaped = strings.ReplaceAll(escaped, articles.MatchStart, "<mark>")
+	escaped = strings.ReplaceAll(escaped, articles.MatchEnd, "</mark>")
+	return template.HTML(escaped)
+}
+
+type searchResult struct {
+	Title       template.HTML `json:"title"`
+	Slug        string        `json:"slug"`
+	URL         string        `json:"url"`
+	Summary     string        `json:"summary"`
+	Snippet     template.HTML `json:"snippet"`
+	PublishedAt time.Time     `json:"published_at"`
+}
+
+type searchPage struct {
+	Query    string         `json:"query"`
+	Page     int            `json:"page"`
+	PrevPage int            `json:"prev_page,omitempty"`
+	NextPage int            `json:"next_page,omitempty"`
+	Results  []searchResult `json:"results"`
+}
+
+// searchArticles runs the search of the q and page query parameters
+func searchArticles(c *middleware.Context) (searchPage, error) {
+	query := strings.TrimSpace(c.Request.URL.Query().Get("q"))
+	page := pageNumber(c.Request)
+
+	// one more result than shown is fetched to know if there is a next page
+	found, err := articles.SearchArticles(c.Env(), query, searchResultsPerPage+1, (page-1)*searchResultsPerPage)
+	if err != nil {
+		return searchPage{}, fmt.Errorf("searchArticles: %w", err)
+	}
+
+	result := searchPage{Query: query, Page: page, PrevPage: page - 1, Results: []searchResult{}}
+	if len(found) > searchResultsPerPage {
+		found = found[:searchResultsPerPage]
+		result.NextPage = page + 1
+	}
+	for _, f := range found {
+		result.Results = append(result.Results, searchResult{
+			Title:       highlight(f.Title),
+			Slug:        f.Slug,
+			URL:         "/articles/" + f.Slug,
+			Summary:     f.Summary,
+			Snippet:     highlight(f.Snippet),
+			PublishedAt: f.PublishedAt,
+		})
+	}
+	return result, nil
+}
+
+// Search renders the search page with the published articles matching the q query parameter
+func Search(c *middleware.Context) error {
+	result, err := searchArticles(c)
+	if err != nil {
+		return fmt.Errorf("Search: %w", err)
+	}
+
+	err = render(c, "search.html", result)
+	if err != nil {
+		return fmt.Errorf("Search: %w", err)
+	}
+	return nil
+}
+
+// SearchJSON returns the published articles matching the q query parameter as JSON.
+// Title and snippet are HTML with the matched terms in <mark> elements.
+func SearchJSON(c *middleware.Context) error {
+	result, err := searchArticles(c)
+	if err != nil {
+		return fmt.Errorf("SearchJSON: %w", err)
+	}
+
+	c.ResponseWriter.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(c.ResponseWriter).Encode(result)
+	if err != nil {
+		return fmt.Errorf("SearchJSON: %w", err)
+	}
+	return nil
+}
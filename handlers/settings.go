@@ -1,7 +1,109 @@
 package handlers
 
-import "net/http"
+import (
+	"fmt"
+	"net/http"
+	"strings"
 
-func SettingsHandler(w http.ResponseWriter, r *http.Request) {
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/audit"
+	"github.com/AndreHeber/go-sqlite-blog/models/settings"
+)
 
+// settingField is a setting with the value shown in the form
+type settingField struct {
+	settings.Setting
+	Value string
+}
+
+// renderSettings renders the settings form with the values and the reason they can't be saved, if any
+func renderSettings(c *middleware.Context, values map[string]string, problem string) error {
+	fields := make([]settingField, 0, len(settings.Registry))
+	for _, setting := range settings.Registry {
+		value, ok := values[setting.Key]
+		if !ok {
+			value = setting.Default
+		}
+		fields = append(fields, settingField{Setting: setting, Value: value})
+	}
+	return render(c, "admin_settings.html", map[string]any{
+		"Fields":  fields,
+		"Problem": problem,
+		"Saved":   c.Request.URL.Query().Get("saved") != "",
+	})
+}
+
+// ShowSettings renders the form to change the site settings
+func ShowSettings(c *middleware.Context) error {
+	values, err := settings.GetValues(c.Env())
+	if err != nil {
+		return fmt.Errorf("ShowSettings: %w", err)
+	}
+	err = renderSettings(c, values, "")
+	if err != nil {
+		return fmt.Errorf("ShowSettings: %w", err)
+	}
+	return nil
+}
+
+// SaveSettings stores the submitted settings, settings missing from the form keep their value.
+// If a value is invalid, nothing is saved and the form is shown again with the error.
+func SaveSettings(c *middleware.Context) error {
+	env := c.Env()
+	err := c.Request.ParseForm()
+	if err != nil {
+		return middleware.Error(http.StatusBadRequest, fmt.Errorf("SaveSettings: %w", err))
+	}
+
+	submitted := make(map[string]string)
+	for _, setting := range settings.Registry {
+		// a checkbox follows a hidden field with the same name, the last value wins
+		if list := c.Request.PostForm[setting.Key]; len(list) > 0 {
+			submitted[setting.Key] = strings.TrimSpace(list[len(list)-1])
+		}
+	}
+
+	err = settings.Validate(submitted)
+	if err != nil {
+		values, getErr := settings.GetValues(env)
+		if getErr != nil {
+			return fmt.Errorf("SaveSettings: %w", getErr)
+		}
+		for key, value := range submitted {
+			values[key] = value
+		}
+		c.ResponseWriter.WriteHeader(http.StatusBadRequest)
+		return renderSettings(c, values, err.Error())
+	}
+
+	stored, err := settings.GetValues(env)
+	if err != nil {
+		return fmt.Errorf("SaveSettings: %w", err)
+	}
+	err = settings.SaveValues(env, submitted)
+	if err != nil {
+		return fmt.Errorf("SaveSettings: %w", err)
+	}
+	c.InvalidateSettings()
+
+	changes := make(map[string]any)
+	for _, setting := range settings.Registry {
+		value, ok := submitted[setting.Key]
+		if !ok {
+			continue
+		}
+		old, ok := stored[setting.Key]
+		if !ok {
+			old = setting.Default
+		}
+		if value != old {
+			changes[setting.Key] = map[string]string{"from": old, "to": value}
+		}
+	}
+	if len(changes) > 0 {
+		c.Audit(audit.SettingsChanged, changes)
+	}
+
+	http.Redirect(c.ResponseWriter, c.Request, "/admin/settings?saved=1", http.StatusSeeOther)
+	return nil
 }
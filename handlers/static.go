@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+)
+
+// ServeStatic serves the file of the {path...} path value from assets. Browsers check with
+// the ETag whether a file changed, since the same URL gets new content with a new build.
+func ServeStatic(assets fs.FS) middleware.HandlerFunc {
+	return func(c *middleware.Context) error {
+		name := c.Request.PathValue("path")
+		if !fs.ValidPath(name) {
+			return middleware.Error(http.StatusNotFound, fmt.Errorf("ServeStatic: invalid path %q", name))
+		}
+		info, err := fs.Stat(assets, name)
+		if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+			return middleware.Error(http.StatusNotFound, fmt.Errorf("ServeStatic: %s not found", name))
+		}
+		if err != nil {
+			return fmt.Errorf("ServeStatic: %w", err)
+		}
+		data, err := fs.ReadFile(assets, name)
+		if err != nil {
+			return fmt.Errorf("ServeStatic: %w", err)
+		}
+
+		hash := sha256.Sum256(data)
+		header := c.ResponseWriter.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("ETag", `"`+hex.EncodeToString(hash[:16])+`"`)
+		http.ServeContent(c.ResponseWriter, c.Request, path.Base(name), info.ModTime(), bytes.NewReader(data))
+		return nil
+	}
+}
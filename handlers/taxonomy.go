@@ -0,0 +1,488 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/articles"
+	"github.com/AndreHeber/go-sqlite-blog/models/categories"
+	"github.com/AndreHeber/go-sqlite-blog/models/tags"
+	"github.com/AndreHeber/go-sqlite-blog/slug"
+)
+
+const (
+	taxonomyNameMaxLength = 100
+	tagCloudSizes         = 5
+)
+
+// idFromPath parses the {id} path value, an invalid id is not found
+func idFromPath(c *middleware.Context) (uint64, error) {
+	id, err := strconv.ParseUint(c.Request.PathValue("id"), 10, 64)
+	if err != nil {
+		return 0, middleware.Error(http.StatusNotFound, err)
+	}
+	return id, nil
+}
+
+// nameAndSlugFromForm validates the submitted name of a category or tag and makes its slug,
+// from the slug field or else the name. nameExists and slugExists check the other entries.
+func nameAndSlugFromForm(c *middleware.Context, nameExists, slugExists func(string) (bool, error)) (string, string, error) {
+	name := strings.TrimSpace(c.Request.FormValue("name"))
+	if name == "" {
+		return "", "", middleware.Error(http.StatusBadRequest, errors.New("nameAndSlugFromForm: a name is required"))
+	}
+	if utf8.RuneCountInString(name) > taxonomyNameMaxLength {
+		return "", "", middleware.Error(http.StatusBadRequest, fmt.Errorf("nameAndSlugFromForm: the name is longer than %d characters", taxonomyNameMaxLength))
+	}
+	taken, err := nameExists(name)
+	if err != nil {
+		return "", "", fmt.Errorf("nameAndSlugFromForm: %w", err)
+	}
+	if taken {
+		return "", "", middleware.Error(http.StatusBadRequest, fmt.Errorf("nameAndSlugFromForm: %q already exists", name))
+	}
+
+	base := slug.Make(c.Request.FormValue("slug"))
+	if base == "" {
+		base = slug.Make(name)
+	}
+	unique, err := slug.Unique(base, slugExists)
+	if err != nil {
+		return "", "", fmt.Errorf("nameAndSlugFromForm: %w", err)
+	}
+	return name, unique, nil
+}
+
+// categoryFromPath loads the category of the {id} path value
+func categoryFromPath(c *middleware.Context) (categories.Category, error) {
+	id, err := idFromPath(c)
+	if err != nil {
+		return categories.Category{}, err
+	}
+	category, err := categories.GetCategoryByID(c.Env(), id)
+	if errors.Is(err, categories.ErrNotFound) {
+		return categories.Category{}, middleware.Error(http.StatusNotFound, err)
+	}
+	return category, err
+}
+
+// categoryFromForm copies the submitted name and slug into category
+func categoryFromForm(c *middleware.Context, category *categories.Category) error {
+	env := c.Env()
+	name, categorySlug, err := nameAndSlugFromForm(c,
+		func(name string) (bool, error) { return categories.NameExists(env, name, category.ID) },
+		func(s string) (bool, error) { return categories.SlugExists(env, s, category.ID) },
+	)
+	if err != nil {
+		return fmt.Errorf("categoryFromForm: %w", err)
+	}
+	category.Name = name
+	category.Slug = categorySlug
+	return nil
+}
+
+// ShowCategories renders the list of categories to manage them
+func ShowCategories(c *middleware.Context) error {
+	list, err := categories.GetCategories(c.Env())
+	if err != nil {
+		return fmt.Errorf("ShowCategories: %w", err)
+	}
+	err = render(c, "admin_categories.html", map[string]any{"Categories": list})
+	if err != nil {
+		return fmt.Errorf("ShowCategories: %w", err)
+	}
+	return nil
+}
+
+// CreateCategory saves a new category
+func CreateCategory(c *middleware.Context) error {
+	var category categories.Category
+	err := categoryFromForm(c, &category)
+	if err != nil {
+		return fmt.Errorf("CreateCategory: %w", err)
+	}
+	_, err = categories.CreateCategory(c.Env(), category)
+	if err != nil {
+		return fmt.Errorf("CreateCategory: %w", err)
+	}
+	http.Redirect(c.ResponseWriter, c.Request, "/admin/categories", http.StatusSeeOther)
+	return nil
+}
+
+// UpdateCategory saves the changed name and slug of a category
+func UpdateCategory(c *middleware.Context) error {
+	category, err := categoryFromPath(c)
+	if err != nil {
+		return fmt.Errorf("UpdateCategory: %w", err)
+	}
+	err = categoryFromForm(c, &category)
+	if err != nil {
+		return fmt.Errorf("UpdateCategory: %w", err)
+	}
+	err = categories.UpdateCategory(c.Env(), category)
+	if err != nil {
+		return fmt.Errorf("UpdateCategory: %w", err)
+	}
+	http.Redirect(c.ResponseWriter, c.Request, "/admin/categories", http.StatusSeeOther)
+	return nil
+}
+
+// DeleteCategory deletes a category, its articles are kept
+func DeleteCategory(c *middleware.Context) error {
+	category, err := categoryFromPath(c)
+	if err != nil {
+		return fmt.Errorf("DeleteCategory: %w", err)
+	}
+	err = categories.DeleteCategory(c.Env(), category.ID)
+	if err != nil {
+		return fmt.Errorf("DeleteCategory: %w", err)
+	}
+	http.Redirect(c.ResponseWriter, c.Request, "/admin/categories", http.StatusSeeOther)
+	return nil
+}
+
+// tagFromPath loads the tag of the {id} path value
+func tagFromPath(c *middleware.Context) (tags.Tag, error) {
+	id, err := idFromPath(c)
+	if err != nil {
+		return tags.Tag{}, err
+	}
+	tag, err := tags.GetTagByID(c.Env(), id)
+	if errors.Is(err, tags.ErrNotFound) {
+		return tags.Tag{}, middleware.Error(http.StatusNotFound, err)
+	}
+	return tag, err
+}
+
+// tagFromForm copies the submitted name and slug into tag
+func tagFromForm(c *middleware.Context, tag *tags.Tag) error {
+	env := c.Env()
+	name, tagSlug, err := nameAndSlugFromForm(c,
+		func(name string) (bool, error) { return tags.NameExists(env, name, tag.ID) },
+		func(s string) (bool, error) { return tags.SlugExists(env, s, tag.ID) },
+	)
+	if err != nil {
+		return fmt.Errorf("tagFromForm: %w", err)
+	}
+	tag.Name = name
+	tag.Slug = tagSlug
+	return nil
+}
+
+// ShowTags renders the list of tags to manage and merge them
+func ShowTags(c *middleware.Context) error {
+	list, err := tags.GetTags(c.Env())
+	if err != nil {
+		return fmt.Errorf("ShowTags: %w", err)
+	}
+	err = render(c, "admin_tags.html", map[string]any{"Tags": list})
+	if err != nil {
+		return fmt.Errorf("ShowTags: %w", err)
+	}
+	return nil
+}
+
+// CreateTag saves a new tag
+func CreateTag(c *middleware.Context) error {
+	var tag tags.Tag
+	err := tagFromForm(c, &tag)
+	if err != nil {
+		return fmt.Errorf("CreateTag: %w", err)
+	}
+	_, err = tags.CreateTag(c.Env(), tag)
+	if err != nil {
+		return fmt.Errorf("CreateTag: %w", err)
+	}
+	http.Redirect(c.ResponseWriter, c.Request, "/admin/tags", http.StatusSeeOther)
+	return nil
+}
+
+// UpdateTag saves the changed name and slug of a tag
+func UpdateTag(c *middleware.Context) error {
+	tag, err := tagFromPath(c)
+	if err != nil {
+		return fmt.Errorf("UpdateTag: %w", err)
+	}
+	err = tagFromForm(c, &tag)
+	if err != nil {
+		return fmt.Errorf("UpdateTag: %w", err)
+	}
+	err = tags.UpdateTag(c.Env(), tag)
+	if err != nil {
+		return fmt.Errorf("UpdateTag: %w", err)
+	}
+	http.Redirect(c.ResponseWriter, c.Request, "/admin/tags", http.StatusSeeOther)
+	return nil
+}
+
+// DeleteTag deletes a tag, its articles are kept
+func DeleteTag(c *middleware.Context) error {
+	tag, err := tagFromPath(c)
+	if err != nil {
+		return fmt.Errorf("DeleteTag: %w", err)
+	}
+	err = tags.DeleteTag(c.Env(), tag.ID)
+	if err != nil {
+		return fmt.Errorf("DeleteTag: %w", err)
+	}
+	http.Redirect(c.ResponseWriter, c.Request, "/admin/tags", http.StatusSeeOther)
+	return nil
+}
+
+// MergeTags moves the articles of the tag in the from form value to the tag in the into
+// form value, then deletes the first one
+func MergeTags(c *middleware.Context) error {
+	env := c.Env()
+	var merge [2]tags.Tag
+	for i, name := range []string{"from", "into"} {
+		id, err := strconv.ParseUint(c.Request.FormValue(name), 10, 64)
+		if err != nil {
+			return middleware.Error(http.StatusBadRequest, fmt.Errorf("MergeTags: %s: %w", name, err))
+		}
+		merge[i], err = tags.GetTagByID(env, id)
+		if errors.Is(err, tags.ErrNotFound) {
+			return middleware.Error(http.StatusBadRequest, fmt.Errorf("MergeTags: %s: %w", name, err))
+		}
+		if err != nil {
+			return fmt.Errorf("MergeTags: %w", err)
+		}
+	}
+	from, into := merge[0], merge[1]
+	if from.ID == into.ID {
+		return middleware.Error(http.StatusBadRequest, errors.New("MergeTags: can't merge a tag into itself"))
+	}
+
+	err := tags.MergeTags(env, from.ID, into.ID)
+	if err != nil {
+		return fmt.Errorf("MergeTags: %w", err)
+	}
+	http.Redirect(c.ResponseWriter, c.Request, "/admin/tags", http.StatusSeeOther)
+	return nil
+}
+
+// cloudTag is a tag of the tag cloud, Size goes from 1 to tagCloudSizes by its number of articles
+type cloudTag struct {
+	tags.Tag
+	Size int
+}
+
+// TagCloud renders the tags with published articles, sized by their number of articles
+func TagCloud(c *middleware.Context) error {
+	list, err := tags.GetTags(c.Env())
+	if err != nil {
+		return fmt.Errorf("TagCloud: %w", err)
+	}
+
+	maxCount := 0
+	for _, tag := range list {
+		maxCount = max(maxCount, tag.Count)
+	}
+	var cloud []cloudTag
+	for _, tag := range list {
+		if tag.Count == 0 {
+			continue
+		}
+		cloud = append(cloud, cloudTag{Tag: tag, Size: 1 + (tag.Count-1)*(tagCloudSizes-1)/max(maxCount-1, 1)})
+	}
+
+	err = render(c, "tags.html", map[string]any{"Tags": cloud})
+	if err != nil {
+		return fmt.Errorf("TagCloud: %w", err)
+	}
+	return nil
+}
+
+// renderArchive renders a page of the published articles of a category or tag
+func renderArchive(c *middleware.Context, heading, path string, getPage func(limit, offset int) ([]articles.Article, error)) error {
+	page := pageNumber(c.Request)
+	perPage := c.Settings().ArticlesPerPage
+	list, err := getPage(perPage+1, (page-1)*perPage)
+	if err != nil {
+		return fmt.Errorf("renderArchive: %w", err)
+	}
+
+	// one more article than shown was fetched to know if there is a next page
+	nextPage := 0
+	if len(list) > perPage {
+		list = list[:perPage]
+		nextPage = page + 1
+	}
+
+	err = render(c, "articles.html", map[string]any{
+		"Heading":  heading,
+		"FeedPath": path,
+		"Articles": list,
+		"PrevPage": page - 1,
+		"NextPage": nextPage,
+	})
+	if err != nil {
+		return fmt.Errorf("renderArchive: %w", err)
+	}
+	return nil
+}
+
+// ShowCategory renders the published articles of the category in the {slug} path value
+func ShowCategory(c *middleware.Context) error {
+	env := c.Env()
+	category, err := categories.GetCategoryBySlug(env, c.Request.PathValue("slug"))
+	if errors.Is(err, categories.ErrNotFound) {
+		return middleware.Error(http.StatusNotFound, fmt.Errorf("ShowCategory: %w", err))
+	}
+	if err != nil {
+		return fmt.Errorf("ShowCategory: %w", err)
+	}
+
+	err = renderArchive(c, "Category: "+category.Name, "/category/"+category.Slug, func(limit, offset int) ([]articles.Article, error) {
+		return articles.GetPublishedArticlesByCategory(env, category.ID, limit, offset)
+	})
+	if err != nil {
+		return fmt.Errorf("ShowCategory: %w", err)
+	}
+	return nil
+}
+
+// ShowTag renders the published articles of the tag in the {slug} path value
+func ShowTag(c *middleware.Context) error {
+	env := c.Env()
+	tag, err := tags.GetTagBySlug(env, c.Request.PathValue("slug"))
+	if errors.Is(err, tags.ErrNotFound) {
+		return middleware.Error(http.StatusNotFound, fmt.Errorf("ShowTag: %w", err))
+	}
+	if err != nil {
+		return fmt.Errorf("ShowTag: %w", err)
+	}
+
+	err = renderArchive(c, "Tag: "+tag.Name, "/tag/"+tag.Slug, func(limit, offset int) ([]articles.Article, error) {
+		return articles.GetPublishedArticlesByTag(env, tag.ID, limit, offset)
+	})
+	if err != nil {
+		return fmt.Errorf("ShowTag: %w", err)
+	}
+	return nil
+}
+
+// taxonomyFromForm returns the ids of the categories checked in the article form,
+// unknown ids are ignored, and the comma separated tag names without duplicates
+func taxonomyFromForm(c *middleware.Context) ([]uint64, []string, error) {
+	var categoryIDs []uint64
+	for _, value := range c.Request.Form["categories"] {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, nil, middleware.Error(http.StatusBadRequest, fmt.Errorf("taxonomyFromForm: %w", err))
+		}
+		categoryIDs = append(categoryIDs, id)
+	}
+
+	categoryIDs, tagNames, err := checkTaxonomy(c, categoryIDs, strings.Split(c.Request.FormValue("tags"), ","))
+	if err != nil {
+		return nil, nil, fmt.Errorf("taxonomyFromForm: %w", err)
+	}
+	return categoryIDs, tagNames, nil
+}
+
+// checkTaxonomy drops unknown and repeated categories and empty and repeated tags,
+// tags that are too long are rejected
+func checkTaxonomy(c *middleware.Context, categoryIDs []uint64, tagNames []string) ([]uint64, []string, error) {
+	all, err := categories.GetCategories(c.Env())
+	if err != nil {
+		return nil, nil, fmt.Errorf("checkTaxonomy: %w", err)
+	}
+	known := make(map[uint64]bool, len(all))
+	for _, category := range all {
+		known[category.ID] = true
+	}
+
+	var checkedIDs []uint64
+	for _, id := range categoryIDs {
+		if known[id] {
+			checkedIDs = append(checkedIDs, id)
+			delete(known, id)
+		}
+	}
+
+	var checkedNames []string
+	seen := make(map[string]bool)
+	for _, name := range tagNames {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		if utf8.RuneCountInString(name) > taxonomyNameMaxLength {
+			return nil, nil, middleware.Error(http.StatusBadRequest, fmt.Errorf("checkTaxonomy: the tag %q is longer than %d characters", name, taxonomyNameMaxLength))
+		}
+		seen[strings.ToLower(name)] = true
+		checkedNames = append(checkedNames, name)
+	}
+
+	return checkedIDs, checkedNames, nil
+}
+
+// articleTaxonomy returns the categories and tags to save with an article. Tags that don't
+// exist yet are created, they may stay unused if saving the article fails.
+func articleTaxonomy(c *middleware.Context, categoryIDs []uint64, tagNames []string) (articles.Taxonomy, error) {
+	env := c.Env()
+	tagIDs := make([]uint64, 0, len(tagNames))
+	for _, name := range tagNames {
+		tag, err := tags.GetTagByName(env, name)
+		if errors.Is(err, tags.ErrNotFound) {
+			tag.Name = name
+			tag.Slug, err = slug.Unique(slug.Make(name), func(s string) (bool, error) {
+				return tags.SlugExists(env, s, 0)
+			})
+			if err != nil {
+				return articles.Taxonomy{}, fmt.Errorf("articleTaxonomy: %w", err)
+			}
+			tag.ID, err = tags.CreateTag(env, tag)
+		}
+		if err != nil {
+			return articles.Taxonomy{}, fmt.Errorf("articleTaxonomy: %w", err)
+		}
+		tagIDs = append(tagIDs, tag.ID)
+	}
+	return articles.Taxonomy{CategoryIDs: categoryIDs, TagIDs: tagIDs}, nil
+}
+
+// renderArticleForm renders the article form with the categories to choose from
+// and the current categories and tags of the article
+func renderArticleForm(c *middleware.Context, article articles.Article) error {
+	env := c.Env()
+	all, err := categories.GetCategories(env)
+	if err != nil {
+		return fmt.Errorf("renderArticleForm: %w", err)
+	}
+
+	selected := make(map[uint64]bool)
+	var tagNames []string
+	if article.ID != 0 {
+		articleCategories, err := categories.GetArticleCategories(env, article.ID)
+		if err != nil {
+			return fmt.Errorf("renderArticleForm: %w", err)
+		}
+		for _, category := range articleCategories {
+			selected[category.ID] = true
+		}
+		articleTags, err := tags.GetArticleTags(env, article.ID)
+		if err != nil {
+			return fmt.Errorf("renderArticleForm: %w", err)
+		}
+		for _, tag := range articleTags {
+			tagNames = append(tagNames, tag.Name)
+		}
+	}
+
+	err = render(c, "article_form.html", map[string]any{
+		"Article":    article,
+		"Categories": all,
+		"Selected":   selected,
+		"Tags":       strings.Join(tagNames, ", "),
+	})
+	if err != nil {
+		return fmt.Errorf("renderArticleForm: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/templates"
+	"github.com/AndreHeber/go-sqlite-blog/theme"
+)
+
+// templateFromPath loads the template of the {name} path value
+func templateFromPath(c *middleware.Context) (theme.Source, error) {
+	source, err := c.Theme.Source(c.Env(), c.Request.PathValue("name"))
+	if errors.Is(err, theme.ErrNotFound) {
+		return theme.Source{}, middleware.Error(http.StatusNotFound, err)
+	}
+	return source, err
+}
+
+// renderTemplateForm renders the editor of a template with the reason it can't be saved, if any
+func renderTemplateForm(c *middleware.Context, source theme.Source, problem string) error {
+	return render(c, "template_form.html", map[string]any{"Template": source, "Problem": problem})
+}
+
+// ShowTemplates renders the list of templates to customize them
+func ShowTemplates(c *middleware.Context) error {
+	list, err := c.Theme.Sources(c.Env())
+	if err != nil {
+		return fmt.Errorf("ShowTemplates: %w", err)
+	}
+	err = render(c, "admin_templates.html", map[string]any{"Templates": list})
+	if err != nil {
+		return fmt.Errorf("ShowTemplates: %w", err)
+	}
+	return nil
+}
+
+// NewTemplate renders the editor for a new layout or partial
+func NewTemplate(c *middleware.Context) error {
+	err := renderTemplateForm(c, theme.Source{}, "")
+	if err != nil {
+		return fmt.Errorf("NewTemplate: %w", err)
+	}
+	return nil
+}
+
+// EditTemplate renders the editor of a template
+func EditTemplate(c *middleware.Context) error {
+	source, err := templateFromPath(c)
+	if err != nil {
+		return fmt.Errorf("EditTemplate: %w", err)
+	}
+	err = renderTemplateForm(c, source, "")
+	if err != nil {
+		return fmt.Errorf("EditTemplate: %w", err)
+	}
+	return nil
+}
+
+// SaveTemplate stores a changed template or a new layout or partial. The pages that use it
+// are compiled first, if that fails the editor is shown again with the error.
+func SaveTemplate(c *middleware.Context) error {
+	env := c.Env()
+	name := strings.TrimSpace(c.Request.FormValue("name"))
+	content := c.Request.FormValue("content")
+	if !theme.ValidName(name) {
+		return middleware.Error(http.StatusBadRequest, fmt.Errorf("SaveTemplate: invalid name %q, use lowercase letters, digits, - and _ and end with .html", name))
+	}
+	if strings.TrimSpace(content) == "" {
+		return middleware.Error(http.StatusBadRequest, errors.New("SaveTemplate: content is required"))
+	}
+
+	source, err := c.Theme.Source(env, name)
+	if errors.Is(err, theme.ErrNotFound) {
+		// handlers only render the pages they know, new templates can only be used by them
+		if !theme.Shared(name) {
+			return middleware.Error(http.StatusBadRequest, fmt.Errorf("SaveTemplate: %s is no page, the names of new layouts and partials start with _", name))
+		}
+		source = theme.Source{Name: name}
+	} else if err != nil {
+		return fmt.Errorf("SaveTemplate: %w", err)
+	}
+
+	err = c.Theme.Validate(env, name, content)
+	if err != nil {
+		source.Content = content
+		c.ResponseWriter.WriteHeader(http.StatusBadRequest)
+		return renderTemplateForm(c, source, err.Error())
+	}
+
+	err = templates.SaveTemplate(env, name, content)
+	if err != nil {
+		return fmt.Errorf("SaveTemplate: %w", err)
+	}
+	c.Theme.Invalidate()
+
+	http.Redirect(c.ResponseWriter, c.Request, "/admin/templates", http.StatusSeeOther)
+	return nil
+}
+
+// ResetTemplate deletes a customized template, so that its default is used again.
+// Layouts and partials without a default are deleted unless a page still uses them.
+func ResetTemplate(c *middleware.Context) error {
+	source, err := templateFromPath(c)
+	if err != nil {
+		return fmt.Errorf("ResetTemplate: %w", err)
+	}
+	if !source.Customized {
+		return middleware.Error(http.StatusBadRequest, fmt.Errorf("ResetTemplate: %s is not customized", source.Name))
+	}
+
+	err = c.Theme.ValidateDelete(c.Env(), source.Name)
+	if err != nil {
+		return middleware.Error(http.StatusConflict, fmt.Errorf("ResetTemplate: %w", err))
+	}
+	err = templates.DeleteTemplate(c.Env(), source.Name)
+	if err != nil {
+		return fmt.Errorf("ResetTemplate: %w", err)
+	}
+	c.Theme.Invalidate()
+
+	http.Redirect(c.ResponseWriter, c.Request, "/admin/templates", http.StatusSeeOther)
+	return nil
+}
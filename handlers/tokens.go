@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/tokens"
+	"github.com/AndreHeber/go-sqlite-blog/signing"
+)
+
+// issueToken stores a new single use token for the user and returns it signed,
+// ready to be put into a link. Older tokens of the same purpose are invalidated.
+func issueToken(c *middleware.Context, userID uint64, purpose tokens.Purpose, ttl time.Duration) (string, error) {
+	env := c.Env()
+
+	err := tokens.DeleteUserTokens(env, userID, purpose)
+	if err != nil {
+		return "", fmt.Errorf("issueToken: %w", err)
+	}
+
+	now := time.Now().UTC()
+	token := signing.RandomToken(32)
+	err = tokens.CreateToken(env, tokens.Token{
+		ID:        signing.HashToken(token),
+		UserID:    userID,
+		Purpose:   purpose,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return "", fmt.Errorf("issueToken: %w", err)
+	}
+
+	return c.Signer.Sign(token), nil
+}
+
+// consumeToken checks the signature of a token created by issueToken and uses it up
+func consumeToken(c *middleware.Context, signed string, purpose tokens.Purpose) (tokens.Token, error) {
+	token, err := c.Signer.Verify(signed)
+	if err != nil {
+		return tokens.Token{}, middleware.Error(http.StatusBadRequest, fmt.Errorf("consumeToken: %w", tokens.ErrInvalid))
+	}
+
+	t, err := tokens.ConsumeToken(c.Env(), signing.HashToken(token), purpose, time.Now().UTC())
+	if err != nil {
+		return tokens.Token{}, middleware.Error(http.StatusBadRequest, fmt.Errorf("consumeToken: %w", err))
+	}
+	return t, nil
+}
+
+// showMessage renders a page with a title and a short text
+func showMessage(c *middleware.Context, title, message string) error {
+	return render(c, "message.html", map[string]string{"Title": title, "Message": message})
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/audit"
+	"github.com/AndreHeber/go-sqlite-blog/models/roles"
+	"github.com/AndreHeber/go-sqlite-blog/models/users"
+)
+
+// ShowUsers renders the user administration page
+func ShowUsers(c *middleware.Context) error {
+	env := c.Env()
+
+	allUsers, err := users.GetUsers(env)
+	if err != nil {
+		return fmt.Errorf("ShowUsers: %w", err)
+	}
+	allRoles, err := roles.GetRoles(env)
+	if err != nil {
+		return fmt.Errorf("ShowUsers: %w", err)
+	}
+
+	err = render(c, "admin_users.html", map[string]any{"Users": allUsers, "Roles": allRoles})
+	if err != nil {
+		return fmt.Errorf("ShowUsers: %w", err)
+	}
+	return nil
+}
+
+// UpdateUserRole assigns the role from the form to the user in the path
+func UpdateUserRole(c *middleware.Context) error {
+	r := c.Request
+	env := c.Env()
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return middleware.Error(http.StatusBadRequest, fmt.Errorf("UpdateUserRole: %w", err))
+	}
+	if id == c.User.ID {
+		// an admin demoting themselves could lock everyone out
+		return middleware.Error(http.StatusBadRequest, errors.New("UpdateUserRole: can't change your own role"))
+	}
+
+	role, err := roles.GetRoleByName(env, r.FormValue("role"))
+	if err != nil {
+		return middleware.Error(http.StatusBadRequest, fmt.Errorf("UpdateUserRole: %w", err))
+	}
+
+	user, err := users.GetUserByID(env, id)
+	if err != nil {
+		return middleware.Error(http.StatusNotFound, fmt.Errorf("UpdateUserRole: %w", err))
+	}
+
+	err = users.UpdateRole(env, id, role.ID)
+	if err != nil {
+		return fmt.Errorf("UpdateUserRole: %w", err)
+	}
+	c.Audit(audit.RoleChanged, map[string]any{"user_id": user.ID, "username": user.Username, "from_role_id": user.RoleID, "to_role_id": role.ID})
+
+	http.Redirect(c.ResponseWriter, r, "/admin/users", http.StatusSeeOther)
+	return nil
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/AndreHeber/go-sqlite-blog/mail"
+	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/tokens"
+	"github.com/AndreHeber/go-sqlite-blog/models/users"
+)
+
+// sendVerificationEmail mails the user a link to /verify
+func sendVerificationEmail(c *middleware.Context, user users.User) error {
+	token, err := issueToken(c, user.ID, tokens.EmailVerification, c.Config.Accounts.VerificationTTL)
+	if err != nil {
+		return fmt.Errorf("sendVerificationEmail: %w", err)
+	}
+
+	link := strings.TrimSuffix(c.Config.BaseURL, "/") + "/verify?token=" + url.QueryEscape(token)
+	err = c.Mailer.Send(c.Ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hello %s,\r\n\r\nplease verify your email address by opening this link:\r\n\r\n%s\r\n\r\nThe link is valid for %s.\r\n",
+			user.Username, link, c.Config.Accounts.VerificationTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("sendVerificationEmail: %w", err)
+	}
+	return nil
+}
+
+// Verify marks the email of the user as verified, the token comes from the link in the email
+func Verify(c *middleware.Context) error {
+	token, err := consumeToken(c, c.Request.URL.Query().Get("token"), tokens.EmailVerification)
+	if err != nil {
+		return fmt.Errorf("Verify: %w", err)
+	}
+
+	err = users.UpdateVerified(c.Env(), token.UserID, true)
+	if err != nil {
+		return fmt.Errorf("Verify: %w", err)
+	}
+
+	return showMessage(c, "Email verified", "Thank you, your email address is verified. You can log in now.")
+}
+
+// ShowResendVerification renders the form to request a new verification email
+func ShowResendVerification(c *middleware.Context) error {
+	err := render(c, "resend_verification.html", nil)
+	if err != nil {
+		return fmt.Errorf("ShowResendVerification: %w", err)
+	}
+	return nil
+}
+
+// ResendVerification sends a new verification email. The answer is the same
+// whether the address is registered or not, so it can't be used to probe for accounts.
+// Like in ForgotPassword, the email is sent in the background.
+func ResendVerification(c *middleware.Context) error {
+	email := strings.TrimSpace(c.Request.FormValue("email"))
+
+	user, err := users.GetUserByEmail(c.Env(), email)
+	if err == nil && !user.Verified {
+		c.Go(func(c *middleware.Context) error {
+			err := sendVerificationEmail(c, user)
+			if err != nil {
+				return fmt.Errorf("ResendVerification: %w", err)
+			}
+			return nil
+		})
+	}
+
+	return showMessage(c, "Check your inbox", "If the address belongs to an unverified account, a new verification link is on its way.")
+}
@@ -0,0 +1,179 @@
+// Package imaging prepares uploaded images for the web: it removes metadata like the GPS
+// position of a photo, turns photos upright by their EXIF orientation and resizes them.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// MaxPixels limits the size of images that are decoded, a small file can describe a huge image
+const MaxPixels = 50_000_000
+
+// JPEGQuality is used for photos that have to be encoded again
+const JPEGQuality = 85
+
+var (
+	ErrTooManyPixels = errors.New("imaging: image too large")
+	ErrInvalid       = errors.New("imaging: invalid image")
+)
+
+// Config returns the dimensions of an encoded image
+func Config(data []byte) (image.Config, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return image.Config{}, fmt.Errorf("Config: %w: %w", ErrInvalid, err)
+	}
+	return config, nil
+}
+
+// Decode decodes an image of at most MaxPixels
+func Decode(data []byte) (image.Image, error) {
+	config, err := Config(data)
+	if err != nil {
+		return nil, fmt.Errorf("Decode: %w", err)
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, fmt.Errorf("Decode: %w", ErrTooManyPixels)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("Decode: %w: %w", ErrInvalid, err)
+	}
+	return img, nil
+}
+
+// Sanitize removes the metadata of a JPEG, PNG, WebP or GIF image. JPEG photos that are
+// stored rotated or mirrored are turned upright and encoded again, since their orientation
+// is part of the removed metadata. Other types are returned unchanged.
+func Sanitize(data []byte, contentType string) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		if orientation := Orientation(data); orientation > 1 {
+			img, err := Decode(data)
+			if err != nil {
+				return nil, fmt.Errorf("Sanitize: %w", err)
+			}
+			var buf bytes.Buffer
+			err = jpeg.Encode(&buf, Orient(img, orientation), &jpeg.Options{Quality: JPEGQuality})
+			if err != nil {
+				return nil, fmt.Errorf("Sanitize: %w", err)
+			}
+			return buf.Bytes(), nil
+		}
+		stripped, err := stripJPEG(data)
+		if err != nil {
+			return nil, fmt.Errorf("Sanitize: %w", err)
+		}
+		return stripped, nil
+	case "image/png":
+		stripped, err := stripPNG(data)
+		if err != nil {
+			return nil, fmt.Errorf("Sanitize: %w", err)
+		}
+		return stripped, nil
+	case "image/webp":
+		stripped, err := stripWebP(data)
+		if err != nil {
+			return nil, fmt.Errorf("Sanitize: %w", err)
+		}
+		return stripped, nil
+	case "image/gif":
+		stripped, err := stripGIF(data)
+		if err != nil {
+			return nil, fmt.Errorf("Sanitize: %w", err)
+		}
+		return stripped, nil
+	default:
+		return data, nil
+	}
+}
+
+// Resize scales an image to the width, keeping its aspect ratio
+func Resize(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// opaque reports whether the image has no transparent pixels
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// Encode writes the image as JPEG if it is opaque, otherwise as PNG to keep the transparency,
+// and returns the content type
+func Encode(w io.Writer, img image.Image) (string, error) {
+	if opaque(img) {
+		return "image/jpeg", jpeg.Encode(w, img, &jpeg.Options{Quality: JPEGQuality})
+	}
+	return "image/png", png.Encode(w, img)
+}
+
+// toNRGBA returns the image as *image.NRGBA with its origin at 0,0
+func toNRGBA(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	if nrgba, ok := img.(*image.NRGBA); ok && bounds.Min == (image.Point{}) {
+		return nrgba
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	return dst
+}
+
+// Orient turns an image upright, orientation is the value of the EXIF orientation tag:
+// 2 to 4 are mirrored and rotated by 180 degrees, 5 to 8 are rotated by 90 degrees.
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	src := toNRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// source returns the pixel of src that ends up at x, y
+	var source func(x, y int) (int, int)
+	dw, dh := w, h
+	switch orientation {
+	case 2:
+		source = func(x, y int) (int, int) { return w - 1 - x, y }
+	case 3:
+		source = func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }
+	case 4:
+		source = func(x, y int) (int, int) { return x, h - 1 - y }
+	case 5:
+		source = func(x, y int) (int, int) { return y, x }
+	case 6:
+		source = func(x, y int) (int, int) { return y, h - 1 - x }
+	case 7:
+		source = func(x, y int) (int, int) { return w - 1 - y, h - 1 - x }
+	case 8:
+		source = func(x, y int) (int, int) { return w - 1 - y, x }
+	}
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			sx, sy := source(x, y)
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
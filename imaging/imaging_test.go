@@ -0,0 +1,230 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// exifSegment returns an APP1 segment with the orientation tag in big endian TIFF data
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1) // one entry
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0) // padding and no next directory
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, markerAPP1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+func TestOrient(t *testing.T) {
+	// a 3x2 image where every pixel is unique
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			src.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), A: 255})
+		}
+	}
+
+	// the source pixel that ends up in the top left and top right corner
+	tests := []struct {
+		orientation   int
+		width, height int
+		topLeft       [2]uint8
+		topRight      [2]uint8
+	}{
+		{1, 3, 2, [2]uint8{0, 0}, [2]uint8{2, 0}},
+		{2, 3, 2, [2]uint8{2, 0}, [2]uint8{0, 0}},
+		{3, 3, 2, [2]uint8{2, 1}, [2]uint8{0, 1}},
+		{4, 3, 2, [2]uint8{0, 1}, [2]uint8{2, 1}},
+		{5, 2, 3, [2]uint8{0, 0}, [2]uint8{0, 1}},
+		{6, 2, 3, [2]uint8{0, 1}, [2]uint8{0, 0}},
+		{7, 2, 3, [2]uint8{2, 1}, [2]uint8{2, 0}},
+		{8, 2, 3, [2]uint8{2, 0}, [2]uint8{2, 1}},
+	}
+	for _, tt := range tests {
+		img := Orient(src, tt.orientation)
+		bounds := img.Bounds()
+		if bounds.Dx() != tt.width || bounds.Dy() != tt.height {
+			t.Errorf("orientation %d: expected %dx%d, got %v", tt.orientation, tt.width, tt.height, bounds)
+			continue
+		}
+		for _, corner := range []struct {
+			x    int
+			want [2]uint8
+		}{{0, tt.topLeft}, {tt.width - 1, tt.topRight}} {
+			c := color.NRGBAModel.Convert(img.At(corner.x, 0)).(color.NRGBA)
+			if [2]uint8{c.R, c.G} != corner.want {
+				t.Errorf("orientation %d: pixel %d,0 comes from %d,%d, expected %v", tt.orientation, corner.x, c.R, c.G, corner.want)
+			}
+		}
+	}
+}
+
+func TestSanitizeJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 40, 20)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+	comment := []byte{0xFF, markerCOM, 0, 6, 'g', 'p', 's', '!'}
+
+	upright := append(append(append([]byte{}, encoded[:2]...), comment...), encoded[2:]...)
+	rotated := append(append(append([]byte{}, encoded[:2]...), exifSegment(6)...), encoded[2:]...)
+
+	if got := Orientation(rotated); got != 6 {
+		t.Errorf("expected orientation 6, got %d", got)
+	}
+	if got := Orientation(upright); got != 1 {
+		t.Errorf("expected orientation 1 without EXIF data, got %d", got)
+	}
+
+	stripped, err := Sanitize(upright, "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stripped, encoded) {
+		t.Errorf("expected the comment to be removed and the image data kept")
+	}
+
+	turned, err := Sanitize(rotated, "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := Config(turned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Width != 20 || config.Height != 40 {
+		t.Errorf("expected the photo turned upright to 20x40, got %dx%d", config.Width, config.Height)
+	}
+	if Orientation(turned) != 1 || bytes.Contains(turned, []byte("Exif")) {
+		t.Errorf("expected the EXIF data to be removed")
+	}
+}
+
+func TestSanitizePNG(t *testing.T) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	// a tEXt chunk after the header chunk, which is 8+25 bytes into the file
+	text := []byte("tEXtAuthor\x00someone")
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)-4))
+	chunk = append(chunk, text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(text))
+	withText := append(append(append([]byte{}, encoded[:33]...), chunk...), encoded[33:]...)
+
+	if _, err := png.Decode(bytes.NewReader(withText)); err != nil {
+		t.Fatalf("test image is invalid: %v", err)
+	}
+	stripped, err := Sanitize(withText, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stripped, encoded) {
+		t.Errorf("expected the text chunk to be removed")
+	}
+}
+
+// webpChunk returns a RIFF chunk with the padding byte of odd lengths
+func webpChunk(kind string, payload []byte) []byte {
+	chunk := binary.LittleEndian.AppendUint32([]byte(kind), uint32(len(payload)))
+	chunk = append(chunk, payload...)
+	if len(payload)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// webpFile returns a WebP file of the chunks
+func webpFile(chunks ...[]byte) []byte {
+	body := []byte("WEBP")
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	return append(binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body))), body...)
+}
+
+func TestSanitizeWebP(t *testing.T) {
+	// a lossless 1x1 image
+	lossless, err := base64.StdEncoding.DecodeString("UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bitstream := lossless[12:]
+
+	// the extended header with the EXIF and XMP flags, the canvas is 1x1
+	header := []byte{0x08 | 0x04, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	withMetadata := webpFile(
+		webpChunk("VP8X", header),
+		bitstream,
+		webpChunk("EXIF", []byte("Exif\x00\x00GPS")),
+		webpChunk("XMP ", []byte("<x:xmpmeta/>")),
+	)
+	if _, err := Config(withMetadata); err != nil {
+		t.Fatalf("test image is invalid: %v", err)
+	}
+
+	stripped, err := Sanitize(withMetadata, "image/webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := webpFile(webpChunk("VP8X", make([]byte, 10)), bitstream)
+	if !bytes.Equal(stripped, want) {
+		t.Errorf("expected the EXIF and XMP chunks and flags to be removed, got %q", stripped)
+	}
+	if _, err := Decode(stripped); err != nil {
+		t.Errorf("expected a valid image, got %v", err)
+	}
+}
+
+func TestSanitizeGIF(t *testing.T) {
+	frame := image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{color.Black, color.White})
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &gif.GIF{Image: []*image.Paletted{frame, frame}, Delay: []int{10, 10}, LoopCount: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	// a comment and an XMP application extension after the global color table
+	comment := []byte("\x21\xFE\x08GPS 1, 2\x00")
+	xmp := []byte("\x21\xFF\x0BXMP DataXMP\x05<xmp>\x00")
+	at := 13 + gifColorTable(encoded[10])
+	withMetadata := append(append(append(append([]byte{}, encoded[:at]...), comment...), xmp...), encoded[at:]...)
+	if _, err := gif.DecodeAll(bytes.NewReader(withMetadata)); err != nil {
+		t.Fatalf("test image is invalid: %v", err)
+	}
+
+	stripped, err := Sanitize(withMetadata, "image/gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stripped, encoded) {
+		t.Errorf("expected the comment and XMP data to be removed and the loop to be kept, got % x", stripped)
+	}
+}
+
+func TestResize(t *testing.T) {
+	img := Resize(image.NewGray(image.Rect(0, 0, 1000, 750)), 320)
+	if bounds := img.Bounds(); bounds.Dx() != 320 || bounds.Dy() != 240 {
+		t.Errorf("expected 320x240, got %v", bounds)
+	}
+}
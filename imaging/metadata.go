@@ -0,0 +1,266 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// JPEG markers
+const (
+	markerSOS  = 0xDA // start of the compressed image data
+	markerAPP1 = 0xE1 // EXIF and XMP
+	markerAPP2 = 0xE2 // ICC color profile
+	markerAPPE = 0xEE // Adobe color transform, needed to decode CMYK images
+	markerAPPF = 0xEF
+	markerCOM  = 0xFE // comment
+)
+
+// jpegSegments calls fn for every segment of a JPEG image before the image data,
+// with its marker and the segment including the marker and length. It returns the
+// offset of the start of scan segment.
+func jpegSegments(data []byte, fn func(marker byte, segment []byte)) (int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, fmt.Errorf("jpegSegments: %w: no JPEG", ErrInvalid)
+	}
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return 0, fmt.Errorf("jpegSegments: %w: no marker at %d", ErrInvalid, i)
+		}
+		marker := data[i+1]
+		if marker == 0xFF { // fill byte
+			i++
+			continue
+		}
+		if marker == markerSOS {
+			return i, nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 0, fmt.Errorf("jpegSegments: %w: bad segment length at %d", ErrInvalid, i)
+		}
+		fn(marker, data[i:i+2+length])
+		i += 2 + length
+	}
+	return 0, fmt.Errorf("jpegSegments: %w: no image data", ErrInvalid)
+}
+
+// stripJPEG removes the application segments and comments of a JPEG image,
+// except the color profile and the Adobe segment. The image data is kept as it is.
+func stripJPEG(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	sos, err := jpegSegments(data, func(marker byte, segment []byte) {
+		metadata := (marker >= markerAPP1 && marker <= markerAPPF && marker != markerAPP2 && marker != markerAPPE) || marker == markerCOM
+		if !metadata {
+			out.Write(segment)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("stripJPEG: %w", err)
+	}
+	out.Write(data[sos:])
+	return out.Bytes(), nil
+}
+
+// Orientation returns the EXIF orientation of a JPEG image, 1 (upright) if it has none
+func Orientation(data []byte) int {
+	orientation := 1
+	_, _ = jpegSegments(data, func(marker byte, segment []byte) {
+		if marker != markerAPP1 || !bytes.HasPrefix(segment[4:], []byte("Exif\x00\x00")) {
+			return
+		}
+		if value, ok := exifOrientation(segment[10:]); ok {
+			orientation = value
+		}
+	})
+	return orientation
+}
+
+// exifOrientation reads the orientation tag of the first image file directory of TIFF data
+func exifOrientation(tiff []byte) (int, bool) {
+	if len(tiff) < 8 {
+		return 0, false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, false
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0, false
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + 12*i
+		if entry+12 > len(tiff) {
+			return 0, false
+		}
+		// tag 0x0112 is the orientation, a SHORT (type 3) stored in the value field
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			value := int(order.Uint16(tiff[entry+8:]))
+			return value, value >= 1 && value <= 8
+		}
+	}
+	return 0, false
+}
+
+// pngMetadata are the chunks with text, EXIF data and the time of the last change
+var pngMetadata = map[string]bool{"tEXt": true, "zTXt": true, "iTXt": true, "eXIf": true, "tIME": true}
+
+// stripPNG removes the metadata chunks of a PNG image
+func stripPNG(data []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil, fmt.Errorf("stripPNG: %w: no PNG", ErrInvalid)
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.WriteString(signature)
+	for i := len(signature); i < len(data); {
+		// length, type, data and crc
+		if i+8 > len(data) {
+			return nil, fmt.Errorf("stripPNG: %w: truncated chunk at %d", ErrInvalid, i)
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) || end < i {
+			return nil, fmt.Errorf("stripPNG: %w: bad chunk length at %d", ErrInvalid, i)
+		}
+		if !pngMetadata[string(data[i+4:i+8])] {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	return out.Bytes(), nil
+}
+
+// webpMetadata are the chunks with EXIF and XMP data
+var webpMetadata = map[string]bool{"EXIF": true, "XMP ": true}
+
+// stripWebP removes the metadata chunks of a WebP image and their flags in the VP8X header
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("stripWebP: %w: no WebP", ErrInvalid)
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+	for i := 12; i < len(data); {
+		// type, length, data and a padding byte for odd lengths
+		if i+8 > len(data) {
+			return nil, fmt.Errorf("stripWebP: %w: truncated chunk at %d", ErrInvalid, i)
+		}
+		length := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + length + length%2
+		if length < 0 || end > len(data) || end < i {
+			return nil, fmt.Errorf("stripWebP: %w: bad chunk length at %d", ErrInvalid, i)
+		}
+		chunk := data[i:end]
+		switch kind := string(chunk[:4]); {
+		case webpMetadata[kind]:
+		case kind == "VP8X" && length > 0:
+			extended := append([]byte{}, chunk...)
+			// the EXIF (0x08) and XMP (0x04) flags
+			extended[8] &^= 0x08 | 0x04
+			out.Write(extended)
+		default:
+			out.Write(chunk)
+		}
+		i = end
+	}
+
+	stripped := out.Bytes()
+	binary.LittleEndian.PutUint32(stripped[4:], uint32(len(stripped)-8))
+	return stripped, nil
+}
+
+// gifKeptApplications are the application extensions that make animations loop
+var gifKeptApplications = map[string]bool{"NETSCAPE2.0": true, "ANIMEXTS1.0": true}
+
+// gifSubBlocks returns the end of the sub-blocks starting at i, the last one has the size 0
+func gifSubBlocks(data []byte, i int) (int, error) {
+	for {
+		if i >= len(data) {
+			return 0, fmt.Errorf("gifSubBlocks: %w: truncated data", ErrInvalid)
+		}
+		size := int(data[i])
+		i += 1 + size
+		if size == 0 {
+			return i, nil
+		}
+	}
+}
+
+// gifColorTable returns the size of the color table the packed field of a descriptor announces
+func gifColorTable(packed byte) int {
+	if packed&0x80 == 0 {
+		return 0
+	}
+	return 3 << (packed&0x07 + 1)
+}
+
+// stripGIF removes the comments and the application extensions other than the loop of
+// animations from a GIF image
+func stripGIF(data []byte) ([]byte, error) {
+	if len(data) < 13 || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return nil, fmt.Errorf("stripGIF: %w: no GIF", ErrInvalid)
+	}
+
+	// header, logical screen descriptor and global color table
+	i := 13 + gifColorTable(data[10])
+	if i > len(data) {
+		return nil, fmt.Errorf("stripGIF: %w: truncated color table", ErrInvalid)
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:i])
+	for {
+		if i >= len(data) {
+			return nil, fmt.Errorf("stripGIF: %w: no trailer", ErrInvalid)
+		}
+		start := i
+		switch data[i] {
+		case 0x3B: // trailer
+			out.WriteByte(0x3B)
+			return out.Bytes(), nil
+		case 0x2C: // image descriptor, color table, LZW code size and image data
+			if i+11 > len(data) {
+				return nil, fmt.Errorf("stripGIF: %w: truncated image at %d", ErrInvalid, i)
+			}
+			end, err := gifSubBlocks(data, i+11+gifColorTable(data[i+9]))
+			if err != nil {
+				return nil, fmt.Errorf("stripGIF: %w", err)
+			}
+			out.Write(data[start:end])
+			i = end
+		case 0x21: // extension with its label
+			if i+2 > len(data) {
+				return nil, fmt.Errorf("stripGIF: %w: truncated extension at %d", ErrInvalid, i)
+			}
+			label := data[i+1]
+			end, err := gifSubBlocks(data, i+2)
+			if err != nil {
+				return nil, fmt.Errorf("stripGIF: %w", err)
+			}
+			keep := label != 0xFE // comment
+			if label == 0xFF {
+				// the first sub-block holds the identifier and authentication code
+				size := int(data[i+2])
+				keep = i+3+size <= end && gifKeptApplications[string(data[i+3:i+3+size])]
+			}
+			if keep {
+				out.Write(data[start:end])
+			}
+			i = end
+		default:
+			return nil, fmt.Errorf("stripGIF: %w: unknown block 0x%02x at %d", ErrInvalid, data[i], i)
+		}
+	}
+}
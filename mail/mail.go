@@ -0,0 +1,123 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/config"
+	"github.com/AndreHeber/go-sqlite-blog/signing"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string // plain text
+}
+
+// Sender delivers emails
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the Sender selected by cfg.Driver
+func New(cfg config.MailConfig) (Sender, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return &SMTPSender{Host: cfg.Host, Port: cfg.Port, Username: cfg.Username, Password: string(cfg.Password), From: cfg.From}, nil
+	case "file":
+		return &FileSender{Dir: cfg.Dir, From: cfg.From}, nil
+	case "stdout", "":
+		return &WriterSender{W: os.Stdout, From: cfg.From}, nil
+	}
+	return nil, fmt.Errorf("New: unknown mail driver %s", cfg.Driver)
+}
+
+// headerValue removes line breaks, so values can't add headers
+var headerValue = strings.NewReplacer("\r", "", "\n", "")
+
+// encode renders the message in the internet message format
+func encode(from string, msg Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+	return b.Bytes()
+}
+
+// SMTPSender delivers emails through an SMTP server, using STARTTLS if the server supports it
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("Send: %w", err)
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	addr := s.Host + ":" + strconv.Itoa(s.Port)
+	err := smtp.SendMail(addr, auth, s.From, []string{msg.To}, encode(s.From, msg))
+	if err != nil {
+		return fmt.Errorf("Send: %w", err)
+	}
+	return nil
+}
+
+// FileSender writes every email as .eml file into Dir, for development and tests
+type FileSender struct {
+	Dir  string
+	From string
+}
+
+func (s *FileSender) Send(ctx context.Context, msg Message) error {
+	err := os.MkdirAll(s.Dir, 0o750)
+	if err != nil {
+		return fmt.Errorf("Send: %w", err)
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), signing.RandomToken(4))
+	err = os.WriteFile(filepath.Join(s.Dir, name), encode(s.From, msg), 0o600)
+	if err != nil {
+		return fmt.Errorf("Send: %w", err)
+	}
+	return nil
+}
+
+// WriterSender writes emails to W, by default stdout
+type WriterSender struct {
+	W    io.Writer
+	From string
+	mu   sync.Mutex
+}
+
+func (s *WriterSender) Send(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(s.W, "%s\r\n.\r\n", encode(s.From, msg))
+	if err != nil {
+		return fmt.Errorf("Send: %w", err)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -11,8 +12,12 @@ import (
 
 	"github.com/AndreHeber/go-sqlite-blog/config"
 	dbService "github.com/AndreHeber/go-sqlite-blog/db"
+	"github.com/AndreHeber/go-sqlite-blog/feed"
 	"github.com/AndreHeber/go-sqlite-blog/handlers"
 	"github.com/AndreHeber/go-sqlite-blog/middleware"
+	"github.com/AndreHeber/go-sqlite-blog/models/roles"
+	"github.com/AndreHeber/go-sqlite-blog/openapi"
+	"github.com/AndreHeber/go-sqlite-blog/static"
 )
 
 func main() {
@@ -27,6 +32,16 @@ func main() {
 	}))
 	slog.SetDefault(logger)
 
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		err = runMigrate(logger, cfg, args[1:], os.Stdout)
+		if err != nil {
+			slog.Error("main: Error running migrate", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// only the server resets the database, never a subcommand
 	if cfg.Database.Reset {
 		slog.Info("Resetting database")
 		// delete database file
@@ -38,12 +53,16 @@ func main() {
 	}
 
 	slog.Info("Initializing database", "driver", cfg.Database.Driver, "source", cfg.Database.Source)
-	db, err := dbService.Init(logger, cfg.Database.Driver, cfg.Database.Source, "./tables.sql")
+	db, err := dbService.Init(logger, cfg.Database.Driver, cfg.Database.Source)
 	if err != nil {
 		os.Exit(1)
 	}
 
-	adapter := middleware.Init(logger, db, cfg.ErrorsInResponse, cfg.Database.LogQueries, cfg.IPRateLimit, cfg.BurstRateLimit)
+	adapter, err := middleware.Init(logger, db, cfg)
+	if err != nil {
+		slog.Error("main: Error initializing middleware", "error", err)
+		os.Exit(1)
+	}
 	mux := setupRouter(adapter)
 
 	// start server
@@ -78,10 +97,30 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		slog.Error("main: Server forced to shutdown", "error", err)
 	}
+	// emails and other work started by requests
+	adapter.Wait()
+}
+
+// router records the patterns of its routes, a test compares them with the OpenAPI document
+type router struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func (r *router) Handle(pattern string, handler http.Handler) {
+	r.patterns = append(r.patterns, pattern)
+	r.ServeMux.Handle(pattern, handler)
 }
 
-func setupRouter(adapter *middleware.Adapter) *http.ServeMux {
-	mux := http.NewServeMux()
+func setupRouter(adapter *middleware.Adapter) *router {
+	mux := &router{ServeMux: http.NewServeMux()}
+
+	// uploads take longer than the timeouts of the server allow, the multipart form
+	// adds a little to the size of the file
+	uploadOptions := []middleware.RouteOption{
+		middleware.WithTimeout(adapter.Config.Media.Timeout),
+		middleware.WithMaxBodyBytes(adapter.Config.Media.MaxSize + 64<<10),
+	}
 
 	mux.Handle("GET /health", adapter.HTTPToContextHandler(handlers.Health))
 	mux.Handle("GET /time-consuming", adapter.HTTPToContextHandler(handlers.TimeConsumingHandler))
@@ -91,6 +130,125 @@ func setupRouter(adapter *middleware.Adapter) *http.ServeMux {
 
 	mux.Handle("GET /login", adapter.HTTPToContextHandler(handlers.ShowLogin))
 	mux.Handle("POST /login", adapter.HTTPToContextHandler(handlers.TryLogin))
+	mux.Handle("GET /verify", adapter.HTTPToContextHandler(handlers.Verify))
+	mux.Handle("GET /verify/resend", adapter.HTTPToContextHandler(handlers.ShowResendVerification))
+	mux.Handle("POST /verify/resend", adapter.HTTPToContextHandler(handlers.ResendVerification))
+
+	mux.Handle("GET /password/forgot", adapter.HTTPToContextHandler(handlers.ShowForgotPassword))
+	mux.Handle("POST /password/forgot", adapter.HTTPToContextHandler(handlers.ForgotPassword))
+	mux.Handle("GET /password/reset", adapter.HTTPToContextHandler(handlers.ShowResetPassword))
+	mux.Handle("POST /password/reset", adapter.HTTPToContextHandler(handlers.ResetPassword))
+
+	mux.Handle("POST /logout", adapter.HTTPToContextHandler(handlers.Logout))
+	mux.Handle("POST /logout/all", adapter.HTTPToContextHandler(middleware.RequireUser(handlers.LogoutEverywhere)))
+
+	mux.Handle("GET /account/tokens", adapter.HTTPToContextHandler(middleware.RequireUser(handlers.ShowTokens)))
+	mux.Handle("POST /account/tokens", adapter.HTTPToContextHandler(middleware.RequireUser(handlers.CreateToken)))
+	mux.Handle("POST /account/tokens/{id}/delete", adapter.HTTPToContextHandler(middleware.RequireUser(handlers.RevokeToken)))
+
+	mux.Handle("GET /{$}", adapter.HTTPToContextHandler(handlers.ListArticles))
+	mux.Handle("GET /articles", adapter.HTTPToContextHandler(handlers.ListArticles))
+	mux.Handle("GET /articles/new", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.ArticleCreate, handlers.NewArticle)))
+	mux.Handle("POST /articles", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.ArticleCreate, handlers.CreateArticle)))
+	mux.Handle("GET /search", adapter.HTTPToContextHandler(handlers.Search))
+	mux.Handle("GET /search.json", adapter.HTTPToContextHandler(handlers.SearchJSON))
+	mux.Handle("GET /articles/{slug}", adapter.HTTPToContextHandler(handlers.ShowArticle))
+	mux.Handle("GET /articles/{slug}/edit", adapter.HTTPToContextHandler(middleware.RequireUser(handlers.EditArticle)))
+	mux.Handle("POST /articles/{slug}/edit", adapter.HTTPToContextHandler(middleware.RequireUser(handlers.UpdateArticle)))
+	mux.Handle("POST /articles/{slug}/delete", adapter.HTTPToContextHandler(middleware.RequireUser(handlers.DeleteArticle)))
+	mux.Handle("GET /articles/{slug}/revisions", adapter.HTTPToContextHandler(middleware.RequireUser(handlers.ShowRevisions)))
+	mux.Handle("GET /articles/{slug}/diff", adapter.HTTPToContextHandler(middleware.RequireUser(handlers.ShowDiff)))
+	mux.Handle("POST /articles/{slug}/revisions/{id}/restore", adapter.HTTPToContextHandler(middleware.RequireUser(handlers.RestoreRevision)))
+	mux.Handle("POST /articles/{slug}/comments", adapter.HTTPToContextHandler(handlers.CreateComment))
+	mux.Handle("POST /articles/{slug}/like", adapter.HTTPToContextHandler(middleware.RequireUser(handlers.LikeArticle)))
+	mux.Handle("POST /articles/{slug}/comments/{id}/like", adapter.HTTPToContextHandler(middleware.RequireUser(handlers.LikeComment)))
+	mux.Handle("GET /popular", adapter.HTTPToContextHandler(handlers.MostLiked))
+
+	mux.Handle("GET /category/{slug}", adapter.HTTPToContextHandler(handlers.ShowCategory))
+	mux.Handle("GET /tag/{slug}", adapter.HTTPToContextHandler(handlers.ShowTag))
+	mux.Handle("GET /tags", adapter.HTTPToContextHandler(handlers.TagCloud))
+
+	mux.Handle("GET /static/{path...}", adapter.HTTPToContextHandler(handlers.ServeStatic(static.Assets(adapter.Config.StaticDir))))
+	mux.Handle("GET /media/{id}/{name}", adapter.HTTPToContextHandler(handlers.ServeMedia, middleware.WithTimeout(adapter.Config.Media.Timeout)))
+
+	mux.Handle("GET /feed.xml", adapter.HTTPToContextHandler(handlers.Feed(feed.RSS)))
+	mux.Handle("GET /atom.xml", adapter.HTTPToContextHandler(handlers.Feed(feed.Atom)))
+	mux.Handle("GET /feed.json", adapter.HTTPToContextHandler(handlers.Feed(feed.JSON)))
+	mux.Handle("GET /category/{slug}/feed.xml", adapter.HTTPToContextHandler(handlers.CategoryFeed(feed.RSS)))
+	mux.Handle("GET /category/{slug}/atom.xml", adapter.HTTPToContextHandler(handlers.CategoryFeed(feed.Atom)))
+	mux.Handle("GET /category/{slug}/feed.json", adapter.HTTPToContextHandler(handlers.CategoryFeed(feed.JSON)))
+	mux.Handle("GET /tag/{slug}/feed.xml", adapter.HTTPToContextHandler(handlers.TagFeed(feed.RSS)))
+	mux.Handle("GET /tag/{slug}/atom.xml", adapter.HTTPToContextHandler(handlers.TagFeed(feed.Atom)))
+	mux.Handle("GET /tag/{slug}/feed.json", adapter.HTTPToContextHandler(handlers.TagFeed(feed.JSON)))
+
+	mux.Handle("GET /admin/comments", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.CommentModerate, handlers.ShowComments)))
+	mux.Handle("POST /admin/comments/{id}/approve", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.CommentModerate, handlers.ApproveComment)))
+	mux.Handle("POST /admin/comments/{id}/reject", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.CommentModerate, handlers.RejectComment)))
+	mux.Handle("POST /admin/comments/{id}/delete", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.CommentModerate, handlers.DeleteComment)))
+	mux.Handle("GET /admin/comments/{id}/edit", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.CommentModerate, handlers.EditComment)))
+	mux.Handle("POST /admin/comments/{id}/edit", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.CommentModerate, handlers.UpdateComment)))
+	mux.Handle("GET /admin/categories", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.TaxonomyManage, handlers.ShowCategories)))
+	mux.Handle("POST /admin/categories", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.TaxonomyManage, handlers.CreateCategory)))
+	mux.Handle("POST /admin/categories/{id}", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.TaxonomyManage, handlers.UpdateCategory)))
+	mux.Handle("POST /admin/categories/{id}/delete", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.TaxonomyManage, handlers.DeleteCategory)))
+	mux.Handle("GET /admin/tags", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.TaxonomyManage, handlers.ShowTags)))
+	mux.Handle("POST /admin/tags", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.TaxonomyManage, handlers.CreateTag)))
+	mux.Handle("POST /admin/tags/merge", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.TaxonomyManage, handlers.MergeTags)))
+	mux.Handle("POST /admin/tags/{id}", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.TaxonomyManage, handlers.UpdateTag)))
+	mux.Handle("POST /admin/tags/{id}/delete", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.TaxonomyManage, handlers.DeleteTag)))
+	mux.Handle("GET /admin/media", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.MediaUpload, handlers.ShowMedia)))
+	mux.Handle("POST /admin/media", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.MediaUpload, handlers.UploadMedia), uploadOptions...))
+	mux.Handle("POST /admin/media/{id}/delete", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.MediaUpload, handlers.DeleteMedia)))
+	mux.Handle("GET /admin/pages", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.PageEdit, handlers.ShowPages)))
+	mux.Handle("GET /admin/pages/new", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.PageEdit, handlers.NewPage)))
+	mux.Handle("POST /admin/pages", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.PageEdit, handlers.CreatePage)))
+	mux.Handle("GET /admin/pages/{id}/edit", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.PageEdit, handlers.EditPage)))
+	mux.Handle("POST /admin/pages/{id}/edit", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.PageEdit, handlers.UpdatePage)))
+	mux.Handle("POST /admin/pages/{id}/delete", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.PageEdit, handlers.DeletePage)))
+	mux.Handle("GET /admin/audit", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.AuditView, handlers.ShowAudit)))
+	mux.Handle("GET /admin/settings", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.SettingsEdit, handlers.ShowSettings)))
+	mux.Handle("POST /admin/settings", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.SettingsEdit, handlers.SaveSettings)))
+	mux.Handle("GET /admin/templates", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.TemplateEdit, handlers.ShowTemplates)))
+	mux.Handle("GET /admin/templates/new", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.TemplateEdit, handlers.NewTemplate)))
+	mux.Handle("POST /admin/templates", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.TemplateEdit, handlers.SaveTemplate)))
+	mux.Handle("GET /admin/templates/{name}", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.TemplateEdit, handlers.EditTemplate)))
+	mux.Handle("POST /admin/templates/{name}/delete", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.TemplateEdit, handlers.ResetTemplate)))
+	mux.Handle("GET /admin/users", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.UserManage, handlers.ShowUsers)))
+	mux.Handle("POST /admin/users/{id}/role", adapter.HTTPToContextHandler(middleware.RequirePermission(roles.UserManage, handlers.UpdateUserRole)))
+
+	// the JSON API, request bodies are small documents
+	apiOptions := []middleware.RouteOption{middleware.WithMaxBodyBytes(1 << 20)}
+	spec := &openapi.Spec{
+		Title:   "go-sqlite-blog",
+		Version: "1.0.0",
+		Error:   middleware.ErrorObject{},
+		List:    middleware.List{},
+		ListParameters: []openapi.Parameter{
+			{Name: "limit", In: "query", Description: "the number of items, 1 to 100, 20 by default", Schema: &openapi.Schema{Type: "integer"}},
+			{Name: "cursor", In: "query", Description: "the next_cursor of the previous page", Schema: &openapi.Schema{Type: "string"}},
+		},
+		Parameters: []openapi.Parameter{
+			{Name: "fields", In: "query", Description: "a comma separated list of the fields to return", Schema: &openapi.Schema{Type: "string"}},
+		},
+		SecuritySchemes: map[string]openapi.SecurityScheme{
+			"bearerAuth": {Type: "http", Scheme: "bearer", Description: "a personal API token"},
+			"cookieAuth": {Type: "apiKey", In: "cookie", Name: adapter.Config.Session.CookieName},
+		},
+	}
+	for _, route := range handlers.APIRoutes {
+		spec.Add(route.Route)
+		var options []middleware.RouteOption
+		if route.Request != nil {
+			options = apiOptions
+		}
+		mux.Handle(route.Method+" "+route.Path, adapter.HTTPToDataHandler(route.DataFunc(), options...))
+	}
+	mux.Handle("GET /api/openapi.json", adapter.HTTPToDataHandler(handlers.OpenAPI(spec)))
+	// unknown API paths get an error object instead of the plain text of the mux
+	mux.Handle("/api/", adapter.HTTPToDataHandler(handlers.APINotFound))
+
+	// pages get the paths that no other route matches, their slugs can't be the first segment of a route above
+	mux.Handle("GET /{slug}", adapter.HTTPToContextHandler(handlers.ShowPage))
 
 	return mux
 }
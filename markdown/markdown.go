@@ -0,0 +1,137 @@
+// Package markdown renders the Markdown of articles to HTML: CommonMark with the GitHub
+// tables, task lists, strikethrough and autolinks, and footnotes. Raw HTML in the source
+// is allowed, the result is sanitized with an allowlist.
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Version changes whenever the same source renders differently,
+// HTML rendered by an older version is rendered again
+const Version = 1
+
+// headingPrefix keeps the ids of headings apart from the ids of the page around the article
+const headingPrefix = "section-"
+
+// Heading is an entry of the table of contents
+type Heading struct {
+	Level int
+	ID    string
+	Text  string
+}
+
+// Document is the rendered Markdown
+type Document struct {
+	HTML string
+	TOC  string // a nested list linking to the headings, empty for less than two headings
+}
+
+var tocKey = parser.NewContextKey()
+
+// anchors prefixes the ids of the headings, links each heading to itself
+// and collects the headings for the table of contents
+type anchors struct{}
+
+func (anchors) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	var headings []Heading
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		value, ok := heading.AttributeString("id")
+		id, _ := value.([]byte)
+		if !ok || len(id) == 0 {
+			return ast.WalkSkipChildren, nil
+		}
+		prefixed := headingPrefix + string(id)
+		heading.SetAttributeString("id", []byte(prefixed))
+		headings = append(headings, Heading{Level: heading.Level, ID: prefixed, Text: string(heading.Text(reader.Source()))})
+
+		link := ast.NewLink()
+		link.Destination = []byte("#" + prefixed)
+		link.SetAttributeString("class", []byte("anchor"))
+		link.AppendChild(link, ast.NewString([]byte("#")))
+		heading.AppendChild(heading, ast.NewString([]byte(" ")))
+		heading.AppendChild(heading, link)
+		return ast.WalkSkipChildren, nil
+	})
+	pc.Set(tocKey, headings)
+}
+
+var md = goldmark.New(
+	goldmark.WithExtensions(extension.GFM, extension.Footnote),
+	goldmark.WithParserOptions(
+		parser.WithAutoHeadingID(),
+		parser.WithASTTransformers(util.Prioritized(anchors{}, 1000)),
+	),
+	// raw HTML is kept for the sanitizer to filter
+	goldmark.WithRendererOptions(goldmarkhtml.WithUnsafe()),
+)
+
+// policy is the allowlist of the HTML of articles, the user generated content policy
+// with the markup the extensions write
+var policy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^(`+headingPrefix+`[\pL\pN_-]+|fn:\d+|fnref\d*:\d+)$`)).OnElements("h1", "h2", "h3", "h4", "h5", "h6", "li", "sup")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^(anchor|footnote-ref|footnote-backref|footnotes)$`)).OnElements("a", "div")
+	p.AllowAttrs("role").Matching(regexp.MustCompile(`^doc-(noteref|backlink|endnotes)$`)).OnElements("a", "div")
+	p.AllowAttrs("style").Matching(regexp.MustCompile(`^text-align:(left|center|right)$`)).OnElements("th", "td")
+	// the checkboxes of task lists
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}()
+
+// Render renders the Markdown source to sanitized HTML with a table of contents
+func Render(source string) (Document, error) {
+	pc := parser.NewContext()
+	var buf bytes.Buffer
+	err := md.Convert([]byte(source), &buf, parser.WithContext(pc))
+	if err != nil {
+		return Document{}, fmt.Errorf("Render: %w", err)
+	}
+	headings, _ := pc.Get(tocKey).([]Heading)
+	return Document{HTML: policy.Sanitize(buf.String()), TOC: toc(headings)}, nil
+}
+
+// toc nests the headings by their level, a heading deeper than the one before starts a sub list
+func toc(headings []Heading) string {
+	if len(headings) < 2 {
+		return ""
+	}
+	var b strings.Builder
+	var levels []int
+	for i, heading := range headings {
+		switch {
+		case i == 0 || heading.Level > levels[len(levels)-1]:
+			b.WriteString("<ul>")
+			levels = append(levels, heading.Level)
+		default:
+			b.WriteString("</li>")
+			for len(levels) > 1 && heading.Level < levels[len(levels)-1] && heading.Level <= levels[len(levels)-2] {
+				b.WriteString("</ul></li>")
+				levels = levels[:len(levels)-1]
+			}
+		}
+		fmt.Fprintf(&b, `<li><a href="#%s">%s</a>`, html.EscapeString(heading.ID), html.EscapeString(heading.Text))
+	}
+	for range levels {
+		b.WriteString("</li></ul>")
+	}
+	return b.String()
+}
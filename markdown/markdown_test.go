@@ -0,0 +1,46 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	doc, err := Render("# Title\n\n<b onclick=\"x()\">bold</b> <script>alert(1)</script> [link](javascript:alert(1)) ~~old~~\n\n- [ ] todo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<h1 id="section-title">Title <a href="#section-title" class="anchor" rel="nofollow">#</a></h1>`,
+		`<b>bold</b>`,
+		`<del>old</del>`,
+		`<input disabled="" type="checkbox"> todo`,
+	} {
+		if !strings.Contains(doc.HTML, want) {
+			t.Errorf("expected %s in %s", want, doc.HTML)
+		}
+	}
+	for _, unwanted := range []string{"onclick", "script", "javascript"} {
+		if strings.Contains(doc.HTML, unwanted) {
+			t.Errorf("expected no %s in %s", unwanted, doc.HTML)
+		}
+	}
+	if doc.TOC != "" {
+		t.Errorf("expected no table of contents for a single heading, got %s", doc.TOC)
+	}
+}
+
+func TestTOC(t *testing.T) {
+	got := toc([]Heading{
+		{2, "a", "A"},
+		{3, "b", "B"},
+		{4, "c", "C <&>"},
+		{2, "d", "D"},
+		{3, "e", "E"},
+	})
+	want := `<ul><li><a href="#a">A</a><ul><li><a href="#b">B</a><ul><li><a href="#c">C &lt;&amp;&gt;</a></li></ul></li></ul></li>` +
+		`<li><a href="#d">D</a><ul><li><a href="#e">E</a></li></ul></li></ul>`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
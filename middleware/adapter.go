@@ -3,30 +3,79 @@ package middleware
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
 
 	"golang.org/x/time/rate"
+
+	"github.com/AndreHeber/go-sqlite-blog/config"
+	"github.com/AndreHeber/go-sqlite-blog/mail"
+	"github.com/AndreHeber/go-sqlite-blog/signing"
+	"github.com/AndreHeber/go-sqlite-blog/static"
+	"github.com/AndreHeber/go-sqlite-blog/theme"
 )
 
+// Adapter holds the state shared by all routes. It must not contain any
+// per-request data, see Context for that.
 type Adapter struct {
-	Request         *http.Request
-	ResponseWriter  http.ResponseWriter
 	Logger          *slog.Logger
 	DB              *sql.DB
-	Ctx             context.Context
-	Cancel          context.CancelFunc
+	Config          *config.Config
+	Mailer          mail.Sender
+	Signer          *signing.Signer
 	ErrorInResponse bool
 	LogDBQueries    bool
 	ipRateLimiter   *IPRateLimiter
+	sessions        *SessionManager
+	Settings        *SettingsCache
+	Theme           *theme.Theme
+	background      *sync.WaitGroup
+}
+
+func Init(logger *slog.Logger, db *sql.DB, cfg *config.Config) (*Adapter, error) {
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		return nil, fmt.Errorf("Init: %w", err)
+	}
+
+	// the placeholder of earlier config files is public, anyone could sign cookies and links with it
+	if cfg.Session.Secret == "change-me-in-production" {
+		return nil, errors.New("Init: session.secret is the placeholder change-me-in-production, set SESSION_SECRET to a random value")
+	}
+	secret := []byte(cfg.Session.Secret)
+	if len(secret) == 0 {
+		logger.Warn("middleware: Init", "warning", "NO SESSION SECRET CONFIGURED, using a random one, sessions and links in emails will not survive a restart. Set SESSION_SECRET in production.")
+		secret = []byte(signing.RandomToken(32))
+	}
+	signer := signing.New(secret)
+
+	return &Adapter{
+		Logger:          logger,
+		DB:              db,
+		Config:          cfg,
+		Mailer:          mailer,
+		Signer:          signer,
+		ErrorInResponse: cfg.ErrorsInResponse,
+		LogDBQueries:    cfg.Database.LogQueries,
+		ipRateLimiter:   NewIPRateLimiter(cfg.IPRateLimit, cfg.BurstRateLimit),
+		sessions:        NewSessionManager(cfg.Session, signer),
+		Settings:        NewSettingsCache(),
+		// the functions of a nil Context are never called, templates are only parsed with them.
+		// Templates from a directory are compiled again for every request to show changes at once.
+		Theme:      theme.New(static.Templates(cfg.StaticDir), (*Context)(nil).TemplateFuncs(), cfg.StaticDir != ""),
+		background: &sync.WaitGroup{},
+	}, nil
 }
 
-func Init(logger *slog.Logger, db *sql.DB, errorInResponse bool, logDBQueries bool, ipRateLimit rate.Limit, burst int) *Adapter {
-	return &Adapter{Logger: logger, DB: db, ErrorInResponse: errorInResponse, LogDBQueries: logDBQueries, ipRateLimiter: NewIPRateLimiter(ipRateLimit, burst)}
+// Wait blocks until the work handlers started with Context.Go is done
+func (a *Adapter) Wait() {
+	a.background.Wait()
 }
 
 // 1. Simple rate limiter per IP
@@ -58,44 +107,94 @@ func NewIPRateLimiter(r rate.Limit, b int) *IPRateLimiter {
 	}
 }
 
-// Create an adapter function
-func (a *Adapter) HTTPToContextHandler(h func(*Adapter) error) http.HandlerFunc {
+// sensitiveKeys are parts of the form and query keys whose values are never logged,
+// like password, password_confirm or token
+var sensitiveKeys = []string{"password", "token", "secret"}
+
+// logParameters formats the form and query values for the request log, with sensitive values redacted
+func logParameters(form url.Values) string {
+	formValues := make([]string, 0, len(form))
+	for key, value := range form {
+		for _, sensitive := range sensitiveKeys {
+			if strings.Contains(strings.ToLower(key), sensitive) {
+				value = []string{"[redacted]"}
+				break
+			}
+		}
+		formValues = append(formValues, fmt.Sprintf("%s=%s", key, value))
+	}
+	return strings.Join(formValues, "&")
+}
+
+// HTTPToContextHandler converts a HandlerFunc into a http.HandlerFunc.
+// Every request gets its own Context with a deadline of 10 seconds,
+// options change it and other limits for the route.
+func (a *Adapter) HTTPToContextHandler(h HandlerFunc, options ...RouteOption) http.HandlerFunc {
+	route := routeOptions{timeout: defaultTimeout}
+	for _, option := range options {
+		option(&route)
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		limiter := a.ipRateLimiter.getLimiter(r.RemoteAddr)
 		if !limiter.Allow() {
 			a.Logger.Info("middleware: HttpToContextHandler", "error", "Too many requests", "ip", r.RemoteAddr)
-			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			route.writeError(w, http.StatusTooManyRequests, "Too many requests")
 			return
 		}
 
-		if err := r.ParseForm(); err != nil {
+		if err := route.apply(w, r); err != nil {
 			a.Logger.Error("middleware: HttpToContextHandler", "error", err)
+			route.writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 			return
 		}
 
-		formValues := make([]string, 0, len(r.Form))
-		for key, value := range r.Form {
-			formValues = append(formValues, fmt.Sprintf("%s=%s", key, value))
+		if err := r.ParseForm(); err != nil {
+			a.Logger.Error("middleware: HttpToContextHandler", "error", err)
+			return
 		}
-		parameters := strings.Join(formValues, "&")
 
-		a.Request = r
-		a.ResponseWriter = w
-
-		ctx := context.Background()
-		a.Ctx, a.Cancel = context.WithTimeout(ctx, 10*time.Second)
-		defer a.Cancel()
+		parameters := logParameters(r.Form)
+
+		ctx, cancel := context.WithTimeout(r.Context(), route.timeout)
+		defer cancel()
+
+		c := &Context{
+			Request:         r.WithContext(ctx),
+			ResponseWriter:  w,
+			Logger:          a.Logger,
+			DB:              a.DB,
+			Config:          a.Config,
+			Mailer:          a.Mailer,
+			Signer:          a.Signer,
+			Ctx:             ctx,
+			ErrorInResponse: a.ErrorInResponse,
+			LogDBQueries:    a.LogDBQueries,
+			sessions:        a.sessions,
+			settings:        a.Settings,
+			Theme:           a.Theme,
+			background:      a.background,
+		}
 
 		start := time.Now()
-		if err := h(a); err != nil {
-			a.Logger.Error("middleware: HttpToContextHandler", "error", err)
+		err := a.sessions.load(c)
+		if err == nil {
+			err = h(c)
+		}
+		if err != nil {
+			status := statusOf(err)
+			if status >= http.StatusInternalServerError {
+				a.Logger.Error("middleware: HttpToContextHandler", "error", err)
+			} else {
+				a.Logger.Info("middleware: HttpToContextHandler", "error", err, "status", status)
+			}
 
 			// Handle error appropriately
 			if a.ErrorInResponse {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				route.writeError(w, status, err.Error())
 			} else {
 				// return common error
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				route.writeError(w, status, http.StatusText(status))
 			}
 		}
 
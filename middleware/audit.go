@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/models/audit"
+	"github.com/AndreHeber/go-sqlite-blog/models/users"
+)
+
+// Audit records the action of the current user with the IP address and user agent of the
+// request. details are stored as JSON. Failures are logged but don't fail the request,
+// the action already happened.
+func (c *Context) Audit(action audit.Action, details map[string]any) {
+	c.AuditAs(c.User, action, details)
+}
+
+// AuditAs records the action of a user that isn't logged in with this request,
+// like a registration. user is nil for anonymous actions.
+func (c *Context) AuditAs(user *users.User, action audit.Action, details map[string]any) {
+	env := c.Env()
+	now := time.Now().UTC()
+
+	if details == nil {
+		details = map[string]any{}
+	}
+	data, err := json.Marshal(details)
+	if err != nil {
+		c.Logger.Error("middleware: Audit", "error", err, "action", action)
+		return
+	}
+
+	ip, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		ip = c.Request.RemoteAddr
+	}
+	entry := audit.Entry{
+		Action:    action,
+		Details:   string(data),
+		IP:        ip,
+		UserAgent: c.Request.UserAgent(),
+		CreatedAt: now,
+	}
+	if user != nil {
+		entry.UserID = user.ID
+	}
+	err = audit.CreateEntry(env, entry)
+	if err != nil {
+		c.Logger.Error("middleware: Audit", "error", err, "action", action)
+		return
+	}
+
+	// opportunistic cleanup, so the table doesn't grow forever
+	if retention := c.Settings().AuditRetention; retention > 0 {
+		err = audit.DeleteEntriesBefore(env, now.Add(-retention))
+		if err != nil {
+			c.Logger.Error("middleware: Audit", "error", err, "action", action)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/config"
+	"github.com/AndreHeber/go-sqlite-blog/mail"
+	"github.com/AndreHeber/go-sqlite-blog/models"
+	"github.com/AndreHeber/go-sqlite-blog/models/apitokens"
+	"github.com/AndreHeber/go-sqlite-blog/models/media"
+	"github.com/AndreHeber/go-sqlite-blog/models/pages"
+	"github.com/AndreHeber/go-sqlite-blog/models/roles"
+	"github.com/AndreHeber/go-sqlite-blog/models/sessions"
+	"github.com/AndreHeber/go-sqlite-blog/models/settings"
+	"github.com/AndreHeber/go-sqlite-blog/models/users"
+	"github.com/AndreHeber/go-sqlite-blog/signing"
+	"github.com/AndreHeber/go-sqlite-blog/theme"
+)
+
+// Context holds everything a handler needs to serve a single request.
+// A new Context is created for every request by HTTPToContextHandler, so
+// handlers never share request state with each other. Handlers must not
+// keep a reference to it after they return.
+type Context struct {
+	Request         *http.Request
+	ResponseWriter  http.ResponseWriter
+	Logger          *slog.Logger
+	DB              *sql.DB
+	Config          *config.Config
+	Mailer          mail.Sender
+	Signer          *signing.Signer
+	Theme           *theme.Theme
+	Ctx             context.Context
+	ErrorInResponse bool
+	LogDBQueries    bool
+
+	// User and Session are nil for anonymous requests. Token is set instead of
+	// Session for requests authenticated by an API token.
+	User        *users.User
+	Session     *sessions.Session
+	Token       *apitokens.Token
+	sessions    *SessionManager
+	permissions map[roles.Permission]bool // of the role of User, loaded by the first Can
+	settings    *SettingsCache
+	background  *sync.WaitGroup
+}
+
+// HandlerFunc is the signature of all handlers served through the Adapter.
+type HandlerFunc func(*Context) error
+
+// Env returns the model environment bound to this request.
+func (c *Context) Env() *models.Env {
+	return &models.Env{DB: c.DB, Ctx: c.Ctx, Logger: c.Logger, LogDBQueries: c.LogDBQueries}
+}
+
+// Go runs f in the background with a copy of the Context that outlives the request,
+// e.g. to send an email without the response waiting for it. The copy has no Request
+// and ResponseWriter, errors of f are logged. Adapter.Wait waits for f to return.
+func (c *Context) Go(f HandlerFunc) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Ctx), backgroundTimeout)
+	background := *c
+	background.Request = nil
+	background.ResponseWriter = nil
+	background.Ctx = ctx
+
+	c.background.Add(1)
+	go func() {
+		defer c.background.Done()
+		defer cancel()
+		err := f(&background)
+		if err != nil {
+			background.Logger.Error("middleware: Go", "error", err)
+		}
+	}()
+}
+
+// StartSession logs the user in
+func (c *Context) StartSession(user users.User) error {
+	return c.sessions.Start(c, user)
+}
+
+// EndSession logs out the current session
+func (c *Context) EndSession() error {
+	return c.sessions.End(c)
+}
+
+// EndAllSessions logs the current user out on all devices
+func (c *Context) EndAllSessions() error {
+	return c.sessions.EndAll(c)
+}
+
+// TemplateFuncs returns the functions available in templates rendered for this request:
+//
+//	{{if can "article.publish"}} ... {{end}}
+//	{{with currentUser}}{{.Username}}{{end}}
+//	<img src="/media/1/photo.jpg" srcset="{{srcset 1}}" sizes="(max-width: 800px) 100vw, 800px">
+//	{{range menu}}<a href="/{{.Slug}}">{{.Title}}</a>{{end}}
+//	<title>{{(settings).SiteTitle}}</title>
+//	{{date .PublishedAt}}, {{datetime .UpdatedAt}}
+func (c *Context) TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"can": func(permission string) bool {
+			return c.Can(roles.Permission(permission))
+		},
+		"currentUser": func() *users.User {
+			return c.User
+		},
+		// srcset lists an uploaded image with its resized versions
+		"srcset": func(id uint64) (string, error) {
+			original, err := media.GetMediaByID(c.Env(), id)
+			if err != nil {
+				return "", err
+			}
+			derivatives, err := media.GetDerivatives(c.Env(), id)
+			if err != nil {
+				return "", err
+			}
+			return media.Srcset(append(derivatives, original)...), nil
+		},
+		// menu returns the published pages of the navigation
+		"menu": func() ([]pages.Page, error) {
+			return pages.GetMenuPages(c.Env())
+		},
+		"settings": func() settings.Settings {
+			return c.Settings()
+		},
+		// date and datetime format a time in the time zone of the site
+		"date": func(t time.Time) string {
+			return t.In(c.Settings().Timezone).Format("2006-01-02")
+		},
+		"datetime": func(t time.Time) string {
+			return t.In(c.Settings().Timezone).Format("2006-01-02 15:04")
+		},
+		// dict builds a map from key value pairs, to pass several values to a nested template
+		"dict": func(pairs ...any) (map[string]any, error) {
+			if len(pairs)%2 != 0 {
+				return nil, errors.New("dict: odd number of arguments")
+			}
+			m := make(map[string]any, len(pairs)/2)
+			for i := 0; i < len(pairs); i += 2 {
+				key, ok := pairs[i].(string)
+				if !ok {
+					return nil, fmt.Errorf("dict: key %v is not a string", pairs[i])
+				}
+				m[key] = pairs[i+1]
+			}
+			return m, nil
+		},
+	}
+}
@@ -0,0 +1,285 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AndreHeber/go-sqlite-blog/models/roles"
+)
+
+// DataFunc is a handler that returns the data of the response instead of writing it.
+// The Adapter serializes the data in a format the client accepts, see HTTPToDataHandler.
+type DataFunc func(*Context) (any, error)
+
+// Response is returned by a DataFunc to answer with another status than 200 OK
+// or with extra headers. A nil Body sends no content.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   any
+}
+
+// List is the envelope of a page of a collection. NextCursor is empty on the last page,
+// otherwise it is passed as ?cursor= to get the next page.
+type List struct {
+	Data       any    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// encoder writes data in a media type
+type encoder struct {
+	mediaType string
+	encode    func(w http.ResponseWriter, v any) error
+}
+
+var encoders = []encoder{
+	{"application/json", func(w http.ResponseWriter, v any) error {
+		return json.NewEncoder(w).Encode(v)
+	}},
+}
+
+// ErrorObject is the body of every error answered by a data route
+type ErrorObject struct {
+	Error struct {
+		Status  int    `json:"status"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// errorCode is the status text in snake case, e.g. not_found
+func errorCode(status int) string {
+	code := strings.ToLower(http.StatusText(status))
+	code = strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(code)
+	if code == "" {
+		return "error"
+	}
+	return code
+}
+
+// writeErrorObject answers with an error object in JSON, whatever the client accepts
+func writeErrorObject(w http.ResponseWriter, status int, message string) {
+	var body ErrorObject
+	body.Error.Status = status
+	body.Error.Code = errorCode(status)
+	body.Error.Message = message
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// negotiate picks the encoder for the Accept header of the request, the one with the
+// highest quality wins. Without an Accept header the first encoder is used.
+func negotiate(r *http.Request) (encoder, error) {
+	values := r.Header.Values("Accept")
+	if len(values) == 0 {
+		return encoders[0], nil
+	}
+
+	type accepted struct {
+		mediaType string
+		quality   float64
+	}
+	var list []accepted
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			quality := 1.0
+			if q, ok := params["q"]; ok {
+				quality, err = strconv.ParseFloat(q, 64)
+				if err != nil {
+					continue
+				}
+			}
+			list = append(list, accepted{mediaType, quality})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].quality > list[j].quality })
+
+	for _, a := range list {
+		if a.quality <= 0 {
+			continue
+		}
+		for _, e := range encoders {
+			major, _, _ := strings.Cut(e.mediaType, "/")
+			if a.mediaType == e.mediaType || a.mediaType == "*/*" || a.mediaType == major+"/*" {
+				return e, nil
+			}
+		}
+	}
+	return encoder{}, fmt.Errorf("negotiate: none of %q is supported", values)
+}
+
+// filterFields keeps only the named fields of an object, or of every object in a List.
+// Unknown fields are ignored.
+func filterFields(v any, fields []string) (any, error) {
+	keep := func(data []byte) (map[string]json.RawMessage, error) {
+		var object map[string]json.RawMessage
+		err := json.Unmarshal(data, &object)
+		if err != nil {
+			return nil, errors.New("filterFields: only objects have fields")
+		}
+		filtered := make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if value, ok := object[field]; ok {
+				filtered[field] = value
+			}
+		}
+		return filtered, nil
+	}
+
+	if list, ok := v.(List); ok {
+		data, err := json.Marshal(list.Data)
+		if err != nil {
+			return nil, fmt.Errorf("filterFields: %w", err)
+		}
+		var items []json.RawMessage
+		err = json.Unmarshal(data, &items)
+		if err != nil {
+			return nil, fmt.Errorf("filterFields: %w", err)
+		}
+		filtered := make([]map[string]json.RawMessage, 0, len(items))
+		for _, item := range items {
+			object, err := keep(item)
+			if err != nil {
+				return nil, err
+			}
+			filtered = append(filtered, object)
+		}
+		list.Data = filtered
+		return list, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("filterFields: %w", err)
+	}
+	return keep(data)
+}
+
+// requestedFields returns the fields of the ?fields=a,b query parameter, nil for all fields
+func requestedFields(r *http.Request) []string {
+	var fields []string
+	for _, field := range strings.Split(r.URL.Query().Get("fields"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// writeData serializes the data returned by a DataFunc
+func (c *Context) writeData(e encoder, data any) error {
+	response, ok := data.(Response)
+	if !ok {
+		response = Response{Body: data}
+	}
+	if response.Status == 0 {
+		response.Status = http.StatusOK
+	}
+	fields := requestedFields(c.Request)
+	if response.Body != nil && fields != nil {
+		var err error
+		response.Body, err = filterFields(response.Body, fields)
+		if err != nil {
+			return Error(http.StatusBadRequest, fmt.Errorf("writeData: %w", err))
+		}
+	}
+
+	for key, values := range response.Header {
+		c.ResponseWriter.Header()[key] = values
+	}
+	if response.Body == nil {
+		c.ResponseWriter.WriteHeader(response.Status)
+		return nil
+	}
+
+	c.ResponseWriter.Header().Set("Content-Type", e.mediaType)
+	c.ResponseWriter.Header().Set("X-Content-Type-Options", "nosniff")
+	c.ResponseWriter.WriteHeader(response.Status)
+	err := e.encode(c.ResponseWriter, response.Body)
+	if err != nil {
+		return fmt.Errorf("writeData: %w", err)
+	}
+	return nil
+}
+
+// HTTPToDataHandler converts a DataFunc into a http.HandlerFunc. The format of the
+// response is negotiated with the Accept header before h runs, unsupported formats
+// get 406 Not Acceptable. ?fields=a,b limits the fields of the returned objects.
+// Errors are answered as error objects:
+//
+//	{"error": {"status": 404, "code": "not_found", "message": "Not Found"}}
+func (a *Adapter) HTTPToDataHandler(h DataFunc, options ...RouteOption) http.HandlerFunc {
+	options = append(options, func(o *routeOptions) { o.data = true })
+	return a.HTTPToContextHandler(func(c *Context) error {
+		e, err := negotiate(c.Request)
+		if err != nil {
+			return Error(http.StatusNotAcceptable, err)
+		}
+		data, err := h(c)
+		if err != nil {
+			return err
+		}
+		return c.writeData(e, data)
+	}, options...)
+}
+
+// RequireData only calls h for requests with a JSON body, other bodies get
+// 415 Unsupported Media Type. Browsers can't send JSON to another site without
+// asking first, which keeps forms of other sites from using the session cookie.
+func RequireData(h DataFunc) DataFunc {
+	return func(c *Context) (any, error) {
+		mediaType, _, _ := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+		if mediaType != "application/json" {
+			return nil, Error(http.StatusUnsupportedMediaType, errors.New("RequireData: the body must be application/json"))
+		}
+		return h(c)
+	}
+}
+
+// DecodeData decodes the JSON body of the request into v, unknown fields are rejected
+func (c *Context) DecodeData(v any) error {
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return fmt.Errorf("DecodeData: %w", err)
+		}
+		return Error(http.StatusBadRequest, fmt.Errorf("DecodeData: %w", err))
+	}
+	return nil
+}
+
+// DataRequireUser is RequireUser for data routes
+func DataRequireUser(h DataFunc) DataFunc {
+	return func(c *Context) (any, error) {
+		if c.User == nil {
+			return nil, Error(http.StatusUnauthorized, errors.New("RequireUser: login required"))
+		}
+		return h(c)
+	}
+}
+
+// DataRequirePermission is RequirePermission for data routes
+func DataRequirePermission(permission roles.Permission, h DataFunc) DataFunc {
+	return DataRequireUser(func(c *Context) (any, error) {
+		if !c.Can(permission) {
+			return nil, Error(http.StatusForbidden, fmt.Errorf("RequirePermission: missing permission %s", permission))
+		}
+		return h(c)
+	})
+}
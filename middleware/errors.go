@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+)
+
+// StatusError is an error that is answered with a specific HTTP status code
+// instead of 500 Internal Server Error.
+type StatusError struct {
+	Status int
+	Err    error
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// Error wraps err so that the Adapter answers with the given status code
+func Error(status int, err error) error {
+	return &StatusError{Status: status, Err: err}
+}
+
+// statusOf returns the HTTP status code for an error returned by a handler
+func statusOf(err error) int {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Status
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+)
+
+// defaultTimeout is the deadline of a request unless the route sets another with WithTimeout
+const defaultTimeout = 10 * time.Second
+
+// backgroundTimeout is the deadline of the work a handler starts with Context.Go
+const backgroundTimeout = time.Minute
+
+// routeOptions change the limits of the server for a single route
+type routeOptions struct {
+	timeout      time.Duration
+	maxBodyBytes int64
+	data         bool // errors are answered as error objects, see HTTPToDataHandler
+}
+
+// RouteOption is passed to HTTPToContextHandler to change the limits of a route
+type RouteOption func(*routeOptions)
+
+// WithTimeout replaces the deadline of the request and the read and write timeouts
+// of the server for the route, for uploads and downloads of large files
+func WithTimeout(timeout time.Duration) RouteOption {
+	return func(o *routeOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithMaxBodyBytes limits the size of the request body, a larger body is answered
+// with 413 Request Entity Too Large
+func WithMaxBodyBytes(n int64) RouteOption {
+	return func(o *routeOptions) {
+		o.maxBodyBytes = n
+	}
+}
+
+// apply sets the read and write deadlines of the connection and limits the body.
+// The deadlines of the server are kept if the route doesn't change the timeout.
+func (o routeOptions) apply(w http.ResponseWriter, r *http.Request) error {
+	if o.timeout != defaultTimeout {
+		controller := http.NewResponseController(w)
+		deadline := time.Now().Add(o.timeout)
+		err := controller.SetReadDeadline(deadline)
+		if err != nil {
+			return err
+		}
+		err = controller.SetWriteDeadline(deadline)
+		if err != nil {
+			return err
+		}
+	}
+	if o.maxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, o.maxBodyBytes)
+	}
+	return nil
+}
+
+// writeError answers with the message as plain text, or as an error object on data routes
+func (o routeOptions) writeError(w http.ResponseWriter, status int, message string) {
+	if o.data {
+		writeErrorObject(w, status, message)
+		return
+	}
+	http.Error(w, message, status)
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/AndreHeber/go-sqlite-blog/models/roles"
+)
+
+// Can reports whether the current user has the permission.
+// Anonymous users have no permissions, API tokens only those they were granted.
+func (c *Context) Can(permission roles.Permission) bool {
+	if c.User == nil {
+		return false
+	}
+	if c.Token != nil && !c.Token.Allows(permission) {
+		return false
+	}
+
+	// loaded once per request, so a change of the permissions shows up with the next one
+	if c.permissions == nil {
+		list, err := roles.GetRolePermissions(c.Env(), c.User.RoleID)
+		if err != nil {
+			c.Logger.Error("middleware: Can", "error", err, "permission", permission)
+			return false
+		}
+		c.permissions = make(map[roles.Permission]bool, len(list))
+		for _, p := range list {
+			c.permissions[p] = true
+		}
+	}
+	return c.permissions[permission]
+}
+
+// RequirePermission only calls h if the current user has the permission.
+// Anonymous users are handled like in RequireUser, others get 403.
+func RequirePermission(permission roles.Permission, h HandlerFunc) HandlerFunc {
+	return RequireUser(func(c *Context) error {
+		if !c.Can(permission) {
+			return Error(http.StatusForbidden, fmt.Errorf("RequirePermission: missing permission %s", permission))
+		}
+		return h(c)
+	})
+}
@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/config"
+	"github.com/AndreHeber/go-sqlite-blog/models/sessions"
+	"github.com/AndreHeber/go-sqlite-blog/models/users"
+	"github.com/AndreHeber/go-sqlite-blog/signing"
+)
+
+// touchInterval limits how often the last seen time of a session is written
+const touchInterval = time.Minute
+
+// SessionManager creates and resolves the signed session cookies.
+// The cookie holds a random token, the database only the hash of it.
+type SessionManager struct {
+	signer          *signing.Signer
+	cookieName      string
+	secureCookie    bool
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
+}
+
+func NewSessionManager(cfg config.SessionConfig, signer *signing.Signer) *SessionManager {
+	return &SessionManager{
+		signer:          signer,
+		cookieName:      cfg.CookieName,
+		secureCookie:    cfg.SecureCookie,
+		idleTimeout:     cfg.IdleTimeout,
+		absoluteTimeout: cfg.AbsoluteTimeout,
+	}
+}
+
+// Start creates a new session for the user and sets the session cookie
+func (m *SessionManager) Start(c *Context, user users.User) error {
+	env := c.Env()
+	now := time.Now().UTC()
+
+	// opportunistic cleanup, so the table doesn't grow forever
+	err := sessions.DeleteExpiredSessions(env, now, now.Add(-m.idleTimeout))
+	if err != nil {
+		return fmt.Errorf("Start: %w", err)
+	}
+
+	token := signing.RandomToken(32)
+	session := sessions.Session{
+		ID:         signing.HashToken(token),
+		UserID:     user.ID,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(m.absoluteTimeout),
+	}
+	err = sessions.CreateSession(env, session)
+	if err != nil {
+		return fmt.Errorf("Start: %w", err)
+	}
+
+	http.SetCookie(c.ResponseWriter, &http.Cookie{
+		Name:     m.cookieName,
+		Value:    m.signer.Sign(token),
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   m.secureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	c.User = &user
+	c.Session = &session
+	return nil
+}
+
+// End deletes the current session and clears the session cookie
+func (m *SessionManager) End(c *Context) error {
+	if c.Session != nil {
+		err := sessions.DeleteSession(c.Env(), c.Session.ID)
+		if err != nil {
+			return fmt.Errorf("End: %w", err)
+		}
+	}
+
+	m.clearCookie(c.ResponseWriter)
+	c.User = nil
+	c.Session = nil
+	return nil
+}
+
+// EndAll deletes all sessions of the current user, logging them out everywhere
+func (m *SessionManager) EndAll(c *Context) error {
+	if c.User != nil {
+		err := sessions.DeleteUserSessions(c.Env(), c.User.ID)
+		if err != nil {
+			return fmt.Errorf("EndAll: %w", err)
+		}
+	}
+
+	m.clearCookie(c.ResponseWriter)
+	c.User = nil
+	c.Session = nil
+	return nil
+}
+
+// load resolves the session cookie and puts the session and its user on the context.
+// Missing, invalid and expired sessions leave the request anonymous.
+// Requests with an Authorization header are authenticated by their API token instead.
+func (m *SessionManager) load(c *Context) error {
+	if authorization := c.Request.Header.Get("Authorization"); authorization != "" {
+		return m.loadToken(c, authorization)
+	}
+
+	cookie, err := c.Request.Cookie(m.cookieName)
+	if errors.Is(err, http.ErrNoCookie) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("load: %w", err)
+	}
+
+	token, err := m.signer.Verify(cookie.Value)
+	if err != nil {
+		m.clearCookie(c.ResponseWriter)
+		return nil
+	}
+
+	env := c.Env()
+	session, err := sessions.GetSessionByID(env, signing.HashToken(token))
+	if err != nil {
+		m.clearCookie(c.ResponseWriter)
+		return nil
+	}
+
+	now := time.Now().UTC()
+	if now.After(session.ExpiresAt) || now.After(session.LastSeenAt.Add(m.idleTimeout)) {
+		m.clearCookie(c.ResponseWriter)
+		return sessions.DeleteSession(env, session.ID)
+	}
+
+	user, err := users.GetUserByID(env, session.UserID)
+	if err != nil {
+		return fmt.Errorf("load: %w", err)
+	}
+
+	if now.Sub(session.LastSeenAt) > touchInterval {
+		session.LastSeenAt = now
+		err = sessions.TouchSession(env, session.ID, now)
+		if err != nil {
+			return fmt.Errorf("load: %w", err)
+		}
+	}
+
+	c.User = &user
+	c.Session = &session
+	return nil
+}
+
+func (m *SessionManager) clearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.cookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   m.secureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// RequireUser only calls h if the request belongs to a logged in user.
+// Anonymous page views are redirected to the login page, other requests get 401.
+func RequireUser(h HandlerFunc) HandlerFunc {
+	return func(c *Context) error {
+		if c.User != nil {
+			return h(c)
+		}
+
+		if c.Request.Method == http.MethodGet {
+			http.Redirect(c.ResponseWriter, c.Request, "/login?next="+url.QueryEscape(c.Request.URL.RequestURI()), http.StatusSeeOther)
+			return nil
+		}
+
+		return Error(http.StatusUnauthorized, errors.New("RequireUser: login required"))
+	}
+}
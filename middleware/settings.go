@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/AndreHeber/go-sqlite-blog/cache"
+	"github.com/AndreHeber/go-sqlite-blog/models"
+	"github.com/AndreHeber/go-sqlite-blog/models/settings"
+)
+
+// SettingsCache keeps the site settings in memory, they are loaded
+// again after the admin page saved them.
+type SettingsCache struct {
+	settings cache.Map[struct{}, settings.Settings]
+}
+
+func NewSettingsCache() *SettingsCache {
+	return &SettingsCache{}
+}
+
+// Get returns the settings, they are loaded on the first call after an Invalidate
+func (s *SettingsCache) Get(env *models.Env) (settings.Settings, error) {
+	loaded, err := s.settings.Get(struct{}{}, func() (settings.Settings, error) {
+		return settings.Load(env)
+	})
+	if err != nil {
+		return settings.Settings{}, fmt.Errorf("Get: %w", err)
+	}
+	return loaded, nil
+}
+
+// Invalidate drops the cached settings
+func (s *SettingsCache) Invalidate() {
+	s.settings.Invalidate()
+}
+
+// Settings returns the site settings. If they can't be loaded,
+// the error is logged and the defaults are used.
+func (c *Context) Settings() settings.Settings {
+	s, err := c.settings.Get(c.Env())
+	if err != nil {
+		c.Logger.Error("middleware: Settings", "error", err)
+		return settings.Defaults()
+	}
+	return s
+}
+
+// InvalidateSettings makes the next request load the settings again, after they were saved
+func (c *Context) InvalidateSettings() {
+	c.settings.Invalidate()
+}
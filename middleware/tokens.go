@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/models/apitokens"
+	"github.com/AndreHeber/go-sqlite-blog/models/users"
+	"github.com/AndreHeber/go-sqlite-blog/signing"
+)
+
+// errInvalidToken answers requests with a missing, unknown or expired bearer token
+var errInvalidToken = errors.New("invalid or expired API token")
+
+// loadToken resolves the bearer token of the Authorization header and puts the token and
+// its user on the context. Unlike a bad session cookie, a bad token is answered with 401,
+// the client asked to be authenticated.
+func (m *SessionManager) loadToken(c *Context, authorization string) error {
+	scheme, value, _ := strings.Cut(authorization, " ")
+	value = strings.TrimSpace(value)
+	if !strings.EqualFold(scheme, "Bearer") || value == "" {
+		return m.rejectToken(c, errInvalidToken)
+	}
+
+	env := c.Env()
+	token, err := apitokens.GetTokenByHash(env, signing.HashToken(value))
+	if errors.Is(err, apitokens.ErrNotFound) {
+		return m.rejectToken(c, errInvalidToken)
+	}
+	if err != nil {
+		return fmt.Errorf("loadToken: %w", err)
+	}
+	now := time.Now().UTC()
+	if token.Expired(now) {
+		return m.rejectToken(c, errInvalidToken)
+	}
+
+	user, err := users.GetUserByID(env, token.UserID)
+	if err != nil {
+		return fmt.Errorf("loadToken: %w", err)
+	}
+
+	if now.Sub(token.LastUsedAt) > touchInterval {
+		token.LastUsedAt = now
+		err = apitokens.TouchToken(env, token.ID, now)
+		if err != nil {
+			return fmt.Errorf("loadToken: %w", err)
+		}
+	}
+
+	c.User = &user
+	c.Token = &token
+	return nil
+}
+
+func (m *SessionManager) rejectToken(c *Context, err error) error {
+	c.ResponseWriter.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	return Error(http.StatusUnauthorized, fmt.Errorf("loadToken: %w", err))
+}
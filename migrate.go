@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/config"
+	dbService "github.com/AndreHeber/go-sqlite-blog/db"
+)
+
+const migrateUsage = "usage: go-sqlite-blog [flags] migrate status|up|down"
+
+// runMigrate implements the migrate command:
+//
+//	migrate status  lists all migrations and whether they are applied
+//	migrate up      applies all pending migrations
+//	migrate down    reverts the most recently applied migration
+func runMigrate(logger *slog.Logger, cfg *config.Config, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+
+	db, err := dbService.ConnectDB(cfg.Database.Driver, cfg.Database.Source)
+	if err != nil {
+		return fmt.Errorf("runMigrate: %w", err)
+	}
+	defer func() { _ = dbService.CloseDB(db) }()
+
+	migrator, err := dbService.NewMigrator(logger, db, dbService.Migrations)
+	if err != nil {
+		return fmt.Errorf("runMigrate: %w", err)
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return fmt.Errorf("runMigrate: %w", err)
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+		for _, s := range status {
+			appliedAt := ""
+			if !s.AppliedAt.IsZero() {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, s.State, appliedAt)
+		}
+		return w.Flush()
+	case "up":
+		count, err := migrator.Up(ctx)
+		if err != nil {
+			return fmt.Errorf("runMigrate: %w", err)
+		}
+		fmt.Fprintf(out, "applied %d migrations\n", count)
+	case "down":
+		migration, err := migrator.Down(ctx)
+		if err != nil {
+			return fmt.Errorf("runMigrate: %w", err)
+		}
+		fmt.Fprintf(out, "reverted %04d_%s\n", migration.Version, migration.Name)
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+// Package apitokens stores the personal access tokens users create for scripts.
+// Only the hash of a token is stored, the token itself is shown once when it is created.
+package apitokens
+
+import (
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/models"
+	"github.com/AndreHeber/go-sqlite-blog/models/roles"
+)
+
+var ErrNotFound = errors.New("api token not found")
+
+// Token is a personal access token. It grants the permissions listed in it,
+// as far as the role of its user has them.
+type Token struct {
+	ID          uint64
+	UserID      uint64
+	Name        string
+	Hash        string // sha256 of the token
+	Permissions []roles.Permission
+	CreatedAt   time.Time
+	ExpiresAt   time.Time // zero if the token doesn't expire
+	LastUsedAt  time.Time // zero if the token was never used
+}
+
+// Expired reports whether the token has expired at now
+func (t Token) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+// Allows reports whether the token was granted the permission
+func (t Token) Allows(permission roles.Permission) bool {
+	for _, p := range t.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanToken(row scanner) (Token, error) {
+	var token Token
+	var permissions string
+	var expiresAt, lastUsedAt sql.NullTime
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.Hash, &permissions, &token.CreatedAt, &expiresAt, &lastUsedAt)
+	for _, p := range strings.Fields(permissions) {
+		token.Permissions = append(token.Permissions, roles.Permission(p))
+	}
+	token.ExpiresAt = expiresAt.Time
+	token.LastUsedAt = lastUsedAt.Time
+	return token, err
+}
+
+// joinPermissions stores the permissions space separated
+func joinPermissions(permissions []roles.Permission) string {
+	list := make([]string, len(permissions))
+	for i, p := range permissions {
+		list[i] = string(p)
+	}
+	return strings.Join(list, " ")
+}
+
+//go:embed insert.sql
+var insert string
+
+// CreateToken saves a new token and returns its id
+func CreateToken(env *models.Env, token Token) (uint64, error) {
+	result, err := env.DB.ExecContext(env.Ctx, insert, token.UserID, token.Name, token.Hash, joinPermissions(token.Permissions), token.CreatedAt, nullTime(token.ExpiresAt))
+	if err != nil {
+		env.Logger.Error("models: CreateToken", "error", err, "sql", insert, "user_id", token.UserID)
+		return 0, fmt.Errorf("CreateToken: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("CreateToken: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: CreateToken", "sql", insert, "user_id", token.UserID)
+	}
+
+	return uint64(id), nil
+}
+
+//go:embed select_where_hash.sql
+var selectWhereHash string
+
+// GetTokenByHash returns the token with the hash, expired tokens included
+func GetTokenByHash(env *models.Env, hash string) (Token, error) {
+	token, err := scanToken(env.DB.QueryRowContext(env.Ctx, selectWhereHash, hash))
+	if err == sql.ErrNoRows {
+		return Token{}, fmt.Errorf("GetTokenByHash: %w", ErrNotFound)
+	}
+	if err != nil {
+		env.Logger.Error("models: GetTokenByHash", "error", err, "sql", selectWhereHash)
+		return Token{}, fmt.Errorf("GetTokenByHash: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetTokenByHash", "sql", selectWhereHash)
+	}
+
+	return token, nil
+}
+
+//go:embed select_where_user.sql
+var selectWhereUser string
+
+// GetUserTokens returns the tokens of the user, newest first
+func GetUserTokens(env *models.Env, userID uint64) ([]Token, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectWhereUser, userID)
+	if err != nil {
+		env.Logger.Error("models: GetUserTokens", "error", err, "sql", selectWhereUser, "user_id", userID)
+		return nil, fmt.Errorf("GetUserTokens: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Token
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("GetUserTokens: %w", err)
+		}
+		list = append(list, token)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetUserTokens: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetUserTokens", "sql", selectWhereUser, "user_id", userID)
+	}
+
+	return list, nil
+}
+
+//go:embed update_last_used.sql
+var updateLastUsed string
+
+// TouchToken records when the token was last used
+func TouchToken(env *models.Env, id uint64, lastUsedAt time.Time) error {
+	_, err := env.DB.ExecContext(env.Ctx, updateLastUsed, lastUsedAt.UTC(), id)
+	if err != nil {
+		env.Logger.Error("models: TouchToken", "error", err, "sql", updateLastUsed, "id", id)
+		return fmt.Errorf("TouchToken: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: TouchToken", "sql", updateLastUsed, "id", id)
+	}
+
+	return nil
+}
+
+//go:embed delete.sql
+var deleteToken string
+
+// DeleteToken revokes a token of the user, tokens of other users are not found
+func DeleteToken(env *models.Env, id, userID uint64) error {
+	result, err := env.DB.ExecContext(env.Ctx, deleteToken, id, userID)
+	if err != nil {
+		env.Logger.Error("models: DeleteToken", "error", err, "sql", deleteToken, "id", id)
+		return fmt.Errorf("DeleteToken: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("DeleteToken: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("DeleteToken: %w", ErrNotFound)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: DeleteToken", "sql", deleteToken, "id", id)
+	}
+
+	return nil
+}
@@ -0,0 +1 @@
+DELETE FROM api_tokens WHERE id = ? AND user_id = ?
\ No newline at end of file
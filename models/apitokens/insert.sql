@@ -0,0 +1 @@
+INSERT INTO api_tokens (user_id, name, hash, permissions, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT id, user_id, name, hash, permissions, created_at, expires_at, last_used_at FROM api_tokens WHERE hash = ? LIMIT 1
\ No newline at end of file
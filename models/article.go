@@ -1,11 +0,0 @@
-package models
-
-import "time"
-
-type Article struct {
-	ID        int
-	Title     string
-	Content   string
-	CreatedAt time.Time
-	UpdatedAt time.Time
-}
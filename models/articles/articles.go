@@ -0,0 +1,427 @@
+package articles
+
+import (
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/models"
+)
+
+var (
+	ErrNotFound = errors.New("article not found")
+	ErrConflict = errors.New("article was changed in the meantime")
+)
+
+type Article struct {
+	ID             uint64
+	Title          string
+	Slug           string
+	Summary        string
+	Content        string
+	AuthorID       uint64
+	Published      bool
+	PublishedAt    time.Time // zero if the article was never published
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	CommentsClosed bool   // no new comments, the existing ones are still shown
+	UpdatedBy      uint64 // the user who saved this version
+	ContentHTML    string // rendered from the Markdown of Content
+	TOCHTML        string // the table of contents of ContentHTML
+	HTMLVersion    int    // the version of the renderer of ContentHTML, 0 if it was never rendered
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanArticle(row scanner) (Article, error) {
+	var article Article
+	var publishedAt sql.NullTime
+	err := row.Scan(&article.ID, &article.Title, &article.Slug, &article.Summary, &article.Content, &article.AuthorID, &article.Published, &publishedAt, &article.CreatedAt, &article.UpdatedAt, &article.CommentsClosed, &article.UpdatedBy, &article.ContentHTML, &article.TOCHTML, &article.HTMLVersion)
+	article.PublishedAt = publishedAt.Time
+	return article, err
+}
+
+func scanArticles(rows *sql.Rows) ([]Article, error) {
+	defer rows.Close()
+
+	var articles []Article
+	for rows.Next() {
+		article, err := scanArticle(rows)
+		if err != nil {
+			return nil, err
+		}
+		articles = append(articles, article)
+	}
+	return articles, rows.Err()
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+//go:embed insert.sql
+var insert string
+
+//go:embed delete_categories.sql
+var deleteCategories string
+
+//go:embed insert_category.sql
+var insertCategory string
+
+//go:embed delete_tags.sql
+var deleteTags string
+
+//go:embed insert_tag.sql
+var insertTag string
+
+// Taxonomy holds the categories and tags of an article, the tags must exist
+type Taxonomy struct {
+	CategoryIDs []uint64
+	TagIDs      []uint64
+}
+
+// setTaxonomy replaces the categories and tags of an article in tx
+func setTaxonomy(env *models.Env, tx *sql.Tx, articleID uint64, taxonomy Taxonomy) error {
+	_, err := tx.ExecContext(env.Ctx, deleteCategories, articleID)
+	if err != nil {
+		env.Logger.Error("models: setTaxonomy", "error", err, "sql", deleteCategories, "article_id", articleID)
+		return fmt.Errorf("setTaxonomy: %w", err)
+	}
+	for _, categoryID := range taxonomy.CategoryIDs {
+		_, err = tx.ExecContext(env.Ctx, insertCategory, articleID, categoryID)
+		if err != nil {
+			env.Logger.Error("models: setTaxonomy", "error", err, "sql", insertCategory, "article_id", articleID, "category_id", categoryID)
+			return fmt.Errorf("setTaxonomy: %w", err)
+		}
+	}
+
+	_, err = tx.ExecContext(env.Ctx, deleteTags, articleID)
+	if err != nil {
+		env.Logger.Error("models: setTaxonomy", "error", err, "sql", deleteTags, "article_id", articleID)
+		return fmt.Errorf("setTaxonomy: %w", err)
+	}
+	for _, tagID := range taxonomy.TagIDs {
+		_, err = tx.ExecContext(env.Ctx, insertTag, articleID, tagID)
+		if err != nil {
+			env.Logger.Error("models: setTaxonomy", "error", err, "sql", insertTag, "article_id", articleID, "tag_id", tagID)
+			return fmt.Errorf("setTaxonomy: %w", err)
+		}
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: setTaxonomy", "sql", deleteCategories+";\n"+insertCategory+";\n"+deleteTags+";\n"+insertTag, "article_id", articleID)
+	}
+
+	return nil
+}
+
+// CreateArticle saves a new article with its categories and tags in one transaction and returns its id
+func CreateArticle(env *models.Env, article Article, taxonomy Taxonomy) (uint64, error) {
+	tx, err := env.DB.BeginTx(env.Ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("CreateArticle: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(env.Ctx, insert, article.Title, article.Slug, article.Summary, article.Content, article.AuthorID, article.Published, nullTime(article.PublishedAt), article.CreatedAt, article.UpdatedAt, article.CommentsClosed, article.UpdatedBy, article.ContentHTML, article.TOCHTML, article.HTMLVersion)
+	if err != nil {
+		env.Logger.Error("models: CreateArticle", "error", err, "sql", insert, "slug", article.Slug)
+		return 0, fmt.Errorf("CreateArticle: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("CreateArticle: %w", err)
+	}
+	err = setTaxonomy(env, tx, uint64(id), taxonomy)
+	if err != nil {
+		return 0, fmt.Errorf("CreateArticle: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("CreateArticle: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: CreateArticle", "sql", insert, "slug", article.Slug)
+	}
+
+	return uint64(id), nil
+}
+
+//go:embed select_where_slug.sql
+var selectWhereSlug string
+
+func GetArticleBySlug(env *models.Env, slug string) (Article, error) {
+	article, err := scanArticle(env.DB.QueryRowContext(env.Ctx, selectWhereSlug, slug))
+	if err == sql.ErrNoRows {
+		return Article{}, fmt.Errorf("GetArticleBySlug: %w", ErrNotFound)
+	}
+	if err != nil {
+		env.Logger.Error("models: GetArticleBySlug", "error", err, "sql", selectWhereSlug, "slug", slug)
+		return Article{}, fmt.Errorf("GetArticleBySlug: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetArticleBySlug", "sql", selectWhereSlug, "slug", slug)
+	}
+
+	return article, nil
+}
+
+//go:embed select_where_id.sql
+var selectWhereID string
+
+func GetArticleByID(env *models.Env, id uint64) (Article, error) {
+	article, err := scanArticle(env.DB.QueryRowContext(env.Ctx, selectWhereID, id))
+	if err == sql.ErrNoRows {
+		return Article{}, fmt.Errorf("GetArticleByID: %w", ErrNotFound)
+	}
+	if err != nil {
+		env.Logger.Error("models: GetArticleByID", "error", err, "sql", selectWhereID, "id", id)
+		return Article{}, fmt.Errorf("GetArticleByID: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetArticleByID", "sql", selectWhereID, "id", id)
+	}
+
+	return article, nil
+}
+
+//go:embed select_published.sql
+var selectPublished string
+
+// GetPublishedArticles returns published articles, newest first
+func GetPublishedArticles(env *models.Env, limit, offset int) ([]Article, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectPublished, limit, offset)
+	if err != nil {
+		env.Logger.Error("models: GetPublishedArticles", "error", err, "sql", selectPublished)
+		return nil, fmt.Errorf("GetPublishedArticles: %w", err)
+	}
+	articles, err := scanArticles(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetPublishedArticles: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetPublishedArticles", "sql", selectPublished, "limit", limit, "offset", offset)
+	}
+
+	return articles, nil
+}
+
+//go:embed select_published_where_category.sql
+var selectPublishedWhereCategory string
+
+// GetPublishedArticlesByCategory returns the published articles of the category, newest first
+func GetPublishedArticlesByCategory(env *models.Env, categoryID uint64, limit, offset int) ([]Article, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectPublishedWhereCategory, categoryID, limit, offset)
+	if err != nil {
+		env.Logger.Error("models: GetPublishedArticlesByCategory", "error", err, "sql", selectPublishedWhereCategory, "category_id", categoryID)
+		return nil, fmt.Errorf("GetPublishedArticlesByCategory: %w", err)
+	}
+	articles, err := scanArticles(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetPublishedArticlesByCategory: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetPublishedArticlesByCategory", "sql", selectPublishedWhereCategory, "category_id", categoryID, "limit", limit, "offset", offset)
+	}
+
+	return articles, nil
+}
+
+//go:embed select_published_where_tag.sql
+var selectPublishedWhereTag string
+
+// GetPublishedArticlesByTag returns the published articles of the tag, newest first
+func GetPublishedArticlesByTag(env *models.Env, tagID uint64, limit, offset int) ([]Article, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectPublishedWhereTag, tagID, limit, offset)
+	if err != nil {
+		env.Logger.Error("models: GetPublishedArticlesByTag", "error", err, "sql", selectPublishedWhereTag, "tag_id", tagID)
+		return nil, fmt.Errorf("GetPublishedArticlesByTag: %w", err)
+	}
+	articles, err := scanArticles(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetPublishedArticlesByTag: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetPublishedArticlesByTag", "sql", selectPublishedWhereTag, "tag_id", tagID, "limit", limit, "offset", offset)
+	}
+
+	return articles, nil
+}
+
+//go:embed select_visible_to_author.sql
+var selectVisibleToAuthor string
+
+// GetArticlesVisibleToAuthor returns published articles and the drafts of the author
+func GetArticlesVisibleToAuthor(env *models.Env, authorID uint64, limit, offset int) ([]Article, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectVisibleToAuthor, authorID, limit, offset)
+	if err != nil {
+		env.Logger.Error("models: GetArticlesVisibleToAuthor", "error", err, "sql", selectVisibleToAuthor)
+		return nil, fmt.Errorf("GetArticlesVisibleToAuthor: %w", err)
+	}
+	articles, err := scanArticles(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetArticlesVisibleToAuthor: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetArticlesVisibleToAuthor", "sql", selectVisibleToAuthor, "author_id", authorID, "limit", limit, "offset", offset)
+	}
+
+	return articles, nil
+}
+
+//go:embed select.sql
+var selectArticles string
+
+// GetArticles returns all articles including drafts
+func GetArticles(env *models.Env, limit, offset int) ([]Article, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectArticles, limit, offset)
+	if err != nil {
+		env.Logger.Error("models: GetArticles", "error", err, "sql", selectArticles)
+		return nil, fmt.Errorf("GetArticles: %w", err)
+	}
+	articles, err := scanArticles(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetArticles: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetArticles", "sql", selectArticles, "limit", limit, "offset", offset)
+	}
+
+	return articles, nil
+}
+
+//go:embed select_before_id.sql
+var selectBeforeID string
+
+// GetArticlesBefore returns the articles with an id below beforeID, or the newest if it is 0,
+// in descending order of their ids. Drafts are included if drafts is set, otherwise only those
+// of authorID.
+func GetArticlesBefore(env *models.Env, beforeID uint64, limit int, drafts bool, authorID uint64) ([]Article, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectBeforeID, drafts, authorID, beforeID, beforeID, limit)
+	if err != nil {
+		env.Logger.Error("models: GetArticlesBefore", "error", err, "sql", selectBeforeID, "before_id", beforeID)
+		return nil, fmt.Errorf("GetArticlesBefore: %w", err)
+	}
+	articles, err := scanArticles(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetArticlesBefore: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetArticlesBefore", "sql", selectBeforeID, "before_id", beforeID, "limit", limit, "drafts", drafts, "author_id", authorID)
+	}
+
+	return articles, nil
+}
+
+//go:embed exists_slug.sql
+var existsSlug string
+
+// SlugExists reports whether an article other than excludeID uses the slug
+func SlugExists(env *models.Env, slug string, excludeID uint64) (bool, error) {
+	var exists bool
+	err := env.DB.QueryRowContext(env.Ctx, existsSlug, slug, excludeID).Scan(&exists)
+	if err != nil {
+		env.Logger.Error("models: SlugExists", "error", err, "sql", existsSlug, "slug", slug)
+		return false, fmt.Errorf("SlugExists: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: SlugExists", "sql", existsSlug, "slug", slug)
+	}
+
+	return exists, nil
+}
+
+//go:embed update.sql
+var update string
+
+//go:embed insert_revision.sql
+var insertRevision string
+
+// UpdateArticle saves the article. If the title or content changes, the version
+// before the update is kept in the revisions, in the same transaction.
+// lastUpdatedAt is the time of the update the changes are based on, if the
+// article was saved since then ErrConflict is returned and nothing is saved.
+// The categories and tags are replaced by taxonomy, unless it is nil.
+func UpdateArticle(env *models.Env, article Article, lastUpdatedAt time.Time, taxonomy *Taxonomy) error {
+	tx, err := env.DB.BeginTx(env.Ctx, nil)
+	if err != nil {
+		return fmt.Errorf("UpdateArticle: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(env.Ctx, insertRevision, article.ID, article.Title, article.Content)
+	if err != nil {
+		env.Logger.Error("models: UpdateArticle", "error", err, "sql", insertRevision, "id", article.ID)
+		return fmt.Errorf("UpdateArticle: %w", err)
+	}
+	result, err := tx.ExecContext(env.Ctx, update, article.Title, article.Slug, article.Summary, article.Content, article.Published, nullTime(article.PublishedAt), article.UpdatedAt, article.CommentsClosed, article.UpdatedBy, article.ContentHTML, article.TOCHTML, article.HTMLVersion, article.ID, lastUpdatedAt)
+	if err != nil {
+		env.Logger.Error("models: UpdateArticle", "error", err, "sql", update, "id", article.ID)
+		return fmt.Errorf("UpdateArticle: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("UpdateArticle: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("UpdateArticle: %w", ErrConflict)
+	}
+	if taxonomy != nil {
+		err = setTaxonomy(env, tx, article.ID, *taxonomy)
+		if err != nil {
+			return fmt.Errorf("UpdateArticle: %w", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("UpdateArticle: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: UpdateArticle", "sql", insertRevision+";\n"+update, "id", article.ID)
+	}
+
+	return nil
+}
+
+//go:embed update_html.sql
+var updateHTML string
+
+// UpdateArticleHTML stores the rendered HTML of the article. The article isn't
+// changed by that, so neither the time of the update nor the revisions are.
+func UpdateArticleHTML(env *models.Env, article Article) error {
+	_, err := env.DB.ExecContext(env.Ctx, updateHTML, article.ContentHTML, article.TOCHTML, article.HTMLVersion, article.ID)
+	if err != nil {
+		env.Logger.Error("models: UpdateArticleHTML", "error", err, "sql", updateHTML, "id", article.ID)
+		return fmt.Errorf("UpdateArticleHTML: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: UpdateArticleHTML", "sql", updateHTML, "id", article.ID)
+	}
+
+	return nil
+}
+
+//go:embed delete.sql
+var deleteArticle string
+
+// DeleteArticle deletes the article, comments, revisions and likes are removed by the foreign keys
+func DeleteArticle(env *models.Env, id uint64) error {
+	_, err := env.DB.ExecContext(env.Ctx, deleteArticle, id)
+	if err != nil {
+		env.Logger.Error("models: DeleteArticle", "error", err, "sql", deleteArticle, "id", id)
+		return fmt.Errorf("DeleteArticle: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: DeleteArticle", "sql", deleteArticle, "id", id)
+	}
+
+	return nil
+}
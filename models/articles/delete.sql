@@ -0,0 +1 @@
+DELETE FROM articles WHERE id = ?
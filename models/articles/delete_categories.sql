@@ -0,0 +1 @@
+DELETE FROM article_categories WHERE article_id = ?
\ No newline at end of file
@@ -0,0 +1 @@
+DELETE FROM article_tags WHERE article_id = ?
\ No newline at end of file
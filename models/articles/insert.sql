@@ -0,0 +1 @@
+INSERT INTO articles (title, slug, summary, content, author_id, published, published_at, created_at, updated_at, comments_closed, updated_by, content_html, toc_html, html_version) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
\ No newline at end of file
@@ -0,0 +1 @@
+INSERT INTO article_categories (article_id, category_id) VALUES (?, ?)
\ No newline at end of file
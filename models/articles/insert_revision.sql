@@ -0,0 +1,2 @@
+INSERT INTO article_revisions (article_id, title, content, edited_at, edited_by)
+SELECT id, title, content, updated_at, updated_by FROM articles WHERE id = ? AND (title != ? OR content != ?)
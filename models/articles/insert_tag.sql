@@ -0,0 +1 @@
+INSERT INTO article_tags (article_id, tag_id) VALUES (?, ?)
\ No newline at end of file
@@ -0,0 +1,80 @@
+package articles
+
+import (
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/models"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Revision is an earlier version of an article, saved by UpdateArticle
+type Revision struct {
+	ID         uint64
+	ArticleID  uint64
+	Title      string
+	Content    string
+	EditedAt   time.Time
+	EditedBy   uint64
+	EditorName string
+}
+
+func scanRevision(row scanner) (Revision, error) {
+	var revision Revision
+	err := row.Scan(&revision.ID, &revision.ArticleID, &revision.Title, &revision.Content, &revision.EditedAt, &revision.EditedBy, &revision.EditorName)
+	return revision, err
+}
+
+//go:embed select_revisions_where_article.sql
+var selectRevisionsWhereArticle string
+
+// GetRevisions returns the earlier versions of an article, newest first
+func GetRevisions(env *models.Env, articleID uint64) ([]Revision, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectRevisionsWhereArticle, articleID)
+	if err != nil {
+		env.Logger.Error("models: GetRevisions", "error", err, "sql", selectRevisionsWhereArticle, "article_id", articleID)
+		return nil, fmt.Errorf("GetRevisions: %w", err)
+	}
+	defer rows.Close()
+
+	var revisions []Revision
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, fmt.Errorf("GetRevisions: %w", err)
+		}
+		revisions = append(revisions, revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetRevisions: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetRevisions", "sql", selectRevisionsWhereArticle, "article_id", articleID)
+	}
+
+	return revisions, nil
+}
+
+//go:embed select_revision_where_id.sql
+var selectRevisionWhereID string
+
+// GetRevision returns a revision of the article
+func GetRevision(env *models.Env, articleID uint64, id uint64) (Revision, error) {
+	revision, err := scanRevision(env.DB.QueryRowContext(env.Ctx, selectRevisionWhereID, id, articleID))
+	if err == sql.ErrNoRows {
+		return Revision{}, fmt.Errorf("GetRevision: %w", ErrRevisionNotFound)
+	}
+	if err != nil {
+		env.Logger.Error("models: GetRevision", "error", err, "sql", selectRevisionWhereID, "id", id)
+		return Revision{}, fmt.Errorf("GetRevision: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetRevision", "sql", selectRevisionWhereID, "id", id)
+	}
+
+	return revision, nil
+}
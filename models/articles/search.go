@@ -0,0 +1,114 @@
+package articles
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/AndreHeber/go-sqlite-blog/models"
+)
+
+// MatchStart and MatchEnd surround the matched terms in the title and snippet of a SearchResult.
+// They are private use characters, so they can't be confused with article text
+// and the text can be escaped before the markers are replaced.
+const (
+	MatchStart = "\uE000"
+	MatchEnd   = "\uE001"
+)
+
+// SearchResult is a published article matching a search
+type SearchResult struct {
+	ID          uint64
+	Title       string // with the matched terms marked
+	Slug        string
+	Summary     string
+	Snippet     string // excerpt of the content with the matched terms marked
+	PublishedAt time.Time
+}
+
+// MatchQuery turns user input into an FTS5 query. Words are matched as terms,
+// "quoted words" as a phrase and a trailing * matches a prefix. All terms have to match.
+// Everything is quoted, so the input can't use FTS5 operators or cause syntax errors.
+func MatchQuery(input string) string {
+	var terms []string
+	addTerm := func(term string, prefix bool) {
+		term = strings.TrimSpace(term)
+		if strings.IndexFunc(term, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) }) < 0 {
+			return
+		}
+		term = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+
+	rest := input
+	for {
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+		if rest == "" {
+			break
+		}
+
+		if rest[0] == '"' {
+			phrase, after, _ := strings.Cut(rest[1:], `"`)
+			prefix := strings.HasPrefix(after, "*")
+			addTerm(phrase, prefix)
+			rest = strings.TrimLeft(after, "*")
+			continue
+		}
+
+		end := strings.IndexFunc(rest, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+		if end < 0 {
+			end = len(rest)
+		}
+		word := rest[:end]
+		rest = rest[end:]
+		addTerm(strings.TrimRight(word, "*"), strings.HasSuffix(word, "*"))
+	}
+
+	return strings.Join(terms, " ")
+}
+
+//go:embed search.sql
+var search string
+
+// SearchArticles returns the published articles matching the user input, best matches first.
+// The input is converted with MatchQuery, input without any terms matches nothing.
+func SearchArticles(env *models.Env, input string, limit, offset int) ([]SearchResult, error) {
+	query := MatchQuery(input)
+	if query == "" {
+		return nil, nil
+	}
+
+	rows, err := env.DB.QueryContext(env.Ctx, search, MatchStart, MatchEnd, query, limit, offset)
+	if err != nil {
+		env.Logger.Error("models: SearchArticles", "error", err, "sql", search, "query", query)
+		return nil, fmt.Errorf("SearchArticles: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var result SearchResult
+		err = rows.Scan(&result.ID, &result.Slug, &result.Summary, &result.PublishedAt, &result.Title, &result.Snippet)
+		if err != nil {
+			env.Logger.Error("models: SearchArticles", "error", err, "sql", search, "query", query)
+			return nil, fmt.Errorf("SearchArticles: %w", err)
+		}
+		results = append(results, result)
+	}
+	err = rows.Err()
+	if err != nil {
+		env.Logger.Error("models: SearchArticles", "error", err, "sql", search, "query", query)
+		return nil, fmt.Errorf("SearchArticles: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: SearchArticles", "sql", search, "query", query)
+	}
+
+	return results, nil
+}
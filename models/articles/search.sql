@@ -0,0 +1,8 @@
+SELECT articles.id, articles.slug, articles.summary, articles.published_at,
+    highlight(articles_fts, 0, ?1, ?2),
+    snippet(articles_fts, 2, ?1, ?2, '…', 24)
+FROM articles_fts
+JOIN articles ON articles.id = articles_fts.rowid
+WHERE articles_fts MATCH ?3 AND articles.published
+ORDER BY bm25(articles_fts, 10.0, 5.0, 1.0)
+LIMIT ?4 OFFSET ?5
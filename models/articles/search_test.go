@@ -0,0 +1,27 @@
+package articles
+
+import "testing"
+
+func TestMatchQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", ""},
+		{"sqlite", `"sqlite"`},
+		{"go  sqlite", `"go" "sqlite"`},
+		{"sql*", `"sql"*`},
+		{`"full text" search`, `"full text" "search"`},
+		{`"full te"*`, `"full te"*`},
+		{`"unbalanced phrase`, `"unbalanced phrase"`},
+		{`say"hi"`, `"say" "hi"`},
+		{"a OR b", `"a" "OR" "b"`},
+		{"- * \"\" ()", ""},
+		{"title:x", `"title:x"`},
+	}
+	for _, test := range tests {
+		if got := MatchQuery(test.input); got != test.want {
+			t.Errorf("MatchQuery(%q) = %q, want %q", test.input, got, test.want)
+		}
+	}
+}
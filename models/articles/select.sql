@@ -0,0 +1 @@
+SELECT id, title, slug, summary, content, author_id, published, published_at, created_at, updated_at, comments_closed, updated_by, content_html, toc_html, html_version FROM articles ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?
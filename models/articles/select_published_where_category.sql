@@ -0,0 +1,6 @@
+SELECT articles.id, articles.title, articles.slug, articles.summary, articles.content, articles.author_id, articles.published, articles.published_at, articles.created_at, articles.updated_at, articles.comments_closed, articles.updated_by, articles.content_html, articles.toc_html, articles.html_version
+FROM articles
+JOIN article_categories ON article_categories.article_id = articles.id
+WHERE article_categories.category_id = ? AND articles.published
+ORDER BY articles.published_at DESC, articles.id DESC
+LIMIT ? OFFSET ?
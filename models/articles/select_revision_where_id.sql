@@ -0,0 +1,4 @@
+SELECT article_revisions.id, article_revisions.article_id, article_revisions.title, article_revisions.content, article_revisions.edited_at, article_revisions.edited_by, users.username
+FROM article_revisions
+JOIN users ON users.id = article_revisions.edited_by
+WHERE article_revisions.id = ? AND article_revisions.article_id = ?
@@ -0,0 +1,5 @@
+SELECT article_revisions.id, article_revisions.article_id, article_revisions.title, article_revisions.content, article_revisions.edited_at, article_revisions.edited_by, users.username
+FROM article_revisions
+JOIN users ON users.id = article_revisions.edited_by
+WHERE article_revisions.article_id = ?
+ORDER BY article_revisions.edited_at DESC, article_revisions.id DESC
@@ -0,0 +1 @@
+UPDATE articles SET title = ?, slug = ?, summary = ?, content = ?, published = ?, published_at = ?, updated_at = ?, comments_closed = ?, updated_by = ?, content_html = ?, toc_html = ?, html_version = ? WHERE id = ? AND updated_at = ?
\ No newline at end of file
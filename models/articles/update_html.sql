@@ -0,0 +1 @@
+UPDATE articles SET content_html = ?, toc_html = ?, html_version = ? WHERE id = ?
\ No newline at end of file
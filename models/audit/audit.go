@@ -0,0 +1,139 @@
+// Package audit records who did what on the site, for the admins to look up later
+package audit
+
+import (
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/models"
+)
+
+type Action string
+
+// Actions that are recorded
+const (
+	LoginSucceeded   Action = "login.success"
+	LoginFailed      Action = "login.failure"
+	UserRegistered   Action = "user.register"
+	RoleChanged      Action = "user.role"
+	ArticlePublished Action = "article.publish"
+	ArticleWithdrawn Action = "article.unpublish"
+	ArticleDeleted   Action = "article.delete"
+	CommentApproved  Action = "comment.approve"
+	CommentRejected  Action = "comment.reject"
+	CommentEdited    Action = "comment.edit"
+	CommentDeleted   Action = "comment.delete"
+	SettingsChanged  Action = "settings.update"
+	TokenCreated     Action = "token.create"
+	TokenRevoked     Action = "token.revoke"
+)
+
+// Actions lists all actions, for the filter of the admin view
+var Actions = []Action{
+	LoginSucceeded, LoginFailed, UserRegistered, RoleChanged,
+	ArticlePublished, ArticleWithdrawn, ArticleDeleted,
+	CommentApproved, CommentRejected, CommentEdited, CommentDeleted,
+	SettingsChanged, TokenCreated, TokenRevoked,
+}
+
+type Entry struct {
+	ID        uint64
+	UserID    uint64 // 0 for anonymous requests
+	Username  string // empty for anonymous requests
+	Action    Action
+	Details   string // a JSON object
+	IP        string
+	UserAgent string
+	CreatedAt time.Time
+}
+
+// Filter selects entries, empty fields match all
+type Filter struct {
+	Action   Action
+	Username string
+	From     time.Time // inclusive
+	To       time.Time // exclusive
+}
+
+func nullID(id uint64) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// nullTime is NULL for the zero time, to leave a bound of the Filter open
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+//go:embed insert.sql
+var insert string
+
+// CreateEntry records an entry
+func CreateEntry(env *models.Env, entry Entry) error {
+	_, err := env.DB.ExecContext(env.Ctx, insert, nullID(entry.UserID), entry.Action, entry.Details, entry.IP, entry.UserAgent, entry.CreatedAt)
+	if err != nil {
+		env.Logger.Error("models: CreateEntry", "error", err, "sql", insert, "action", entry.Action)
+		return fmt.Errorf("CreateEntry: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: CreateEntry", "sql", insert, "action", entry.Action)
+	}
+
+	return nil
+}
+
+//go:embed select.sql
+var selectEntries string
+
+// GetEntries returns the entries matching the filter, newest first
+func GetEntries(env *models.Env, filter Filter, limit, offset int) ([]Entry, error) {
+	from, to := nullTime(filter.From), nullTime(filter.To)
+	rows, err := env.DB.QueryContext(env.Ctx, selectEntries,
+		filter.Action, filter.Action, filter.Username, filter.Username, from, from, to, to, limit, offset)
+	if err != nil {
+		env.Logger.Error("models: GetEntries", "error", err, "sql", selectEntries, "filter", filter)
+		return nil, fmt.Errorf("GetEntries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var entry Entry
+		var userID sql.NullInt64
+		err = rows.Scan(&entry.ID, &userID, &entry.Username, &entry.Action, &entry.Details, &entry.IP, &entry.UserAgent, &entry.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("GetEntries: %w", err)
+		}
+		entry.UserID = uint64(userID.Int64)
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetEntries: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetEntries", "sql", selectEntries, "filter", filter, "limit", limit, "offset", offset)
+	}
+
+	return entries, nil
+}
+
+//go:embed delete_before.sql
+var deleteBefore string
+
+// DeleteEntriesBefore deletes the entries recorded before t
+func DeleteEntriesBefore(env *models.Env, t time.Time) error {
+	_, err := env.DB.ExecContext(env.Ctx, deleteBefore, t.UTC())
+	if err != nil {
+		env.Logger.Error("models: DeleteEntriesBefore", "error", err, "sql", deleteBefore, "before", t)
+		return fmt.Errorf("DeleteEntriesBefore: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: DeleteEntriesBefore", "sql", deleteBefore, "before", t)
+	}
+
+	return nil
+}
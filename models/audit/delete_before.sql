@@ -0,0 +1 @@
+DELETE FROM audit_logs WHERE created_at < ?
\ No newline at end of file
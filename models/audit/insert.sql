@@ -0,0 +1 @@
+INSERT INTO audit_logs (user_id, action, details, ip, user_agent, created_at) VALUES (?, ?, ?, ?, ?, ?)
\ No newline at end of file
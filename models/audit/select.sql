@@ -0,0 +1,10 @@
+SELECT audit_logs.id, audit_logs.user_id, COALESCE(users.username, ''), audit_logs.action, audit_logs.details,
+    audit_logs.ip, audit_logs.user_agent, audit_logs.created_at
+FROM audit_logs
+LEFT JOIN users ON users.id = audit_logs.user_id
+WHERE (? = '' OR audit_logs.action = ?)
+    AND (? = '' OR users.username = ?)
+    AND (? IS NULL OR audit_logs.created_at >= ?)
+    AND (? IS NULL OR audit_logs.created_at < ?)
+ORDER BY audit_logs.created_at DESC, audit_logs.id DESC
+LIMIT ? OFFSET ?
\ No newline at end of file
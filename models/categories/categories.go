@@ -0,0 +1,250 @@
+package categories
+
+import (
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+
+	"github.com/AndreHeber/go-sqlite-blog/models"
+)
+
+var ErrNotFound = errors.New("category not found")
+
+type Category struct {
+	ID    uint64
+	Name  string
+	Slug  string
+	Count int // published articles in the category, only set by GetCategories
+}
+
+func scanCategories(rows *sql.Rows, withCount bool) ([]Category, error) {
+	defer rows.Close()
+
+	var categories []Category
+	for rows.Next() {
+		var category Category
+		dest := []any{&category.ID, &category.Name, &category.Slug}
+		if withCount {
+			dest = append(dest, &category.Count)
+		}
+		err := rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+//go:embed select.sql
+var selectCategories string
+
+// GetCategories returns all categories by name, with the number of their published articles
+func GetCategories(env *models.Env) ([]Category, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectCategories)
+	if err != nil {
+		env.Logger.Error("models: GetCategories", "error", err, "sql", selectCategories)
+		return nil, fmt.Errorf("GetCategories: %w", err)
+	}
+	categories, err := scanCategories(rows, true)
+	if err != nil {
+		return nil, fmt.Errorf("GetCategories: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetCategories", "sql", selectCategories)
+	}
+
+	return categories, nil
+}
+
+//go:embed select_before_id.sql
+var selectBeforeID string
+
+// GetCategoriesBefore returns the categories with an id below beforeID, or the newest if it is 0,
+// in descending order of their ids, with the number of their published articles
+func GetCategoriesBefore(env *models.Env, beforeID uint64, limit int) ([]Category, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectBeforeID, beforeID, beforeID, limit)
+	if err != nil {
+		env.Logger.Error("models: GetCategoriesBefore", "error", err, "sql", selectBeforeID, "before_id", beforeID)
+		return nil, fmt.Errorf("GetCategoriesBefore: %w", err)
+	}
+	categories, err := scanCategories(rows, true)
+	if err != nil {
+		return nil, fmt.Errorf("GetCategoriesBefore: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetCategoriesBefore", "sql", selectBeforeID, "before_id", beforeID, "limit", limit)
+	}
+
+	return categories, nil
+}
+
+//go:embed select_where_slug.sql
+var selectWhereSlug string
+
+func GetCategoryBySlug(env *models.Env, slug string) (Category, error) {
+	var category Category
+	err := env.DB.QueryRowContext(env.Ctx, selectWhereSlug, slug).Scan(&category.ID, &category.Name, &category.Slug)
+	if err == sql.ErrNoRows {
+		return Category{}, fmt.Errorf("GetCategoryBySlug: %w", ErrNotFound)
+	}
+	if err != nil {
+		env.Logger.Error("models: GetCategoryBySlug", "error", err, "sql", selectWhereSlug, "slug", slug)
+		return Category{}, fmt.Errorf("GetCategoryBySlug: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetCategoryBySlug", "sql", selectWhereSlug, "slug", slug)
+	}
+
+	return category, nil
+}
+
+//go:embed select_where_id.sql
+var selectWhereID string
+
+func GetCategoryByID(env *models.Env, id uint64) (Category, error) {
+	var category Category
+	err := env.DB.QueryRowContext(env.Ctx, selectWhereID, id).Scan(&category.ID, &category.Name, &category.Slug)
+	if err == sql.ErrNoRows {
+		return Category{}, fmt.Errorf("GetCategoryByID: %w", ErrNotFound)
+	}
+	if err != nil {
+		env.Logger.Error("models: GetCategoryByID", "error", err, "sql", selectWhereID, "id", id)
+		return Category{}, fmt.Errorf("GetCategoryByID: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetCategoryByID", "sql", selectWhereID, "id", id)
+	}
+
+	return category, nil
+}
+
+//go:embed select_where_article.sql
+var selectWhereArticle string
+
+// GetArticleCategories returns the categories of an article by name
+func GetArticleCategories(env *models.Env, articleID uint64) ([]Category, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectWhereArticle, articleID)
+	if err != nil {
+		env.Logger.Error("models: GetArticleCategories", "error", err, "sql", selectWhereArticle, "article_id", articleID)
+		return nil, fmt.Errorf("GetArticleCategories: %w", err)
+	}
+	categories, err := scanCategories(rows, false)
+	if err != nil {
+		return nil, fmt.Errorf("GetArticleCategories: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetArticleCategories", "sql", selectWhereArticle, "article_id", articleID)
+	}
+
+	return categories, nil
+}
+
+//go:embed exists_slug.sql
+var existsSlug string
+
+// SlugExists reports whether a category other than excludeID uses the slug
+func SlugExists(env *models.Env, slug string, excludeID uint64) (bool, error) {
+	var exists bool
+	err := env.DB.QueryRowContext(env.Ctx, existsSlug, slug, excludeID).Scan(&exists)
+	if err != nil {
+		env.Logger.Error("models: SlugExists", "error", err, "sql", existsSlug, "slug", slug)
+		return false, fmt.Errorf("SlugExists: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: SlugExists", "sql", existsSlug, "slug", slug)
+	}
+
+	return exists, nil
+}
+
+//go:embed exists_name.sql
+var existsName string
+
+// NameExists reports whether a category other than excludeID has the name, ignoring case
+func NameExists(env *models.Env, name string, excludeID uint64) (bool, error) {
+	var exists bool
+	err := env.DB.QueryRowContext(env.Ctx, existsName, name, excludeID).Scan(&exists)
+	if err != nil {
+		env.Logger.Error("models: NameExists", "error", err, "sql", existsName, "name", name)
+		return false, fmt.Errorf("NameExists: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: NameExists", "sql", existsName, "name", name)
+	}
+
+	return exists, nil
+}
+
+//go:embed insert.sql
+var insert string
+
+// CreateCategory saves a new category and returns its id
+func CreateCategory(env *models.Env, category Category) (uint64, error) {
+	result, err := env.DB.ExecContext(env.Ctx, insert, category.Name, category.Slug)
+	if err != nil {
+		env.Logger.Error("models: CreateCategory", "error", err, "sql", insert, "slug", category.Slug)
+		return 0, fmt.Errorf("CreateCategory: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("CreateCategory: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: CreateCategory", "sql", insert, "slug", category.Slug)
+	}
+
+	return uint64(id), nil
+}
+
+//go:embed update.sql
+var update string
+
+func UpdateCategory(env *models.Env, category Category) error {
+	_, err := env.DB.ExecContext(env.Ctx, update, category.Name, category.Slug, category.ID)
+	if err != nil {
+		env.Logger.Error("models: UpdateCategory", "error", err, "sql", update, "id", category.ID)
+		return fmt.Errorf("UpdateCategory: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: UpdateCategory", "sql", update, "id", category.ID)
+	}
+
+	return nil
+}
+
+//go:embed delete_articles.sql
+var deleteArticles string
+
+//go:embed delete.sql
+var deleteCategory string
+
+// DeleteCategory removes the category from its articles and deletes it
+func DeleteCategory(env *models.Env, id uint64) error {
+	tx, err := env.DB.BeginTx(env.Ctx, nil)
+	if err != nil {
+		return fmt.Errorf("DeleteCategory: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{deleteArticles, deleteCategory} {
+		_, err = tx.ExecContext(env.Ctx, query, id)
+		if err != nil {
+			env.Logger.Error("models: DeleteCategory", "error", err, "sql", query, "id", id)
+			return fmt.Errorf("DeleteCategory: %w", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("DeleteCategory: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: DeleteCategory", "sql", deleteArticles+";\n"+deleteCategory, "id", id)
+	}
+
+	return nil
+}
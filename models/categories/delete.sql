@@ -0,0 +1 @@
+DELETE FROM categories WHERE id = ?
@@ -0,0 +1 @@
+DELETE FROM article_categories WHERE category_id = ?
@@ -0,0 +1 @@
+SELECT EXISTS(SELECT 1 FROM categories WHERE slug = ? AND id != ?)
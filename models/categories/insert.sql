@@ -0,0 +1 @@
+INSERT INTO categories (name, slug) VALUES (?, ?)
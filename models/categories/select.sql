@@ -0,0 +1,6 @@
+SELECT categories.id, categories.name, categories.slug, COUNT(articles.id)
+FROM categories
+LEFT JOIN article_categories ON article_categories.category_id = categories.id
+LEFT JOIN articles ON articles.id = article_categories.article_id AND articles.published
+GROUP BY categories.id
+ORDER BY categories.name COLLATE NOCASE
@@ -0,0 +1,8 @@
+SELECT categories.id, categories.name, categories.slug, COUNT(articles.id)
+FROM categories
+LEFT JOIN article_categories ON article_categories.category_id = categories.id
+LEFT JOIN articles ON articles.id = article_categories.article_id AND articles.published
+WHERE ? = 0 OR categories.id < ?
+GROUP BY categories.id
+ORDER BY categories.id DESC
+LIMIT ?
\ No newline at end of file
@@ -0,0 +1,5 @@
+SELECT categories.id, categories.name, categories.slug
+FROM categories
+JOIN article_categories ON article_categories.category_id = categories.id
+WHERE article_categories.article_id = ?
+ORDER BY categories.name COLLATE NOCASE
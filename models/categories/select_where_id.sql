@@ -0,0 +1 @@
+SELECT id, name, slug FROM categories WHERE id = ?
@@ -0,0 +1 @@
+UPDATE categories SET name = ?, slug = ? WHERE id = ?
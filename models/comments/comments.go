@@ -0,0 +1,254 @@
+package comments
+
+import (
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/models"
+)
+
+var ErrNotFound = errors.New("comment not found")
+
+// Status is the moderation state of a comment, only approved comments are public
+type Status string
+
+const (
+	Pending  Status = "pending"
+	Approved Status = "approved"
+	Rejected Status = "rejected"
+)
+
+type Comment struct {
+	ID         uint64
+	ArticleID  uint64
+	ParentID   uint64 // 0 for comments on the article itself
+	UserID     uint64 // 0 for anonymous comments
+	AuthorName string
+	Content    string
+	CreatedAt  time.Time
+	Approved   bool
+	Rejected   bool
+}
+
+func (c Comment) Status() Status {
+	switch {
+	case c.Approved:
+		return Approved
+	case c.Rejected:
+		return Rejected
+	default:
+		return Pending
+	}
+}
+
+// ModerationComment is a comment with the article it belongs to
+type ModerationComment struct {
+	Comment
+	ArticleTitle string
+	ArticleSlug  string
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanComment(row scanner, extra ...any) (Comment, error) {
+	var comment Comment
+	var parentID, userID sql.NullInt64
+	var authorName sql.NullString
+	dest := append([]any{&comment.ID, &comment.ArticleID, &parentID, &userID, &authorName, &comment.Content, &comment.CreatedAt, &comment.Approved, &comment.Rejected}, extra...)
+	err := row.Scan(dest...)
+	comment.ParentID = uint64(parentID.Int64)
+	comment.UserID = uint64(userID.Int64)
+	comment.AuthorName = authorName.String
+	return comment, err
+}
+
+func scanComments(rows *sql.Rows) ([]Comment, error) {
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+func nullID(id uint64) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+//go:embed insert.sql
+var insert string
+
+// CreateComment saves a new comment and returns its id
+func CreateComment(env *models.Env, comment Comment) (uint64, error) {
+	result, err := env.DB.ExecContext(env.Ctx, insert, comment.ArticleID, nullID(comment.ParentID), nullID(comment.UserID), comment.AuthorName, comment.Content, comment.CreatedAt, comment.Approved, comment.Rejected)
+	if err != nil {
+		env.Logger.Error("models: CreateComment", "error", err, "sql", insert, "article_id", comment.ArticleID)
+		return 0, fmt.Errorf("CreateComment: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("CreateComment: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: CreateComment", "sql", insert, "article_id", comment.ArticleID)
+	}
+
+	return uint64(id), nil
+}
+
+//go:embed select_where_id.sql
+var selectWhereID string
+
+func GetCommentByID(env *models.Env, id uint64) (Comment, error) {
+	comment, err := scanComment(env.DB.QueryRowContext(env.Ctx, selectWhereID, id))
+	if err == sql.ErrNoRows {
+		return Comment{}, fmt.Errorf("GetCommentByID: %w", ErrNotFound)
+	}
+	if err != nil {
+		env.Logger.Error("models: GetCommentByID", "error", err, "sql", selectWhereID, "id", id)
+		return Comment{}, fmt.Errorf("GetCommentByID: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetCommentByID", "sql", selectWhereID, "id", id)
+	}
+
+	return comment, nil
+}
+
+//go:embed select_approved_where_article.sql
+var selectApprovedWhereArticle string
+
+// GetApprovedComments returns the approved comments of an article, oldest first
+func GetApprovedComments(env *models.Env, articleID uint64) ([]Comment, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectApprovedWhereArticle, articleID)
+	if err != nil {
+		env.Logger.Error("models: GetApprovedComments", "error", err, "sql", selectApprovedWhereArticle, "article_id", articleID)
+		return nil, fmt.Errorf("GetApprovedComments: %w", err)
+	}
+	comments, err := scanComments(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetApprovedComments: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetApprovedComments", "sql", selectApprovedWhereArticle, "article_id", articleID)
+	}
+
+	return comments, nil
+}
+
+//go:embed select_approved_before_id.sql
+var selectApprovedBeforeID string
+
+// GetApprovedCommentsBefore returns the approved comments of an article with an id below beforeID,
+// or the newest if it is 0, in descending order of their ids
+func GetApprovedCommentsBefore(env *models.Env, articleID uint64, beforeID uint64, limit int) ([]Comment, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectApprovedBeforeID, articleID, beforeID, beforeID, limit)
+	if err != nil {
+		env.Logger.Error("models: GetApprovedCommentsBefore", "error", err, "sql", selectApprovedBeforeID, "article_id", articleID, "before_id", beforeID)
+		return nil, fmt.Errorf("GetApprovedCommentsBefore: %w", err)
+	}
+	comments, err := scanComments(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetApprovedCommentsBefore: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetApprovedCommentsBefore", "sql", selectApprovedBeforeID, "article_id", articleID, "before_id", beforeID, "limit", limit)
+	}
+
+	return comments, nil
+}
+
+//go:embed select_where_status.sql
+var selectWhereStatus string
+
+// GetCommentsByStatus returns the comments of all articles in the moderation state, newest first
+func GetCommentsByStatus(env *models.Env, status Status, limit, offset int) ([]ModerationComment, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectWhereStatus, status == Approved, status == Rejected, limit, offset)
+	if err != nil {
+		env.Logger.Error("models: GetCommentsByStatus", "error", err, "sql", selectWhereStatus, "status", status)
+		return nil, fmt.Errorf("GetCommentsByStatus: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []ModerationComment
+	for rows.Next() {
+		var comment ModerationComment
+		comment.Comment, err = scanComment(rows, &comment.ArticleTitle, &comment.ArticleSlug)
+		if err != nil {
+			return nil, fmt.Errorf("GetCommentsByStatus: %w", err)
+		}
+		comments = append(comments, comment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetCommentsByStatus: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetCommentsByStatus", "sql", selectWhereStatus, "status", status, "limit", limit, "offset", offset)
+	}
+
+	return comments, nil
+}
+
+//go:embed update_status.sql
+var updateStatus string
+
+func UpdateStatus(env *models.Env, id uint64, status Status) error {
+	_, err := env.DB.ExecContext(env.Ctx, updateStatus, status == Approved, status == Rejected, id)
+	if err != nil {
+		env.Logger.Error("models: UpdateStatus", "error", err, "sql", updateStatus, "id", id, "status", status)
+		return fmt.Errorf("UpdateStatus: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: UpdateStatus", "sql", updateStatus, "id", id, "status", status)
+	}
+
+	return nil
+}
+
+//go:embed update_content.sql
+var updateContent string
+
+// UpdateContent changes the text and the shown author name of a comment
+func UpdateContent(env *models.Env, id uint64, authorName, content string) error {
+	_, err := env.DB.ExecContext(env.Ctx, updateContent, authorName, content, id)
+	if err != nil {
+		env.Logger.Error("models: UpdateContent", "error", err, "sql", updateContent, "id", id)
+		return fmt.Errorf("UpdateContent: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: UpdateContent", "sql", updateContent, "id", id)
+	}
+
+	return nil
+}
+
+//go:embed delete.sql
+var deleteComment string
+
+// DeleteComment deletes a comment together with all replies to it
+func DeleteComment(env *models.Env, id uint64) error {
+	_, err := env.DB.ExecContext(env.Ctx, deleteComment, id)
+	if err != nil {
+		env.Logger.Error("models: DeleteComment", "error", err, "sql", deleteComment, "id", id)
+		return fmt.Errorf("DeleteComment: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: DeleteComment", "sql", deleteComment, "id", id)
+	}
+
+	return nil
+}
@@ -0,0 +1,6 @@
+WITH RECURSIVE thread(id) AS (
+    SELECT ?
+    UNION ALL
+    SELECT comments.id FROM comments JOIN thread ON comments.parent_id = thread.id
+)
+DELETE FROM comments WHERE id IN (SELECT id FROM thread)
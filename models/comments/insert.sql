@@ -0,0 +1 @@
+INSERT INTO comments (article_id, parent_id, user_id, author_name, content, created_at, approved, rejected) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
@@ -0,0 +1 @@
+SELECT id, article_id, parent_id, user_id, author_name, content, created_at, approved, rejected FROM comments WHERE article_id = ? AND approved AND (? = 0 OR id < ?) ORDER BY id DESC LIMIT ?
\ No newline at end of file
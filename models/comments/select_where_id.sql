@@ -0,0 +1 @@
+SELECT id, article_id, parent_id, user_id, author_name, content, created_at, approved, rejected FROM comments WHERE id = ? LIMIT 1
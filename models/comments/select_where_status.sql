@@ -0,0 +1,7 @@
+SELECT comments.id, comments.article_id, comments.parent_id, comments.user_id, comments.author_name, comments.content, comments.created_at, comments.approved, comments.rejected,
+    articles.title, articles.slug
+FROM comments
+JOIN articles ON articles.id = comments.article_id
+WHERE comments.approved = ? AND comments.rejected = ?
+ORDER BY comments.created_at DESC, comments.id DESC
+LIMIT ? OFFSET ?
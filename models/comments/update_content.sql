@@ -0,0 +1 @@
+UPDATE comments SET author_name = ?, content = ? WHERE id = ?
@@ -0,0 +1 @@
+UPDATE comments SET approved = ?, rejected = ? WHERE id = ?
@@ -0,0 +1,5 @@
+SELECT likes.comment_id, SUM(likes.type = 1), SUM(likes.type = 2)
+FROM likes
+JOIN comments ON comments.id = likes.comment_id
+WHERE comments.article_id = ?
+GROUP BY likes.comment_id
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT COALESCE(SUM(type = 1), 0), COALESCE(SUM(type = 2), 0) FROM likes WHERE article_id = ?
\ No newline at end of file
@@ -0,0 +1 @@
+DELETE FROM likes WHERE user_id = ? AND article_id IS ? AND comment_id IS ?
\ No newline at end of file
@@ -0,0 +1,259 @@
+// Package likes stores the reactions of users to articles and comments.
+// A user has at most one reaction per article or comment, the unique indexes of
+// the likes table enforce it.
+package likes
+
+import (
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/models"
+)
+
+var ErrInvalid = errors.New("invalid reaction")
+
+// Reaction is the type of a like, 0 is no reaction
+type Reaction int
+
+const (
+	Like    Reaction = 1
+	Dislike Reaction = 2
+)
+
+func (r Reaction) String() string {
+	switch r {
+	case Like:
+		return "like"
+	case Dislike:
+		return "dislike"
+	default:
+		return ""
+	}
+}
+
+// ParseReaction returns the reaction named s
+func ParseReaction(s string) (Reaction, error) {
+	switch s {
+	case "like":
+		return Like, nil
+	case "dislike":
+		return Dislike, nil
+	default:
+		return 0, fmt.Errorf("ParseReaction: %w %q", ErrInvalid, s)
+	}
+}
+
+// Target is the article or the comment a reaction belongs to, exactly one of the ids is set
+type Target struct {
+	ArticleID uint64
+	CommentID uint64
+}
+
+func nullID(id uint64) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// Counts are the numbers of likes and dislikes of an article or comment
+type Counts struct {
+	Likes    int `json:"likes"`
+	Dislikes int `json:"dislikes"`
+}
+
+//go:embed select_where_user.sql
+var selectWhereUser string
+
+//go:embed delete_where_user.sql
+var deleteWhereUser string
+
+//go:embed upsert_article.sql
+var upsertArticle string
+
+//go:embed upsert_comment.sql
+var upsertComment string
+
+// Toggle sets the reaction of the user to the target, or removes it if the user already
+// reacted that way. It returns the reaction of the user afterwards.
+func Toggle(env *models.Env, userID uint64, target Target, reaction Reaction) (Reaction, error) {
+	if (target.ArticleID == 0) == (target.CommentID == 0) {
+		return 0, errors.New("Toggle: the target must be either an article or a comment")
+	}
+	articleID, commentID := nullID(target.ArticleID), nullID(target.CommentID)
+
+	tx, err := env.DB.BeginTx(env.Ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("Toggle: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current Reaction
+	err = tx.QueryRowContext(env.Ctx, selectWhereUser, userID, articleID, commentID).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		env.Logger.Error("models: Toggle", "error", err, "sql", selectWhereUser, "user_id", userID, "target", target)
+		return 0, fmt.Errorf("Toggle: %w", err)
+	}
+
+	query, args := upsertArticle, []any{reaction, userID, target.ArticleID, time.Now().UTC()}
+	if target.CommentID != 0 {
+		query, args = upsertComment, []any{reaction, userID, target.CommentID, time.Now().UTC()}
+	}
+	if current == reaction {
+		query, args, reaction = deleteWhereUser, []any{userID, articleID, commentID}, 0
+	}
+	_, err = tx.ExecContext(env.Ctx, query, args...)
+	if err != nil {
+		env.Logger.Error("models: Toggle", "error", err, "sql", query, "user_id", userID, "target", target)
+		return 0, fmt.Errorf("Toggle: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("Toggle: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: Toggle", "sql", selectWhereUser+";\n"+query, "user_id", userID, "target", target)
+	}
+
+	return reaction, nil
+}
+
+//go:embed count_where_article.sql
+var countWhereArticle string
+
+// GetArticleCounts returns the reactions to the article
+func GetArticleCounts(env *models.Env, articleID uint64) (Counts, error) {
+	var counts Counts
+	err := env.DB.QueryRowContext(env.Ctx, countWhereArticle, articleID).Scan(&counts.Likes, &counts.Dislikes)
+	if err != nil {
+		env.Logger.Error("models: GetArticleCounts", "error", err, "sql", countWhereArticle, "article_id", articleID)
+		return Counts{}, fmt.Errorf("GetArticleCounts: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetArticleCounts", "sql", countWhereArticle, "article_id", articleID)
+	}
+
+	return counts, nil
+}
+
+//go:embed count_comments_where_article.sql
+var countCommentsWhereArticle string
+
+// GetCommentCounts returns the reactions to the comments of the article by comment id,
+// comments without reactions are missing
+func GetCommentCounts(env *models.Env, articleID uint64) (map[uint64]Counts, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, countCommentsWhereArticle, articleID)
+	if err != nil {
+		env.Logger.Error("models: GetCommentCounts", "error", err, "sql", countCommentsWhereArticle, "article_id", articleID)
+		return nil, fmt.Errorf("GetCommentCounts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[uint64]Counts)
+	for rows.Next() {
+		var commentID uint64
+		var c Counts
+		err = rows.Scan(&commentID, &c.Likes, &c.Dislikes)
+		if err != nil {
+			return nil, fmt.Errorf("GetCommentCounts: %w", err)
+		}
+		counts[commentID] = c
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetCommentCounts: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetCommentCounts", "sql", countCommentsWhereArticle, "article_id", articleID)
+	}
+
+	return counts, nil
+}
+
+// Reactions are the reactions of a user to an article and its comments
+type Reactions struct {
+	Article  Reaction
+	Comments map[uint64]Reaction
+}
+
+//go:embed select_where_user_article.sql
+var selectWhereUserArticle string
+
+// GetUserReactions returns the reactions of the user to the article and its comments
+func GetUserReactions(env *models.Env, userID, articleID uint64) (Reactions, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectWhereUserArticle, userID, articleID, articleID)
+	if err != nil {
+		env.Logger.Error("models: GetUserReactions", "error", err, "sql", selectWhereUserArticle, "user_id", userID, "article_id", articleID)
+		return Reactions{}, fmt.Errorf("GetUserReactions: %w", err)
+	}
+	defer rows.Close()
+
+	reactions := Reactions{Comments: make(map[uint64]Reaction)}
+	for rows.Next() {
+		var commentID sql.NullInt64
+		var reaction Reaction
+		err = rows.Scan(&commentID, &reaction)
+		if err != nil {
+			return Reactions{}, fmt.Errorf("GetUserReactions: %w", err)
+		}
+		if commentID.Valid {
+			reactions.Comments[uint64(commentID.Int64)] = reaction
+		} else {
+			reactions.Article = reaction
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return Reactions{}, fmt.Errorf("GetUserReactions: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetUserReactions", "sql", selectWhereUserArticle, "user_id", userID, "article_id", articleID)
+	}
+
+	return reactions, nil
+}
+
+// LikedArticle is a published article with its reactions
+type LikedArticle struct {
+	ID          uint64
+	Title       string
+	Slug        string
+	PublishedAt time.Time
+	Counts
+}
+
+//go:embed select_most_liked.sql
+var selectMostLiked string
+
+// GetMostLikedArticles returns the published articles with the most likes, articles without likes are left out
+func GetMostLikedArticles(env *models.Env, limit int) ([]LikedArticle, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectMostLiked, limit)
+	if err != nil {
+		env.Logger.Error("models: GetMostLikedArticles", "error", err, "sql", selectMostLiked)
+		return nil, fmt.Errorf("GetMostLikedArticles: %w", err)
+	}
+	defer rows.Close()
+
+	var list []LikedArticle
+	for rows.Next() {
+		var article LikedArticle
+		var publishedAt sql.NullTime
+		err = rows.Scan(&article.ID, &article.Title, &article.Slug, &publishedAt, &article.Likes, &article.Dislikes)
+		if err != nil {
+			return nil, fmt.Errorf("GetMostLikedArticles: %w", err)
+		}
+		article.PublishedAt = publishedAt.Time
+		list = append(list, article)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetMostLikedArticles: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetMostLikedArticles", "sql", selectMostLiked, "limit", limit)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,8 @@
+SELECT articles.id, articles.title, articles.slug, articles.published_at, SUM(likes.type = 1) AS like_count, SUM(likes.type = 2)
+FROM articles
+JOIN likes ON likes.article_id = articles.id
+WHERE articles.published
+GROUP BY articles.id
+HAVING like_count > 0
+ORDER BY like_count DESC, articles.published_at DESC, articles.id DESC
+LIMIT ?
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT type FROM likes WHERE user_id = ? AND article_id IS ? AND comment_id IS ?
\ No newline at end of file
@@ -0,0 +1,4 @@
+SELECT likes.comment_id, likes.type
+FROM likes
+LEFT JOIN comments ON comments.id = likes.comment_id
+WHERE likes.user_id = ? AND (likes.article_id = ? OR comments.article_id = ?)
\ No newline at end of file
@@ -0,0 +1,2 @@
+INSERT INTO likes (type, user_id, article_id, created_at) VALUES (?, ?, ?, ?)
+ON CONFLICT (user_id, article_id) WHERE article_id IS NOT NULL DO UPDATE SET type = excluded.type, created_at = excluded.created_at
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT EXISTS(SELECT 1 FROM media WHERE file_path = ?)
@@ -0,0 +1 @@
+INSERT INTO media (parent_id, file_name, file_path, content_type, size, hash, width, height, uploaded_by, uploaded_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
@@ -0,0 +1,252 @@
+package media
+
+import (
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/models"
+)
+
+var ErrNotFound = errors.New("media not found")
+
+// Media is an uploaded file. FilePath is relative to the media directory
+// and may be shared by several uploads of the same content.
+type Media struct {
+	ID           uint64
+	ParentID     uint64 // the original image of a resized version, 0 for uploads
+	FileName     string
+	FilePath     string
+	ContentType  string
+	Size         int64
+	Hash         string
+	Width        int // 0 for files that aren't images
+	Height       int
+	UploadedBy   uint64
+	UploadedAt   time.Time
+	UploaderName string
+}
+
+// URL returns the path the file is served under
+func (m Media) URL() string {
+	return fmt.Sprintf("/media/%d/%s", m.ID, m.FileName)
+}
+
+// Srcset returns the srcset attribute of an image with its resized versions, like
+// "/media/2/photo-320w.jpg 320w, /media/1/photo.jpg 1200w". Files without a width are left out.
+func Srcset(images ...Media) string {
+	var candidates []string
+	for _, image := range images {
+		if image.Width > 0 {
+			candidates = append(candidates, fmt.Sprintf("%s %dw", image.URL(), image.Width))
+		}
+	}
+	return strings.Join(candidates, ", ")
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMedia(row scanner) (Media, error) {
+	var media Media
+	var parentID, uploadedBy sql.NullInt64
+	err := row.Scan(&media.ID, &parentID, &media.FileName, &media.FilePath, &media.ContentType, &media.Size, &media.Hash, &media.Width, &media.Height, &uploadedBy, &media.UploadedAt, &media.UploaderName)
+	media.ParentID = uint64(parentID.Int64)
+	media.UploadedBy = uint64(uploadedBy.Int64)
+	return media, err
+}
+
+func nullID(id uint64) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// scanList reads the rows of a query that selects the columns of scanMedia
+func scanList(rows *sql.Rows) ([]Media, error) {
+	defer rows.Close()
+
+	var list []Media
+	for rows.Next() {
+		media, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, media)
+	}
+	return list, rows.Err()
+}
+
+//go:embed insert.sql
+var insert string
+
+// CreateMedia saves a new upload or resized image and returns its id
+func CreateMedia(env *models.Env, media Media) (uint64, error) {
+	result, err := env.DB.ExecContext(env.Ctx, insert, nullID(media.ParentID), media.FileName, media.FilePath, media.ContentType, media.Size, media.Hash, media.Width, media.Height, nullID(media.UploadedBy), media.UploadedAt)
+	if err != nil {
+		env.Logger.Error("models: CreateMedia", "error", err, "sql", insert, "file_path", media.FilePath)
+		return 0, fmt.Errorf("CreateMedia: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("CreateMedia: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: CreateMedia", "sql", insert, "file_path", media.FilePath)
+	}
+
+	return uint64(id), nil
+}
+
+//go:embed select.sql
+var selectMedia string
+
+// GetMedia returns a page of uploads without their resized versions, newest first
+func GetMedia(env *models.Env, limit, offset int) ([]Media, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectMedia, limit, offset)
+	if err != nil {
+		env.Logger.Error("models: GetMedia", "error", err, "sql", selectMedia)
+		return nil, fmt.Errorf("GetMedia: %w", err)
+	}
+	list, err := scanList(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetMedia: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetMedia", "sql", selectMedia)
+	}
+
+	return list, nil
+}
+
+//go:embed select_before_id.sql
+var selectBeforeID string
+
+// GetMediaBefore returns the uploads with an id below beforeID, or the newest if it is 0,
+// in descending order of their ids
+func GetMediaBefore(env *models.Env, beforeID uint64, limit int) ([]Media, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectBeforeID, beforeID, beforeID, limit)
+	if err != nil {
+		env.Logger.Error("models: GetMediaBefore", "error", err, "sql", selectBeforeID, "before_id", beforeID)
+		return nil, fmt.Errorf("GetMediaBefore: %w", err)
+	}
+	list, err := scanList(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetMediaBefore: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetMediaBefore", "sql", selectBeforeID, "before_id", beforeID, "limit", limit)
+	}
+
+	return list, nil
+}
+
+//go:embed select_where_id.sql
+var selectWhereID string
+
+func GetMediaByID(env *models.Env, id uint64) (Media, error) {
+	media, err := scanMedia(env.DB.QueryRowContext(env.Ctx, selectWhereID, id))
+	if err == sql.ErrNoRows {
+		return Media{}, fmt.Errorf("GetMediaByID: %w", ErrNotFound)
+	}
+	if err != nil {
+		env.Logger.Error("models: GetMediaByID", "error", err, "sql", selectWhereID, "id", id)
+		return Media{}, fmt.Errorf("GetMediaByID: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetMediaByID", "sql", selectWhereID, "id", id)
+	}
+
+	return media, nil
+}
+
+//go:embed select_where_parent.sql
+var selectWhereParent string
+
+// GetDerivatives returns the resized versions of an image, narrowest first
+func GetDerivatives(env *models.Env, parentID uint64) ([]Media, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectWhereParent, parentID)
+	if err != nil {
+		env.Logger.Error("models: GetDerivatives", "error", err, "sql", selectWhereParent, "parent_id", parentID)
+		return nil, fmt.Errorf("GetDerivatives: %w", err)
+	}
+	list, err := scanList(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetDerivatives: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetDerivatives", "sql", selectWhereParent, "parent_id", parentID)
+	}
+
+	return list, nil
+}
+
+//go:embed select_referencing_articles.sql
+var selectReferencingArticles string
+
+// GetReferencingArticles returns the slugs of the articles whose content links to the upload
+func GetReferencingArticles(env *models.Env, id uint64) ([]string, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectReferencingArticles, id)
+	if err != nil {
+		env.Logger.Error("models: GetReferencingArticles", "error", err, "sql", selectReferencingArticles, "id", id)
+		return nil, fmt.Errorf("GetReferencingArticles: %w", err)
+	}
+	defer rows.Close()
+
+	var slugs []string
+	for rows.Next() {
+		var slug string
+		err = rows.Scan(&slug)
+		if err != nil {
+			return nil, fmt.Errorf("GetReferencingArticles: %w", err)
+		}
+		slugs = append(slugs, slug)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetReferencingArticles: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetReferencingArticles", "sql", selectReferencingArticles, "id", id)
+	}
+
+	return slugs, nil
+}
+
+//go:embed exists_file_path.sql
+var existsFilePath string
+
+// FilePathInUse reports whether an upload still uses the file
+func FilePathInUse(env *models.Env, filePath string) (bool, error) {
+	var exists bool
+	err := env.DB.QueryRowContext(env.Ctx, existsFilePath, filePath).Scan(&exists)
+	if err != nil {
+		env.Logger.Error("models: FilePathInUse", "error", err, "sql", existsFilePath, "file_path", filePath)
+		return false, fmt.Errorf("FilePathInUse: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: FilePathInUse", "sql", existsFilePath, "file_path", filePath)
+	}
+
+	return exists, nil
+}
+
+//go:embed delete.sql
+var deleteMedia string
+
+// DeleteMedia deletes an upload and its resized versions
+func DeleteMedia(env *models.Env, id uint64) error {
+	_, err := env.DB.ExecContext(env.Ctx, deleteMedia, id)
+	if err != nil {
+		env.Logger.Error("models: DeleteMedia", "error", err, "sql", deleteMedia, "id", id)
+		return fmt.Errorf("DeleteMedia: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: DeleteMedia", "sql", deleteMedia, "id", id)
+	}
+
+	return nil
+}
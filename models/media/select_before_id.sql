@@ -0,0 +1,6 @@
+SELECT media.id, media.parent_id, media.file_name, media.file_path, media.content_type, media.size, media.hash, media.width, media.height, media.uploaded_by, media.uploaded_at, COALESCE(users.username, '')
+FROM media
+LEFT JOIN users ON users.id = media.uploaded_by
+WHERE media.parent_id IS NULL AND (? = 0 OR media.id < ?)
+ORDER BY media.id DESC
+LIMIT ?
\ No newline at end of file
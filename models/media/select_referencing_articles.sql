@@ -0,0 +1 @@
+SELECT slug FROM articles WHERE content LIKE '%/media/' || ? || '/%' ORDER BY id
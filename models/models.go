@@ -4,8 +4,6 @@ import (
 	"context"
 	"database/sql"
 	"log/slog"
-
-	"github.com/AndreHeber/go-sqlite-blog/middleware"
 )
 
 type Env struct {
@@ -14,7 +12,3 @@ type Env struct {
 	Logger       *slog.Logger
 	LogDBQueries bool
 }
-
-func EnvFromAdapter(adapter *middleware.Adapter) *Env {
-	return &Env{DB: adapter.DB, Ctx: adapter.Ctx, Logger: adapter.Logger, LogDBQueries: adapter.LogDBQueries}
-}
@@ -0,0 +1 @@
+DELETE FROM pages WHERE id = ?
@@ -0,0 +1 @@
+SELECT EXISTS(SELECT 1 FROM pages WHERE slug = ? AND id != ?)
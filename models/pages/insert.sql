@@ -0,0 +1 @@
+INSERT INTO pages (title, slug, content, published, menu_order, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)
@@ -0,0 +1,239 @@
+package pages
+
+import (
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/models"
+)
+
+var (
+	ErrNotFound = errors.New("page not found")
+	ErrConflict = errors.New("page was changed in the meantime")
+)
+
+// Page is a static page like About or Contact, served at /<slug>
+type Page struct {
+	ID        uint64
+	Title     string
+	Slug      string
+	Content   string
+	Published bool
+	MenuOrder int // position in the navigation, 0 leaves the page out
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPage(row scanner) (Page, error) {
+	var page Page
+	var updatedAt sql.NullTime
+	err := row.Scan(&page.ID, &page.Title, &page.Slug, &page.Content, &page.Published, &page.MenuOrder, &page.CreatedAt, &updatedAt)
+	page.UpdatedAt = updatedAt.Time
+	return page, err
+}
+
+func scanPages(rows *sql.Rows) ([]Page, error) {
+	defer rows.Close()
+
+	var pages []Page
+	for rows.Next() {
+		page, err := scanPage(rows)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	}
+	return pages, rows.Err()
+}
+
+//go:embed select.sql
+var selectPages string
+
+// GetPages returns all pages including drafts by title
+func GetPages(env *models.Env) ([]Page, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectPages)
+	if err != nil {
+		env.Logger.Error("models: GetPages", "error", err, "sql", selectPages)
+		return nil, fmt.Errorf("GetPages: %w", err)
+	}
+	pages, err := scanPages(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetPages: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetPages", "sql", selectPages)
+	}
+
+	return pages, nil
+}
+
+//go:embed select_before_id.sql
+var selectBeforeID string
+
+// GetPagesBefore returns the pages with an id below beforeID, or the newest if it is 0,
+// in descending order of their ids. Drafts are only included if drafts is set.
+func GetPagesBefore(env *models.Env, beforeID uint64, limit int, drafts bool) ([]Page, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectBeforeID, drafts, beforeID, beforeID, limit)
+	if err != nil {
+		env.Logger.Error("models: GetPagesBefore", "error", err, "sql", selectBeforeID, "before_id", beforeID)
+		return nil, fmt.Errorf("GetPagesBefore: %w", err)
+	}
+	pages, err := scanPages(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetPagesBefore: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetPagesBefore", "sql", selectBeforeID, "before_id", beforeID, "limit", limit, "drafts", drafts)
+	}
+
+	return pages, nil
+}
+
+//go:embed select_menu.sql
+var selectMenu string
+
+// GetMenuPages returns the published pages of the navigation in their order
+func GetMenuPages(env *models.Env) ([]Page, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectMenu)
+	if err != nil {
+		env.Logger.Error("models: GetMenuPages", "error", err, "sql", selectMenu)
+		return nil, fmt.Errorf("GetMenuPages: %w", err)
+	}
+	pages, err := scanPages(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetMenuPages: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetMenuPages", "sql", selectMenu)
+	}
+
+	return pages, nil
+}
+
+//go:embed select_where_slug.sql
+var selectWhereSlug string
+
+func GetPageBySlug(env *models.Env, slug string) (Page, error) {
+	page, err := scanPage(env.DB.QueryRowContext(env.Ctx, selectWhereSlug, slug))
+	if err == sql.ErrNoRows {
+		return Page{}, fmt.Errorf("GetPageBySlug: %w", ErrNotFound)
+	}
+	if err != nil {
+		env.Logger.Error("models: GetPageBySlug", "error", err, "sql", selectWhereSlug, "slug", slug)
+		return Page{}, fmt.Errorf("GetPageBySlug: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetPageBySlug", "sql", selectWhereSlug, "slug", slug)
+	}
+
+	return page, nil
+}
+
+//go:embed select_where_id.sql
+var selectWhereID string
+
+func GetPageByID(env *models.Env, id uint64) (Page, error) {
+	page, err := scanPage(env.DB.QueryRowContext(env.Ctx, selectWhereID, id))
+	if err == sql.ErrNoRows {
+		return Page{}, fmt.Errorf("GetPageByID: %w", ErrNotFound)
+	}
+	if err != nil {
+		env.Logger.Error("models: GetPageByID", "error", err, "sql", selectWhereID, "id", id)
+		return Page{}, fmt.Errorf("GetPageByID: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetPageByID", "sql", selectWhereID, "id", id)
+	}
+
+	return page, nil
+}
+
+//go:embed exists_slug.sql
+var existsSlug string
+
+// SlugExists reports whether a page other than excludeID uses the slug
+func SlugExists(env *models.Env, slug string, excludeID uint64) (bool, error) {
+	var exists bool
+	err := env.DB.QueryRowContext(env.Ctx, existsSlug, slug, excludeID).Scan(&exists)
+	if err != nil {
+		env.Logger.Error("models: SlugExists", "error", err, "sql", existsSlug, "slug", slug)
+		return false, fmt.Errorf("SlugExists: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: SlugExists", "sql", existsSlug, "slug", slug)
+	}
+
+	return exists, nil
+}
+
+//go:embed insert.sql
+var insert string
+
+// CreatePage saves a new page and returns its id
+func CreatePage(env *models.Env, page Page) (uint64, error) {
+	result, err := env.DB.ExecContext(env.Ctx, insert, page.Title, page.Slug, page.Content, page.Published, page.MenuOrder, page.CreatedAt, page.UpdatedAt)
+	if err != nil {
+		env.Logger.Error("models: CreatePage", "error", err, "sql", insert, "slug", page.Slug)
+		return 0, fmt.Errorf("CreatePage: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("CreatePage: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: CreatePage", "sql", insert, "slug", page.Slug)
+	}
+
+	return uint64(id), nil
+}
+
+//go:embed update.sql
+var update string
+
+// UpdatePage saves the page. lastUpdatedAt is the time of the update the changes are based on,
+// if the page was saved since then ErrConflict is returned and nothing is saved.
+func UpdatePage(env *models.Env, page Page, lastUpdatedAt time.Time) error {
+	result, err := env.DB.ExecContext(env.Ctx, update, page.Title, page.Slug, page.Content, page.Published, page.MenuOrder, page.UpdatedAt, page.ID, lastUpdatedAt)
+	if err != nil {
+		env.Logger.Error("models: UpdatePage", "error", err, "sql", update, "id", page.ID)
+		return fmt.Errorf("UpdatePage: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("UpdatePage: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("UpdatePage: %w", ErrConflict)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: UpdatePage", "sql", update, "id", page.ID)
+	}
+
+	return nil
+}
+
+//go:embed delete.sql
+var deletePage string
+
+func DeletePage(env *models.Env, id uint64) error {
+	_, err := env.DB.ExecContext(env.Ctx, deletePage, id)
+	if err != nil {
+		env.Logger.Error("models: DeletePage", "error", err, "sql", deletePage, "id", id)
+		return fmt.Errorf("DeletePage: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: DeletePage", "sql", deletePage, "id", id)
+	}
+
+	return nil
+}
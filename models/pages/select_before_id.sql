@@ -0,0 +1 @@
+SELECT id, title, slug, content, published, menu_order, created_at, updated_at FROM pages WHERE (published OR ?) AND (? = 0 OR id < ?) ORDER BY id DESC LIMIT ?
\ No newline at end of file
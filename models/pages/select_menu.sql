@@ -0,0 +1 @@
+SELECT id, title, slug, content, published, menu_order, created_at, updated_at FROM pages WHERE published AND menu_order > 0 ORDER BY menu_order, title COLLATE NOCASE
@@ -0,0 +1 @@
+SELECT id, title, slug, content, published, menu_order, created_at, updated_at FROM pages WHERE id = ?
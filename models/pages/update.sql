@@ -0,0 +1 @@
+UPDATE pages SET title = ?, slug = ?, content = ?, published = ?, menu_order = ?, updated_at = ? WHERE id = ? AND updated_at = ?
\ No newline at end of file
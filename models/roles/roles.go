@@ -0,0 +1,123 @@
+package roles
+
+import (
+	"database/sql"
+	_ "embed"
+	"fmt"
+
+	"github.com/AndreHeber/go-sqlite-blog/models"
+)
+
+// Names of the seeded roles
+const (
+	Reader = "reader"
+	Author = "author"
+	Editor = "editor"
+	Admin  = "admin"
+)
+
+// Permission is an action a role may perform, stored in the permissions table
+type Permission string
+
+// Permission vocabulary, see db/migrations/0001_initial.up.sql for which role is granted what
+const (
+	CommentCreate   Permission = "comment.create"
+	CommentModerate Permission = "comment.moderate"
+	ArticleCreate   Permission = "article.create"
+	ArticleEdit     Permission = "article.edit"    // edit articles of other users
+	ArticlePublish  Permission = "article.publish" // publish and unpublish articles
+	ArticleDelete   Permission = "article.delete"  // delete articles of other users
+	MediaUpload     Permission = "media.upload"
+	MediaDelete     Permission = "media.delete" // delete media of other users
+	PageEdit        Permission = "page.edit"
+	TaxonomyManage  Permission = "taxonomy.manage" // categories and tags
+	UserManage      Permission = "user.manage"     // list users and change their roles
+	SettingsEdit    Permission = "settings.edit"
+	TemplateEdit    Permission = "template.edit"
+	AuditView       Permission = "audit.view"
+)
+
+type Role struct {
+	ID   uint64
+	Name string
+}
+
+//go:embed select.sql
+var selectRoles string
+
+func GetRoles(env *models.Env) ([]Role, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectRoles)
+	if err != nil {
+		env.Logger.Error("models: GetRoles", "error", err, "sql", selectRoles)
+		return nil, fmt.Errorf("GetRoles: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []Role
+	for rows.Next() {
+		var role Role
+		err = rows.Scan(&role.ID, &role.Name)
+		if err != nil {
+			return nil, fmt.Errorf("GetRoles: %w", err)
+		}
+		roles = append(roles, role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetRoles: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetRoles", "sql", selectRoles)
+	}
+
+	return roles, nil
+}
+
+//go:embed select_where_name.sql
+var selectWhereName string
+
+func GetRoleByName(env *models.Env, name string) (Role, error) {
+	var role Role
+	err := env.DB.QueryRowContext(env.Ctx, selectWhereName, name).Scan(&role.ID, &role.Name)
+	if err == sql.ErrNoRows {
+		return Role{}, fmt.Errorf("GetRoleByName: role not found")
+	}
+	if err != nil {
+		env.Logger.Error("models: GetRoleByName", "error", err, "sql", selectWhereName, "name", name)
+		return Role{}, fmt.Errorf("GetRoleByName: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetRoleByName", "sql", selectWhereName, "name", name)
+	}
+
+	return role, nil
+}
+
+//go:embed select_permissions_where_role.sql
+var selectPermissionsWhereRole string
+
+func GetRolePermissions(env *models.Env, roleID uint64) ([]Permission, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectPermissionsWhereRole, roleID)
+	if err != nil {
+		env.Logger.Error("models: GetRolePermissions", "error", err, "sql", selectPermissionsWhereRole, "role_id", roleID)
+		return nil, fmt.Errorf("GetRolePermissions: %w", err)
+	}
+	defer rows.Close()
+
+	var permissions []Permission
+	for rows.Next() {
+		var permission Permission
+		err = rows.Scan(&permission)
+		if err != nil {
+			return nil, fmt.Errorf("GetRolePermissions: %w", err)
+		}
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetRolePermissions: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetRolePermissions", "sql", selectPermissionsWhereRole, "role_id", roleID)
+	}
+
+	return permissions, nil
+}
@@ -0,0 +1 @@
+SELECT permission FROM permissions WHERE role_id = ?
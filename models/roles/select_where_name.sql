@@ -0,0 +1 @@
+SELECT id, name FROM roles WHERE name = ? LIMIT 1
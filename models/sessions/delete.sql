@@ -0,0 +1 @@
+DELETE FROM sessions WHERE id = ?
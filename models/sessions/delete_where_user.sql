@@ -0,0 +1 @@
+DELETE FROM sessions WHERE user_id = ?
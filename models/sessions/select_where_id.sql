@@ -0,0 +1 @@
+SELECT id, user_id, created_at, last_seen_at, expires_at FROM sessions WHERE id = ? LIMIT 1
@@ -0,0 +1,127 @@
+package sessions
+
+import (
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/models"
+)
+
+// Session is a login of a user. The ID is the sha256 hash of the token
+// stored in the cookie, so the cookie can't be recreated from the database.
+type Session struct {
+	ID         string
+	UserID     uint64
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+}
+
+//go:embed insert.sql
+var insert string
+
+func CreateSession(env *models.Env, session Session) error {
+	_, err := env.DB.ExecContext(env.Ctx, insert, session.ID, session.UserID, session.CreatedAt, session.LastSeenAt, session.ExpiresAt)
+	if err != nil {
+		env.Logger.Error("models: CreateSession", "error", err, "sql", insert, "user_id", session.UserID)
+		return fmt.Errorf("CreateSession: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: CreateSession", "sql", insert, "user_id", session.UserID)
+	}
+
+	return nil
+}
+
+//go:embed select_where_id.sql
+var selectWhereID string
+
+func GetSessionByID(env *models.Env, id string) (Session, error) {
+	var session Session
+	err := env.DB.QueryRowContext(env.Ctx, selectWhereID, id).Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return Session{}, fmt.Errorf("GetSessionByID: session not found")
+	}
+	if err != nil {
+		env.Logger.Error("models: GetSessionByID", "error", err, "sql", selectWhereID)
+		return Session{}, fmt.Errorf("GetSessionByID: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetSessionByID", "sql", selectWhereID)
+	}
+
+	return session, nil
+}
+
+//go:embed update_last_seen.sql
+var updateLastSeen string
+
+func TouchSession(env *models.Env, id string, lastSeenAt time.Time) error {
+	_, err := env.DB.ExecContext(env.Ctx, updateLastSeen, lastSeenAt, id)
+	if err != nil {
+		env.Logger.Error("models: TouchSession", "error", err, "sql", updateLastSeen)
+		return fmt.Errorf("TouchSession: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: TouchSession", "sql", updateLastSeen)
+	}
+
+	return nil
+}
+
+//go:embed delete.sql
+var deleteSession string
+
+func DeleteSession(env *models.Env, id string) error {
+	_, err := env.DB.ExecContext(env.Ctx, deleteSession, id)
+	if err != nil {
+		env.Logger.Error("models: DeleteSession", "error", err, "sql", deleteSession)
+		return fmt.Errorf("DeleteSession: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: DeleteSession", "sql", deleteSession)
+	}
+
+	return nil
+}
+
+//go:embed delete_where_user.sql
+var deleteWhereUser string
+
+// DeleteUserSessions logs the user out everywhere
+func DeleteUserSessions(env *models.Env, userID uint64) error {
+	_, err := env.DB.ExecContext(env.Ctx, deleteWhereUser, userID)
+	if err != nil {
+		env.Logger.Error("models: DeleteUserSessions", "error", err, "sql", deleteWhereUser, "user_id", userID)
+		return fmt.Errorf("DeleteUserSessions: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: DeleteUserSessions", "sql", deleteWhereUser, "user_id", userID)
+	}
+
+	return nil
+}
+
+//go:embed delete_expired.sql
+var deleteExpired string
+
+// DeleteExpiredSessions removes sessions past their absolute expiry or idle since before idleSince
+func DeleteExpiredSessions(env *models.Env, now time.Time, idleSince time.Time) error {
+	_, err := env.DB.ExecContext(env.Ctx, deleteExpired, now, idleSince)
+	if err != nil {
+		env.Logger.Error("models: DeleteExpiredSessions", "error", err, "sql", deleteExpired)
+		return fmt.Errorf("DeleteExpiredSessions: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: DeleteExpiredSessions", "sql", deleteExpired)
+	}
+
+	return nil
+}
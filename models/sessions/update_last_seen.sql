@@ -0,0 +1 @@
+UPDATE sessions SET last_seen_at = ? WHERE id = ?
@@ -0,0 +1,220 @@
+// Package settings holds the site wide settings that admins change at runtime.
+// Every setting is listed in the Registry with its default and how it is validated,
+// the typed Settings are built from it.
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	// the time zones are embedded, so that they don't depend on the system the binary runs on
+	_ "time/tzdata"
+)
+
+var ErrInvalid = errors.New("invalid setting")
+
+// Comment policies
+const (
+	CommentsModerated  = "moderated"  // anyone may comment, comments wait for approval
+	CommentsRegistered = "registered" // only logged in users may comment, comments wait for approval
+	CommentsOpen       = "open"       // anyone may comment, comments are shown at once
+	CommentsClosed     = "closed"     // nobody may comment
+)
+
+// commentPolicies are the valid values of the comment_policy setting
+var commentPolicies = []string{CommentsModerated, CommentsRegistered, CommentsOpen, CommentsClosed}
+
+// Settings are the typed values of all settings
+type Settings struct {
+	SiteTitle       string
+	SiteDescription string
+	ArticlesPerPage int
+	CommentPolicy   string
+	Timezone        *time.Location
+	FeedFullContent bool
+	AuditRetention  time.Duration // 0 keeps the audit log forever
+}
+
+// Kind tells the admin page which input to show for a setting
+type Kind string
+
+const (
+	Text   Kind = "text"
+	Number Kind = "number"
+	Bool   Kind = "bool"
+	Select Kind = "select"
+)
+
+// Setting describes a setting. apply validates a value and sets it on Settings.
+type Setting struct {
+	Key     string
+	Label   string
+	Help    string
+	Kind    Kind
+	Options []string // the values of a Select
+	Default string
+	apply   func(s *Settings, value string) error
+}
+
+// Registry lists all settings in the order of the admin page
+var Registry = []Setting{
+	{
+		Key:     "site_title",
+		Label:   "Site title",
+		Help:    "Shown in the title of every page and in the feeds.",
+		Kind:    Text,
+		Default: "Go-SQLite-Blog",
+		apply: func(s *Settings, value string) error {
+			value, err := text(value, 1, 100)
+			if err != nil {
+				return err
+			}
+			s.SiteTitle = value
+			return nil
+		},
+	},
+	{
+		Key:   "site_description",
+		Label: "Site description",
+		Help:  "Used as the meta description of the pages and in the feeds.",
+		Kind:  Text,
+		apply: func(s *Settings, value string) error {
+			value, err := text(value, 0, 300)
+			if err != nil {
+				return err
+			}
+			s.SiteDescription = value
+			return nil
+		},
+	},
+	{
+		Key:     "articles_per_page",
+		Label:   "Articles per page",
+		Help:    "The number of articles on each page of the article lists and archives, 1 to 100.",
+		Kind:    Number,
+		Default: "10",
+		apply: func(s *Settings, value string) error {
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || n < 1 || n > 100 {
+				return fmt.Errorf("%w: %q is no number from 1 to 100", ErrInvalid, value)
+			}
+			s.ArticlesPerPage = n
+			return nil
+		},
+	},
+	{
+		Key:     "comment_policy",
+		Label:   "Comments",
+		Help:    "moderated: anyone may comment after approval, registered: only logged in users after approval, open: anyone without approval, closed: no new comments.",
+		Kind:    Select,
+		Options: commentPolicies,
+		Default: CommentsModerated,
+		apply: func(s *Settings, value string) error {
+			if !slices.Contains(commentPolicies, value) {
+				return fmt.Errorf("%w: unknown comment policy %q", ErrInvalid, value)
+			}
+			s.CommentPolicy = value
+			return nil
+		},
+	},
+	{
+		Key:     "timezone",
+		Label:   "Time zone",
+		Help:    "Dates are shown in this time zone, for example Europe/Berlin.",
+		Kind:    Text,
+		Default: "UTC",
+		apply: func(s *Settings, value string) error {
+			value = strings.TrimSpace(value)
+			// LoadLocation treats "" as UTC and "Local" as the zone of the server
+			if value == "" || value == "Local" {
+				return fmt.Errorf("%w: unknown time zone %q", ErrInvalid, value)
+			}
+			location, err := time.LoadLocation(value)
+			if err != nil {
+				return fmt.Errorf("%w: unknown time zone %q", ErrInvalid, value)
+			}
+			s.Timezone = location
+			return nil
+		},
+	},
+	{
+		Key:     "feed_full_content",
+		Label:   "Full articles in feeds",
+		Help:    "Feeds contain the full articles instead of only the summaries.",
+		Kind:    Bool,
+		Default: "false",
+		apply: func(s *Settings, value string) error {
+			full, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%w: %q is neither true nor false", ErrInvalid, value)
+			}
+			s.FeedFullContent = full
+			return nil
+		},
+	},
+	{
+		Key:     "audit_retention_days",
+		Label:   "Keep the audit log for days",
+		Help:    "Older entries are deleted, 0 keeps them forever.",
+		Kind:    Number,
+		Default: "90",
+		apply: func(s *Settings, value string) error {
+			days, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || days < 0 || days > 3650 {
+				return fmt.Errorf("%w: %q is no number from 0 to 3650", ErrInvalid, value)
+			}
+			s.AuditRetention = time.Duration(days) * 24 * time.Hour
+			return nil
+		},
+	},
+}
+
+// text trims value and checks that its length is from min to max characters
+func text(value string, min, max int) (string, error) {
+	value = strings.TrimSpace(value)
+	length := utf8.RuneCountInString(value)
+	if length < min {
+		return value, fmt.Errorf("%w: a value is required", ErrInvalid)
+	}
+	if length > max {
+		return value, fmt.Errorf("%w: longer than %d characters", ErrInvalid, max)
+	}
+	return value, nil
+}
+
+// Defaults returns the settings with the default values
+func Defaults() Settings {
+	var s Settings
+	for _, setting := range Registry {
+		if err := setting.apply(&s, setting.Default); err != nil {
+			panic(fmt.Sprintf("settings: invalid default of %s: %v", setting.Key, err))
+		}
+	}
+	return s
+}
+
+// Validate checks the values by key in the order of the Registry and returns the first
+// invalid one. Unknown keys are invalid too.
+func Validate(values map[string]string) error {
+	for key := range values {
+		if !slices.ContainsFunc(Registry, func(setting Setting) bool { return setting.Key == key }) {
+			return fmt.Errorf("Validate: %w: unknown key %q", ErrInvalid, key)
+		}
+	}
+	var s Settings
+	for _, setting := range Registry {
+		value, ok := values[setting.Key]
+		if !ok {
+			continue
+		}
+		if err := setting.apply(&s, value); err != nil {
+			return fmt.Errorf("Validate: %s: %w", setting.Label, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1 @@
+SELECT key, value FROM settings
\ No newline at end of file
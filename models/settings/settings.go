@@ -0,0 +1,92 @@
+package settings
+
+import (
+	_ "embed"
+	"fmt"
+
+	"github.com/AndreHeber/go-sqlite-blog/models"
+)
+
+//go:embed select.sql
+var selectAll string
+
+// GetValues returns the stored values by key, settings that were never saved are missing
+func GetValues(env *models.Env) (map[string]string, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectAll)
+	if err != nil {
+		env.Logger.Error("models: GetValues", "error", err, "sql", selectAll)
+		return nil, fmt.Errorf("GetValues: %w", err)
+	}
+	defer rows.Close()
+
+	values := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		err = rows.Scan(&key, &value)
+		if err != nil {
+			return nil, fmt.Errorf("GetValues: %w", err)
+		}
+		values[key] = value
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetValues: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetValues", "sql", selectAll)
+	}
+
+	return values, nil
+}
+
+//go:embed upsert.sql
+var upsert string
+
+// SaveValues stores the values by key in one transaction
+func SaveValues(env *models.Env, values map[string]string) error {
+	tx, err := env.DB.BeginTx(env.Ctx, nil)
+	if err != nil {
+		return fmt.Errorf("SaveValues: %w", err)
+	}
+	defer tx.Rollback()
+
+	for key, value := range values {
+		_, err = tx.ExecContext(env.Ctx, upsert, key, value)
+		if err != nil {
+			env.Logger.Error("models: SaveValues", "error", err, "sql", upsert, "key", key)
+			return fmt.Errorf("SaveValues: %w", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("SaveValues: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: SaveValues", "sql", upsert, "count", len(values))
+	}
+
+	return nil
+}
+
+// Load returns the settings with the stored values. A stored value that is no longer valid,
+// for example a removed time zone, is logged and replaced by the default.
+func Load(env *models.Env) (Settings, error) {
+	values, err := GetValues(env)
+	if err != nil {
+		return Settings{}, fmt.Errorf("Load: %w", err)
+	}
+
+	s := Defaults()
+	for _, setting := range Registry {
+		value, ok := values[setting.Key]
+		if !ok {
+			continue
+		}
+		err = setting.apply(&s, value)
+		if err != nil {
+			env.Logger.Warn("models: Load", "warning", "invalid setting, using the default", "key", setting.Key, "value", value, "error", err)
+		}
+	}
+	return s, nil
+}
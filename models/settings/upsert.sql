@@ -0,0 +1,2 @@
+INSERT INTO settings (key, value) VALUES (?, ?)
+ON CONFLICT (key) DO UPDATE SET value = excluded.value
\ No newline at end of file
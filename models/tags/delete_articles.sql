@@ -0,0 +1 @@
+DELETE FROM article_tags WHERE tag_id = ?
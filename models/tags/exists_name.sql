@@ -0,0 +1 @@
+SELECT EXISTS(SELECT 1 FROM tags WHERE name = ? COLLATE NOCASE AND id != ?)
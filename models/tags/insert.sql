@@ -0,0 +1 @@
+INSERT INTO tags (name, slug) VALUES (?, ?)
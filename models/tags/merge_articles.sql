@@ -0,0 +1,2 @@
+INSERT OR IGNORE INTO article_tags (article_id, tag_id)
+SELECT article_id, ?2 FROM article_tags WHERE tag_id = ?1
@@ -0,0 +1,6 @@
+SELECT tags.id, tags.name, tags.slug, COUNT(articles.id)
+FROM tags
+LEFT JOIN article_tags ON article_tags.tag_id = tags.id
+LEFT JOIN articles ON articles.id = article_tags.article_id AND articles.published
+GROUP BY tags.id
+ORDER BY tags.name COLLATE NOCASE
@@ -0,0 +1,8 @@
+SELECT tags.id, tags.name, tags.slug, COUNT(articles.id)
+FROM tags
+LEFT JOIN article_tags ON article_tags.tag_id = tags.id
+LEFT JOIN articles ON articles.id = article_tags.article_id AND articles.published
+WHERE ? = 0 OR tags.id < ?
+GROUP BY tags.id
+ORDER BY tags.id DESC
+LIMIT ?
\ No newline at end of file
@@ -0,0 +1,5 @@
+SELECT tags.id, tags.name, tags.slug
+FROM tags
+JOIN article_tags ON article_tags.tag_id = tags.id
+WHERE article_tags.article_id = ?
+ORDER BY tags.name COLLATE NOCASE
@@ -0,0 +1,306 @@
+package tags
+
+import (
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+
+	"github.com/AndreHeber/go-sqlite-blog/models"
+)
+
+var ErrNotFound = errors.New("tag not found")
+
+type Tag struct {
+	ID    uint64
+	Name  string
+	Slug  string
+	Count int // published articles with the tag, only set by GetTags
+}
+
+func scanTags(rows *sql.Rows, withCount bool) ([]Tag, error) {
+	defer rows.Close()
+
+	var tags []Tag
+	for rows.Next() {
+		var tag Tag
+		dest := []any{&tag.ID, &tag.Name, &tag.Slug}
+		if withCount {
+			dest = append(dest, &tag.Count)
+		}
+		err := rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+//go:embed select.sql
+var selectTags string
+
+// GetTags returns all tags by name, with the number of their published articles
+func GetTags(env *models.Env) ([]Tag, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectTags)
+	if err != nil {
+		env.Logger.Error("models: GetTags", "error", err, "sql", selectTags)
+		return nil, fmt.Errorf("GetTags: %w", err)
+	}
+	tags, err := scanTags(rows, true)
+	if err != nil {
+		return nil, fmt.Errorf("GetTags: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetTags", "sql", selectTags)
+	}
+
+	return tags, nil
+}
+
+//go:embed select_before_id.sql
+var selectBeforeID string
+
+// GetTagsBefore returns the tags with an id below beforeID, or the newest if it is 0,
+// in descending order of their ids, with the number of their published articles
+func GetTagsBefore(env *models.Env, beforeID uint64, limit int) ([]Tag, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectBeforeID, beforeID, beforeID, limit)
+	if err != nil {
+		env.Logger.Error("models: GetTagsBefore", "error", err, "sql", selectBeforeID, "before_id", beforeID)
+		return nil, fmt.Errorf("GetTagsBefore: %w", err)
+	}
+	tags, err := scanTags(rows, true)
+	if err != nil {
+		return nil, fmt.Errorf("GetTagsBefore: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetTagsBefore", "sql", selectBeforeID, "before_id", beforeID, "limit", limit)
+	}
+
+	return tags, nil
+}
+
+//go:embed select_where_slug.sql
+var selectWhereSlug string
+
+func GetTagBySlug(env *models.Env, slug string) (Tag, error) {
+	var tag Tag
+	err := env.DB.QueryRowContext(env.Ctx, selectWhereSlug, slug).Scan(&tag.ID, &tag.Name, &tag.Slug)
+	if err == sql.ErrNoRows {
+		return Tag{}, fmt.Errorf("GetTagBySlug: %w", ErrNotFound)
+	}
+	if err != nil {
+		env.Logger.Error("models: GetTagBySlug", "error", err, "sql", selectWhereSlug, "slug", slug)
+		return Tag{}, fmt.Errorf("GetTagBySlug: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetTagBySlug", "sql", selectWhereSlug, "slug", slug)
+	}
+
+	return tag, nil
+}
+
+//go:embed select_where_id.sql
+var selectWhereID string
+
+func GetTagByID(env *models.Env, id uint64) (Tag, error) {
+	var tag Tag
+	err := env.DB.QueryRowContext(env.Ctx, selectWhereID, id).Scan(&tag.ID, &tag.Name, &tag.Slug)
+	if err == sql.ErrNoRows {
+		return Tag{}, fmt.Errorf("GetTagByID: %w", ErrNotFound)
+	}
+	if err != nil {
+		env.Logger.Error("models: GetTagByID", "error", err, "sql", selectWhereID, "id", id)
+		return Tag{}, fmt.Errorf("GetTagByID: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetTagByID", "sql", selectWhereID, "id", id)
+	}
+
+	return tag, nil
+}
+
+//go:embed select_where_article.sql
+var selectWhereArticle string
+
+// GetArticleTags returns the tags of an article by name
+func GetArticleTags(env *models.Env, articleID uint64) ([]Tag, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectWhereArticle, articleID)
+	if err != nil {
+		env.Logger.Error("models: GetArticleTags", "error", err, "sql", selectWhereArticle, "article_id", articleID)
+		return nil, fmt.Errorf("GetArticleTags: %w", err)
+	}
+	tags, err := scanTags(rows, false)
+	if err != nil {
+		return nil, fmt.Errorf("GetArticleTags: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetArticleTags", "sql", selectWhereArticle, "article_id", articleID)
+	}
+
+	return tags, nil
+}
+
+//go:embed exists_slug.sql
+var existsSlug string
+
+// SlugExists reports whether a tag other than excludeID uses the slug
+func SlugExists(env *models.Env, slug string, excludeID uint64) (bool, error) {
+	var exists bool
+	err := env.DB.QueryRowContext(env.Ctx, existsSlug, slug, excludeID).Scan(&exists)
+	if err != nil {
+		env.Logger.Error("models: SlugExists", "error", err, "sql", existsSlug, "slug", slug)
+		return false, fmt.Errorf("SlugExists: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: SlugExists", "sql", existsSlug, "slug", slug)
+	}
+
+	return exists, nil
+}
+
+//go:embed exists_name.sql
+var existsName string
+
+// NameExists reports whether a tag other than excludeID has the name, ignoring case
+func NameExists(env *models.Env, name string, excludeID uint64) (bool, error) {
+	var exists bool
+	err := env.DB.QueryRowContext(env.Ctx, existsName, name, excludeID).Scan(&exists)
+	if err != nil {
+		env.Logger.Error("models: NameExists", "error", err, "sql", existsName, "name", name)
+		return false, fmt.Errorf("NameExists: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: NameExists", "sql", existsName, "name", name)
+	}
+
+	return exists, nil
+}
+
+//go:embed insert.sql
+var insert string
+
+// CreateTag saves a new tag and returns its id
+func CreateTag(env *models.Env, tag Tag) (uint64, error) {
+	result, err := env.DB.ExecContext(env.Ctx, insert, tag.Name, tag.Slug)
+	if err != nil {
+		env.Logger.Error("models: CreateTag", "error", err, "sql", insert, "slug", tag.Slug)
+		return 0, fmt.Errorf("CreateTag: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("CreateTag: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: CreateTag", "sql", insert, "slug", tag.Slug)
+	}
+
+	return uint64(id), nil
+}
+
+//go:embed update.sql
+var update string
+
+func UpdateTag(env *models.Env, tag Tag) error {
+	_, err := env.DB.ExecContext(env.Ctx, update, tag.Name, tag.Slug, tag.ID)
+	if err != nil {
+		env.Logger.Error("models: UpdateTag", "error", err, "sql", update, "id", tag.ID)
+		return fmt.Errorf("UpdateTag: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: UpdateTag", "sql", update, "id", tag.ID)
+	}
+
+	return nil
+}
+
+//go:embed delete_articles.sql
+var deleteArticles string
+
+//go:embed delete.sql
+var deleteTag string
+
+// DeleteTag removes the tag from its articles and deletes it
+func DeleteTag(env *models.Env, id uint64) error {
+	tx, err := env.DB.BeginTx(env.Ctx, nil)
+	if err != nil {
+		return fmt.Errorf("DeleteTag: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{deleteArticles, deleteTag} {
+		_, err = tx.ExecContext(env.Ctx, query, id)
+		if err != nil {
+			env.Logger.Error("models: DeleteTag", "error", err, "sql", query, "id", id)
+			return fmt.Errorf("DeleteTag: %w", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("DeleteTag: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: DeleteTag", "sql", deleteArticles+";\n"+deleteTag, "id", id)
+	}
+
+	return nil
+}
+
+//go:embed select_where_name.sql
+var selectWhereName string
+
+// GetTagByName returns the tag with the name, ignoring case
+func GetTagByName(env *models.Env, name string) (Tag, error) {
+	var tag Tag
+	err := env.DB.QueryRowContext(env.Ctx, selectWhereName, name).Scan(&tag.ID, &tag.Name, &tag.Slug)
+	if err == sql.ErrNoRows {
+		return Tag{}, fmt.Errorf("GetTagByName: %w", ErrNotFound)
+	}
+	if err != nil {
+		env.Logger.Error("models: GetTagByName", "error", err, "sql", selectWhereName, "name", name)
+		return Tag{}, fmt.Errorf("GetTagByName: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetTagByName", "sql", selectWhereName, "name", name)
+	}
+
+	return tag, nil
+}
+
+//go:embed merge_articles.sql
+var mergeArticles string
+
+// MergeTags moves the articles of the tag fromID to the tag intoID and deletes the tag fromID
+func MergeTags(env *models.Env, fromID, intoID uint64) error {
+	tx, err := env.DB.BeginTx(env.Ctx, nil)
+	if err != nil {
+		return fmt.Errorf("MergeTags: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(env.Ctx, mergeArticles, fromID, intoID)
+	if err != nil {
+		env.Logger.Error("models: MergeTags", "error", err, "sql", mergeArticles, "from", fromID, "into", intoID)
+		return fmt.Errorf("MergeTags: %w", err)
+	}
+	for _, query := range []string{deleteArticles, deleteTag} {
+		_, err = tx.ExecContext(env.Ctx, query, fromID)
+		if err != nil {
+			env.Logger.Error("models: MergeTags", "error", err, "sql", query, "from", fromID)
+			return fmt.Errorf("MergeTags: %w", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("MergeTags: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: MergeTags", "sql", mergeArticles+";\n"+deleteArticles+";\n"+deleteTag, "from", fromID, "into", intoID)
+	}
+
+	return nil
+}
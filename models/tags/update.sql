@@ -0,0 +1 @@
+UPDATE tags SET name = ?, slug = ? WHERE id = ?
@@ -0,0 +1 @@
+DELETE FROM templates WHERE name = ?
@@ -0,0 +1 @@
+SELECT id, name, content FROM templates ORDER BY name
@@ -0,0 +1,82 @@
+package templates
+
+import (
+	_ "embed"
+	"fmt"
+
+	"github.com/AndreHeber/go-sqlite-blog/models"
+)
+
+// Template is a html/template template that replaces the default of the same name
+type Template struct {
+	ID      uint64
+	Name    string
+	Content string
+}
+
+//go:embed select.sql
+var selectTemplates string
+
+// GetTemplates returns all templates stored in the database by name
+func GetTemplates(env *models.Env) ([]Template, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectTemplates)
+	if err != nil {
+		env.Logger.Error("models: GetTemplates", "error", err, "sql", selectTemplates)
+		return nil, fmt.Errorf("GetTemplates: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Template
+	for rows.Next() {
+		var template Template
+		err = rows.Scan(&template.ID, &template.Name, &template.Content)
+		if err != nil {
+			return nil, fmt.Errorf("GetTemplates: %w", err)
+		}
+		list = append(list, template)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetTemplates: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetTemplates", "sql", selectTemplates)
+	}
+
+	return list, nil
+}
+
+//go:embed upsert.sql
+var upsert string
+
+// SaveTemplate creates the template or replaces the content of the one with the same name
+func SaveTemplate(env *models.Env, name, content string) error {
+	_, err := env.DB.ExecContext(env.Ctx, upsert, name, content)
+	if err != nil {
+		env.Logger.Error("models: SaveTemplate", "error", err, "sql", upsert, "name", name)
+		return fmt.Errorf("SaveTemplate: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: SaveTemplate", "sql", upsert, "name", name)
+	}
+
+	return nil
+}
+
+//go:embed delete.sql
+var deleteTemplate string
+
+// DeleteTemplate deletes the template, its default is used again
+func DeleteTemplate(env *models.Env, name string) error {
+	_, err := env.DB.ExecContext(env.Ctx, deleteTemplate, name)
+	if err != nil {
+		env.Logger.Error("models: DeleteTemplate", "error", err, "sql", deleteTemplate, "name", name)
+		return fmt.Errorf("DeleteTemplate: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: DeleteTemplate", "sql", deleteTemplate, "name", name)
+	}
+
+	return nil
+}
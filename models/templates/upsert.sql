@@ -0,0 +1,2 @@
+INSERT INTO templates (name, content) VALUES (?, ?)
+ON CONFLICT (name) DO UPDATE SET content = excluded.content
@@ -0,0 +1 @@
+DELETE FROM user_tokens WHERE id = ? AND purpose = ? RETURNING id, user_id, purpose, created_at, expires_at
@@ -0,0 +1 @@
+DELETE FROM user_tokens WHERE user_id = ? AND purpose = ?
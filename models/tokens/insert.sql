@@ -0,0 +1 @@
+INSERT INTO user_tokens (id, user_id, purpose, created_at, expires_at) VALUES (?, ?, ?, ?, ?)
@@ -0,0 +1,92 @@
+package tokens
+
+import (
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AndreHeber/go-sqlite-blog/models"
+)
+
+// Purpose separates tokens, so a token sent for one flow can't be used in another
+type Purpose string
+
+const (
+	EmailVerification Purpose = "email_verification"
+	PasswordReset     Purpose = "password_reset"
+)
+
+var ErrInvalid = errors.New("token is invalid or expired")
+
+// Token is a single use token sent to a user. The ID is the sha256 of the token,
+// the token itself is only known to the recipient.
+type Token struct {
+	ID        string
+	UserID    uint64
+	Purpose   Purpose
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+//go:embed insert.sql
+var insert string
+
+func CreateToken(env *models.Env, token Token) error {
+	_, err := env.DB.ExecContext(env.Ctx, insert, token.ID, token.UserID, token.Purpose, token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		env.Logger.Error("models: CreateToken", "error", err, "sql", insert, "user_id", token.UserID, "purpose", token.Purpose)
+		return fmt.Errorf("CreateToken: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: CreateToken", "sql", insert, "user_id", token.UserID, "purpose", token.Purpose)
+	}
+
+	return nil
+}
+
+//go:embed delete_returning.sql
+var deleteReturning string
+
+// ConsumeToken deletes the token and returns it, so it can be used only once.
+// Expired tokens are deleted as well, but return ErrInvalid.
+func ConsumeToken(env *models.Env, id string, purpose Purpose, now time.Time) (Token, error) {
+	var token Token
+	err := env.DB.QueryRowContext(env.Ctx, deleteReturning, id, purpose).Scan(&token.ID, &token.UserID, &token.Purpose, &token.CreatedAt, &token.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return Token{}, fmt.Errorf("ConsumeToken: %w", ErrInvalid)
+	}
+	if err != nil {
+		env.Logger.Error("models: ConsumeToken", "error", err, "sql", deleteReturning, "purpose", purpose)
+		return Token{}, fmt.Errorf("ConsumeToken: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: ConsumeToken", "sql", deleteReturning, "purpose", purpose)
+	}
+
+	if now.After(token.ExpiresAt) {
+		return Token{}, fmt.Errorf("ConsumeToken: %w", ErrInvalid)
+	}
+
+	return token, nil
+}
+
+//go:embed delete_where_user.sql
+var deleteWhereUser string
+
+// DeleteUserTokens invalidates all tokens of the user for the purpose
+func DeleteUserTokens(env *models.Env, userID uint64, purpose Purpose) error {
+	_, err := env.DB.ExecContext(env.Ctx, deleteWhereUser, userID, purpose)
+	if err != nil {
+		env.Logger.Error("models: DeleteUserTokens", "error", err, "sql", deleteWhereUser, "user_id", userID, "purpose", purpose)
+		return fmt.Errorf("DeleteUserTokens: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: DeleteUserTokens", "sql", deleteWhereUser, "user_id", userID, "purpose", purpose)
+	}
+
+	return nil
+}
@@ -1 +1,3 @@
-INSERT INTO users (username, password_hash, salt, email, verified, role_id, created_at, last_login) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+INSERT INTO users (username, password_hash, salt, email, verified, role_id, created_at, last_login)
+SELECT ?, ?, ?, ?, ?, CASE WHEN EXISTS (SELECT 1 FROM users) THEN ? ELSE ? END, ?, ?
+RETURNING id, role_id
\ No newline at end of file
@@ -1,11 +0,0 @@
-CREATE TABLE IF NOT EXISTS users (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    username TEXT NOT NULL UNIQUE,
-    password_hash TEXT NOT NULL,
-    email TEXT NOT NULL UNIQUE,
-    verified BOOLEAN NOT NULL DEFAULT FALSE,
-    role_id INTEGER NOT NULL DEFAULT 1,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    last_login TIMESTAMP,
-    FOREIGN KEY(role_id) REFERENCES roles(id)
-);
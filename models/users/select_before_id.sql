@@ -0,0 +1 @@
+SELECT id, username, password_hash, salt, email, verified, role_id, created_at, last_login FROM users WHERE ? = 0 OR id < ? ORDER BY id DESC LIMIT ?
\ No newline at end of file
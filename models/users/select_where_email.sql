@@ -0,0 +1 @@
+SELECT * FROM users WHERE email = ? LIMIT 1
\ No newline at end of file
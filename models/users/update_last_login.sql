@@ -0,0 +1 @@
+UPDATE users SET last_login = ? WHERE id = ?
@@ -0,0 +1 @@
+UPDATE users SET password_hash = ?, salt = ? WHERE id = ?
@@ -0,0 +1 @@
+UPDATE users SET role_id = ? WHERE id = ?
@@ -0,0 +1 @@
+UPDATE users SET verified = ? WHERE id = ?
@@ -24,18 +24,21 @@ type User struct {
 //go:embed insert.sql
 var insert string
 
-func CreateUser(env *models.Env, user User) error {
-	_, err := env.DB.ExecContext(env.Ctx, insert, user.Username, user.HashedPassword, user.Salt, user.Email, user.Verified, user.RoleID, user.CreatedAt, user.LastLogin)
+// CreateUser saves a new user and returns its id and role. The first user gets the role
+// firstRoleID instead of user.RoleID, in the same statement, so of concurrent
+// registrations only one can be the first.
+func CreateUser(env *models.Env, user User, firstRoleID uint64) (id uint64, roleID uint64, err error) {
+	err = env.DB.QueryRowContext(env.Ctx, insert, user.Username, user.HashedPassword, user.Salt, user.Email, user.Verified, user.RoleID, firstRoleID, user.CreatedAt, user.LastLogin).Scan(&id, &roleID)
 	if err != nil {
 		env.Logger.Error("models: CreateUser", "error", err, "sql", insert, "user", user)
-		return fmt.Errorf("CreateUser: %w", err)
+		return 0, 0, fmt.Errorf("CreateUser: %w", err)
 	}
 
 	if env.LogDBQueries {
 		env.Logger.Info("models: CreateUser", "sql", insert, "user", user)
 	}
 
-	return nil
+	return id, roleID, nil
 }
 
 //go:embed select_where_username.sql
@@ -57,3 +60,168 @@ func GetUserByUsername(env *models.Env, username string) (User, error) {
 
 	return user, nil
 }
+
+//go:embed select_where_id.sql
+var selectWhereID string
+
+func GetUserByID(env *models.Env, id uint64) (User, error) {
+	var user User
+	err := env.DB.QueryRowContext(env.Ctx, selectWhereID, id).Scan(&user.ID, &user.Username, &user.HashedPassword, &user.Salt, &user.Email, &user.Verified, &user.RoleID, &user.CreatedAt, &user.LastLogin)
+	if err == sql.ErrNoRows {
+		return User{}, fmt.Errorf("GetUserByID: user not found")
+	}
+	if err != nil {
+		env.Logger.Error("models: GetUserByID", "error", err, "sql", selectWhereID, "id", id)
+		return User{}, fmt.Errorf("GetUserByID: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetUserByID", "sql", selectWhereID, "id", id)
+	}
+
+	return user, nil
+}
+
+//go:embed update_last_login.sql
+var updateLastLogin string
+
+func UpdateLastLogin(env *models.Env, id uint64, lastLogin time.Time) error {
+	_, err := env.DB.ExecContext(env.Ctx, updateLastLogin, lastLogin, id)
+	if err != nil {
+		env.Logger.Error("models: UpdateLastLogin", "error", err, "sql", updateLastLogin, "id", id)
+		return fmt.Errorf("UpdateLastLogin: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: UpdateLastLogin", "sql", updateLastLogin, "id", id)
+	}
+
+	return nil
+}
+
+func scanUsers(rows *sql.Rows) ([]User, error) {
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		err := rows.Scan(&user.ID, &user.Username, &user.HashedPassword, &user.Salt, &user.Email, &user.Verified, &user.RoleID, &user.CreatedAt, &user.LastLogin)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+//go:embed select.sql
+var selectUsers string
+
+func GetUsers(env *models.Env) ([]User, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectUsers)
+	if err != nil {
+		env.Logger.Error("models: GetUsers", "error", err, "sql", selectUsers)
+		return nil, fmt.Errorf("GetUsers: %w", err)
+	}
+	users, err := scanUsers(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetUsers: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetUsers", "sql", selectUsers)
+	}
+
+	return users, nil
+}
+
+//go:embed select_before_id.sql
+var selectBeforeID string
+
+// GetUsersBefore returns the users with an id below beforeID, or the newest if it is 0,
+// in descending order of their ids
+func GetUsersBefore(env *models.Env, beforeID uint64, limit int) ([]User, error) {
+	rows, err := env.DB.QueryContext(env.Ctx, selectBeforeID, beforeID, beforeID, limit)
+	if err != nil {
+		env.Logger.Error("models: GetUsersBefore", "error", err, "sql", selectBeforeID, "before_id", beforeID)
+		return nil, fmt.Errorf("GetUsersBefore: %w", err)
+	}
+	users, err := scanUsers(rows)
+	if err != nil {
+		return nil, fmt.Errorf("GetUsersBefore: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetUsersBefore", "sql", selectBeforeID, "before_id", beforeID, "limit", limit)
+	}
+
+	return users, nil
+}
+
+//go:embed update_role.sql
+var updateRole string
+
+func UpdateRole(env *models.Env, id uint64, roleID uint64) error {
+	_, err := env.DB.ExecContext(env.Ctx, updateRole, roleID, id)
+	if err != nil {
+		env.Logger.Error("models: UpdateRole", "error", err, "sql", updateRole, "id", id, "role_id", roleID)
+		return fmt.Errorf("UpdateRole: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: UpdateRole", "sql", updateRole, "id", id, "role_id", roleID)
+	}
+
+	return nil
+}
+
+//go:embed select_where_email.sql
+var selectWhereEmail string
+
+func GetUserByEmail(env *models.Env, email string) (User, error) {
+	var user User
+	err := env.DB.QueryRowContext(env.Ctx, selectWhereEmail, email).Scan(&user.ID, &user.Username, &user.HashedPassword, &user.Salt, &user.Email, &user.Verified, &user.RoleID, &user.CreatedAt, &user.LastLogin)
+	if err == sql.ErrNoRows {
+		return User{}, fmt.Errorf("GetUserByEmail: user not found")
+	}
+	if err != nil {
+		env.Logger.Error("models: GetUserByEmail", "error", err, "sql", selectWhereEmail)
+		return User{}, fmt.Errorf("GetUserByEmail: %w", err)
+	}
+	if env.LogDBQueries {
+		env.Logger.Info("models: GetUserByEmail", "sql", selectWhereEmail)
+	}
+
+	return user, nil
+}
+
+//go:embed update_verified.sql
+var updateVerified string
+
+func UpdateVerified(env *models.Env, id uint64, verified bool) error {
+	_, err := env.DB.ExecContext(env.Ctx, updateVerified, verified, id)
+	if err != nil {
+		env.Logger.Error("models: UpdateVerified", "error", err, "sql", updateVerified, "id", id)
+		return fmt.Errorf("UpdateVerified: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: UpdateVerified", "sql", updateVerified, "id", id)
+	}
+
+	return nil
+}
+
+//go:embed update_password.sql
+var updatePassword string
+
+func UpdatePassword(env *models.Env, id uint64, hashedPassword, salt string) error {
+	_, err := env.DB.ExecContext(env.Ctx, updatePassword, hashedPassword, salt, id)
+	if err != nil {
+		env.Logger.Error("models: UpdatePassword", "error", err, "sql", updatePassword, "id", id)
+		return fmt.Errorf("UpdatePassword: %w", err)
+	}
+
+	if env.LogDBQueries {
+		env.Logger.Info("models: UpdatePassword", "sql", updatePassword, "id", id)
+	}
+
+	return nil
+}
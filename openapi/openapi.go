@@ -0,0 +1,367 @@
+// Package openapi builds an OpenAPI 3.1 document from a table of routes. The schemas
+// of request and response bodies are derived from their Go types by reflection, so the
+// document follows the code.
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Version is the version of the OpenAPI specification the document follows
+const Version = "3.1.0"
+
+// Route describes a route of the API
+type Route struct {
+	Method     string
+	Path       string // the pattern of the ServeMux, e.g. /api/v1/articles/{slug}
+	Summary    string
+	Permission string // the permission the route needs, empty if it has none
+	Login      bool   // the route needs a logged in user, implied by Permission
+	Request    any    // a value of the type of the JSON body, nil for none
+	Response   any    // a value of the type of the answer, nil for no content
+	List       bool   // the answer is a page of a list of Response items
+	Status     int    // the status code of success, 200 if 0
+	ETag       bool   // the answer carries an ETag
+	IfMatch    bool   // requests need an If-Match header
+}
+
+// Schema is a JSON Schema, as far as the document needs it
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 any                `json:"type,omitempty"` // a name or a list of names
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"` // path, query or header
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Operation struct {
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// Document is an OpenAPI document, paths map to the operations by lower case method
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+// Spec collects the routes of an API
+type Spec struct {
+	Title   string
+	Version string
+	// Error is a value of the type of the error answers
+	Error any
+	// List is a value of the envelope of list pages, its "data" property holds the items
+	List any
+	// ListParameters are the query parameters of all list routes
+	ListParameters []Parameter
+	// Parameters are the query parameters of all routes that return data
+	Parameters []Parameter
+	// SecuritySchemes are the ways to authenticate, required by routes with a login
+	SecuritySchemes map[string]SecurityScheme
+
+	routes []Route
+}
+
+// Add adds a route to the document
+func (s *Spec) Add(route Route) {
+	s.routes = append(s.routes, route)
+}
+
+// Routes returns the added routes
+func (s *Spec) Routes() []Route {
+	return s.routes
+}
+
+var pathParameter = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)(\.\.\.)?\}`)
+
+// Document builds the OpenAPI document of the added routes
+func (s *Spec) Document() Document {
+	g := generator{schemas: make(map[string]*Schema), names: make(map[reflect.Type]string)}
+	doc := Document{
+		OpenAPI: Version,
+		Info:    Info{Title: s.Title, Version: s.Version},
+		Paths:   make(map[string]map[string]*Operation),
+		Components: Components{
+			Schemas:         g.schemas,
+			SecuritySchemes: s.SecuritySchemes,
+		},
+	}
+
+	var errorResponse *Schema
+	if s.Error != nil {
+		errorResponse = g.schemaOf(reflect.TypeOf(s.Error))
+	}
+	fail := func(status int) Response {
+		response := Response{Description: http.StatusText(status)}
+		if errorResponse != nil {
+			response.Content = map[string]MediaType{"application/json": {Schema: errorResponse}}
+		}
+		return response
+	}
+
+	for _, route := range s.routes {
+		path := pathParameter.ReplaceAllString(route.Path, "{$1}")
+		op := &Operation{
+			Summary:     route.Summary,
+			OperationID: operationID(route.Method, route.Path),
+			Responses:   make(map[string]Response),
+		}
+
+		for _, match := range pathParameter.FindAllStringSubmatch(route.Path, -1) {
+			op.Parameters = append(op.Parameters, Parameter{Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+		if route.Response != nil {
+			op.Parameters = append(op.Parameters, s.Parameters...)
+		}
+		if route.List {
+			op.Parameters = append(op.Parameters, s.ListParameters...)
+		}
+		if route.IfMatch {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name:        "If-Match",
+				In:          "header",
+				Description: "the ETag of the resource, or * to overwrite it",
+				Required:    true,
+				Schema:      &Schema{Type: "string"},
+			})
+			op.Responses[strconv.Itoa(http.StatusPreconditionFailed)] = fail(http.StatusPreconditionFailed)
+			op.Responses[strconv.Itoa(http.StatusPreconditionRequired)] = fail(http.StatusPreconditionRequired)
+		}
+
+		if route.Request != nil {
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]MediaType{"application/json": {Schema: g.schemaOf(reflect.TypeOf(route.Request))}},
+			}
+			op.Responses[strconv.Itoa(http.StatusBadRequest)] = fail(http.StatusBadRequest)
+			op.Responses[strconv.Itoa(http.StatusUnsupportedMediaType)] = fail(http.StatusUnsupportedMediaType)
+		}
+
+		if route.Permission != "" || route.Login {
+			for name := range s.SecuritySchemes {
+				op.Security = append(op.Security, map[string][]string{name: {}})
+			}
+			sort.Slice(op.Security, func(i, j int) bool { return firstKey(op.Security[i]) < firstKey(op.Security[j]) })
+			op.Responses[strconv.Itoa(http.StatusUnauthorized)] = fail(http.StatusUnauthorized)
+			// also for tokens without the permission or users who don't own the resource
+			op.Responses[strconv.Itoa(http.StatusForbidden)] = fail(http.StatusForbidden)
+		}
+		if route.Permission != "" {
+			op.Description = "Needs the permission " + route.Permission + "."
+		}
+		if len(pathParameter.FindAllString(route.Path, -1)) > 0 {
+			op.Responses[strconv.Itoa(http.StatusNotFound)] = fail(http.StatusNotFound)
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := Response{Description: http.StatusText(status)}
+		if route.Response != nil {
+			schema := g.schemaOf(reflect.TypeOf(route.Response))
+			if route.List && s.List != nil {
+				schema = g.listOf(reflect.TypeOf(s.List), schema)
+			}
+			success.Content = map[string]MediaType{"application/json": {Schema: schema}}
+		}
+		if route.ETag {
+			success.Headers = map[string]Header{"ETag": {Description: "the version of the resource for If-Match", Schema: &Schema{Type: "string"}}}
+		}
+		op.Responses[strconv.Itoa(status)] = success
+		op.Responses["default"] = fail(http.StatusInternalServerError)
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*Operation)
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = op
+	}
+	return doc
+}
+
+func firstKey(m map[string][]string) string {
+	for key := range m {
+		return key
+	}
+	return ""
+}
+
+// operationID names an operation after its method and path, e.g. getApiV1ArticlesSlug
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, word := range strings.FieldsFunc(path, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
+
+// generator derives schemas from Go types, named struct types become components
+type generator struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaName is the exported name of a type, without the "api" prefix
+// of the types that only exist to shape answers, e.g. Article for apiArticle
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	if rest, ok := strings.CutPrefix(name, "api"); ok && rest != "" && unicode.IsUpper(rune(rest[0])) {
+		name = rest
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func (g *generator) schemaOf(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Pointer:
+		schema := g.schemaOf(t.Elem())
+		if schema.Ref != "" {
+			return &Schema{OneOf: []*Schema{schema, {Type: "null"}}}
+		}
+		if schema.Type == nil {
+			return schema
+		}
+		nullable := *schema
+		nullable.Type = []any{schema.Type, "null"}
+		return &nullable
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if name, ok := g.names[t]; ok {
+			return &Schema{Ref: "#/components/schemas/" + name}
+		}
+		name := schemaName(t)
+		g.names[t] = name
+		g.schemas[name] = g.structSchema(t)
+		return &Schema{Ref: "#/components/schemas/" + name}
+	default:
+		// interfaces hold any value
+		return &Schema{}
+	}
+}
+
+// structSchema lists the fields like encoding/json writes them. Fields without
+// omitempty are required, embedded structs add their fields.
+func (g *generator) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded := g.structSchema(field.Type)
+			for key, property := range embedded.Properties {
+				schema.Properties[key] = property
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = g.schemaOf(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+// listOf is the schema of the list envelope with items in its "data" property
+func (g *generator) listOf(envelope reflect.Type, items *Schema) *Schema {
+	schema := g.structSchema(envelope)
+	schema.Properties["data"] = &Schema{Type: "array", Items: items}
+	return schema
+}
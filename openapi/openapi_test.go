@@ -0,0 +1,66 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type apiItem struct {
+	ID      uint64     `json:"id"`
+	Name    string     `json:"name,omitempty"`
+	Parent  *apiItem   `json:"parent"`
+	Done    *time.Time `json:"done"`
+	private int
+}
+
+type envelope struct {
+	Data any    `json:"data"`
+	Next string `json:"next,omitempty"`
+}
+
+func TestDocument(t *testing.T) {
+	spec := Spec{Title: "test", Version: "1", List: envelope{}}
+	spec.Add(Route{Method: "GET", Path: "/items", Response: apiItem{}, List: true})
+	spec.Add(Route{Method: "PUT", Path: "/items/{id}", Login: true, Request: apiItem{}, Response: apiItem{}, IfMatch: true})
+	doc := spec.Document()
+
+	if doc.OpenAPI != Version {
+		t.Errorf("got version %q", doc.OpenAPI)
+	}
+
+	item := doc.Components.Schemas["Item"]
+	if item == nil {
+		t.Fatalf("expected the schema Item, got %v", doc.Components.Schemas)
+	}
+	if want := []string{"done", "id", "parent"}; !reflect.DeepEqual(item.Required, want) {
+		t.Errorf("got required %v, want %v", item.Required, want)
+	}
+	if _, ok := item.Properties["private"]; ok {
+		t.Error("unexported fields must not be properties")
+	}
+	if done := item.Properties["done"]; done.Format != "date-time" || !reflect.DeepEqual(done.Type, []any{"string", "null"}) {
+		t.Errorf("got done %+v", done)
+	}
+	if parent := item.Properties["parent"]; len(parent.OneOf) != 2 || parent.OneOf[0].Ref != "#/components/schemas/Item" {
+		t.Errorf("got parent %+v", parent)
+	}
+
+	list := doc.Paths["/items"]["get"].Responses["200"].Content["application/json"].Schema
+	if data := list.Properties["data"]; data.Type != "array" || data.Items.Ref != "#/components/schemas/Item" {
+		t.Errorf("got list data %+v", data)
+	}
+
+	put := doc.Paths["/items/{id}"]["put"]
+	if put.OperationID != "putItemsId" {
+		t.Errorf("got operation id %q", put.OperationID)
+	}
+	if len(put.Parameters) != 2 || put.Parameters[0].Name != "id" || put.Parameters[1].Name != "If-Match" {
+		t.Errorf("got parameters %+v", put.Parameters)
+	}
+	for _, status := range []string{"200", "400", "401", "404", "412", "415", "428"} {
+		if _, ok := put.Responses[status]; !ok {
+			t.Errorf("expected the response %s", status)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidSignature = errors.New("signing: invalid signature")
+
+// Signer signs and verifies values with HMAC-SHA256
+type Signer struct {
+	key []byte
+}
+
+func New(key []byte) *Signer {
+	return &Signer{key: key}
+}
+
+// Sign returns value followed by a dot and its base64 encoded signature
+func (s *Signer) Sign(value string) string {
+	return value + "." + base64.RawURLEncoding.EncodeToString(s.mac(value))
+}
+
+// Verify checks the signature of a value created by Sign and returns the value without it
+func (s *Signer) Verify(signed string) (string, error) {
+	i := strings.LastIndexByte(signed, '.')
+	if i < 0 {
+		return "", ErrInvalidSignature
+	}
+	value := signed[:i]
+	signature, err := base64.RawURLEncoding.DecodeString(signed[i+1:])
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	if !hmac.Equal(signature, s.mac(value)) {
+		return "", ErrInvalidSignature
+	}
+	return value, nil
+}
+
+func (s *Signer) mac(value string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(value))
+	return h.Sum(nil)
+}
+
+// RandomToken returns a random url safe token with size bytes of entropy
+func RandomToken(size int) string {
+	b := make([]byte, size)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// HashToken returns the hex encoded sha256 of a token, tokens are stored hashed in the database
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
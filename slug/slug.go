@@ -0,0 +1,56 @@
+package slug
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// replacements for common letters that have no ascii equivalent after lowercasing
+var replacements = map[rune]string{
+	'ä': "ae", 'ö': "oe", 'ü': "ue", 'ß': "ss",
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'å': "a", 'æ': "ae",
+	'ç': "c", 'è': "e", 'é': "e", 'ê': "e", 'ë': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ñ': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ø': "o", 'œ': "oe",
+	'ù': "u", 'ú': "u", 'û': "u", 'ý': "y", 'ÿ': "y",
+}
+
+// Make turns a title into a lowercase url path segment like "hello-world"
+func Make(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+			dash = false
+		case replacements[r] != "":
+			b.WriteString(replacements[r])
+			dash = false
+		case !dash && b.Len() > 0:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// Unique appends -2, -3, ... to slug until exists reports it as free
+func Unique(slug string, exists func(string) (bool, error)) (string, error) {
+	if slug == "" {
+		slug = "untitled"
+	}
+
+	candidate := slug
+	for i := 2; ; i++ {
+		taken, err := exists(candidate)
+		if err != nil {
+			return "", fmt.Errorf("Unique: %w", err)
+		}
+		if !taken {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", slug, i)
+	}
+}
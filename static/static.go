@@ -0,0 +1,36 @@
+// Package static holds the default templates and assets, they are built into the binary
+// so that it runs from any directory.
+package static
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+//go:embed templates/*.html assets
+var files embed.FS
+
+// Templates returns the default html/template templates. If dir is set, they are read from
+// its templates directory instead, so that changes show up without a new build.
+func Templates(dir string) fs.FS {
+	return sub(dir, "templates")
+}
+
+// Assets returns the CSS and other files served at /static, from the assets directory of dir if it is set
+func Assets(dir string) fs.FS {
+	return sub(dir, "assets")
+}
+
+func sub(dir, name string) fs.FS {
+	if dir != "" {
+		return os.DirFS(filepath.Join(dir, name))
+	}
+	files, err := fs.Sub(files, name)
+	if err != nil {
+		// name is one of the embedded directories above, so it is always valid
+		panic(err)
+	}
+	return files
+}
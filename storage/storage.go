@@ -0,0 +1,110 @@
+// Package storage keeps uploaded files on disk, named after the sha256 hash of their content.
+// Uploading the same file twice stores it once.
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrTooLarge    = errors.New("storage: file too large")
+	ErrInvalidPath = errors.New("storage: invalid path")
+)
+
+// Storage stores files in a directory
+type Storage struct {
+	Dir string
+}
+
+func New(dir string) Storage {
+	return Storage{Dir: dir}
+}
+
+// File is a stored file. Path is relative to the directory of the storage.
+type File struct {
+	Path string
+	Hash string
+	Size int64
+}
+
+// Save stores the content of r under ab/abcdef...<ext>, where abcdef... is its hex sha256 hash.
+// Content larger than maxSize bytes is not stored and ErrTooLarge is returned.
+func (s Storage) Save(r io.Reader, ext string, maxSize int64) (File, error) {
+	err := os.MkdirAll(s.Dir, 0o755)
+	if err != nil {
+		return File{}, fmt.Errorf("Save: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.Dir, ".upload-*")
+	if err != nil {
+		return File{}, fmt.Errorf("Save: %w", err)
+	}
+	// after the rename this only cleans up on errors
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return File{}, fmt.Errorf("Save: %w", err)
+	}
+	if size > maxSize {
+		return File{}, fmt.Errorf("Save: %w", ErrTooLarge)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return File{}, fmt.Errorf("Save: %w", err)
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	file := File{Path: filepath.ToSlash(filepath.Join(sum[:2], sum+ext)), Hash: sum, Size: size}
+	target := filepath.Join(s.Dir, filepath.FromSlash(file.Path))
+	if _, err := os.Stat(target); err == nil {
+		return file, nil
+	}
+	err = os.MkdirAll(filepath.Dir(target), 0o755)
+	if err != nil {
+		return File{}, fmt.Errorf("Save: %w", err)
+	}
+	err = os.Rename(tmp.Name(), target)
+	if err != nil {
+		return File{}, fmt.Errorf("Save: %w", err)
+	}
+	return file, nil
+}
+
+// fullPath returns the path of a stored file on disk, paths outside the directory are rejected
+func (s Storage) fullPath(path string) (string, error) {
+	path = filepath.FromSlash(path)
+	if !filepath.IsLocal(path) {
+		return "", ErrInvalidPath
+	}
+	return filepath.Join(s.Dir, path), nil
+}
+
+// Open opens a stored file for reading
+func (s Storage) Open(path string) (*os.File, error) {
+	full, err := s.fullPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("Open: %w", err)
+	}
+	return os.Open(full)
+}
+
+// Remove deletes a stored file, a missing file is not an error
+func (s Storage) Remove(path string) error {
+	full, err := s.fullPath(path)
+	if err != nil {
+		return fmt.Errorf("Remove: %w", err)
+	}
+	err = os.Remove(full)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("Remove: %w", err)
+	}
+	return nil
+}
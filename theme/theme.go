@@ -0,0 +1,302 @@
+// Package theme compiles the html/template templates of the site. A template is looked up
+// in the templates table first and then in the defaults, so the look of the site can be
+// changed without a new build.
+//
+// Templates whose names start with "_" are layouts and partials, they are parsed together
+// with every page. A page executes a layout and defines the templates the layout calls:
+//
+//	{{template "layout" .}}
+//	{{define "title"}}About{{end}}
+//	{{define "content"}}<h2>About</h2>{{end}}
+package theme
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template/parse"
+
+	"github.com/AndreHeber/go-sqlite-blog/cache"
+	"github.com/AndreHeber/go-sqlite-blog/models"
+	"github.com/AndreHeber/go-sqlite-blog/models/templates"
+)
+
+var ErrNotFound = errors.New("template not found")
+
+// namePattern are the valid names of templates, they are file names without a directory
+var namePattern = regexp.MustCompile(`^[a-z0-9_-]+\.html$`)
+
+// ValidName reports whether name can be used for a template
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// Shared reports whether the template is a layout or partial that is parsed with every page
+func Shared(name string) bool {
+	return strings.HasPrefix(name, "_")
+}
+
+// Source is a template of the site
+type Source struct {
+	Name       string
+	Content    string
+	Default    string // the content of the default, empty if there is none
+	Customized bool   // the template is stored in the database
+}
+
+// Theme compiles templates once and keeps them until one of them changes
+type Theme struct {
+	defaults fs.FS
+	funcs    template.FuncMap
+	reload   bool
+
+	compiled cache.Map[string, *template.Template]
+}
+
+// New returns a Theme with the default templates in the root of defaults. Only the names
+// of funcs matter, templates are parsed with them and get the real functions when executed.
+// With reload, nothing is cached, so that changes of the defaults show up at once.
+func New(defaults fs.FS, funcs template.FuncMap, reload bool) *Theme {
+	return &Theme{defaults: defaults, funcs: funcs, reload: reload}
+}
+
+// Sources returns all templates by name
+func (t *Theme) Sources(env *models.Env) ([]Source, error) {
+	names, err := fs.Glob(t.defaults, "*.html")
+	if err != nil {
+		return nil, fmt.Errorf("Sources: %w", err)
+	}
+	byName := make(map[string]*Source, len(names))
+	for _, name := range names {
+		content, err := fs.ReadFile(t.defaults, name)
+		if err != nil {
+			return nil, fmt.Errorf("Sources: %w", err)
+		}
+		byName[name] = &Source{Name: name, Content: string(content), Default: string(content)}
+	}
+
+	stored, err := templates.GetTemplates(env)
+	if err != nil {
+		return nil, fmt.Errorf("Sources: %w", err)
+	}
+	for _, template := range stored {
+		source, ok := byName[template.Name]
+		if !ok {
+			source = &Source{Name: template.Name}
+			byName[template.Name] = source
+		}
+		source.Content = template.Content
+		source.Customized = true
+	}
+
+	list := make([]Source, 0, len(byName))
+	for _, source := range byName {
+		list = append(list, *source)
+	}
+	slices.SortFunc(list, func(a, b Source) int { return strings.Compare(a.Name, b.Name) })
+	return list, nil
+}
+
+// Source returns the template with the name
+func (t *Theme) Source(env *models.Env, name string) (Source, error) {
+	list, err := t.Sources(env)
+	if err != nil {
+		return Source{}, fmt.Errorf("Source: %w", err)
+	}
+	for _, source := range list {
+		if source.Name == name {
+			return source, nil
+		}
+	}
+	return Source{}, fmt.Errorf("Source: %w: %s", ErrNotFound, name)
+}
+
+// contents returns the content of all templates by name
+func (t *Theme) contents(env *models.Env) (map[string]string, error) {
+	list, err := t.Sources(env)
+	if err != nil {
+		return nil, err
+	}
+	contents := make(map[string]string, len(list))
+	for _, source := range list {
+		contents[source.Name] = source.Content
+	}
+	return contents, nil
+}
+
+// Lookup returns the compiled page with the name. The template must not be executed,
+// but cloned and given the functions of the request.
+func (t *Theme) Lookup(env *models.Env, name string) (*template.Template, error) {
+	compile := func() (*template.Template, error) {
+		contents, err := t.contents(env)
+		if err != nil {
+			return nil, err
+		}
+		return t.compile(name, contents)
+	}
+
+	var tmpl *template.Template
+	var err error
+	if t.reload {
+		tmpl, err = compile()
+	} else {
+		tmpl, err = t.compiled.Get(name, compile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Lookup: %w", err)
+	}
+	return tmpl, nil
+}
+
+// Invalidate drops all compiled templates, a changed layout or partial affects every page
+func (t *Theme) Invalidate() {
+	t.compiled.Invalidate()
+}
+
+// Validate compiles the pages that use the template as if its content were saved.
+// A changed layout or partial is checked with every page.
+func (t *Theme) Validate(env *models.Env, name, content string) error {
+	contents, err := t.contents(env)
+	if err != nil {
+		return fmt.Errorf("Validate: %w", err)
+	}
+	contents[name] = content
+	err = t.compileAffected(name, contents)
+	if err != nil {
+		return fmt.Errorf("Validate: %w", err)
+	}
+	return nil
+}
+
+// ValidateDelete compiles the pages that use the template as if it were deleted,
+// a customized default is used again
+func (t *Theme) ValidateDelete(env *models.Env, name string) error {
+	source, err := t.Source(env, name)
+	if err != nil {
+		return fmt.Errorf("ValidateDelete: %w", err)
+	}
+	contents, err := t.contents(env)
+	if err != nil {
+		return fmt.Errorf("ValidateDelete: %w", err)
+	}
+	if source.Default != "" {
+		contents[name] = source.Default
+	} else {
+		delete(contents, name)
+	}
+	err = t.compileAffected(name, contents)
+	if err != nil {
+		return fmt.Errorf("ValidateDelete: %w", err)
+	}
+	return nil
+}
+
+// compileAffected compiles the page with the name, or every page if it is shared
+func (t *Theme) compileAffected(name string, contents map[string]string) error {
+	if !Shared(name) {
+		if _, ok := contents[name]; !ok {
+			return nil
+		}
+		_, err := t.compile(name, contents)
+		return err
+	}
+	for page := range contents {
+		if Shared(page) {
+			continue
+		}
+		if _, err := t.compile(page, contents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compile parses the page with all layouts and partials and checks that every template it calls is defined
+func (t *Theme) compile(name string, contents map[string]string) (*template.Template, error) {
+	if Shared(name) {
+		return nil, fmt.Errorf("compile: %s is a layout or partial, not a page", name)
+	}
+	content, ok := contents[name]
+	if !ok {
+		return nil, fmt.Errorf("compile: %w: %s", ErrNotFound, name)
+	}
+
+	tmpl := template.New(name).Funcs(t.funcs)
+	for _, shared := range sortedShared(contents) {
+		_, err := tmpl.New(shared).Parse(contents[shared])
+		if err != nil {
+			return nil, fmt.Errorf("compile: %w", err)
+		}
+	}
+	_, err := tmpl.Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("compile: %w", err)
+	}
+
+	err = checkCalls(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("compile: %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// sortedShared returns the names of the layouts and partials in a fixed order,
+// so that a template defined twice always ends up the same
+func sortedShared(contents map[string]string) []string {
+	var names []string
+	for name := range contents {
+		if Shared(name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// checkCalls reports {{template "name"}} calls of templates that aren't defined,
+// html/template would only find them when the page is rendered
+func checkCalls(tmpl *template.Template) error {
+	for _, defined := range tmpl.Templates() {
+		if defined.Tree == nil {
+			continue
+		}
+		var missing string
+		walk(defined.Tree.Root, func(call *parse.TemplateNode) {
+			if missing == "" && tmpl.Lookup(call.Name) == nil {
+				missing = call.Name
+			}
+		})
+		if missing != "" {
+			return fmt.Errorf("checkCalls: %s calls the undefined template %q", defined.Name(), missing)
+		}
+	}
+	return nil
+}
+
+// walk calls fn for every template call below node
+func walk(node parse.Node, fn func(*parse.TemplateNode)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walk(child, fn)
+		}
+	case *parse.IfNode:
+		walk(n.List, fn)
+		walk(n.ElseList, fn)
+	case *parse.RangeNode:
+		walk(n.List, fn)
+		walk(n.ElseList, fn)
+	case *parse.WithNode:
+		walk(n.List, fn)
+		walk(n.ElseList, fn)
+	case *parse.TemplateNode:
+		fn(n)
+	}
+}
@@ -0,0 +1,55 @@
+package theme
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	contents := map[string]string{
+		"_layout.html": `{{define "layout"}}<title>{{template "title" .}}</title>{{block "head" .}}<meta>{{end}}{{template "content" .}}{{end}}`,
+		"_nav.html":    `{{define "nav"}}<nav>{{shout "home"}}</nav>{{end}}`,
+		"plain.html":   `{{template "layout" .}}{{define "title"}}Plain{{end}}{{define "content"}}{{template "nav" .}}{{.}}{{end}}`,
+		"styled.html":  `{{template "layout" .}}{{define "title"}}Styled{{end}}{{define "head"}}<style></style>{{end}}{{define "content"}}{{.}}{{end}}`,
+		"broken.html":  `{{template "layout" .}}{{define "title"}}Broken{{end}}{{define "content"}}{{if .}}{{template "sidebar" .}}{{end}}{{end}}`,
+	}
+	theme := New(nil, template.FuncMap{"shout": strings.ToUpper}, false)
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"plain.html", "<title>Plain</title><meta><nav>HOME</nav>text"},
+		{"styled.html", "<title>Styled</title><style></style>text"},
+	}
+	for _, tt := range tests {
+		tmpl, err := theme.compile(tt.name, contents)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var out strings.Builder
+		if err := tmpl.Execute(&out, "text"); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, out.String())
+		}
+	}
+
+	if _, err := theme.compile("broken.html", contents); err == nil || !strings.Contains(err.Error(), `"sidebar"`) {
+		t.Errorf("expected the call of an undefined template to be reported, got %v", err)
+	}
+	if _, err := theme.compile("_nav.html", contents); err == nil {
+		t.Errorf("expected a partial not to be compiled as a page")
+	}
+
+	delete(contents, "broken.html")
+	if err := theme.compileAffected("_nav.html", contents); err != nil {
+		t.Errorf("expected all pages to compile: %v", err)
+	}
+	contents["_layout.html"] = `{{define "layout"}}{{template "footer" .}}{{end}}`
+	if err := theme.compileAffected("_layout.html", contents); err == nil {
+		t.Errorf("expected a changed layout to be checked with every page")
+	}
+}